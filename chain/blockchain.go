@@ -249,17 +249,14 @@ func (bc *BlockChain) AddBlock(b *core.Block) {
 	bc.CurrentBlock = b
 	bc.Storage.AddBlock(b)
 
-	// Update Lagrangian epoch every N blocks
-	if params.EnableJustitia == 1 && params.JustitiaSubsidyMode == int(justitia.SubsidyLagrangian) {
-		// Update epoch every 10 blocks (configurable)
-		epochInterval := uint64(10)
-		if b.Header.Number%epochInterval == 0 {
-			// Get scheduler from txpool
-			if priorityPool, ok := bc.Txpool.(*core.PriorityTxPool); ok {
-				if sched := priorityPool.GetScheduler(); sched != nil {
-					if lagSched, ok := sched.(*scheduler.Scheduler); ok {
-						lagSched.UpdateEpoch()
-					}
+	// Close the Lagrangian or RL epoch every EpochBlocks blocks (cadence tracked by the scheduler)
+	if params.EnableJustitia == 1 && (params.JustitiaSubsidyMode == int(justitia.SubsidyLagrangian) ||
+		params.JustitiaSubsidyMode == int(justitia.SubsidyRL)) {
+		// Get scheduler from txpool
+		if priorityPool, ok := bc.Txpool.(*core.PriorityTxPool); ok {
+			if sched := priorityPool.GetScheduler(); sched != nil {
+				if lagSched, ok := sched.(*scheduler.Scheduler); ok {
+					lagSched.MaybeUpdateEpoch(b.Header.Number)
 				}
 			}
 		}
@@ -288,9 +285,20 @@ func NewBlockChain(cc *params.ChainConfig, db ethdb.Database) (*BlockChain, erro
 			feeTracker,
 			justitia.SubsidyMode(params.JustitiaSubsidyMode),
 		)
+		if params.JustitiaSchedulerDebug == 1 {
+			sched.SetLogger(scheduler.StdoutLogger{})
+		} else {
+			sched.SetLogger(scheduler.StdoutWarnLogger{})
+		}
+
+		// Feed queue lengths to dynamic subsidy modes: the local one from the pool, remote ones from fee sync
+		sched.QueueLenProvider = scheduler.TrackerQueueLenProvider(int(cc.ShardID), func() int64 {
+			return priorityPool.GetMetrics().QueueLengthA
+		}, feeTracker)
 
 		// Set scheduler to txpool (uses interface to avoid circular dependency)
 		priorityPool.SetScheduler(sched, int(cc.ShardID))
+		priorityPool.SetRelayByUtility(params.JustitiaRelayFIFO == 0)
 
 		txpool = priorityPool
 		fmt.Printf("S%dN%d: Using PriorityTxPool with Justitia Scheduler (mode=%d, window=%d)\n",
@@ -4,6 +4,7 @@ package pbft_all
 import (
 	"blockEmulator/core"
 	"blockEmulator/fees"
+	"blockEmulator/fees/feesync"
 	"blockEmulator/message"
 	"blockEmulator/networks"
 	"blockEmulator/params"
@@ -20,6 +21,8 @@ import (
 type RawRelayPbftExtraHandleMod struct {
 	pbftNode *PbftConsensusNode
 	// pointer to pbft data
+
+	feeSync *fees.SyncThrottle // Rate limiter for FeeInfoSync broadcasts (created on first use)
 }
 
 // propose request with different types
@@ -206,6 +209,7 @@ func (rphm *RawRelayPbftExtraHandleMod) HandleforSequentialRequest(som *message.
 func (rphm *RawRelayPbftExtraHandleMod) updateFeeTracker(block *core.Block) {
 	// Extract intra-shard transaction fees (ITX only, exclude CTX)
 	itxFees := make([]*big.Int, 0)
+	itxGas := make([]uint64, 0)
 
 	for _, tx := range block.Body {
 		// Only count transactions that are NOT cross-shard (ITX)
@@ -213,6 +217,7 @@ func (rphm *RawRelayPbftExtraHandleMod) updateFeeTracker(block *core.Block) {
 		if !tx.IsCrossShard && !tx.Relayed {
 			if tx.FeeToProposer != nil && tx.FeeToProposer.Sign() > 0 {
 				itxFees = append(itxFees, tx.FeeToProposer)
+				itxGas = append(itxGas, tx.GasUsed)
 			}
 		}
 	}
@@ -220,7 +225,7 @@ func (rphm *RawRelayPbftExtraHandleMod) updateFeeTracker(block *core.Block) {
 	// Update the global fee tracker
 	if len(itxFees) > 0 {
 		feeTracker := fees.GetGlobalTracker()
-		feeTracker.OnBlockFinalized(int(rphm.pbftNode.ShardID), itxFees)
+		feeTracker.OnBlockFinalizedWithGas(int(rphm.pbftNode.ShardID), itxFees, itxGas)
 
 		// Get updated average for debugging
 		avgFee := feeTracker.GetAvgITXFee(int(rphm.pbftNode.ShardID))
@@ -232,41 +237,65 @@ func (rphm *RawRelayPbftExtraHandleMod) updateFeeTracker(block *core.Block) {
 	}
 }
 
+// validateFeeInfo checks a received FeeInfoSync against the configured ceiling and checksum key
+func validateFeeInfo(feeMsg *message.FeeInfoSync) error {
+	return feeMsg.Validate(new(big.Int).SetUint64(params.JustitiaFeeSyncMaxAvgFee), []byte(params.JustitiaFeeSyncKey))
+}
+
 // broadcastFeeInfo broadcasts this shard's average fee to all other shards
 // This enables cross-shard subsidy calculation in multi-process architecture
 func (rphm *RawRelayPbftExtraHandleMod) broadcastFeeInfo(block *core.Block) {
 	feeTracker := fees.GetGlobalTracker()
 	avgFee := feeTracker.GetAvgITXFee(int(rphm.pbftNode.ShardID))
 
-	// Create fee sync message
-	feeMsg := message.NewFeeInfoSync(
-		rphm.pbftNode.ShardID,
-		avgFee,
-		block.Header.Number,
-	)
-
-	// Serialize the message
-	feeByte, err := json.Marshal(feeMsg)
-	if err != nil {
-		rphm.pbftNode.pl.Plog.Printf("S%dN%d : Error marshaling fee info: %v\n",
-			rphm.pbftNode.ShardID, rphm.pbftNode.NodeID, err)
+	// Coalesce updates that arrive faster than the configured interval
+	if rphm.feeSync == nil {
+		rphm.feeSync = fees.NewSyncThrottle(time.Duration(params.JustitiaFeeSyncIntervalMs)*time.Millisecond,
+			params.JustitiaFeeSyncChangeThreshold)
+	}
+	height := block.Header.Number
+	if !rphm.feeSync.ShouldBroadcast(avgFee, time.Now()) {
+		// Send the latest coalesced average once the interval has passed, even if no block follows
+		rphm.feeSync.Defer(time.Now(), func() { rphm.sendFeeInfo(height) })
 		return
 	}
+	rphm.sendFeeInfo(height)
+}
 
-	msg_send := message.MergeMessage(message.CFeeInfoSync, feeByte)
+// sendFeeInfo broadcasts the current average fee at blockHeight. The throttle records the
+// broadcast only when a message was actually built (none is while the average is not positive)
+func (rphm *RawRelayPbftExtraHandleMod) sendFeeInfo(blockHeight uint64) {
+	// Share the local queue length so other shards' dynamic subsidy modes see the real destination queue
+	queueLen := int64(-1)
+	if priorityPool, ok := rphm.pbftNode.CurChain.Txpool.(*core.PriorityTxPool); ok {
+		queueLen = priorityPool.GetMetrics().QueueLengthA
+	}
 
-	// Broadcast to leader nodes of all other shards
-	for sid := uint64(0); sid < uint64(params.ShardNum); sid++ {
-		if sid != rphm.pbftNode.ShardID {
-			// Send to the leader (node 0) of each shard
-			// In PBFT, the leader is typically the node with ID equal to the view number
-			// For simplicity, we send to node 0 of each shard
-			targetIP := rphm.pbftNode.ip_nodeTable[sid][0]
-			go networks.TcpDial(msg_send, targetIP)
+	for _, feeMsg := range feesync.BuildFeeSyncMessages(int(rphm.pbftNode.ShardID), blockHeight, queueLen) {
+		// Serialize the message
+		feeByte, err := json.Marshal(feeMsg)
+		if err != nil {
+			rphm.pbftNode.pl.Plog.Printf("S%dN%d : Error marshaling fee info: %v\n",
+				rphm.pbftNode.ShardID, rphm.pbftNode.NodeID, err)
+			return
+		}
+
+		msg_send := message.MergeMessage(message.CFeeInfoSync, feeByte)
+
+		// Broadcast to leader nodes of all other shards
+		for sid := uint64(0); sid < uint64(params.ShardNum); sid++ {
+			if sid != rphm.pbftNode.ShardID {
+				// Send to the leader (node 0) of each shard
+				// In PBFT, the leader is typically the node with ID equal to the view number
+				// For simplicity, we send to node 0 of each shard
+				targetIP := rphm.pbftNode.ip_nodeTable[sid][0]
+				go networks.TcpDial(msg_send, targetIP)
+			}
 		}
-	}
 
-	rphm.pbftNode.pl.Plog.Printf("S%dN%d : Broadcasted fee info E(f_%d)=%s to all other shards at block %d\n",
-		rphm.pbftNode.ShardID, rphm.pbftNode.NodeID, rphm.pbftNode.ShardID,
-		avgFee.String(), block.Header.Number)
+		rphm.pbftNode.pl.Plog.Printf("S%dN%d : Broadcasted fee info E(f_%d)=%s to all other shards at block %d\n",
+			rphm.pbftNode.ShardID, rphm.pbftNode.NodeID, rphm.pbftNode.ShardID,
+			feeMsg.AvgITXFee.String(), blockHeight)
+		rphm.feeSync.Sent(feeMsg.AvgITXFee, time.Now())
+	}
 }
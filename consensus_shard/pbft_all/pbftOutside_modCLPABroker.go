@@ -118,9 +118,19 @@ func (cbom *CLPABrokerOutsideModule) handleFeeInfoSync(content []byte) {
 			cbom.pbftNode.ShardID, cbom.pbftNode.NodeID, err)
 		return
 	}
+	if err := validateFeeInfo(feeMsg); err != nil {
+		cbom.pbftNode.pl.Plog.Printf("S%dN%d : Rejected fee info from S%d: %v\n",
+			cbom.pbftNode.ShardID, cbom.pbftNode.NodeID, feeMsg.ShardID, err)
+		return
+	}
 
 	feeTracker := fees.GetGlobalTracker()
-	feeTracker.UpdateRemoteShardFee(int(feeMsg.ShardID), feeMsg.AvgITXFee)
+	if err := feeTracker.UpdateRemoteShardFeeAt(int(feeMsg.ShardID), feeMsg.AvgITXFee, feeMsg.BlockHeight); err != nil {
+		cbom.pbftNode.pl.Plog.Printf("S%dN%d : Dropped fee info from S%d at block %d: %v\n",
+			cbom.pbftNode.ShardID, cbom.pbftNode.NodeID, feeMsg.ShardID, feeMsg.BlockHeight, err)
+		return
+	}
+	feeTracker.UpdateRemoteQueueLength(int(feeMsg.ShardID), feeMsg.QueueLength)
 
 	cbom.pbftNode.pl.Plog.Printf("S%dN%d : Received fee info from S%d: E(f_%d)=%s at block %d\n",
 		cbom.pbftNode.ShardID, cbom.pbftNode.NodeID, feeMsg.ShardID,
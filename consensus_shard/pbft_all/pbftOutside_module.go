@@ -104,10 +104,20 @@ func (rrom *RawRelayOutsideModule) handleFeeInfoSync(content []byte) {
 			rrom.pbftNode.ShardID, rrom.pbftNode.NodeID, err)
 		return
 	}
+	if err := validateFeeInfo(feeMsg); err != nil {
+		rrom.pbftNode.pl.Plog.Printf("S%dN%d : Rejected fee info from S%d: %v\n",
+			rrom.pbftNode.ShardID, rrom.pbftNode.NodeID, feeMsg.ShardID, err)
+		return
+	}
 
 	// Update the global fee tracker with remote shard's fee info
 	feeTracker := fees.GetGlobalTracker()
-	feeTracker.UpdateRemoteShardFee(int(feeMsg.ShardID), feeMsg.AvgITXFee)
+	if err := feeTracker.UpdateRemoteShardFeeAt(int(feeMsg.ShardID), feeMsg.AvgITXFee, feeMsg.BlockHeight); err != nil {
+		rrom.pbftNode.pl.Plog.Printf("S%dN%d : Dropped fee info from S%d at block %d: %v\n",
+			rrom.pbftNode.ShardID, rrom.pbftNode.NodeID, feeMsg.ShardID, feeMsg.BlockHeight, err)
+		return
+	}
+	feeTracker.UpdateRemoteQueueLength(int(feeMsg.ShardID), feeMsg.QueueLength)
 
 	rrom.pbftNode.pl.Plog.Printf("S%dN%d : Received fee info from S%d: E(f_%d)=%s at block %d\n",
 		rrom.pbftNode.ShardID, rrom.pbftNode.NodeID, feeMsg.ShardID,
@@ -149,9 +149,19 @@ func (crom *CLPARelayOutsideModule) handleFeeInfoSync(content []byte) {
 			crom.pbftNode.ShardID, crom.pbftNode.NodeID, err)
 		return
 	}
+	if err := validateFeeInfo(feeMsg); err != nil {
+		crom.pbftNode.pl.Plog.Printf("S%dN%d : Rejected fee info from S%d: %v\n",
+			crom.pbftNode.ShardID, crom.pbftNode.NodeID, feeMsg.ShardID, err)
+		return
+	}
 
 	feeTracker := fees.GetGlobalTracker()
-	feeTracker.UpdateRemoteShardFee(int(feeMsg.ShardID), feeMsg.AvgITXFee)
+	if err := feeTracker.UpdateRemoteShardFeeAt(int(feeMsg.ShardID), feeMsg.AvgITXFee, feeMsg.BlockHeight); err != nil {
+		crom.pbftNode.pl.Plog.Printf("S%dN%d : Dropped fee info from S%d at block %d: %v\n",
+			crom.pbftNode.ShardID, crom.pbftNode.NodeID, feeMsg.ShardID, feeMsg.BlockHeight, err)
+		return
+	}
+	feeTracker.UpdateRemoteQueueLength(int(feeMsg.ShardID), feeMsg.QueueLength)
 
 	crom.pbftNode.pl.Plog.Printf("S%dN%d : Received fee info from S%d: E(f_%d)=%s at block %d\n",
 		crom.pbftNode.ShardID, crom.pbftNode.NodeID, feeMsg.ShardID,
@@ -36,16 +36,24 @@ type Transaction struct {
 	FromShard        int       // Source shard ID (computed from sender address)
 	ToShard          int       // Destination shard ID (computed from recipient address)
 	IsCrossShard     bool      // Whether this is a cross-shard transaction
+	ForceCrossShard  *bool     // Testing override of IsCrossShard for scheduling (nil = use IsCrossShard)
 	PairID           string    // Unique identifier for matching CTX and CTX' (typically TxHash as string)
 	FeeToProposer    *big.Int  // Fee that goes to proposer (f_AB for CTX, f for ITX)
+	GasUsed          uint64    // Gas used in the source dataset (0 if unknown), for gas-weighted E(f_s)
 	ArrivalTime      time.Time // Time when tx arrived at mempool (for delay metrics)
 	TxSize           int       // Transaction size (default 1 for count-based capacity)
+	Deadline         time.Time // Optional inclusion deadline for time-sensitive txs (zero = none)
 	
 	// Cross-shard reward tracking
 	SubsidyR         *big.Int  // Subsidy R_AB for this CTX
 	UtilityA         *big.Int  // Utility uA for source shard proposer
 	UtilityB         *big.Int  // Utility uB for destination shard proposer
 	JustitiaCase     int       // Classification: 1=Case1, 2=Case2, 3=Case3 (0=not classified/ITX)
+	SubsidyMode      int       // Subsidy mode used to compute SubsidyR (meaningful only when JustitiaCase != 0)
+
+	// Injection-time preview (informational only, never used for selection or settlement)
+	PredictedSubsidyR *big.Int // Subsidy R_AB predicted by the supervisor at injection
+	PredictedCase     int      // Case predicted by the supervisor at injection (0=not previewed)
 	
 	// Relay tracking
 	IsRelay2         bool      // Whether this is the second phase of relay (executed in recipient shard)
@@ -79,6 +87,9 @@ func (tx *Transaction) Encode() []byte {
 }
 
 // Decode transaction
+// gob omits nil pointers, so FeeToProposer of a tx encoded without it is initialized to zero, as
+// NewTransaction does. SubsidyR, UtilityA and UtilityB stay nil until the scheduler scores the tx.
+// gob also drops pointers to zero values: ForceCrossShard set to false decodes as nil
 func DecodeTx(to_decode []byte) *Transaction {
 	var tx Transaction
 
@@ -88,6 +99,10 @@ func DecodeTx(to_decode []byte) *Transaction {
 		log.Panic(err)
 	}
 
+	if tx.FeeToProposer == nil {
+		tx.FeeToProposer = big.NewInt(0)
+	}
+
 	return &tx
 }
 
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestTransaction_EncodeDecode tests that a fully populated CTX survives a gob round trip
+func TestTransaction_EncodeDecode(t *testing.T) {
+	propTime := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	tx := NewTransaction("sender", "recipient", big.NewInt(42), 7, propTime)
+	force := true
+	tx.FromShard, tx.ToShard = 0, 1
+	tx.IsCrossShard = true
+	tx.ForceCrossShard = &force
+	tx.PairID = "pair"
+	tx.FeeToProposer = big.NewInt(1500)
+	tx.GasUsed = 21000
+	tx.ArrivalTime = propTime.Add(time.Second)
+	tx.Deadline = propTime.Add(time.Minute)
+	tx.SubsidyR = new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil) // Beyond uint64
+	tx.UtilityA = big.NewInt(700)
+	tx.UtilityB = big.NewInt(800)
+	tx.JustitiaCase = 2
+	tx.SubsidyMode = 1
+	tx.PredictedSubsidyR = big.NewInt(900)
+	tx.PredictedCase = 1
+	tx.IsRelay2 = true
+	tx.OriginalPropTime = propTime.Add(-time.Hour)
+	tx.IncludedInBlockA = 10
+	tx.IncludedInBlockB = 12
+
+	got := DecodeTx(tx.Encode())
+
+	bigs := []struct {
+		name      string
+		got, want *big.Int
+	}{
+		{"Value", got.Value, tx.Value},
+		{"FeeToProposer", got.FeeToProposer, tx.FeeToProposer},
+		{"SubsidyR", got.SubsidyR, tx.SubsidyR},
+		{"UtilityA", got.UtilityA, tx.UtilityA},
+		{"UtilityB", got.UtilityB, tx.UtilityB},
+		{"PredictedSubsidyR", got.PredictedSubsidyR, tx.PredictedSubsidyR},
+	}
+	for _, b := range bigs {
+		if b.got == nil || b.got.Cmp(b.want) != 0 {
+			t.Errorf("%s = %v, want %s", b.name, b.got, b.want)
+		}
+	}
+
+	times := []struct {
+		name      string
+		got, want time.Time
+	}{
+		{"Time", got.Time, tx.Time},
+		{"ArrivalTime", got.ArrivalTime, tx.ArrivalTime},
+		{"Deadline", got.Deadline, tx.Deadline},
+		{"OriginalPropTime", got.OriginalPropTime, tx.OriginalPropTime},
+	}
+	for _, tm := range times {
+		if !tm.got.Equal(tm.want) {
+			t.Errorf("%s = %v, want %v", tm.name, tm.got, tm.want)
+		}
+	}
+
+	if got.FromShard != 0 || got.ToShard != 1 || !got.IsCrossShard || got.PairID != "pair" || got.GasUsed != 21000 {
+		t.Errorf("Routing fields = %d->%d cross=%v pair=%q gas=%d", got.FromShard, got.ToShard, got.IsCrossShard, got.PairID, got.GasUsed)
+	}
+	if got.ForceCrossShard == nil || !*got.ForceCrossShard {
+		t.Errorf("ForceCrossShard = %v, want true", got.ForceCrossShard)
+	}
+	if got.JustitiaCase != 2 || got.SubsidyMode != 1 || got.PredictedCase != 1 {
+		t.Errorf("Case fields = %d/%d/%d, want 2/1/1", got.JustitiaCase, got.SubsidyMode, got.PredictedCase)
+	}
+	if !got.IsRelay2 || got.IncludedInBlockA != 10 || got.IncludedInBlockB != 12 {
+		t.Errorf("Relay fields = %v/%d/%d, want true/10/12", got.IsRelay2, got.IncludedInBlockA, got.IncludedInBlockB)
+	}
+	if string(got.TxHash) != string(tx.TxHash) {
+		t.Error("TxHash changed in round trip")
+	}
+}
+
+// TestTransaction_DecodeNilAmounts tests that a nil FeeToProposer decodes as zero while the
+// scheduler-computed amounts stay nil
+func TestTransaction_DecodeNilAmounts(t *testing.T) {
+	tx := &Transaction{Sender: "sender", Recipient: "recipient", Value: big.NewInt(1), Time: time.Now()}
+
+	got := DecodeTx(tx.Encode())
+
+	if got.FeeToProposer == nil || got.FeeToProposer.Sign() != 0 {
+		t.Errorf("FeeToProposer = %v, want 0", got.FeeToProposer)
+	}
+	for name, v := range map[string]*big.Int{
+		"SubsidyR":          got.SubsidyR,
+		"UtilityA":          got.UtilityA,
+		"UtilityB":          got.UtilityB,
+		"PredictedSubsidyR": got.PredictedSubsidyR,
+	} {
+		if v != nil {
+			t.Errorf("%s = %v, want nil (not scored)", name, v)
+		}
+	}
+}
@@ -4,8 +4,11 @@ package core
 import (
 	"blockEmulator/incentive/justitia"
 	"blockEmulator/utils"
+	"bytes"
 	"container/heap"
+	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 )
@@ -26,6 +29,37 @@ type PriorityTxPool struct {
 	// Justitia components (using interface to avoid circular dependency)
 	scheduler TxScheduler // Justitia scheduler for transaction selection
 	shardID   int         // Current shard ID
+	selecting int         // Txs taken out of the queue while the scheduler selects (still counted by GetMetrics)
+
+	// Heap ordering (SortByFee by default; see SetSortMode)
+	sortMode   PoolSortMode
+	weightFee  float64
+	weightUtil float64
+
+	relayByUtility bool // PackRelayTxs takes the highest-UtilityB relays first instead of FIFO
+}
+
+// PoolSortMode selects the key PriorityTxPool orders its heap by
+type PoolSortMode int
+
+const (
+	SortByFee      PoolSortMode = iota // FeeToProposer only (default)
+	SortByUtility                      // The local proposer's Justitia utility
+	SortByWeighted                     // weightFee*fee + weightUtil*utility
+)
+
+// String returns the name of the sort mode
+func (m PoolSortMode) String() string {
+	switch m {
+	case SortByFee:
+		return "Fee"
+	case SortByUtility:
+		return "Utility"
+	case SortByWeighted:
+		return "Weighted"
+	default:
+		return fmt.Sprintf("PoolSortMode(%d)", int(m))
+	}
 }
 
 // TxPriorityQueue implements heap.Interface for transaction prioritization
@@ -53,13 +87,24 @@ func (pq TxPriorityQueue) Less(i, j int) bool {
 		feeJ = big.NewInt(0)
 	}
 	
-	cmp := feeI.Cmp(feeJ)
+	return lessAfterCmp(txI, txJ, feeI.Cmp(feeJ))
+}
+
+// lessAfterCmp orders txI before txJ by the result cmp of comparing their priority keys,
+// falling back to FIFO and then TxHash on a tie
+func lessAfterCmp(txI, txJ *Transaction, cmp int) bool {
 	if cmp != 0 {
-		return cmp > 0 // Higher fee = higher priority
+		return cmp > 0 // Higher key = higher priority
 	}
-	
-	// If fees are equal, use FIFO (earlier timestamp = higher priority)
-	return txI.Time.Before(txJ.Time)
+
+	// If keys are equal, use FIFO (earlier timestamp = higher priority)
+	if !txI.Time.Equal(txJ.Time) {
+		return txI.Time.Before(txJ.Time)
+	}
+
+	// Same fee and timestamp: break the tie on TxHash so that pop order
+	// (and therefore PackTxs output) is reproducible across runs
+	return bytes.Compare(txI.TxHash, txJ.TxHash) < 0
 }
 
 func (pq TxPriorityQueue) Swap(i, j int) {
@@ -80,6 +125,70 @@ func (pq *TxPriorityQueue) Pop() interface{} {
 	return item
 }
 
+// rankedQueue orders a TxPriorityQueue by key instead of FeeToProposer
+type rankedQueue struct {
+	*TxPriorityQueue
+	key func(*Transaction) *big.Float
+}
+
+func (rq rankedQueue) Less(i, j int) bool {
+	pq := *rq.TxPriorityQueue
+	return lessAfterCmp(pq[i], pq[j], rq.key(pq[i]).Cmp(rq.key(pq[j])))
+}
+
+// heapOf returns q ordered by the pool's sort mode (caller must hold lock)
+func (txpool *PriorityTxPool) heapOf(q *TxPriorityQueue) heap.Interface {
+	switch txpool.sortMode {
+	case SortByUtility:
+		return rankedQueue{q, func(tx *Transaction) *big.Float {
+			if u := txpool.localUtility(tx); u != nil {
+				return new(big.Float).SetInt(u)
+			}
+			return new(big.Float).SetInt(feeOrZero(tx))
+		}}
+	case SortByWeighted:
+		return rankedQueue{q, func(tx *Transaction) *big.Float {
+			fee := new(big.Float).SetInt(feeOrZero(tx))
+			u := txpool.localUtility(tx)
+			if u == nil {
+				return fee
+			}
+			key := fee.Mul(fee, big.NewFloat(txpool.weightFee))
+			return key.Add(key, new(big.Float).Mul(new(big.Float).SetInt(u), big.NewFloat(txpool.weightUtil)))
+		}}
+	default:
+		return q
+	}
+}
+
+// localUtility returns the tx's utility for this shard's proposer: UtilityA when the tx
+// originates here, UtilityB otherwise (nil if not set)
+func (txpool *PriorityTxPool) localUtility(tx *Transaction) *big.Int {
+	if tx.FromShard == txpool.shardID {
+		return tx.UtilityA
+	}
+	return tx.UtilityB
+}
+
+// feeOrZero returns FeeToProposer, or zero if it is nil
+func feeOrZero(tx *Transaction) *big.Int {
+	if tx.FeeToProposer == nil {
+		return big.NewInt(0)
+	}
+	return tx.FeeToProposer
+}
+
+// SetSortMode changes how the heap is ordered and re-heapifies the queued transactions.
+// The weights are only used by SortByWeighted; transactions without a utility rank by fee
+func (txpool *PriorityTxPool) SetSortMode(mode PoolSortMode, weightFee, weightUtil float64) {
+	txpool.lock.Lock()
+	defer txpool.lock.Unlock()
+	txpool.sortMode = mode
+	txpool.weightFee = weightFee
+	txpool.weightUtil = weightUtil
+	heap.Init(txpool.heapOf(txpool.TxQueue))
+}
+
 // NewPriorityTxPool creates a new transaction pool with Justitia support
 func NewPriorityTxPool() *PriorityTxPool {
 	pq := make(TxPriorityQueue, 0)
@@ -99,6 +208,9 @@ func (txpool *PriorityTxPool) SetScheduler(sched TxScheduler, shardID int) {
 	defer txpool.lock.Unlock()
 	txpool.scheduler = sched
 	txpool.shardID = shardID
+	if txpool.sortMode != SortByFee {
+		heap.Init(txpool.heapOf(txpool.TxQueue)) // Utility side depends on the shard
+	}
 }
 
 // GetScheduler returns the Justitia scheduler for this pool
@@ -119,7 +231,7 @@ func (txpool *PriorityTxPool) AddTx2Pool(tx *Transaction) {
 	if tx.OriginalPropTime.IsZero() {
 		tx.OriginalPropTime = tx.Time
 	}
-	heap.Push(txpool.TxQueue, tx)
+	heap.Push(txpool.heapOf(txpool.TxQueue), tx)
 }
 
 // AddTxs2Pool adds multiple transactions to the pool
@@ -134,7 +246,7 @@ func (txpool *PriorityTxPool) AddTxs2Pool(txs []*Transaction) {
 		if tx.OriginalPropTime.IsZero() {
 			tx.OriginalPropTime = tx.Time
 		}
-		heap.Push(txpool.TxQueue, tx)
+		heap.Push(txpool.heapOf(txpool.TxQueue), tx)
 	}
 }
 
@@ -157,9 +269,10 @@ func (txpool *PriorityTxPool) packTxsWithScheduler(max_txs uint64) []*Transactio
 	// Extract all available transactions from priority queue
 	allTxs := make([]*Transaction, 0, txpool.TxQueue.Len())
 	for txpool.TxQueue.Len() > 0 {
-		tx := heap.Pop(txpool.TxQueue).(*Transaction)
+		tx := heap.Pop(txpool.heapOf(txpool.TxQueue)).(*Transaction)
 		allTxs = append(allTxs, tx)
 	}
+	txpool.selecting = len(allTxs)
 	
 	txpool.lock.Unlock()
 	
@@ -169,6 +282,7 @@ func (txpool *PriorityTxPool) packTxsWithScheduler(max_txs uint64) []*Transactio
 	
 	// Put unselected transactions back into the priority queue
 	txpool.lock.Lock()
+	txpool.selecting = 0
 	selectedMap := make(map[string]bool)
 	for _, tx := range selected {
 		selectedMap[string(tx.TxHash)] = true
@@ -176,7 +290,7 @@ func (txpool *PriorityTxPool) packTxsWithScheduler(max_txs uint64) []*Transactio
 	
 	for _, tx := range allTxs {
 		if !selectedMap[string(tx.TxHash)] {
-			heap.Push(txpool.TxQueue, tx)
+			heap.Push(txpool.heapOf(txpool.TxQueue), tx)
 		}
 	}
 	txpool.lock.Unlock()
@@ -197,7 +311,7 @@ func (txpool *PriorityTxPool) packTxsSimple(max_txs uint64) []*Transaction {
 	txs_Packed := make([]*Transaction, 0, txNum)
 	for i := uint64(0); i < txNum; i++ {
 		if txpool.TxQueue.Len() > 0 {
-			tx := heap.Pop(txpool.TxQueue).(*Transaction)
+			tx := heap.Pop(txpool.heapOf(txpool.TxQueue)).(*Transaction)
 			txs_Packed = append(txs_Packed, tx)
 		}
 	}
@@ -214,12 +328,12 @@ func (txpool *PriorityTxPool) PackTxsWithBytes(max_bytes int) []*Transaction {
 	currentSize := 0
 
 	for txpool.TxQueue.Len() > 0 {
-		tx := heap.Pop(txpool.TxQueue).(*Transaction)
+		tx := heap.Pop(txpool.heapOf(txpool.TxQueue)).(*Transaction)
 		txSize := len(tx.Encode())
 
 		if currentSize+txSize > max_bytes {
 			// Put the transaction back if it doesn't fit
-			heap.Push(txpool.TxQueue, tx)
+			heap.Push(txpool.heapOf(txpool.TxQueue), tx)
 			break
 		}
 
@@ -275,6 +389,9 @@ func (txpool *PriorityTxPool) PackRelayTxs(shardID, minRelaySize, maxRelaySize u
 	if len(txpool.RelayPool[shardID]) < int(minRelaySize) {
 		return nil, false
 	}
+	if txpool.relayByUtility {
+		sortRelaysByUtility(txpool.RelayPool[shardID])
+	}
 	txNum := maxRelaySize
 	if uint64(len(txpool.RelayPool[shardID])) < txNum {
 		txNum = uint64(len(txpool.RelayPool[shardID]))
@@ -284,6 +401,30 @@ func (txpool *PriorityTxPool) PackRelayTxs(shardID, minRelaySize, maxRelaySize u
 	return relayTxPacked, true
 }
 
+// SetRelayByUtility makes PackRelayTxs pack relays by descending UtilityB (earlier ArrivalTime
+// first on a tie) instead of in arrival order
+func (txpool *PriorityTxPool) SetRelayByUtility(enabled bool) {
+	txpool.lock.Lock()
+	defer txpool.lock.Unlock()
+	txpool.relayByUtility = enabled
+}
+
+// sortRelaysByUtility orders relays by descending UtilityB (nil counts as zero), FIFO on ties
+func sortRelaysByUtility(relays []*Transaction) {
+	utility := func(tx *Transaction) *big.Int {
+		if tx.UtilityB == nil {
+			return big.NewInt(0)
+		}
+		return tx.UtilityB
+	}
+	sort.SliceStable(relays, func(i, j int) bool {
+		if cmp := utility(relays[i]).Cmp(utility(relays[j])); cmp != 0 {
+			return cmp > 0
+		}
+		return relays[i].ArrivalTime.Before(relays[j].ArrivalTime)
+	})
+}
+
 // TransferTxs transfers transactions when re-sharding
 func (txpool *PriorityTxPool) TransferTxs(addr utils.Address) []*Transaction {
 	txpool.lock.Lock()
@@ -295,11 +436,11 @@ func (txpool *PriorityTxPool) TransferTxs(addr utils.Address) []*Transaction {
 	
 	// Extract transactions from the priority queue
 	for txpool.TxQueue.Len() > 0 {
-		tx := heap.Pop(txpool.TxQueue).(*Transaction)
+		tx := heap.Pop(txpool.heapOf(txpool.TxQueue)).(*Transaction)
 		if tx.Sender == addr {
 			txTransfered = append(txTransfered, tx)
 		} else {
-			heap.Push(&newQueue, tx)
+			heap.Push(txpool.heapOf(&newQueue), tx)
 		}
 	}
 	
@@ -334,11 +475,11 @@ func (txpool *PriorityTxPool) FilterTxs(filter func(*Transaction) bool) []*Trans
 	
 	// Extract all transactions from priority queue
 	for txpool.TxQueue.Len() > 0 {
-		tx := heap.Pop(txpool.TxQueue).(*Transaction)
+		tx := heap.Pop(txpool.heapOf(txpool.TxQueue)).(*Transaction)
 		if filter(tx) {
 			filtered = append(filtered, tx)
 		} else {
-			heap.Push(&newQueue, tx)
+			heap.Push(txpool.heapOf(&newQueue), tx)
 		}
 	}
 	
@@ -346,6 +487,24 @@ func (txpool *PriorityTxPool) FilterTxs(filter func(*Transaction) bool) []*Trans
 	return filtered
 }
 
+// VerifyHeap checks that TxQueue satisfies the heap invariant (debug-only)
+// Every element must not have higher priority than its parent; returns the first violation found
+func (txpool *PriorityTxPool) VerifyHeap() error {
+	txpool.lock.Lock()
+	defer txpool.lock.Unlock()
+
+	pq := *txpool.TxQueue
+	ordered := txpool.heapOf(txpool.TxQueue)
+	for i := 1; i < pq.Len(); i++ {
+		parent := (i - 1) / 2
+		if ordered.Less(i, parent) {
+			return fmt.Errorf("heap invariant violated: element %d (fee %v) outranks parent %d (fee %v)",
+				i, pq[i].FeeToProposer, parent, pq[parent].FeeToProposer)
+		}
+	}
+	return nil
+}
+
 // Initialize/Reset the relay pool
 func (txpool *PriorityTxPool) InitRelayPool() {
 	txpool.lock.Lock()
@@ -369,7 +528,7 @@ func (txpool *PriorityTxPool) GetMetrics() justitia.DynamicMetrics {
 	txpool.lock.Lock()
 	defer txpool.lock.Unlock()
 	
-	queueLen := int64(txpool.TxQueue.Len())
+	queueLen := int64(txpool.TxQueue.Len() + txpool.selecting)
 	
 	// Estimate average wait time based on queue length and transaction timestamps
 	// This is a rough estimate: we look at the oldest transaction in the queue
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"blockEmulator/utils"
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newPoolTestTx creates a transaction from sender with the given fee
+func newPoolTestTx(sender utils.Address, nonce uint64, fee int64) *Transaction {
+	tx := NewTransaction(sender, "recipient", big.NewInt(0), nonce, time.Now())
+	tx.FeeToProposer = big.NewInt(fee)
+	return tx
+}
+
+// TestPriorityTxPool_VerifyHeap tests that the heap invariant holds after FilterTxs and TransferTxs
+func TestPriorityTxPool_VerifyHeap(t *testing.T) {
+	pool := NewPriorityTxPool()
+	senders := []utils.Address{"alice", "bob", "carol"}
+	for i := 0; i < 60; i++ {
+		pool.AddTx2Pool(newPoolTestTx(senders[i%len(senders)], uint64(i), int64((i*37)%101)))
+	}
+	if err := pool.VerifyHeap(); err != nil {
+		t.Fatalf("Heap invalid after insertion: %v", err)
+	}
+
+	filtered := pool.FilterTxs(func(tx *Transaction) bool { return tx.FeeToProposer.Int64()%2 == 0 })
+	if err := pool.VerifyHeap(); err != nil {
+		t.Fatalf("Heap invalid after FilterTxs: %v", err)
+	}
+
+	transferred := pool.TransferTxs("bob")
+	if err := pool.VerifyHeap(); err != nil {
+		t.Fatalf("Heap invalid after TransferTxs: %v", err)
+	}
+	if len(filtered)+len(transferred)+pool.GetTxQueueLen() != 60 {
+		t.Errorf("Transactions lost: filtered=%d transferred=%d remaining=%d",
+			len(filtered), len(transferred), pool.GetTxQueueLen())
+	}
+
+	// A corrupted queue is detected
+	pq := *pool.TxQueue
+	if pq.Len() < 2 {
+		t.Fatal("Expected at least 2 remaining transactions")
+	}
+	pq[pq.Len()-1].FeeToProposer = big.NewInt(1000)
+	if err := pool.VerifyHeap(); err == nil {
+		t.Error("Expected VerifyHeap to detect a corrupted heap")
+	}
+}
+
+// TestPriorityTxPool_TieBreakByHash tests that transactions with identical fee and
+// timestamp are popped in TxHash order regardless of insertion order
+func TestPriorityTxPool_TieBreakByHash(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	var txs []*Transaction
+	for i := 0; i < 20; i++ {
+		tx := NewTransaction("alice", "recipient", big.NewInt(0), uint64(i), ts)
+		tx.FeeToProposer = big.NewInt(42)
+		txs = append(txs, tx)
+	}
+
+	var first []*Transaction
+	for run := 0; run < 3; run++ {
+		pool := NewPriorityTxPool()
+		for i := range txs {
+			// Rotate the insertion order on every run
+			pool.AddTx2Pool(txs[(i+run*7)%len(txs)])
+		}
+		packed := pool.PackTxs(uint64(len(txs)))
+		if len(packed) != len(txs) {
+			t.Fatalf("run %d: packed %d txs, want %d", run, len(packed), len(txs))
+		}
+		for i := 1; i < len(packed); i++ {
+			if bytes.Compare(packed[i-1].TxHash, packed[i].TxHash) >= 0 {
+				t.Fatalf("run %d: pop order not sorted by TxHash at index %d", run, i)
+			}
+		}
+		if first == nil {
+			first = packed
+			continue
+		}
+		for i := range packed {
+			if packed[i] != first[i] {
+				t.Fatalf("run %d: pop order differs from first run at index %d", run, i)
+			}
+		}
+	}
+}
+
+// TestPriorityTxPool_SortModes tests fee, utility and weighted heap ordering with mixed ITX/CTX
+func TestPriorityTxPool_SortModes(t *testing.T) {
+	newTx := func(hash string, from, to int, fee int64, uA, uB *big.Int) *Transaction {
+		tx := newPoolTestTx("alice", 0, fee)
+		tx.TxHash = []byte(hash)
+		tx.FromShard, tx.ToShard = from, to
+		tx.UtilityA, tx.UtilityB = uA, uB
+		return tx
+	}
+	build := func() []*Transaction {
+		return []*Transaction{
+			newTx("itx", 0, 0, 100, big.NewInt(10), big.NewInt(10)),
+			newTx("outgoing", 0, 1, 50, big.NewInt(300), big.NewInt(1)),
+			newTx("incoming", 1, 0, 80, big.NewInt(1), big.NewInt(200)),
+			newTx("unscored", 0, 0, 120, nil, nil), // Falls back to fee
+		}
+	}
+
+	cases := []struct {
+		mode       PoolSortMode
+		weightFee  float64
+		weightUtil float64
+		want       []string
+	}{
+		{SortByFee, 0, 0, []string{"unscored", "itx", "incoming", "outgoing"}},
+		{SortByUtility, 0, 0, []string{"outgoing", "incoming", "unscored", "itx"}},
+		// itx=102.5, outgoing=125, incoming=130, unscored=120
+		{SortByWeighted, 1, 0.25, []string{"incoming", "outgoing", "unscored", "itx"}},
+	}
+	for _, c := range cases {
+		pool := NewPriorityTxPool()
+		pool.SetScheduler(nil, 0)
+		pool.AddTxs2Pool(build())
+		// Switching after insertion re-heapifies the queued transactions
+		pool.SetSortMode(c.mode, c.weightFee, c.weightUtil)
+		if err := pool.VerifyHeap(); err != nil {
+			t.Fatalf("%s: %v", c.mode, err)
+		}
+
+		packed := pool.PackTxs(10)
+		if len(packed) != len(c.want) {
+			t.Fatalf("%s: packed %d txs, want %d", c.mode, len(packed), len(c.want))
+		}
+		for i, tx := range packed {
+			if string(tx.TxHash) != c.want[i] {
+				t.Errorf("%s: position %d = %s, want %s", c.mode, i, tx.TxHash, c.want[i])
+			}
+		}
+	}
+}
+
+// TestPriorityTxPool_RelayByUtility tests that relays pack by descending UtilityB when enabled and FIFO otherwise
+func TestPriorityTxPool_RelayByUtility(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	utilities := []int64{5, 90, 40, 90, 10}
+	fill := func(pool *PriorityTxPool) {
+		for i, u := range utilities {
+			tx := newPoolTestTx("alice", uint64(i), 1)
+			tx.TxHash = []byte{byte('a' + i)}
+			tx.UtilityB = big.NewInt(u)
+			tx.ArrivalTime = base.Add(time.Duration(i) * time.Second)
+			pool.AddRelayTx(tx, 1)
+		}
+	}
+	hashes := func(txs []*Transaction) string {
+		out := ""
+		for _, tx := range txs {
+			out += string(tx.TxHash)
+		}
+		return out
+	}
+
+	fifo := NewPriorityTxPool()
+	fill(fifo)
+	if packed, ok := fifo.PackRelayTxs(1, 1, 3); !ok || hashes(packed) != "abc" {
+		t.Errorf("FIFO packed %q (ok=%v), want \"abc\"", hashes(packed), ok)
+	}
+
+	pool := NewPriorityTxPool()
+	pool.SetRelayByUtility(true)
+	fill(pool)
+	// Below minRelaySize nothing is packed
+	if _, ok := pool.PackRelayTxs(1, 6, 3); ok {
+		t.Error("Expected no packing below minRelaySize")
+	}
+	// Equal utilities keep arrival order: b before d
+	if packed, ok := pool.PackRelayTxs(1, 1, 3); !ok || hashes(packed) != "bdc" {
+		t.Errorf("Utility order packed %q (ok=%v), want \"bdc\"", hashes(packed), ok)
+	}
+	if packed, _ := pool.PackRelayTxs(1, 1, 3); hashes(packed) != "ea" {
+		t.Errorf("Remaining relays packed %q, want \"ea\"", hashes(packed))
+	}
+}
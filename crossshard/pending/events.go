@@ -0,0 +1,108 @@
+package pending
+
+import (
+	"math/big"
+	"sync/atomic"
+)
+
+// settleEventBuffer is the channel capacity of each subscriber; events beyond it are dropped
+const settleEventBuffer = 256
+
+// SettleEventKind tells how a pending entry was resolved
+type SettleEventKind int
+
+const (
+	// SettleEventSettled means CTX' was included in the destination shard and uA/uB were credited
+	SettleEventSettled SettleEventKind = iota
+	// SettleEventExpired means SettleExpired refunded f_AB to the source proposer and voided R
+	SettleEventExpired
+)
+
+// String returns the string representation of the event kind
+func (k SettleEventKind) String() string {
+	switch k {
+	case SettleEventSettled:
+		return "settled"
+	case SettleEventExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// SettleEvent describes one resolved pending entry; amounts are copies (nil counts as zero)
+type SettleEvent struct {
+	Kind     SettleEventKind
+	PairID   string
+	ShardA   int
+	ShardB   int
+	UtilityA *big.Int
+	UtilityB *big.Int
+	FAB      *big.Int
+	R        *big.Int
+}
+
+// Subscribe returns a channel receiving an event for every subsequent settlement and expiry
+// Publishing never blocks: events for a subscriber whose buffer is full are dropped and counted
+// (see DroppedEvents). The channel is closed by Unsubscribe or Reset
+func (l *Ledger) Subscribe() <-chan SettleEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan SettleEvent, settleEventBuffer)
+	l.subscribers = append(l.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe closes ch and stops publishing to it; unknown channels are ignored
+func (l *Ledger) Unsubscribe(ch <-chan SettleEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, sub := range l.subscribers {
+		if (<-chan SettleEvent)(sub) == ch {
+			close(sub)
+			l.subscribers = append(l.subscribers[:i], l.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// DroppedEvents returns the number of events dropped because a subscriber was not keeping up
+func (l *Ledger) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&l.droppedEvents)
+}
+
+// publish sends the event for p to every subscriber without blocking
+// Must be called with lock held
+func (l *Ledger) publish(kind SettleEventKind, p *Pending) {
+	if len(l.subscribers) == 0 {
+		return
+	}
+	for _, sub := range l.subscribers {
+		ev := SettleEvent{
+			Kind:     kind,
+			PairID:   p.PairID,
+			ShardA:   p.ShardA,
+			ShardB:   p.ShardB,
+			UtilityA: orZero(p.UtilityA),
+			UtilityB: orZero(p.UtilityB),
+			FAB:      orZero(p.FAB),
+			R:        orZero(p.R),
+		}
+		select {
+		case sub <- ev:
+		default:
+			atomic.AddUint64(&l.droppedEvents, 1)
+		}
+	}
+}
+
+// closeSubscribers closes and forgets every subscriber channel
+// Must be called with lock held
+func (l *Ledger) closeSubscribers() {
+	for _, sub := range l.subscribers {
+		close(sub)
+	}
+	l.subscribers = nil
+}
@@ -0,0 +1,43 @@
+package pending
+
+import (
+	"math/big"
+	"sync"
+)
+
+// IssuanceAccountant tracks issuance over a whole run: the sum of every positive subsidy R
+// settled, the same amount the ledger debits from the inflation pool (see TotalSubsidyIssued).
+// A negative R (a tax on the CTX) is not issuance and does not reduce the total.
+// Unlike the per-epoch inflation cap it never resets on epoch boundaries
+type IssuanceAccountant struct {
+	mu    sync.Mutex
+	total *big.Int
+}
+
+// NewIssuanceAccountant creates an accountant with zero issuance
+func NewIssuanceAccountant() *IssuanceAccountant {
+	return &IssuanceAccountant{total: big.NewInt(0)}
+}
+
+// Attach registers the accountant as a settlement observer of the ledger, alongside any other
+// observers, and returns the function that detaches it
+func (a *IssuanceAccountant) Attach(l *Ledger) (detach func()) {
+	return l.AddSettlementObserver(a.Observe)
+}
+
+// Observe records one settlement; its signature matches Ledger.AddSettlementObserver
+func (a *IssuanceAccountant) Observe(epoch int, fee, subsidy *big.Int) {
+	if subsidy == nil || subsidy.Sign() <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total.Add(a.total, subsidy)
+}
+
+// TotalIssued returns a copy of the issuance accumulated so far
+func (a *IssuanceAccountant) TotalIssued() *big.Int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return new(big.Int).Set(a.total)
+}
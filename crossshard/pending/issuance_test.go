@@ -0,0 +1,77 @@
+package pending
+
+import (
+	"math/big"
+	"testing"
+)
+
+// TestIssuanceAccountant_TotalIssued tests that issuance sums the positive R of all settlements,
+// matching the ledger's own total
+func TestIssuanceAccountant_TotalIssued(t *testing.T) {
+	ledger := NewLedger()
+	accountant := NewIssuanceAccountant()
+	accountant.Attach(ledger)
+
+	// A negative R is a tax, not issuance
+	subsidies := map[string]int64{"a": 10, "b": 25, "c": 0, "d": -5, "e": 40}
+	for pairID, r := range subsidies {
+		ledger.Add(&Pending{
+			PairID:   pairID,
+			ShardA:   0,
+			ShardB:   1,
+			FAB:      big.NewInt(100),
+			R:        big.NewInt(r),
+			UtilityA: big.NewInt(50),
+			UtilityB: big.NewInt(50 + r),
+		})
+	}
+
+	creditFunc := func(shardID int, proposerID string, amount *big.Int) {}
+	for pairID := range subsidies {
+		if err := ledger.Settle(pairID, "block_B", creditFunc); err != nil {
+			t.Fatalf("Settle(%s) failed: %v", pairID, err)
+		}
+	}
+	// Double settlement is rejected and must not count twice
+	_ = ledger.Settle("a", "block_B", creditFunc)
+
+	if got := accountant.TotalIssued(); got.Int64() != 75 {
+		t.Errorf("TotalIssued = %s, want 75", got)
+	}
+	if got, ledgerTotal := accountant.TotalIssued(), ledger.TotalSubsidyIssued(); got.Cmp(ledgerTotal) != 0 {
+		t.Errorf("TotalIssued = %s, want the ledger's TotalSubsidyIssued = %s", got, ledgerTotal)
+	}
+}
+
+// TestIssuanceAccountant_CoexistsWithObserver tests that attaching the accountant keeps the other
+// settlement observers and that detaching it stops only the accountant
+func TestIssuanceAccountant_CoexistsWithObserver(t *testing.T) {
+	ledger := NewLedger()
+	epochSubsidy := make(map[int]int64)
+	ledger.AddSettlementObserver(func(epoch int, fee, subsidy *big.Int) {
+		epochSubsidy[epoch] += subsidy.Int64()
+	})
+	accountant := NewIssuanceAccountant()
+	detach := accountant.Attach(ledger)
+
+	creditFunc := func(shardID int, proposerID string, amount *big.Int) {}
+	for i, pairID := range []string{"a", "b", "c"} {
+		ledger.Add(&Pending{PairID: pairID, ShardA: 0, ShardB: 1, FAB: big.NewInt(100), R: big.NewInt(10)})
+		if i == 2 {
+			detach()
+			detach() // Idempotent
+		}
+		if err := ledger.SettleInEpoch(i, pairID, "block_B", creditFunc, nil); err != nil {
+			t.Fatalf("SettleInEpoch(%s) failed: %v", pairID, err)
+		}
+	}
+
+	if got := accountant.TotalIssued(); got.Int64() != 20 {
+		t.Errorf("TotalIssued = %s, want 20 (detached before the third settlement)", got)
+	}
+	for epoch := 0; epoch < 3; epoch++ {
+		if epochSubsidy[epoch] != 10 {
+			t.Errorf("Epoch observer saw %d in epoch %d, want 10", epochSubsidy[epoch], epoch)
+		}
+	}
+}
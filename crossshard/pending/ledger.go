@@ -2,11 +2,24 @@
 package pending
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// settlementRingSize is the number of recent settlement timestamps kept for rate estimation
+const settlementRingSize = 4096
+
+// ErrLedgerFull is returned by Add when the ledger holds MaxPending entries; the source shard
+// should defer creating new CTX until settlements free up room
+var ErrLedgerFull = errors.New("pending ledger full")
+
 // Pending represents a cross-shard transaction awaiting settlement
 // Created when source shard A includes CTX
 // Settled when destination shard B includes CTX'
@@ -24,18 +37,81 @@ type Pending struct {
 	CreatedAt     int64    // Timestamp of creation (for cleanup)
 }
 
+// clone returns a copy of p whose big.Int fields do not alias p's
+func (p *Pending) clone() *Pending {
+	c := *p
+	c.FAB = copyBig(p.FAB)
+	c.R = copyBig(p.R)
+	c.EA = copyBig(p.EA)
+	c.EB = copyBig(p.EB)
+	c.UtilityA = copyBig(p.UtilityA)
+	c.UtilityB = copyBig(p.UtilityB)
+	return &c
+}
+
+// copyBig returns a copy of v, keeping nil as nil
+func copyBig(v *big.Int) *big.Int {
+	if v == nil {
+		return nil
+	}
+	return new(big.Int).Set(v)
+}
+
+// orZero returns a copy of v, or zero if v is nil
+func orZero(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(v)
+}
+
 // Ledger maintains the set of pending cross-shard transactions
 type Ledger struct {
-	mu       sync.RWMutex
-	pending  map[string]*Pending // PairID -> Pending entry
-	settled  map[string]bool     // Track settled PairIDs to prevent double settlement
+	mu      sync.RWMutex
+	pending map[string]*Pending // PairID -> Pending entry
+	settled map[string]bool     // Track settled PairIDs to prevent double settlement
+	expired map[string]bool     // PairIDs refunded by SettleExpired, never to be settled
+
+	maxPending int // Add fails with ErrLedgerFull once len(pending) reaches this (0 = unbounded)
+
+	// Settlement throughput tracking
+	settleCount uint64                        // Total successful settlements (atomic)
+	settleTimes [settlementRingSize]time.Time // Ring buffer of recent settlement timestamps
+	settleHead  int                           // Next write position in settleTimes
+
+	// Total subsidy R debited from the inflation pool by settlements, overall and per (ShardA, ShardB)
+	subsidyIssued  *big.Int
+	issuanceByPair map[[2]int]*big.Int
+
+	// Callbacks reporting the value delivered by each settlement, in registration order
+	observers      []settlementObserver
+	nextObserverID int
+	setObserverID  int // ID of the observer installed by SetSettlementObserver (0 = none)
+
+	// Settlement event stream (see Subscribe); droppedEvents is updated atomically
+	subscribers   []chan SettleEvent
+	droppedEvents uint64
+
+	// SettleBatch processes PairIDs in canonical (PairID hash) order instead of input order
+	canonicalOrder bool
+
+	// Reused GetStats accumulators (guarded by statsMu, since GetStats only holds the read lock)
+	statsMu      sync.Mutex
+	statsSubsidy *big.Int
+	statsFees    *big.Int
 }
 
 // NewLedger creates a new pending rewards ledger
 func NewLedger() *Ledger {
 	return &Ledger{
-		pending: make(map[string]*Pending),
-		settled: make(map[string]bool),
+		pending:       make(map[string]*Pending),
+		settled:       make(map[string]bool),
+		expired:       make(map[string]bool),
+		statsSubsidy:  new(big.Int),
+		statsFees:     new(big.Int),
+		subsidyIssued: new(big.Int),
+
+		issuanceByPair: make(map[[2]int]*big.Int),
 	}
 }
 
@@ -49,16 +125,34 @@ func (l *Ledger) Add(p *Pending) error {
 	if l.settled[p.PairID] {
 		return fmt.Errorf("transaction %s already settled", p.PairID)
 	}
+	if l.expired[p.PairID] {
+		return fmt.Errorf("transaction %s already expired", p.PairID)
+	}
 
 	// Check if already pending
 	if _, exists := l.pending[p.PairID]; exists {
 		return fmt.Errorf("transaction %s already pending", p.PairID)
 	}
 
+	if l.maxPending > 0 && len(l.pending) >= l.maxPending {
+		return fmt.Errorf("%w: %d entries pending, cannot add %s", ErrLedgerFull, len(l.pending), p.PairID)
+	}
+
 	l.pending[p.PairID] = p
 	return nil
 }
 
+// SetMaxPending bounds the number of pending entries (n <= 0 removes the bound)
+// Entries already pending are kept even if they exceed a newly lowered bound
+func (l *Ledger) SetMaxPending(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n < 0 {
+		n = 0
+	}
+	l.maxPending = n
+}
+
 // Get retrieves a pending entry by PairID
 func (l *Ledger) Get(pairID string) (*Pending, bool) {
 	l.mu.RLock()
@@ -72,13 +166,151 @@ func (l *Ledger) Get(pairID string) (*Pending, bool) {
 // Calls the credit function to distribute rewards to both proposers
 // Returns error if PairID not found or already settled
 func (l *Ledger) Settle(pairID string, destBlockID string, creditFunc func(shardID int, proposerID string, amount *big.Int)) error {
+	return l.SettleWithDebit(pairID, destBlockID, creditFunc, nil)
+}
+
+// SettleWithDebit settles like Settle and additionally models where the subsidy comes from:
+// the subsidy R is debited from the inflation pool via debitFunc (if non-nil) and added to
+// the ledger's issuance total, so credited uA+uB = fAB (paid by the user) + R (newly issued)
+func (l *Ledger) SettleWithDebit(pairID string, destBlockID string,
+	creditFunc func(shardID int, proposerID string, amount *big.Int), debitFunc func(amount *big.Int)) error {
+	return l.SettleInEpoch(-1, pairID, destBlockID, creditFunc, debitFunc)
+}
+
+// settlementObserver is one callback registered with SetSettlementObserver or AddSettlementObserver
+type settlementObserver struct {
+	id int
+	fn func(epoch int, fee, subsidy *big.Int)
+}
+
+// SetSettlementObserver registers fn to be called on every successful settlement with the
+// settlement epoch, the fee f_AB and the subsidy R delivered (nil removes the observer)
+// It replaces the observer set by the previous call only; observers added with
+// AddSettlementObserver are kept. fn is called with the ledger lock held and must not call back into the ledger
+func (l *Ledger) SetSettlementObserver(fn func(epoch int, fee, subsidy *big.Int)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.removeObserver(l.setObserverID)
+	l.setObserverID = 0
+	if fn != nil {
+		l.setObserverID = l.addObserver(fn)
+	}
+}
+
+// AddSettlementObserver registers fn like SetSettlementObserver, but alongside the other observers,
+// after any registered before it. The returned function removes fn again; calling it more than
+// once is harmless. fn is called with the ledger lock held and must not call back into the ledger
+func (l *Ledger) AddSettlementObserver(fn func(epoch int, fee, subsidy *big.Int)) (remove func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := l.addObserver(fn)
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.removeObserver(id)
+	}
+}
+
+// addObserver appends fn to the observers and returns its ID (caller must hold the write lock)
+func (l *Ledger) addObserver(fn func(epoch int, fee, subsidy *big.Int)) int {
+	l.nextObserverID++
+	l.observers = append(l.observers, settlementObserver{id: l.nextObserverID, fn: fn})
+	return l.nextObserverID
+}
+
+// removeObserver removes the observer with the given ID, if any (caller must hold the write lock)
+func (l *Ledger) removeObserver(id int) {
+	for i, o := range l.observers {
+		if o.id == id {
+			l.observers = append(l.observers[:i:i], l.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetCanonicalSettleOrder makes SettleBatch settle in a deterministic order derived from each
+// PairID's SHA-256 hash, so the destination proposer cannot choose who is settled first
+func (l *Ledger) SetCanonicalSettleOrder(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.canonicalOrder = enabled
+}
+
+// SettleBatch settles every PairID included in one destination block like SettleInEpoch, in input
+// order or, if SetCanonicalSettleOrder is enabled, in canonical order. The whole batch is settled
+// under one lock, so no other settlement interleaves with it. It returns the PairIDs settled, in
+// the order they were processed, and the error for each PairID that could not be settled
+func (l *Ledger) SettleBatch(epoch int, pairIDs []string, destBlockID string,
+	creditFunc func(shardID int, proposerID string, amount *big.Int), debitFunc func(amount *big.Int)) ([]string, map[string]error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	order := pairIDs
+	if l.canonicalOrder {
+		order = canonicalSettleOrder(pairIDs)
+	}
+
+	settled := make([]string, 0, len(order))
+	var failed map[string]error
+	for _, pairID := range order {
+		if err := l.settle(epoch, pairID, destBlockID, creditFunc, debitFunc); err != nil {
+			if failed == nil {
+				failed = make(map[string]error)
+			}
+			failed[pairID] = err
+			continue
+		}
+		settled = append(settled, pairID)
+	}
+	return settled, failed
+}
+
+// canonicalSettleOrder returns a copy of pairIDs sorted by SHA-256(PairID), ties broken by PairID
+func canonicalSettleOrder(pairIDs []string) []string {
+	type keyed struct {
+		pairID string
+		hash   [sha256.Size]byte
+	}
+	keys := make([]keyed, len(pairIDs))
+	for i, id := range pairIDs {
+		keys[i] = keyed{pairID: id, hash: sha256.Sum256([]byte(id))}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c := bytes.Compare(keys[i].hash[:], keys[j].hash[:]); c != 0 {
+			return c < 0
+		}
+		return keys[i].pairID < keys[j].pairID
+	})
+
+	order := make([]string, len(keys))
+	for i, k := range keys {
+		order[i] = k.pairID
+	}
+	return order
+}
+
+// SettleInEpoch settles like SettleWithDebit and reports the settlement to the observers
+// under the caller-supplied epoch (Settle and SettleWithDebit report epoch -1)
+func (l *Ledger) SettleInEpoch(epoch int, pairID string, destBlockID string,
+	creditFunc func(shardID int, proposerID string, amount *big.Int), debitFunc func(amount *big.Int)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.settle(epoch, pairID, destBlockID, creditFunc, debitFunc)
+}
+
+// settle implements SettleInEpoch and SettleBatch
+// Must be called with lock held
+func (l *Ledger) settle(epoch int, pairID string, destBlockID string,
+	creditFunc func(shardID int, proposerID string, amount *big.Int), debitFunc func(amount *big.Int)) error {
 	// Check if already settled
 	if l.settled[pairID] {
 		return fmt.Errorf("transaction %s already settled", pairID)
 	}
+	if l.expired[pairID] {
+		return fmt.Errorf("transaction %s expired before settlement", pairID)
+	}
 
 	// Get pending entry
 	p, exists := l.pending[pairID]
@@ -92,19 +324,94 @@ func (l *Ledger) Settle(pairID string, destBlockID string, creditFunc func(shard
 	sourceProposerID := fmt.Sprintf("proposer_shard_%d_block_%s", p.ShardA, p.SourceBlockID)
 	destProposerID := fmt.Sprintf("proposer_shard_%d_block_%s", p.ShardB, destBlockID)
 
-	// Credit uA to source shard proposer (make copy to prevent modification)
-	creditFunc(p.ShardA, sourceProposerID, new(big.Int).Set(p.UtilityA))
+	// Credit uA to source shard proposer (make copy to prevent modification; nil counts as zero)
+	creditFunc(p.ShardA, sourceProposerID, orZero(p.UtilityA))
 
-	// Credit uB to destination shard proposer (make copy to prevent modification)
-	creditFunc(p.ShardB, destProposerID, new(big.Int).Set(p.UtilityB))
+	// Credit uB to destination shard proposer (make copy to prevent modification; nil counts as zero)
+	creditFunc(p.ShardB, destProposerID, orZero(p.UtilityB))
+
+	// Debit the subsidy portion from the inflation pool
+	if p.R != nil && p.R.Sign() > 0 {
+		l.subsidyIssued.Add(l.subsidyIssued, p.R)
+		pair := [2]int{p.ShardA, p.ShardB}
+		if l.issuanceByPair[pair] == nil {
+			l.issuanceByPair[pair] = new(big.Int)
+		}
+		l.issuanceByPair[pair].Add(l.issuanceByPair[pair], p.R)
+		if debitFunc != nil {
+			debitFunc(new(big.Int).Set(p.R))
+		}
+	}
 
 	// Mark as settled and remove from pending
 	l.settled[pairID] = true
 	delete(l.pending, pairID)
+	l.recordSettlement(time.Now())
+
+	for _, o := range l.observers {
+		o.fn(epoch, orZero(p.FAB), orZero(p.R))
+	}
+	l.publish(SettleEventSettled, p)
 
 	return nil
 }
 
+// recordSettlement bumps the settlement counter and stores the event timestamp
+// Must be called with lock held
+func (l *Ledger) recordSettlement(at time.Time) {
+	atomic.AddUint64(&l.settleCount, 1)
+	l.settleTimes[l.settleHead] = at
+	l.settleHead = (l.settleHead + 1) % settlementRingSize
+}
+
+// SettlementCount returns the total number of successful settlements
+func (l *Ledger) SettlementCount() uint64 {
+	return atomic.LoadUint64(&l.settleCount)
+}
+
+// SettlementRate returns settlements per second over the trailing window
+// Only the most recent settlementRingSize events are retained, so very high
+// rates over long windows are underestimated
+func (l *Ledger) SettlementRate(window time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	cutoff := time.Now().Add(-window)
+	count := 0
+	for _, at := range l.settleTimes {
+		if !at.IsZero() && at.After(cutoff) {
+			count++
+		}
+	}
+	return float64(count) / window.Seconds()
+}
+
+// TotalSubsidyIssued returns the total subsidy R debited from the inflation pool by settlements
+// Only positive R counts as issued: a negative R (a tax on the CTX) is not paid out of the pool
+func (l *Ledger) TotalSubsidyIssued() *big.Int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return new(big.Int).Set(l.subsidyIssued)
+}
+
+// IssuanceByPair returns the subsidy R issued by settlements, keyed by (source shard, destination shard)
+// The values sum to TotalSubsidyIssued
+func (l *Ledger) IssuanceByPair() map[[2]int]*big.Int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := make(map[[2]int]*big.Int, len(l.issuanceByPair))
+	for pair, r := range l.issuanceByPair {
+		out[pair] = new(big.Int).Set(r)
+	}
+	return out
+}
+
 // IsPending checks if a transaction is still pending
 func (l *Ledger) IsPending(pairID string) bool {
 	l.mu.RLock()
@@ -139,6 +446,7 @@ func (l *Ledger) GetSettledCount() int {
 }
 
 // GetAllPending returns a snapshot of all pending transactions
+// Entries are deep copies: modifying their big.Int fields does not affect the ledger
 func (l *Ledger) GetAllPending() []*Pending {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
@@ -146,8 +454,7 @@ func (l *Ledger) GetAllPending() []*Pending {
 	result := make([]*Pending, 0, len(l.pending))
 	for _, p := range l.pending {
 		// Create a copy to avoid concurrent modification
-		pCopy := *p
-		result = append(result, &pCopy)
+		result = append(result, p.clone())
 	}
 	return result
 }
@@ -168,13 +475,63 @@ func (l *Ledger) CleanupOld(olderThan int64) int {
 	return count
 }
 
+// SettleExpired resolves pending entries created before olderThan that never reached the
+// destination shard: the source proposer is refunded f_AB (the user already paid it) via
+// refundFunc, the subsidy R is voided (never issued), and the pair is marked expired so it can
+// no longer be settled. Returns the number of entries expired
+func (l *Ledger) SettleExpired(olderThan int64, refundFunc func(shardID int, proposerID string, amount *big.Int)) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := 0
+	for pairID, p := range l.pending {
+		if p.CreatedAt >= olderThan {
+			continue
+		}
+		if refundFunc != nil {
+			sourceProposerID := fmt.Sprintf("proposer_shard_%d_block_%s", p.ShardA, p.SourceBlockID)
+			refundFunc(p.ShardA, sourceProposerID, orZero(p.FAB))
+		}
+		l.expired[pairID] = true
+		delete(l.pending, pairID)
+		l.publish(SettleEventExpired, p)
+		count++
+	}
+	return count
+}
+
+// IsExpired checks if a transaction was expired by SettleExpired
+func (l *Ledger) IsExpired(pairID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.expired[pairID]
+}
+
+// GetExpiredCount returns the number of expired transactions
+func (l *Ledger) GetExpiredCount() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.expired)
+}
+
 // Reset clears all pending and settled records (for testing)
+// Subscriber channels are closed and must be re-created with Subscribe
 func (l *Ledger) Reset() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	l.pending = make(map[string]*Pending)
 	l.settled = make(map[string]bool)
+	l.expired = make(map[string]bool)
+	atomic.StoreUint64(&l.settleCount, 0)
+	l.settleTimes = [settlementRingSize]time.Time{}
+	l.settleHead = 0
+	l.subsidyIssued = new(big.Int)
+	l.issuanceByPair = make(map[[2]int]*big.Int)
+	l.closeSubscribers()
+	atomic.StoreUint64(&l.droppedEvents, 0)
 }
 
 // Stats returns statistics about the ledger
@@ -186,26 +543,43 @@ type Stats struct {
 }
 
 // GetStats returns current ledger statistics
+// Totals are accumulated into reused big.Int accumulators and returned as copies,
+// so summing many wei-scale values does not allocate per entry
 func (l *Ledger) GetStats() Stats {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
 
-	stats := Stats{
-		PendingCount: len(l.pending),
-		SettledCount: len(l.settled),
-		TotalSubsidy: big.NewInt(0),
-		TotalFees:    big.NewInt(0),
-	}
-
+	l.statsSubsidy.SetInt64(0)
+	l.statsFees.SetInt64(0)
 	for _, p := range l.pending {
 		if p.R != nil {
-			stats.TotalSubsidy.Add(stats.TotalSubsidy, p.R)
+			l.statsSubsidy.Add(l.statsSubsidy, p.R)
 		}
 		if p.FAB != nil {
-			stats.TotalFees.Add(stats.TotalFees, p.FAB)
+			l.statsFees.Add(l.statsFees, p.FAB)
 		}
 	}
 
-	return stats
+	return Stats{
+		PendingCount: len(l.pending),
+		SettledCount: len(l.settled),
+		TotalSubsidy: new(big.Int).Set(l.statsSubsidy),
+		TotalFees:    new(big.Int).Set(l.statsFees),
+	}
 }
 
+// GetStatsStreaming calls onEntry for every pending transaction under the read lock,
+// for callers that want to fold over entries without building the totals
+// onEntry receives a shallow copy; it must not retain it or modify its big.Int fields,
+// and must not call back into the ledger
+func (l *Ledger) GetStatsStreaming(onEntry func(*Pending)) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, p := range l.pending {
+		pCopy := *p
+		onEntry(&pCopy)
+	}
+}
@@ -1,9 +1,13 @@
 package pending
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 	"testing"
 	"time"
+
+	"blockEmulator/utils/snapshot"
 )
 
 // TestLedger_AddAndGet tests basic add and get operations
@@ -394,6 +398,96 @@ func TestLedger_Reset(t *testing.T) {
 	}
 }
 
+// TestLedger_SettlementRate tests settlement throughput tracking
+func TestLedger_SettlementRate(t *testing.T) {
+	ledger := NewLedger()
+	creditFunc := func(shardID int, proposerID string, amount *big.Int) {}
+
+	if rate := ledger.SettlementRate(time.Second); rate != 0 {
+		t.Errorf("Empty ledger rate = %v, want 0", rate)
+	}
+
+	// Settle a burst of entries
+	burst := 50
+	for i := 0; i < burst; i++ {
+		p := &Pending{
+			PairID:    fmt.Sprintf("tx%d", i),
+			UtilityA:  big.NewInt(10),
+			UtilityB:  big.NewInt(10),
+			CreatedAt: time.Now().Unix(),
+		}
+		if err := ledger.Add(p); err != nil {
+			t.Fatalf("Add() failed: %v", err)
+		}
+		if err := ledger.Settle(p.PairID, "block_B", creditFunc); err != nil {
+			t.Fatalf("Settle() failed: %v", err)
+		}
+	}
+
+	// Failed settlements are not counted
+	_ = ledger.Settle("tx0", "block_B", creditFunc)
+
+	if got := ledger.SettlementCount(); got != uint64(burst) {
+		t.Errorf("SettlementCount() = %d, want %d", got, burst)
+	}
+
+	window := 10 * time.Second
+	rate := ledger.SettlementRate(window)
+	want := float64(burst) / window.Seconds()
+	if rate != want {
+		t.Errorf("SettlementRate(%v) = %v, want %v", window, rate, want)
+	}
+
+	ledger.Reset()
+	if ledger.SettlementCount() != 0 || ledger.SettlementRate(window) != 0 {
+		t.Error("Reset() should clear settlement throughput tracking")
+	}
+}
+
+// TestLedger_GetStats_WeiScale tests totals over many wei-scale pendings and the streaming fold
+func TestLedger_GetStats_WeiScale(t *testing.T) {
+	ledger := NewLedger()
+	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+	n := 1000
+	for i := 0; i < n; i++ {
+		ledger.Add(&Pending{
+			PairID:    fmt.Sprintf("tx%d", i),
+			FAB:       new(big.Int).Set(oneEth),
+			R:         new(big.Int).Mul(oneEth, big.NewInt(2)),
+			CreatedAt: time.Now().Unix(),
+		})
+	}
+
+	wantFees := new(big.Int).Mul(oneEth, big.NewInt(int64(n)))
+	wantSubsidy := new(big.Int).Mul(wantFees, big.NewInt(2))
+
+	stats := ledger.GetStats()
+	if stats.TotalFees.Cmp(wantFees) != 0 {
+		t.Errorf("TotalFees = %v, want %v", stats.TotalFees, wantFees)
+	}
+	if stats.TotalSubsidy.Cmp(wantSubsidy) != 0 {
+		t.Errorf("TotalSubsidy = %v, want %v", stats.TotalSubsidy, wantSubsidy)
+	}
+
+	// Returned totals are copies, not the reused accumulators
+	stats.TotalFees.SetInt64(0)
+	if again := ledger.GetStats(); again.TotalFees.Cmp(wantFees) != 0 {
+		t.Errorf("Second GetStats TotalFees = %v, want %v", again.TotalFees, wantFees)
+	}
+
+	// Streaming fold sees every entry
+	count := 0
+	foldFees := big.NewInt(0)
+	ledger.GetStatsStreaming(func(p *Pending) {
+		count++
+		foldFees.Add(foldFees, p.FAB)
+	})
+	if count != n || foldFees.Cmp(wantFees) != 0 {
+		t.Errorf("Streaming fold saw %d entries totalling %v, want %d totalling %v", count, foldFees, n, wantFees)
+	}
+}
+
 // BenchmarkLedger_Add benchmarks adding pending transactions
 func BenchmarkLedger_Add(b *testing.B) {
 	ledger := NewLedger()
@@ -438,3 +532,504 @@ func BenchmarkLedger_Get(b *testing.B) {
 		_, _ = ledger.Get("tx123")
 	}
 }
+
+// BenchmarkLedger_GetStats benchmarks computing totals over many pending transactions
+func BenchmarkLedger_GetStats(b *testing.B) {
+	ledger := NewLedger()
+	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	for i := 0; i < 10000; i++ {
+		ledger.Add(&Pending{
+			PairID:    fmt.Sprintf("tx%d", i),
+			FAB:       new(big.Int).Set(oneEth),
+			R:         new(big.Int).Set(oneEth),
+			CreatedAt: time.Now().Unix(),
+		})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ledger.GetStats()
+	}
+}
+
+// TestLedger_SettleWithDebit tests that the subsidy R is debited from the inflation pool on settlement
+func TestLedger_SettleWithDebit(t *testing.T) {
+	ledger := NewLedger()
+	ledger.Add(&Pending{
+		PairID:        "tx123",
+		ShardA:        0,
+		ShardB:        1,
+		FAB:           big.NewInt(100),
+		R:             big.NewInt(50),
+		EA:            big.NewInt(80),
+		EB:            big.NewInt(70),
+		UtilityA:      big.NewInt(80),
+		UtilityB:      big.NewInt(70),
+		SourceBlockID: "block_A_1",
+		CreatedAt:     time.Now().Unix(),
+	})
+
+	credited := big.NewInt(0)
+	creditFunc := func(shardID int, proposerID string, amount *big.Int) {
+		credited.Add(credited, amount)
+	}
+	debited := big.NewInt(0)
+	debitFunc := func(amount *big.Int) {
+		debited.Add(debited, amount)
+	}
+
+	if err := ledger.SettleWithDebit("tx123", "block_B_1", creditFunc, debitFunc); err != nil {
+		t.Fatalf("SettleWithDebit() failed: %v", err)
+	}
+
+	if debited.Cmp(big.NewInt(50)) != 0 {
+		t.Errorf("Debited = %v, want R = 50", debited)
+	}
+	if credited.Cmp(big.NewInt(150)) != 0 {
+		t.Errorf("Credited = %v, want fAB + R = 150", credited)
+	}
+	if issued := ledger.TotalSubsidyIssued(); issued.Cmp(big.NewInt(50)) != 0 {
+		t.Errorf("TotalSubsidyIssued = %v, want 50", issued)
+	}
+
+	// A failed settlement debits nothing
+	if err := ledger.SettleWithDebit("tx123", "block_B_2", creditFunc, debitFunc); err == nil {
+		t.Error("Expected double settlement to fail")
+	}
+	if debited.Cmp(big.NewInt(50)) != 0 {
+		t.Errorf("Debited after failed settlement = %v, want 50", debited)
+	}
+}
+
+// TestLedger_SettlementObserver tests that the observer receives correct per-epoch fee and subsidy totals
+func TestLedger_SettlementObserver(t *testing.T) {
+	ledger := NewLedger()
+	entries := []struct {
+		pairID string
+		epoch  int
+		fee    int64
+		r      int64
+	}{
+		{"a", 0, 100, 10},
+		{"b", 0, 200, 20},
+		{"c", 1, 300, 30},
+		{"d", 2, 400, 0},
+		{"e", 2, 500, 50},
+	}
+	for _, e := range entries {
+		ledger.Add(&Pending{
+			PairID:   e.pairID,
+			ShardA:   0,
+			ShardB:   1,
+			FAB:      big.NewInt(e.fee),
+			R:        big.NewInt(e.r),
+			UtilityA: big.NewInt(e.fee),
+			UtilityB: big.NewInt(e.r),
+		})
+	}
+
+	fees := make(map[int]*big.Int)
+	subsidies := make(map[int]*big.Int)
+	ledger.SetSettlementObserver(func(epoch int, fee, subsidy *big.Int) {
+		if fees[epoch] == nil {
+			fees[epoch], subsidies[epoch] = big.NewInt(0), big.NewInt(0)
+		}
+		fees[epoch].Add(fees[epoch], fee)
+		subsidies[epoch].Add(subsidies[epoch], subsidy)
+	})
+
+	creditFunc := func(shardID int, proposerID string, amount *big.Int) {}
+	for _, e := range entries {
+		if err := ledger.SettleInEpoch(e.epoch, e.pairID, "block_B", creditFunc, nil); err != nil {
+			t.Fatalf("SettleInEpoch(%s) failed: %v", e.pairID, err)
+		}
+	}
+	// Failed settlements are not observed
+	_ = ledger.SettleInEpoch(3, "a", "block_B", creditFunc, nil)
+
+	want := map[int][2]int64{0: {300, 30}, 1: {300, 30}, 2: {900, 50}}
+	if len(fees) != len(want) {
+		t.Errorf("Observed epochs = %d, want %d", len(fees), len(want))
+	}
+	for epoch, w := range want {
+		if fees[epoch] == nil || fees[epoch].Int64() != w[0] || subsidies[epoch].Int64() != w[1] {
+			t.Errorf("Epoch %d: fee=%v subsidy=%v, want %d/%d", epoch, fees[epoch], subsidies[epoch], w[0], w[1])
+		}
+	}
+}
+
+// TestLedger_IssuanceByPair tests that per-pair issuance sums to the global total
+func TestLedger_IssuanceByPair(t *testing.T) {
+	ledger := NewLedger()
+	entries := []struct {
+		pairID         string
+		shardA, shardB int
+		r              int64
+	}{
+		{"a", 0, 1, 10},
+		{"b", 0, 1, 15},
+		{"c", 1, 0, 7},
+		{"d", 1, 0, 0},
+		{"e", 1, 0, 20},
+	}
+	for _, e := range entries {
+		ledger.Add(&Pending{
+			PairID:   e.pairID,
+			ShardA:   e.shardA,
+			ShardB:   e.shardB,
+			FAB:      big.NewInt(100),
+			R:        big.NewInt(e.r),
+			UtilityA: big.NewInt(50),
+			UtilityB: big.NewInt(50 + e.r),
+		})
+	}
+	creditFunc := func(shardID int, proposerID string, amount *big.Int) {}
+	for _, e := range entries {
+		if err := ledger.Settle(e.pairID, "block_B", creditFunc); err != nil {
+			t.Fatalf("Settle(%s) failed: %v", e.pairID, err)
+		}
+	}
+
+	byPair := ledger.IssuanceByPair()
+	if len(byPair) != 2 {
+		t.Fatalf("IssuanceByPair has %d pairs, want 2", len(byPair))
+	}
+	if r := byPair[[2]int{0, 1}]; r == nil || r.Int64() != 25 {
+		t.Errorf("Issuance 0->1 = %v, want 25", r)
+	}
+	if r := byPair[[2]int{1, 0}]; r == nil || r.Int64() != 27 {
+		t.Errorf("Issuance 1->0 = %v, want 27", r)
+	}
+
+	sum := new(big.Int)
+	for _, r := range byPair {
+		sum.Add(sum, r)
+	}
+	if total := ledger.TotalSubsidyIssued(); sum.Cmp(total) != 0 {
+		t.Errorf("Per-pair issuance sums to %s, want global total %s", sum, total)
+	}
+
+	ledger.Reset()
+	if len(ledger.IssuanceByPair()) != 0 {
+		t.Error("Reset should clear per-pair issuance")
+	}
+}
+
+// TestLedger_SetSettlementObserver tests that SetSettlementObserver replaces only its own observer,
+// leaving those added with AddSettlementObserver in place
+func TestLedger_SetSettlementObserver(t *testing.T) {
+	ledger := NewLedger()
+	for _, id := range []string{"a", "b", "c"} {
+		ledger.Add(&Pending{PairID: id, ShardA: 0, ShardB: 1, FAB: big.NewInt(100), R: big.NewInt(10),
+			UtilityA: big.NewInt(50), UtilityB: big.NewInt(60)})
+	}
+	creditFunc := func(shardID int, proposerID string, amount *big.Int) {}
+
+	var first, second, added int
+	ledger.AddSettlementObserver(func(epoch int, fee, subsidy *big.Int) { added++ })
+	ledger.SetSettlementObserver(func(epoch int, fee, subsidy *big.Int) { first++ })
+	_ = ledger.SettleInEpoch(0, "a", "block_B", creditFunc, nil)
+
+	ledger.SetSettlementObserver(func(epoch int, fee, subsidy *big.Int) { second++ })
+	_ = ledger.SettleInEpoch(0, "b", "block_B", creditFunc, nil)
+
+	ledger.SetSettlementObserver(nil)
+	_ = ledger.SettleInEpoch(0, "c", "block_B", creditFunc, nil)
+
+	if first != 1 || second != 1 || added != 3 {
+		t.Errorf("Observed first=%d second=%d added=%d, want 1/1/3", first, second, added)
+	}
+}
+
+// TestLedger_SettleBatch_CanonicalOrder tests that canonical settlement order ignores input order
+// and that observers see the batch epoch
+func TestLedger_SettleBatch_CanonicalOrder(t *testing.T) {
+	pairIDs := []string{"tx_a", "tx_b", "tx_c", "tx_d", "tx_e", "tx_f"}
+	run := func(input []string, canonical bool) []string {
+		ledger := NewLedger()
+		ledger.SetCanonicalSettleOrder(canonical)
+		for _, id := range pairIDs {
+			ledger.Add(&Pending{
+				PairID:   id,
+				ShardA:   0,
+				ShardB:   1,
+				FAB:      big.NewInt(100),
+				R:        big.NewInt(10),
+				UtilityA: big.NewInt(50),
+				UtilityB: big.NewInt(60),
+			})
+		}
+
+		var credited []string
+		creditFunc := func(shardID int, proposerID string, amount *big.Int) {
+			if shardID == 1 {
+				credited = append(credited, proposerID)
+			}
+		}
+		var epochs []int
+		ledger.AddSettlementObserver(func(epoch int, fee, subsidy *big.Int) {
+			epochs = append(epochs, epoch)
+		})
+		settled, failed := ledger.SettleBatch(7, append(input, "missing"), "block_B", creditFunc, nil)
+		if len(failed) != 1 || failed["missing"] == nil {
+			t.Errorf("Expected only the unknown PairID to fail, got %v", failed)
+		}
+		for _, epoch := range epochs {
+			if epoch != 7 {
+				t.Errorf("Observer saw epoch %d, want the batch epoch 7", epoch)
+			}
+		}
+		if len(epochs) != len(settled) {
+			t.Errorf("Observed %d settlements, reported %d", len(epochs), len(settled))
+		}
+		if len(credited) != len(settled) {
+			t.Errorf("Credited %d settlements, reported %d", len(credited), len(settled))
+		}
+		return settled
+	}
+
+	reversed := make([]string, len(pairIDs))
+	for i, id := range pairIDs {
+		reversed[len(pairIDs)-1-i] = id
+	}
+
+	// Input order is preserved by default
+	if got := run(reversed, false); fmt.Sprint(got) != fmt.Sprint(reversed) {
+		t.Errorf("Default order = %v, want input order %v", got, reversed)
+	}
+
+	// Canonical order is the same for any input order and across runs
+	first := run(pairIDs, true)
+	if len(first) != len(pairIDs) {
+		t.Fatalf("Settled %d entries, want %d", len(first), len(pairIDs))
+	}
+	for i := 0; i < 3; i++ {
+		if got := run(reversed, true); fmt.Sprint(got) != fmt.Sprint(first) {
+			t.Errorf("Run %d canonical order = %v, want %v", i, got, first)
+		}
+	}
+	if fmt.Sprint(first) != fmt.Sprint(canonicalSettleOrder(reversed)) {
+		t.Errorf("Settled order %v does not match canonicalSettleOrder", first)
+	}
+}
+
+// TestLedger_SnapshotRestore tests restoring a version-1 blob and rejecting an unknown version
+func TestLedger_SnapshotRestore(t *testing.T) {
+	blob := []byte(`{"kind":"pending.ledger","version":1,"state":{` +
+		`"pending":[{"PairID":"tx1","ShardA":0,"ShardB":1,"FAB":100,"R":50}],` +
+		`"settled":["tx0"],"settle_count":1,"subsidy_issued":30,` +
+		`"issuance_by_pair":[{"shard_a":0,"shard_b":1,"amount":30}]}}`)
+
+	ledger := NewLedger()
+	if err := ledger.Restore(blob); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	p, ok := ledger.Get("tx1")
+	if !ok || p.R.Int64() != 50 {
+		t.Fatalf("pending tx1 not restored: %+v", p)
+	}
+	if !ledger.IsSettled("tx0") || ledger.SettlementCount() != 1 {
+		t.Error("settled state not restored")
+	}
+	if got := ledger.IssuanceByPair()[[2]int{0, 1}]; got == nil || got.Int64() != 30 {
+		t.Errorf("issuance for (0,1) = %v, want 30", got)
+	}
+
+	// Round trip through Snapshot
+	data, err := ledger.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	restored := NewLedger()
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Restore(Snapshot()): %v", err)
+	}
+	if restored.GetPendingCount() != 1 || restored.GetSettledCount() != 1 {
+		t.Errorf("round trip: pending %d, settled %d", restored.GetPendingCount(), restored.GetSettledCount())
+	}
+
+	// Unknown version is rejected and the ledger is left as it was
+	bad := []byte(`{"kind":"pending.ledger","version":2,"state":{"pending":[]}}`)
+	if err := restored.Restore(bad); !errors.Is(err, snapshot.ErrVersionMismatch) {
+		t.Errorf("Restore(v2) err = %v, want ErrVersionMismatch", err)
+	}
+	if restored.GetPendingCount() != 1 {
+		t.Error("rejected restore modified the ledger")
+	}
+}
+
+// TestLedger_MaxPending tests that Add applies backpressure at the limit until entries settle
+func TestLedger_MaxPending(t *testing.T) {
+	ledger := NewLedger()
+	ledger.SetMaxPending(3)
+
+	newPending := func(id string) *Pending {
+		return &Pending{
+			PairID:   id,
+			ShardA:   0,
+			ShardB:   1,
+			FAB:      big.NewInt(100),
+			R:        big.NewInt(50),
+			EA:       big.NewInt(80),
+			EB:       big.NewInt(70),
+			UtilityA: big.NewInt(75),
+			UtilityB: big.NewInt(75),
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := ledger.Add(newPending(fmt.Sprintf("tx%d", i))); err != nil {
+			t.Fatalf("Add(tx%d) below the limit: %v", i, err)
+		}
+	}
+	for i := 3; i < 5; i++ {
+		if err := ledger.Add(newPending(fmt.Sprintf("tx%d", i))); !errors.Is(err, ErrLedgerFull) {
+			t.Errorf("Add(tx%d) at the limit err = %v, want ErrLedgerFull", i, err)
+		}
+	}
+
+	// A duplicate is still reported as a duplicate, not as backpressure
+	if err := ledger.Add(newPending("tx0")); err == nil || errors.Is(err, ErrLedgerFull) {
+		t.Errorf("duplicate Add err = %v, want already-pending error", err)
+	}
+
+	noCredit := func(shardID int, proposerID string, amount *big.Int) {}
+	if err := ledger.Settle("tx0", "block_B_1", noCredit); err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if err := ledger.Add(newPending("tx3")); err != nil {
+		t.Errorf("Add after settlement freed a slot: %v", err)
+	}
+	if err := ledger.Add(newPending("tx4")); !errors.Is(err, ErrLedgerFull) {
+		t.Errorf("Add(tx4) err = %v, want ErrLedgerFull", err)
+	}
+
+	// Removing the bound accepts new entries again
+	ledger.SetMaxPending(0)
+	if err := ledger.Add(newPending("tx4")); err != nil {
+		t.Errorf("Add with no bound: %v", err)
+	}
+}
+
+// TestLedger_NilAmountsAndDeepCopies tests nil big.Int fields settle as zero and GetAllPending deep-copies
+func TestLedger_NilAmountsAndDeepCopies(t *testing.T) {
+	ledger := NewLedger()
+	if err := ledger.Add(&Pending{PairID: "nil-amounts", ShardA: 0, ShardB: 1}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	credited := make(map[int]*big.Int)
+	creditFunc := func(shardID int, proposerID string, amount *big.Int) {
+		credited[shardID] = amount
+	}
+	if err := ledger.Settle("nil-amounts", "block_B_1", creditFunc); err != nil {
+		t.Fatalf("Settle with nil amounts: %v", err)
+	}
+	if credited[0] == nil || credited[0].Sign() != 0 || credited[1] == nil || credited[1].Sign() != 0 {
+		t.Errorf("nil utilities should be credited as zero, got %v", credited)
+	}
+	if err := ledger.Settle("nil-amounts", "block_B_2", creditFunc); err == nil {
+		t.Error("second settlement should still fail")
+	}
+
+	ledger.Add(&Pending{PairID: "copy", ShardA: 0, ShardB: 1, FAB: big.NewInt(100), R: big.NewInt(50)})
+	all := ledger.GetAllPending()
+	all[0].FAB.SetInt64(1)
+	all[0].R.SetInt64(1)
+	if stats := ledger.GetStats(); stats.TotalFees.Int64() != 100 || stats.TotalSubsidy.Int64() != 50 {
+		t.Errorf("mutating GetAllPending results changed the ledger: fees %v, subsidy %v", stats.TotalFees, stats.TotalSubsidy)
+	}
+}
+
+// TestLedger_SettleExpired tests that stale entries refund f_AB to the source proposer and void R
+func TestLedger_SettleExpired(t *testing.T) {
+	ledger := NewLedger()
+	ledger.Add(&Pending{PairID: "stale", ShardA: 0, ShardB: 1, FAB: big.NewInt(100), R: big.NewInt(50),
+		UtilityA: big.NewInt(75), UtilityB: big.NewInt(75), SourceBlockID: "A1", CreatedAt: 100})
+	ledger.Add(&Pending{PairID: "fresh", ShardA: 0, ShardB: 1, FAB: big.NewInt(100), R: big.NewInt(50),
+		UtilityA: big.NewInt(75), UtilityB: big.NewInt(75), SourceBlockID: "A2", CreatedAt: 300})
+
+	refunds := make(map[int]*big.Int)
+	refundFunc := func(shardID int, proposerID string, amount *big.Int) {
+		if refunds[shardID] == nil {
+			refunds[shardID] = new(big.Int)
+		}
+		refunds[shardID].Add(refunds[shardID], amount)
+	}
+
+	if n := ledger.SettleExpired(200, refundFunc); n != 1 {
+		t.Fatalf("SettleExpired expired %d entries, want 1", n)
+	}
+	if refunds[0] == nil || refunds[0].Int64() != 100 || refunds[1] != nil {
+		t.Errorf("refunds = %v, want only f_AB = 100 to shard 0", refunds)
+	}
+	if !ledger.IsExpired("stale") || ledger.IsExpired("fresh") || ledger.GetExpiredCount() != 1 {
+		t.Error("expired state not tracked correctly")
+	}
+	if ledger.GetPendingCount() != 1 || ledger.TotalSubsidyIssued().Sign() != 0 {
+		t.Errorf("pending %d, issued %v; want 1 pending and no subsidy issued", ledger.GetPendingCount(), ledger.TotalSubsidyIssued())
+	}
+
+	// An expired pair can neither settle nor be re-added
+	noCredit := func(shardID int, proposerID string, amount *big.Int) {}
+	if err := ledger.Settle("stale", "B1", noCredit); err == nil {
+		t.Error("settling an expired pair should fail")
+	}
+	if err := ledger.Add(&Pending{PairID: "stale"}); err == nil {
+		t.Error("re-adding an expired pair should fail")
+	}
+}
+
+func TestLedger_Subscribe(t *testing.T) {
+	ledger := NewLedger()
+	events := ledger.Subscribe()
+	noCredit := func(shardID int, proposerID string, amount *big.Int) {}
+
+	for i, id := range []string{"tx1", "tx2"} {
+		ledger.Add(&Pending{PairID: id, ShardA: 0, ShardB: 1, FAB: big.NewInt(100), R: big.NewInt(int64(10 * (i + 1))),
+			UtilityA: big.NewInt(60), UtilityB: big.NewInt(int64(40 + 10*(i+1))), CreatedAt: 100})
+		if err := ledger.Settle(id, "B1", noCredit); err != nil {
+			t.Fatalf("Settle(%s): %v", id, err)
+		}
+	}
+	for i, id := range []string{"tx1", "tx2"} {
+		ev := <-events
+		if ev.Kind != SettleEventSettled || ev.PairID != id || ev.ShardA != 0 || ev.ShardB != 1 {
+			t.Errorf("event %d = %+v, want settled %s 0->1", i, ev, id)
+		}
+		if ev.R.Int64() != int64(10*(i+1)) || ev.FAB.Int64() != 100 || ev.UtilityA.Int64() != 60 {
+			t.Errorf("event %d amounts: R=%v FAB=%v uA=%v", i, ev.R, ev.FAB, ev.UtilityA)
+		}
+	}
+
+	// Expiry is published too; entries with nil amounts report zero
+	ledger.Add(&Pending{PairID: "stale", ShardA: 1, ShardB: 0, CreatedAt: 50})
+	ledger.SettleExpired(100, nil)
+	if ev := <-events; ev.Kind != SettleEventExpired || ev.PairID != "stale" || ev.R == nil || ev.R.Sign() != 0 {
+		t.Errorf("expiry event = %+v, want expired stale with zero R", ev)
+	}
+
+	// A subscriber that never reads loses events instead of blocking settlement
+	slow := ledger.Subscribe()
+	for i := 0; i < settleEventBuffer+5; i++ {
+		id := fmt.Sprintf("bulk%d", i)
+		ledger.Add(&Pending{PairID: id, ShardA: 0, ShardB: 1})
+		ledger.Settle(id, "B2", noCredit)
+		<-events
+	}
+	if got := ledger.DroppedEvents(); got != 5 {
+		t.Errorf("DroppedEvents = %d, want 5", got)
+	}
+
+	ledger.Unsubscribe(events)
+	if _, ok := <-events; ok {
+		t.Error("unsubscribed channel should be closed")
+	}
+	ledger.Reset()
+	for range slow {
+	}
+	if ledger.DroppedEvents() != 0 {
+		t.Error("Reset should clear the dropped counter")
+	}
+	ledger.Reset() // No subscribers left; closing twice must not panic
+}
@@ -0,0 +1,117 @@
+package pending
+
+import (
+	"math/big"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"blockEmulator/utils/snapshot"
+)
+
+const (
+	// LedgerSnapshotKind tags Ledger snapshots in their envelope
+	LedgerSnapshotKind = "pending.ledger"
+	// LedgerSnapshotVersion is the format written by Snapshot; bump it (and register a
+	// snapshot.Migration from the previous version) whenever ledgerSnapshot changes
+	LedgerSnapshotVersion = 1
+)
+
+// pairIssuance is one issuanceByPair entry (array map keys do not serialize to JSON)
+type pairIssuance struct {
+	ShardA int      `json:"shard_a"`
+	ShardB int      `json:"shard_b"`
+	Amount *big.Int `json:"amount"`
+}
+
+// ledgerSnapshot is the serialized ledger; the settlement-rate ring buffer is not kept
+type ledgerSnapshot struct {
+	Pending        []*Pending     `json:"pending"`
+	Settled        []string       `json:"settled"`
+	Expired        []string       `json:"expired,omitempty"`
+	SettleCount    uint64         `json:"settle_count"`
+	SubsidyIssued  *big.Int       `json:"subsidy_issued"`
+	IssuanceByPair []pairIssuance `json:"issuance_by_pair"`
+}
+
+// Snapshot serializes pending entries, settled PairIDs and issuance totals into a versioned blob
+func (l *Ledger) Snapshot() ([]byte, error) {
+	l.mu.RLock()
+	s := ledgerSnapshot{
+		Pending:       make([]*Pending, 0, len(l.pending)),
+		Settled:       make([]string, 0, len(l.settled)),
+		SettleCount:   atomic.LoadUint64(&l.settleCount),
+		SubsidyIssued: new(big.Int).Set(l.subsidyIssued),
+	}
+	for _, p := range l.pending {
+		s.Pending = append(s.Pending, p)
+	}
+	for id := range l.settled {
+		s.Settled = append(s.Settled, id)
+	}
+	for id := range l.expired {
+		s.Expired = append(s.Expired, id)
+	}
+	for pair, amount := range l.issuanceByPair {
+		s.IssuanceByPair = append(s.IssuanceByPair, pairIssuance{ShardA: pair[0], ShardB: pair[1], Amount: new(big.Int).Set(amount)})
+	}
+	l.mu.RUnlock()
+
+	// Deterministic output for identical ledgers
+	sort.Slice(s.Pending, func(i, j int) bool { return s.Pending[i].PairID < s.Pending[j].PairID })
+	sort.Strings(s.Settled)
+	sort.Strings(s.Expired)
+	sort.Slice(s.IssuanceByPair, func(i, j int) bool {
+		a, b := s.IssuanceByPair[i], s.IssuanceByPair[j]
+		if a.ShardA != b.ShardA {
+			return a.ShardA < b.ShardA
+		}
+		return a.ShardB < b.ShardB
+	})
+	return snapshot.Encode(LedgerSnapshotKind, LedgerSnapshotVersion, s)
+}
+
+// Restore replaces the ledger contents with a blob produced by Snapshot
+// An unknown version returns snapshot.ErrVersionMismatch and leaves the ledger untouched
+func (l *Ledger) Restore(data []byte) error {
+	var s ledgerSnapshot
+	if err := snapshot.Decode(data, LedgerSnapshotKind, LedgerSnapshotVersion, &s); err != nil {
+		return err
+	}
+
+	pendingMap := make(map[string]*Pending, len(s.Pending))
+	for _, p := range s.Pending {
+		if p != nil {
+			pendingMap[p.PairID] = p
+		}
+	}
+	settled := make(map[string]bool, len(s.Settled))
+	for _, id := range s.Settled {
+		settled[id] = true
+	}
+	expired := make(map[string]bool, len(s.Expired))
+	for _, id := range s.Expired {
+		expired[id] = true
+	}
+	byPair := make(map[[2]int]*big.Int, len(s.IssuanceByPair))
+	for _, e := range s.IssuanceByPair {
+		if e.Amount != nil {
+			byPair[[2]int{e.ShardA, e.ShardB}] = e.Amount
+		}
+	}
+	if s.SubsidyIssued == nil {
+		s.SubsidyIssued = new(big.Int)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = pendingMap
+	l.settled = settled
+	l.expired = expired
+	atomic.StoreUint64(&l.settleCount, s.SettleCount)
+	l.settleTimes = [settlementRingSize]time.Time{}
+	l.settleHead = 0
+	l.subsidyIssued = s.SubsidyIssued
+	l.issuanceByPair = byPair
+	return nil
+}
@@ -3,12 +3,16 @@ package subsidy_budget
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
 )
 
 // Budget defines the per-block subsidy constraints
 type Budget struct {
-	Bmin uint64 // Minimum total subsidy per block
-	Bmax uint64 // Maximum total subsidy per block
+	Bmin      uint64 // Minimum total subsidy per block
+	Bmax      uint64 // Maximum total subsidy per block
+	Tolerance uint64 // Absolute slack around the bounds within which no scaling is applied
 }
 
 // NewBudget creates a new subsidy budget with min and max limits
@@ -37,22 +41,24 @@ type ScalingFactor struct {
 // - If sumR < Bmin: scale up proportionally (num > den)
 // - If Bmin <= sumR <= Bmax: no scaling (num = den = 1)
 // - If no budget limits set (Bmax = 0): no scaling
+// - Tolerance widens the no-scaling band to [Bmin - Tolerance, Bmax + Tolerance],
+//   avoiding scaling churn from rounding-sized overshoots
 func (b *Budget) Apply(sumR uint64) ScalingFactor {
 	// No budget limits
 	if b.Bmax == 0 {
 		return ScalingFactor{Num: 1, Den: 1}
 	}
 
-	// Sum exceeds maximum: scale down
-	if sumR > b.Bmax {
+	// Sum exceeds maximum beyond tolerance: scale down
+	if sumR > b.Bmax && sumR-b.Bmax > b.Tolerance {
 		return ScalingFactor{
 			Num: b.Bmax,
 			Den: sumR,
 		}
 	}
 
-	// Sum below minimum: scale up (if Bmin is set)
-	if b.Bmin > 0 && sumR < b.Bmin && sumR > 0 {
+	// Sum below minimum beyond tolerance: scale up (if Bmin is set)
+	if b.Bmin > 0 && sumR < b.Bmin && sumR > 0 && b.Bmin-sumR > b.Tolerance {
 		return ScalingFactor{
 			Num: b.Bmin,
 			Den: sumR,
@@ -63,14 +69,34 @@ func (b *Budget) Apply(sumR uint64) ScalingFactor {
 	return ScalingFactor{Num: 1, Den: 1}
 }
 
+// ScaleSubsidyBig applies the scaling factor to a single subsidy value of any size,
+// returning R * Num / Den (rounded down) as a new big.Int. nil R is treated as zero
+func (sf ScalingFactor) ScaleSubsidyBig(R *big.Int) *big.Int {
+	if R == nil {
+		return big.NewInt(0)
+	}
+	if sf.Den == 0 {
+		return new(big.Int).Set(R)
+	}
+	scaled := new(big.Int).Mul(R, new(big.Int).SetUint64(sf.Num))
+	return scaled.Quo(scaled, new(big.Int).SetUint64(sf.Den))
+}
+
 // ScaleSubsidy applies the scaling factor to a single subsidy value
+// The product is formed in 128 bits, so it is exact whenever the result fits in a uint64;
+// larger results saturate at math.MaxUint64 (use ScaleSubsidyBig to get them exactly)
 func (sf ScalingFactor) ScaleSubsidy(R uint64) uint64 {
 	if sf.Den == 0 {
 		return R
 	}
-	// Perform multiplication first to maintain precision, then divide
-	// Be careful of overflow for very large values
-	return (R * sf.Num) / sf.Den
+	// Multiply into 128 bits first to maintain precision, then divide
+	hi, lo := bits.Mul64(R, sf.Num)
+	if hi >= sf.Den {
+		// Quotient does not fit in 64 bits (only possible when scaling up)
+		return math.MaxUint64
+	}
+	q, _ := bits.Div64(hi, lo, sf.Den)
+	return q
 }
 
 // IsScalingNeeded returns true if scaling will be applied
@@ -133,13 +159,15 @@ func (cfg *BudgetConfig) ToBudget() (*Budget, error) {
 // Returns: scaled subsidies and the scaling factor used
 func ApplyBudgetToBlock(budget *Budget, subsidies []uint64) ([]uint64, ScalingFactor) {
 	// Calculate sum of all subsidies
-	var sumR uint64
-	for _, r := range subsidies {
-		sumR += r
-	}
+	sum := sumSubsidies(subsidies)
 
 	// Get scaling factor
-	sf := budget.Apply(sumR)
+	var sf ScalingFactor
+	if sum.IsUint64() {
+		sf = budget.Apply(sum.Uint64())
+	} else {
+		sf = overflowScaling(budget, sum)
+	}
 
 	// If no scaling needed, return original
 	if !sf.IsScalingNeeded() {
@@ -155,3 +183,156 @@ func ApplyBudgetToBlock(budget *Budget, subsidies []uint64) ([]uint64, ScalingFa
 	return scaled, sf
 }
 
+
+// sumSubsidies returns the exact sum of subsidies, which may exceed a uint64
+func sumSubsidies(subsidies []uint64) *big.Int {
+	sum := new(big.Int)
+	for _, r := range subsidies {
+		sum.Add(sum, new(big.Int).SetUint64(r))
+	}
+	return sum
+}
+
+// overflowScaling returns a factor of at most Bmax/sum for a sum that does not fit in a uint64
+func overflowScaling(budget *Budget, sum *big.Int) ScalingFactor {
+	if budget.Bmax == 0 {
+		return ScalingFactor{Num: 1, Den: 1}
+	}
+	return ratioScaling(budget.Bmax, sum)
+}
+
+// ratioScaling returns the factor target/sum. A sum that does not fit in a uint64 is shifted
+// into 64 bits together with target, rounding the numerator down and the denominator up so the
+// factor never exceeds target/sum. If target does not survive the shift, the smallest nonzero
+// factor 1/MaxUint64 is used rather than Num = 0
+func ratioScaling(target uint64, sum *big.Int) ScalingFactor {
+	if sum.IsUint64() {
+		return ScalingFactor{Num: target, Den: sum.Uint64()}
+	}
+	shift := uint(sum.BitLen() - 63)
+	num := target >> shift
+	if num == 0 {
+		return ScalingFactor{Num: 1, Den: math.MaxUint64}
+	}
+	den := new(big.Int).Rsh(sum, shift)
+	return ScalingFactor{Num: num, Den: den.Uint64() + 1}
+}
+
+// ApplySoftCap applies a progressive cap to a set of subsidies instead of hard clipping
+// Below softThreshold the aggregate is passed through unchanged. Above it, the excess x = sumR - soft
+// is compressed as soft + band * x / (x + band), where band = hardMax - soft, so the reduction grows
+// smoothly with the excess and the aggregate approaches but never exceeds hardMax.
+// If hardMax <= softThreshold this degrades to proportional hard scaling at hardMax.
+// hardMax = 0 means no limit. Always returns a new slice; the input is not modified
+func ApplySoftCap(subsidies []uint64, softThreshold, hardMax uint64) []uint64 {
+	if hardMax == 0 {
+		return append([]uint64(nil), subsidies...)
+	}
+
+	sumR := sumSubsidies(subsidies)
+
+	// Degenerate band: behave like the hard cap
+	if hardMax <= softThreshold {
+		if sumR.Cmp(new(big.Int).SetUint64(hardMax)) <= 0 {
+			return append([]uint64(nil), subsidies...)
+		}
+		return scaleAll(subsidies, ratioScaling(hardMax, sumR))
+	}
+
+	soft := new(big.Int).SetUint64(softThreshold)
+	if sumR.Cmp(soft) <= 0 {
+		return append([]uint64(nil), subsidies...)
+	}
+
+	// target = soft + band * x / (x + band), computed in big.Int to avoid overflow
+	band := new(big.Int).SetUint64(hardMax - softThreshold)
+	excess := new(big.Int).Sub(sumR, soft)
+	compressed := new(big.Int).Mul(band, excess)
+	compressed.Div(compressed, new(big.Int).Add(excess, band))
+	target := softThreshold + compressed.Uint64() // compressed < band, so target < hardMax
+
+	return scaleAll(subsidies, ratioScaling(target, sumR))
+}
+
+// scaleAll applies a scaling factor to every subsidy, returning a new slice
+func scaleAll(subsidies []uint64, sf ScalingFactor) []uint64 {
+	scaled := make([]uint64, len(subsidies))
+	for i, r := range subsidies {
+		scaled[i] = sf.ScaleSubsidy(r)
+	}
+	return scaled
+}
+
+// DualCap enforces a per-transaction and a per-block subsidy maximum together (0 = no limit)
+type DualCap struct {
+	PerTx    uint64 // Maximum subsidy for any single CTX
+	PerBlock uint64 // Maximum aggregate subsidy for the block
+}
+
+// ApplyDualCap clamps each subsidy to PerTx, then scales all of them down proportionally
+// if the clamped sum still exceeds PerBlock. Returns a new slice; the input is not modified
+func (c DualCap) ApplyDualCap(subsidies []uint64) []uint64 {
+	clamped := make([]uint64, len(subsidies))
+	for i, r := range subsidies {
+		if c.PerTx > 0 && r > c.PerTx {
+			r = c.PerTx
+		}
+		clamped[i] = r
+	}
+
+	sumR := sumSubsidies(clamped)
+	if c.PerBlock == 0 || sumR.Cmp(new(big.Int).SetUint64(c.PerBlock)) <= 0 {
+		return clamped
+	}
+	return scaleAll(clamped, ratioScaling(c.PerBlock, sumR))
+}
+
+// BlockBudgetTracker admits subsidies one at a time against a block's Bmax, for callers that
+// see a block's CTX incrementally instead of as one slice (cf. ApplyBudgetToBlock). Admission
+// is greedy: each subsidy is capped to what is left, so the running sum never exceeds Bmax.
+// The running sum is kept per block and restarts when a different block height is seen
+type BlockBudgetTracker struct {
+	budget *Budget
+	block  uint64 // Height the running sum belongs to
+	spent  uint64 // Subsidy admitted so far in block
+}
+
+// NewBlockBudgetTracker creates a tracker for budget (nil or Bmax = 0 admits everything)
+func NewBlockBudgetTracker(budget *Budget) *BlockBudgetTracker {
+	return &BlockBudgetTracker{budget: budget}
+}
+
+// Admit records a subsidy R for the tx selected into block and returns the part of R that fits
+// into the block's remaining budget (R itself if unlimited, 0 once the budget is exhausted)
+func (t *BlockBudgetTracker) Admit(block uint64, R uint64) uint64 {
+	if block != t.block {
+		t.block = block
+		t.spent = 0
+	}
+	if remaining := t.Remaining(); R > remaining {
+		R = remaining
+	}
+	t.spent += R
+	return R
+}
+
+// Remaining returns the budget left in the current block (math.MaxUint64 - spent if unlimited)
+func (t *BlockBudgetTracker) Remaining() uint64 {
+	if t.budget == nil || t.budget.Bmax == 0 {
+		return math.MaxUint64 - t.spent
+	}
+	if t.spent >= t.budget.Bmax {
+		return 0
+	}
+	return t.budget.Bmax - t.spent
+}
+
+// Spent returns the subsidy admitted in the current block
+func (t *BlockBudgetTracker) Spent() uint64 {
+	return t.spent
+}
+
+// Block returns the height of the block the running sum belongs to
+func (t *BlockBudgetTracker) Block() uint64 {
+	return t.block
+}
@@ -1,6 +1,8 @@
 package subsidy_budget
 
 import (
+	"math"
+	"math/big"
 	"testing"
 )
 
@@ -70,7 +72,7 @@ func TestBudget_Apply_ScaleDown(t *testing.T) {
 	// Test actual scaling
 	R := uint64(200)
 	scaled := sf.ScaleSubsidy(R)
-	expected := (200 * 1000) / 2000 // = 100
+	expected := uint64((200 * 1000) / 2000) // = 100
 	if scaled != expected {
 		t.Errorf("Scaled subsidy should be %d, got %d", expected, scaled)
 	}
@@ -92,7 +94,7 @@ func TestBudget_Apply_ScaleUp(t *testing.T) {
 	// Test actual scaling
 	R := uint64(100)
 	scaled := sf.ScaleSubsidy(R)
-	expected := (100 * 1000) / 500 // = 200
+	expected := uint64((100 * 1000) / 500) // = 200
 	if scaled != expected {
 		t.Errorf("Scaled subsidy should be %d, got %d", expected, scaled)
 	}
@@ -147,6 +149,45 @@ func TestScalingFactor_ScaleSubsidy(t *testing.T) {
 	if scaled != expected {
 		t.Errorf("Expected %d, got %d", expected, scaled)
 	}
+
+	// R * Num exceeds 64 bits: 1e14 wei scaled by 1e16/2e16 must still be exact
+	sf = ScalingFactor{Num: 1e16, Den: 2e16}
+	if scaled = sf.ScaleSubsidy(1e14); scaled != 5e13 {
+		t.Errorf("Expected 5e13 for a 128-bit intermediate, got %d", scaled)
+	}
+}
+
+// TestScalingFactor_ScaleSubsidyBig tests exact scaling of ETH-scale subsidies whose product overflows 64 bits
+func TestScalingFactor_ScaleSubsidyBig(t *testing.T) {
+	// R close to 1 ETH scaled by a block-sum-sized factor: R * Num is about 9e35
+	R := new(big.Int).SetUint64(999999999999999999)
+	sf := ScalingFactor{Num: 900000000000000000, Den: 1700000000000000003}
+
+	want := new(big.Int).Mul(R, new(big.Int).SetUint64(sf.Num))
+	want.Quo(want, new(big.Int).SetUint64(sf.Den))
+	if got := sf.ScaleSubsidyBig(R); got.Cmp(want) != 0 {
+		t.Errorf("ScaleSubsidyBig = %s, want %s", got, want)
+	}
+	if got := sf.ScaleSubsidy(R.Uint64()); got != want.Uint64() {
+		t.Errorf("ScaleSubsidy = %d, want %s", got, want)
+	}
+
+	// Scaling up past 64 bits is exact with big.Int and saturates with uint64
+	up := ScalingFactor{Num: 20, Den: 1}
+	wantUp, _ := new(big.Int).SetString("19999999999999999980", 10)
+	if got := up.ScaleSubsidyBig(R); got.Cmp(wantUp) != 0 {
+		t.Errorf("ScaleSubsidyBig (up) = %s, want %s", got, wantUp)
+	}
+	if got := up.ScaleSubsidy(R.Uint64()); got != math.MaxUint64 {
+		t.Errorf("ScaleSubsidy (up) = %d, want saturation at MaxUint64", got)
+	}
+
+	if got := sf.ScaleSubsidyBig(nil); got.Sign() != 0 {
+		t.Errorf("ScaleSubsidyBig(nil) = %s, want 0", got)
+	}
+	if got := (ScalingFactor{}).ScaleSubsidyBig(R); got.Cmp(R) != 0 || got == R {
+		t.Errorf("Zero denominator should return a copy of R, got %s", got)
+	}
 }
 
 // TestScalingFactor_String tests string representation
@@ -292,3 +333,266 @@ func BenchmarkScalingFactor_ScaleSubsidy(b *testing.B) {
 	}
 }
 
+
+// sumOf returns the aggregate of a subsidy slice
+func sumOf(subsidies []uint64) uint64 {
+	var sum uint64
+	for _, s := range subsidies {
+		sum += s
+	}
+	return sum
+}
+
+// TestApplySoftCap_BelowSoft tests that subsidies below the soft threshold pass unchanged
+func TestApplySoftCap_BelowSoft(t *testing.T) {
+	subsidies := []uint64{100, 150, 200}
+	capped := ApplySoftCap(subsidies, 500, 1000)
+	for i, s := range capped {
+		if s != subsidies[i] {
+			t.Errorf("Index %d: expected %d, got %d", i, subsidies[i], s)
+		}
+	}
+
+	// hardMax = 0 means no limit
+	capped = ApplySoftCap([]uint64{5000}, 500, 0)
+	if capped[0] != 5000 {
+		t.Errorf("No limit: expected 5000, got %d", capped[0])
+	}
+}
+
+// TestApplySoftCap_VersusHardScaling compares the soft-cap curve against proportional hard scaling
+func TestApplySoftCap_VersusHardScaling(t *testing.T) {
+	soft, hard := uint64(500), uint64(1000)
+	b, _ := NewBudget(0, hard)
+
+	var prevSoftSum uint64
+	for sumR := uint64(100); sumR <= 5000; sumR += 100 {
+		subsidies := []uint64{sumR / 4, sumR / 4, sumR / 2}
+
+		softSum := sumOf(ApplySoftCap(subsidies, soft, hard))
+		hardScaled, _ := ApplyBudgetToBlock(b, subsidies)
+		hardSum := sumOf(hardScaled)
+
+		if softSum > hard {
+			t.Errorf("sumR=%d: soft cap aggregate %d exceeds hardMax %d", sumR, softSum, hard)
+		}
+		if sumR <= soft && softSum != sumR {
+			t.Errorf("sumR=%d: expected pass-through below soft threshold, got %d", sumR, softSum)
+		}
+		// Soft cap starts taxing earlier, so it never pays more than hard clipping
+		if softSum > hardSum {
+			t.Errorf("sumR=%d: soft cap aggregate %d exceeds hard-scaled aggregate %d", sumR, softSum, hardSum)
+		}
+		// The curve is monotonic: more requested subsidy never yields less paid subsidy
+		if softSum < prevSoftSum {
+			t.Errorf("sumR=%d: soft cap aggregate decreased from %d to %d", sumR, prevSoftSum, softSum)
+		}
+		prevSoftSum = softSum
+	}
+
+	// Just past the soft threshold the reduction is small; hard scaling applies none yet
+	justAbove := sumOf(ApplySoftCap([]uint64{600}, soft, hard))
+	if justAbove >= 600 || justAbove < 580 {
+		t.Errorf("Expected mild reduction just above soft threshold, got %d", justAbove)
+	}
+}
+
+// TestApplySoftCap_DegenerateBand tests hard scaling when hardMax <= softThreshold
+func TestApplySoftCap_DegenerateBand(t *testing.T) {
+	capped := ApplySoftCap([]uint64{300, 400, 300}, 800, 500)
+	if sum := sumOf(capped); sum > 500 || sum < 500-3 {
+		t.Errorf("Expected aggregate ~500, got %d", sum)
+	}
+}
+
+// TestBudget_Apply_Tolerance tests that overshoots within tolerance are not scaled
+func TestBudget_Apply_Tolerance(t *testing.T) {
+	b, _ := NewBudget(100, 1000)
+	b.Tolerance = 10
+
+	tests := []struct {
+		name        string
+		sumR        uint64
+		wantScaling bool
+	}{
+		{"1 wei over Bmax", 1001, false},
+		{"at Bmax + tolerance", 1010, false},
+		{"beyond tolerance", 1011, true},
+		{"large overshoot", 2000, true},
+		{"slightly under Bmin", 95, false},
+		{"well under Bmin", 50, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sf := b.Apply(tt.sumR)
+			if sf.IsScalingNeeded() != tt.wantScaling {
+				t.Errorf("Apply(%d) scaling = %v, want %v (factor %s)", tt.sumR, sf.IsScalingNeeded(), tt.wantScaling, sf)
+			}
+		})
+	}
+
+	// Without tolerance, 1 wei over Bmax is scaled
+	b.Tolerance = 0
+	if sf := b.Apply(1001); !sf.IsScalingNeeded() {
+		t.Error("Expected scaling for 1 wei over Bmax with zero tolerance")
+	}
+}
+
+// TestDualCap_ApplyDualCap tests the per-tx and per-block caps separately and together
+func TestDualCap_ApplyDualCap(t *testing.T) {
+	tests := []struct {
+		name      string
+		cap       DualCap
+		subsidies []uint64
+		want      []uint64
+	}{
+		{"no limits", DualCap{}, []uint64{100, 200}, []uint64{100, 200}},
+		{"only per-tx binds", DualCap{PerTx: 150, PerBlock: 1000}, []uint64{100, 200, 300}, []uint64{100, 150, 150}},
+		{"only per-block binds", DualCap{PerTx: 1000, PerBlock: 300}, []uint64{100, 200, 300}, []uint64{50, 100, 150}},
+		// Clamped to {100, 150, 150} = 400, then scaled by 200/400
+		{"both bind", DualCap{PerTx: 150, PerBlock: 200}, []uint64{100, 200, 300}, []uint64{50, 75, 75}},
+	}
+	for _, tt := range tests {
+		input := append([]uint64(nil), tt.subsidies...)
+		got := tt.cap.ApplyDualCap(input)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %d subsidies, want %d", tt.name, len(got), len(tt.want))
+		}
+		var sum uint64
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: subsidy[%d] = %d, want %d", tt.name, i, got[i], tt.want[i])
+			}
+			if tt.cap.PerTx > 0 && got[i] > tt.cap.PerTx {
+				t.Errorf("%s: subsidy[%d] = %d exceeds PerTx %d", tt.name, i, got[i], tt.cap.PerTx)
+			}
+			sum += got[i]
+		}
+		if tt.cap.PerBlock > 0 && sum > tt.cap.PerBlock {
+			t.Errorf("%s: sum %d exceeds PerBlock %d", tt.name, sum, tt.cap.PerBlock)
+		}
+		for i := range input {
+			if input[i] != tt.subsidies[i] {
+				t.Errorf("%s: input modified", tt.name)
+				break
+			}
+		}
+	}
+}
+
+// TestApplyBudgetToBlock_SumOverflow tests that subsidies summing past 2^64 still respect Bmax
+func TestApplyBudgetToBlock_SumOverflow(t *testing.T) {
+	budget, _ := NewBudget(0, 1e18)
+	subsidies := make([]uint64, 20)
+	for i := range subsidies {
+		subsidies[i] = 1e18 // 20 ETH in total, more than fits in a uint64
+	}
+
+	scaled, sf := ApplyBudgetToBlock(budget, subsidies)
+	if !sf.IsScalingNeeded() {
+		t.Fatal("Expected scaling for an overflowing total")
+	}
+	var total uint64
+	for _, r := range scaled {
+		total += r
+	}
+	if total > budget.Bmax {
+		t.Errorf("Scaled total %d exceeds Bmax %d", total, budget.Bmax)
+	}
+}
+
+// TestCaps_SumOverflow tests that the soft and dual caps respect their limits when the
+// subsidies sum past 2^64
+func TestCaps_SumOverflow(t *testing.T) {
+	subsidies := []uint64{math.MaxUint64, math.MaxUint64, math.MaxUint64}
+
+	capped := ApplySoftCap(subsidies, 500, 1000)
+	if sum := sumOf(capped); sum > 1000 || sum == 0 {
+		t.Errorf("Soft cap: expected aggregate in (0, 1000], got %d", sum)
+	}
+	capped = ApplySoftCap(subsidies, 1000, 1000)
+	if sum := sumOf(capped); sum > 1000 || sum == 0 {
+		t.Errorf("Degenerate soft cap: expected aggregate in (0, 1000], got %d", sum)
+	}
+
+	capped = DualCap{PerBlock: 1e18}.ApplyDualCap(subsidies)
+	var total uint64
+	for _, r := range capped {
+		if total+r < total {
+			t.Fatalf("Dual cap aggregate overflowed: %v", capped)
+		}
+		total += r
+	}
+	if total > 1e18 || total == 0 {
+		t.Errorf("Dual cap: expected aggregate in (0, 1e18], got %d", total)
+	}
+}
+
+// TestOverflowScaling_NonZero tests that a Bmax too small to survive the shift still yields Num > 0
+func TestOverflowScaling_NonZero(t *testing.T) {
+	budget, _ := NewBudget(0, 1)
+	sum := new(big.Int).Lsh(big.NewInt(1), 100)
+	sf := overflowScaling(budget, sum)
+	if sf.Num == 0 || sf.Den == 0 {
+		t.Fatalf("Expected a nonzero factor, got %s", sf)
+	}
+	if !sf.IsScalingNeeded() {
+		t.Error("Expected scaling for an overflowing total")
+	}
+}
+
+// TestApplySoftCap_ReturnsCopy tests that the pass-through paths do not alias the input
+func TestApplySoftCap_ReturnsCopy(t *testing.T) {
+	cases := []struct {
+		name          string
+		soft, hardMax uint64
+	}{
+		{"no limit", 500, 0},
+		{"below soft", 500, 1000},
+		{"degenerate band under cap", 1000, 800},
+	}
+	for _, tc := range cases {
+		subsidies := []uint64{100, 200}
+		capped := ApplySoftCap(subsidies, tc.soft, tc.hardMax)
+		capped[0] = 999
+		if subsidies[0] != 100 {
+			t.Errorf("%s: modifying the result changed the input", tc.name)
+		}
+	}
+}
+
+// TestBlockBudgetTracker tests that subsidies fed one at a time never exceed Bmax and restart per block
+func TestBlockBudgetTracker(t *testing.T) {
+	budget, _ := NewBudget(0, 1000)
+	tracker := NewBlockBudgetTracker(budget)
+
+	feed := []uint64{300, 400, 250, 200, 100}
+	want := []uint64{300, 400, 250, 50, 0}
+	var total uint64
+	for i, R := range feed {
+		got := tracker.Admit(7, R)
+		if got != want[i] {
+			t.Errorf("Admit #%d (%d) = %d, want %d", i, R, got, want[i])
+		}
+		total += got
+		if tracker.Spent() != total || tracker.Remaining() != budget.Bmax-total {
+			t.Errorf("After #%d: spent=%d remaining=%d, want %d and %d",
+				i, tracker.Spent(), tracker.Remaining(), total, budget.Bmax-total)
+		}
+	}
+	if total != budget.Bmax {
+		t.Errorf("Cumulative subsidy = %d, want exactly Bmax %d", total, budget.Bmax)
+	}
+
+	// A new block starts with the full budget
+	if got := tracker.Admit(8, 600); got != 600 || tracker.Block() != 8 || tracker.Remaining() != 400 {
+		t.Errorf("New block: admitted %d, block %d, remaining %d", got, tracker.Block(), tracker.Remaining())
+	}
+
+	// Without a maximum everything is admitted
+	unlimited := NewBlockBudgetTracker(nil)
+	if got := unlimited.Admit(1, math.MaxUint64/2); got != math.MaxUint64/2 {
+		t.Errorf("Unlimited tracker admitted %d", got)
+	}
+}
@@ -2,18 +2,66 @@
 package expectation
 
 import (
+	"errors"
+	"math"
 	"math/big"
 	"sort"
 	"sync"
+	"time"
+)
+
+// ErrRemoteFeeOutOfOrder is returned by UpdateRemoteShardFeeAt for a block height that is not newer
+// than the last accepted one of the shard
+var ErrRemoteFeeOutOfOrder = errors.New("expectation: remote fee update is not newer than the stored one")
+
+// FeeSource records how a shard's E(f_s) entered the tracker
+type FeeSource int
+
+const (
+	FeeSourceLocal  FeeSource = iota // Computed from locally finalized blocks (OnBlockFinalized)
+	FeeSourceRemote                  // Received via fee sync only (UpdateRemoteShardFee)
+)
+
+// ReferenceMode selects the statistic of a shard's fee window used as its reference fee
+type ReferenceMode int
+
+const (
+	ReferenceMean   ReferenceMode = iota // Rolling mean E(f_s) (GetAvgITXFee)
+	ReferenceMedian                      // Median of the per-block averages in the window
+	ReferenceP75                         // 75th percentile of the per-block averages
+	ReferenceP90                         // 90th percentile of the per-block averages
 )
 
 // Tracker maintains a sliding window of ITX fees per shard and computes rolling averages
 type Tracker struct {
-	WindowSize int                // Number of blocks in the sliding window
-	mu         sync.RWMutex       // Protects concurrent access
-	itxWindows map[int][]*big.Int // shard -> list of per-block average ITX fees
-	blockCount map[int]int        // shard -> number of blocks processed
-	avg        map[int]*big.Int   // shard -> current E(f_s)
+	WindowSize int // Number of blocks in the sliding window
+	// CountNilAsZero controls how nil fees affect a block's average:
+	// false (default) skips them entirely; true counts them as zero-fee ITX in the denominator
+	CountNilAsZero bool
+	// RetainRawFees keeps up to this many raw per-tx fees per block in the window, so percentiles
+	// reflect the fee distribution rather than block averages (0 = keep only block averages)
+	RetainRawFees int
+	// MaxRemoteFeeAge makes GetAvgITXFee return zero (bootstrap) for a remote-only shard whose last
+	// fee sync update is older than this (0 = remote fees never expire)
+	MaxRemoteFeeAge time.Duration
+	// MaxRemoteQueueAge makes GetRemoteQueueLength report a remote queue length as unknown once
+	// its fee sync update is older than this (0 = queue lengths never expire)
+	MaxRemoteQueueAge time.Duration
+
+	mu            sync.RWMutex         // Protects concurrent access
+	itxWindows    map[int][]*big.Int   // shard -> list of per-block average ITX fees
+	blockCount    map[int]int          // shard -> number of blocks processed
+	avg           map[int]*big.Int     // shard -> current E(f_s)
+	source        map[int]FeeSource    // shard -> local or remote-synced (local is sticky)
+	gasWindows    map[int][]*big.Int   // shard -> list of per-block gas-weighted average ITX fees
+	gasAvg        map[int]*big.Int     // shard -> current gas-weighted E(f_s)
+	rawWindows    map[int][][]*big.Int // shard -> per-block retained raw ITX fees (RetainRawFees > 0)
+	ewmaAlpha     float64              // EWMA weight of the newest block average (0 = windowed mean)
+	remoteHeight  map[int]uint64       // shard -> block height of the last accepted fee sync update
+	remoteUpdated map[int]time.Time    // shard -> when the last fee sync update was accepted
+	remoteQueue   map[int]int64        // shard -> tx queue length reported by the last fee sync update
+	remoteQueueAt map[int]time.Time    // shard -> when remoteQueue was recorded
+	now           func() time.Time     // Clock for remote fee ages (time.Now unless overridden in tests)
 }
 
 // NewTracker creates a new fee expectation tracker with the specified window size
@@ -22,17 +70,47 @@ func NewTracker(windowSize int) *Tracker {
 		windowSize = 16 // default window size
 	}
 	return &Tracker{
-		WindowSize: windowSize,
-		itxWindows: make(map[int][]*big.Int),
-		blockCount: make(map[int]int),
-		avg:        make(map[int]*big.Int),
+		WindowSize:    windowSize,
+		itxWindows:    make(map[int][]*big.Int),
+		blockCount:    make(map[int]int),
+		avg:           make(map[int]*big.Int),
+		source:        make(map[int]FeeSource),
+		gasWindows:    make(map[int][]*big.Int),
+		gasAvg:        make(map[int]*big.Int),
+		rawWindows:    make(map[int][][]*big.Int),
+		remoteHeight:  make(map[int]uint64),
+		remoteUpdated: make(map[int]time.Time),
+		remoteQueue:   make(map[int]int64),
+		remoteQueueAt: make(map[int]time.Time),
+		now:           time.Now,
+	}
+}
+
+// NewTrackerEWMA creates a tracker whose E(f_s) is an exponentially weighted moving average of
+// per-block averages, avg = alpha*blockAvg + (1-alpha)*prev, so fee regime changes show up faster
+// than with the windowed mean. alpha outside (0, 1] falls back to the default 0.2. The window is
+// still kept (default size) for percentiles and FeeQuantileOf
+func NewTrackerEWMA(alpha float64) *Tracker {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
 	}
+	t := NewTracker(0)
+	t.ewmaAlpha = alpha
+	return t
 }
 
 // OnBlockFinalized is called when a block is finalized in a shard
 // It updates the sliding window with ITX fees from that block and recomputes E(f_s)
 // itxFeesInBlock contains only the proposer fees from intra-shard transactions
 func (t *Tracker) OnBlockFinalized(shardID int, itxFeesInBlock []*big.Int) {
+	t.OnBlockFinalizedWithGas(shardID, itxFeesInBlock, nil)
+}
+
+// OnBlockFinalizedWithGas is OnBlockFinalized with the gas used by each ITX (parallel to itxFeesInBlock)
+// Besides the count-weighted E(f_s), it maintains a gas-weighted E(f_s) in which each fee is
+// weighted by its gas share, so gas-heavy transactions count more. Blocks without gas data
+// (nil or all-zero gasUsed) contribute their count-weighted average to the gas-weighted window.
+func (t *Tracker) OnBlockFinalizedWithGas(shardID int, itxFeesInBlock []*big.Int, gasUsed []uint64) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -56,6 +134,9 @@ func (t *Tracker) OnBlockFinalized(shardID int, itxFeesInBlock []*big.Int) {
 				}
 				sum.Add(sum, cappedFee)
 				count++
+			} else if fee == nil && t.CountNilAsZero {
+				// Nil fee contributes zero to the sum but still counts as a transaction
+				count++
 			}
 		}
 		if count > 0 {
@@ -70,6 +151,8 @@ func (t *Tracker) OnBlockFinalized(shardID int, itxFeesInBlock []*big.Int) {
 		t.avg[shardID] = big.NewInt(0)
 	}
 
+	t.source[shardID] = FeeSourceLocal
+
 	// Add block average to window (make a copy to avoid sharing)
 	t.itxWindows[shardID] = append(t.itxWindows[shardID], new(big.Int).Set(blockAvg))
 	t.blockCount[shardID]++
@@ -79,8 +162,95 @@ func (t *Tracker) OnBlockFinalized(shardID int, itxFeesInBlock []*big.Int) {
 		t.itxWindows[shardID] = t.itxWindows[shardID][len(t.itxWindows[shardID])-t.WindowSize:]
 	}
 
-	// Recompute rolling average E(f_s)
-	t.recomputeAvg(shardID)
+	// Recompute rolling average E(f_s), or fold the block into the EWMA
+	if t.ewmaAlpha > 0 {
+		t.updateEWMA(shardID, blockAvg)
+	} else {
+		t.recomputeAvg(shardID)
+	}
+
+	// Raw fee window for percentiles
+	if t.RetainRawFees > 0 {
+		t.rawWindows[shardID] = append(t.rawWindows[shardID], sampleBlockFees(itxFeesInBlock, t.RetainRawFees))
+		if len(t.rawWindows[shardID]) > t.WindowSize {
+			t.rawWindows[shardID] = t.rawWindows[shardID][len(t.rawWindows[shardID])-t.WindowSize:]
+		}
+	}
+
+	// Gas-weighted window, falling back to the count-weighted block average without gas data
+	gasBlockAvg := gasWeightedBlockAvg(itxFeesInBlock, gasUsed)
+	if gasBlockAvg == nil {
+		gasBlockAvg = new(big.Int).Set(blockAvg)
+	}
+	t.gasWindows[shardID] = append(t.gasWindows[shardID], gasBlockAvg)
+	if len(t.gasWindows[shardID]) > t.WindowSize {
+		t.gasWindows[shardID] = t.gasWindows[shardID][len(t.gasWindows[shardID])-t.WindowSize:]
+	}
+	gasSum := big.NewInt(0)
+	for _, avg := range t.gasWindows[shardID] {
+		gasSum.Add(gasSum, avg)
+	}
+	t.gasAvg[shardID] = gasSum.Div(gasSum, big.NewInt(int64(len(t.gasWindows[shardID]))))
+}
+
+// sampleBlockFees copies the positive fees of a block, keeping at most limit of them; larger
+// blocks are thinned to evenly spaced order statistics so the block's distribution is preserved
+func sampleBlockFees(fees []*big.Int, limit int) []*big.Int {
+	kept := make([]*big.Int, 0, len(fees))
+	for _, fee := range fees {
+		if fee != nil && fee.Sign() > 0 {
+			kept = append(kept, new(big.Int).Set(fee))
+		}
+	}
+	if len(kept) <= limit {
+		return kept
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Cmp(kept[j]) < 0 })
+	sample := make([]*big.Int, limit)
+	for i := range sample {
+		sample[i] = kept[i*len(kept)/limit]
+	}
+	return sample
+}
+
+// gasWeightedBlockAvg returns sum(fee_i * gas_i) / sum(gas_i) over positive fees with known gas,
+// with fees capped as in the count-weighted average; returns nil if no gas data is available
+func gasWeightedBlockAvg(fees []*big.Int, gasUsed []uint64) *big.Int {
+	if len(gasUsed) != len(fees) {
+		return nil
+	}
+	cap := big.NewInt(1e14) // Same cap as the count-weighted average
+
+	weighted := big.NewInt(0)
+	totalGas := big.NewInt(0)
+	for i, fee := range fees {
+		if fee == nil || fee.Sign() <= 0 || gasUsed[i] == 0 {
+			continue
+		}
+		cappedFee := fee
+		if fee.Cmp(cap) > 0 {
+			cappedFee = cap
+		}
+		gas := new(big.Int).SetUint64(gasUsed[i])
+		weighted.Add(weighted, new(big.Int).Mul(cappedFee, gas))
+		totalGas.Add(totalGas, gas)
+	}
+	if totalGas.Sign() == 0 {
+		return nil
+	}
+	return weighted.Div(weighted, totalGas)
+}
+
+// GetGasWeightedAvgITXFee returns the gas-weighted rolling average ITX fee for a shard
+// Shards without locally finalized blocks (e.g. known only via fee sync) fall back to GetAvgITXFee
+func (t *Tracker) GetGasWeightedAvgITXFee(shardID int) *big.Int {
+	t.mu.RLock()
+	if avg, exists := t.gasAvg[shardID]; exists {
+		defer t.mu.RUnlock()
+		return new(big.Int).Set(avg)
+	}
+	t.mu.RUnlock()
+	return t.GetAvgITXFee(shardID)
 }
 
 // trimExtremes removes the top and bottom percentiles from a fee list
@@ -145,18 +315,148 @@ func (t *Tracker) recomputeAvg(shardID int) {
 	t.avg[shardID] = new(big.Int).Div(sum, big.NewInt(int64(len(window))))
 }
 
-// GetAvgITXFee returns the current rolling average ITX fee E(f_s) for a shard
+// updateEWMA folds a block average into the shard's EWMA; the first local block (even after a
+// remote fee sync value) sets the average directly. Must be called with lock held
+func (t *Tracker) updateEWMA(shardID int, blockAvg *big.Int) {
+	prev := t.avg[shardID]
+	if t.blockCount[shardID] <= 1 || prev == nil {
+		t.avg[shardID] = new(big.Int).Set(blockAvg)
+		return
+	}
+	// prev + alpha*(blockAvg - prev)
+	delta := new(big.Float).SetInt(new(big.Int).Sub(blockAvg, prev))
+	step, _ := delta.Mul(delta, big.NewFloat(t.ewmaAlpha)).Int(nil)
+	t.avg[shardID] = step.Add(step, prev)
+}
+
+// GetAvgITXFee returns the current E(f_s) for a shard: the windowed rolling average, or the EWMA
+// for trackers built with NewTrackerEWMA
 // Returns a copy to prevent concurrent modification
 func (t *Tracker) GetAvgITXFee(shardID int) *big.Int {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
+	if t.remoteStale(shardID) {
+		return big.NewInt(0) // Treat expired remote data like no data
+	}
 	if avg, exists := t.avg[shardID]; exists {
 		return new(big.Int).Set(avg)
 	}
 	return big.NewInt(0) // Return 0 if no data yet (bootstrap phase)
 }
 
+// remoteStale reports whether shardID is known only through fee sync and its last update is
+// older than MaxRemoteFeeAge. Must be called with lock held
+func (t *Tracker) remoteStale(shardID int) bool {
+	if t.MaxRemoteFeeAge <= 0 || t.source[shardID] != FeeSourceRemote {
+		return false
+	}
+	updated, ok := t.remoteUpdated[shardID]
+	return ok && t.now().Sub(updated) > t.MaxRemoteFeeAge
+}
+
+// GetFeeReference returns the shard's reference fee under mode, computed like
+// GetPercentileITXFee. Shards without a local window (e.g. only known via fee sync) fall back
+// to the mean.
+func (t *Tracker) GetFeeReference(shardID int, mode ReferenceMode) *big.Int {
+	var pct float64
+	switch mode {
+	case ReferenceMedian:
+		pct = 50
+	case ReferenceP75:
+		pct = 75
+	case ReferenceP90:
+		pct = 90
+	default:
+		return t.GetAvgITXFee(shardID)
+	}
+
+	t.mu.RLock()
+	sample := t.percentileSample(shardID)
+	t.mu.RUnlock()
+	if len(sample) == 0 {
+		return t.GetAvgITXFee(shardID)
+	}
+	return percentile(sample, pct)
+}
+
+// GetMedianITXFee returns the median ITX fee of a shard's window (see GetPercentileITXFee)
+func (t *Tracker) GetMedianITXFee(shardID int) *big.Int {
+	return t.GetPercentileITXFee(shardID, 50)
+}
+
+// GetPercentileITXFee returns the p-th percentile (0-100) of a shard's window: over the retained
+// raw per-tx fees if RetainRawFees is set, otherwise over the per-block averages. Percentiles use
+// the nearest-rank method; the median of an even-length sample averages the two middle values.
+// Returns 0 if the shard has no window data
+func (t *Tracker) GetPercentileITXFee(shardID int, p float64) *big.Int {
+	t.mu.RLock()
+	sample := t.percentileSample(shardID)
+	t.mu.RUnlock()
+	if len(sample) == 0 {
+		return big.NewInt(0)
+	}
+	return percentile(sample, p)
+}
+
+// percentileSample collects the values percentiles are computed over: the retained raw fees,
+// or the per-block averages if none are retained (must be called with lock held)
+// The returned slice is fresh, but its elements must not be modified
+func (t *Tracker) percentileSample(shardID int) []*big.Int {
+	var sample []*big.Int
+	for _, block := range t.rawWindows[shardID] {
+		sample = append(sample, block...)
+	}
+	if len(sample) > 0 {
+		return sample
+	}
+	for _, blockAvg := range t.itxWindows[shardID] {
+		if blockAvg != nil {
+			sample = append(sample, blockAvg)
+		}
+	}
+	return sample
+}
+
+// percentile sorts sample in place and returns a copy of its p-th percentile (nearest rank)
+func percentile(sample []*big.Int, p float64) *big.Int {
+	sort.Slice(sample, func(i, j int) bool { return sample[i].Cmp(sample[j]) < 0 })
+	n := len(sample)
+	if p == 50 && n%2 == 0 {
+		mid := new(big.Int).Add(sample[n/2-1], sample[n/2])
+		return mid.Rsh(mid, 1)
+	}
+	rank := int(math.Ceil(p * float64(n) / 100)) // 1-based
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > n {
+		rank = n
+	}
+	return new(big.Int).Set(sample[rank-1])
+}
+
+// FeeQuantileOf returns the fraction of block averages in a shard's window that are strictly below fee
+// This places a transaction's fee within the local fee market (0.0 = cheapest, 1.0 = above all)
+// Returns 0 if the shard has no window data or fee is nil
+func (t *Tracker) FeeQuantileOf(shardID int, fee *big.Int) float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	window := t.itxWindows[shardID]
+	if len(window) == 0 || fee == nil {
+		return 0
+	}
+
+	below := 0
+	for _, blockAvg := range window {
+		if blockAvg != nil && blockAvg.Cmp(fee) < 0 {
+			below++
+		}
+	}
+	return float64(below) / float64(len(window))
+}
+
 // GetAllAvgFees returns a snapshot of all shard averages (for metrics/debugging)
 func (t *Tracker) GetAllAvgFees() map[int]*big.Int {
 	t.mu.RLock()
@@ -188,6 +488,14 @@ func (t *Tracker) Reset(shardID int) {
 	delete(t.itxWindows, shardID)
 	delete(t.blockCount, shardID)
 	delete(t.avg, shardID)
+	delete(t.source, shardID)
+	delete(t.gasWindows, shardID)
+	delete(t.gasAvg, shardID)
+	delete(t.rawWindows, shardID)
+	delete(t.remoteHeight, shardID)
+	delete(t.remoteUpdated, shardID)
+	delete(t.remoteQueue, shardID)
+	delete(t.remoteQueueAt, shardID)
 }
 
 // ResetAll clears all tracking data for all shards
@@ -198,15 +506,44 @@ func (t *Tracker) ResetAll() {
 	t.itxWindows = make(map[int][]*big.Int)
 	t.blockCount = make(map[int]int)
 	t.avg = make(map[int]*big.Int)
+	t.source = make(map[int]FeeSource)
+	t.gasWindows = make(map[int][]*big.Int)
+	t.gasAvg = make(map[int]*big.Int)
+	t.rawWindows = make(map[int][][]*big.Int)
+	t.remoteHeight = make(map[int]uint64)
+	t.remoteUpdated = make(map[int]time.Time)
+	t.remoteQueue = make(map[int]int64)
+	t.remoteQueueAt = make(map[int]time.Time)
 }
 
 // UpdateRemoteShardFee updates the average fee for a remote shard
 // This is called when receiving fee sync messages from other shards in multi-process architecture
-// Unlike OnBlockFinalized, this directly sets the average without maintaining a window
+// Unlike OnBlockFinalized, this directly sets the average without maintaining a window.
+// The update is unconditional; fee sync handlers use UpdateRemoteShardFeeAt to drop reordered messages
 func (t *Tracker) UpdateRemoteShardFee(shardID int, avgFee *big.Int) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	t.setRemoteFee(shardID, avgFee)
+}
+
+// UpdateRemoteShardFeeAt is UpdateRemoteShardFee for a fee sync message generated at blockHeight.
+// A message whose height is not greater than the last accepted one of the shard is rejected with
+// ErrRemoteFeeOutOfOrder, so a delayed message cannot overwrite newer data
+func (t *Tracker) UpdateRemoteShardFeeAt(shardID int, avgFee *big.Int, blockHeight uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.remoteHeight[shardID]; ok && blockHeight <= last {
+		return ErrRemoteFeeOutOfOrder
+	}
+	t.remoteHeight[shardID] = blockHeight
+	t.setRemoteFee(shardID, avgFee)
+	return nil
+}
+
+// setRemoteFee stores a remote shard average and its arrival time. Must be called with lock held
+func (t *Tracker) setRemoteFee(shardID int, avgFee *big.Int) {
 	if avgFee == nil {
 		avgFee = big.NewInt(0)
 	}
@@ -216,9 +553,81 @@ func (t *Tracker) UpdateRemoteShardFee(shardID int, avgFee *big.Int) {
 		t.itxWindows[shardID] = make([]*big.Int, 0, t.WindowSize)
 		t.blockCount[shardID] = 0
 	}
+	// A shard with locally finalized blocks stays local even if fee sync also reports it
+	if _, exists := t.source[shardID]; !exists {
+		t.source[shardID] = FeeSourceRemote
+	}
 
 	// Directly update the average (make a copy to avoid concurrent modification)
 	t.avg[shardID] = new(big.Int).Set(avgFee)
+	t.remoteUpdated[shardID] = t.now()
+}
+
+// GetRemoteFeeAge returns how long ago the last fee sync update of a shard was accepted,
+// and false if the shard never received one
+func (t *Tracker) GetRemoteFeeAge(shardID int) (time.Duration, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	updated, ok := t.remoteUpdated[shardID]
+	if !ok {
+		return 0, false
+	}
+	return t.now().Sub(updated), true
+}
+
+// UpdateRemoteQueueLength records the tx queue length a remote shard reported in its fee sync
+// message. Negative lengths mean the sender did not report one and are ignored
+func (t *Tracker) UpdateRemoteQueueLength(shardID int, queueLen int64) {
+	if queueLen < 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.remoteQueue[shardID] = queueLen
+	t.remoteQueueAt[shardID] = t.now()
+}
+
+// GetRemoteQueueLength returns the last queue length reported by a remote shard, and false if
+// none was reported or it is older than MaxRemoteQueueAge
+func (t *Tracker) GetRemoteQueueLength(shardID int) (int64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	queueLen, ok := t.remoteQueue[shardID]
+	if !ok {
+		return 0, false
+	}
+	if t.MaxRemoteQueueAge > 0 && t.now().Sub(t.remoteQueueAt[shardID]) > t.MaxRemoteQueueAge {
+		return 0, false
+	}
+	return queueLen, true
+}
+
+// GetLocalShards returns the sorted IDs of shards with locally finalized blocks
+func (t *Tracker) GetLocalShards() []int {
+	return t.shardsBySource(FeeSourceLocal)
+}
+
+// GetRemoteShards returns the sorted IDs of shards known only through fee sync updates
+func (t *Tracker) GetRemoteShards() []int {
+	return t.shardsBySource(FeeSourceRemote)
+}
+
+// shardsBySource returns the sorted IDs of shards with the given fee source
+func (t *Tracker) shardsBySource(source FeeSource) []int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	shards := make([]int, 0)
+	for shardID, s := range t.source {
+		if s == source {
+			shards = append(shards, shardID)
+		}
+	}
+	sort.Ints(shards)
+	return shards
 }
 
 // GetLastUpdateTime returns when a shard's fee info was last updated (for debugging)
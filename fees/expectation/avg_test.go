@@ -1,8 +1,13 @@
 package expectation
 
 import (
+	"errors"
+	"math"
 	"math/big"
 	"testing"
+	"time"
+
+	"blockEmulator/utils/snapshot"
 )
 
 // TestTracker_OnBlockFinalized tests basic block finalization
@@ -116,11 +121,11 @@ func TestTracker_EmptyBlock(t *testing.T) {
 	}
 }
 
-// TestTracker_NilFees tests handling of nil fees
+// TestTracker_NilFees tests the default policy of skipping nil fees
 func TestTracker_NilFees(t *testing.T) {
 	tracker := NewTracker(4)
 	shardID := 0
-	
+
 	// Add block with some nil fees
 	fees := []*big.Int{
 		big.NewInt(100),
@@ -128,18 +133,43 @@ func TestTracker_NilFees(t *testing.T) {
 		big.NewInt(300),
 	}
 	tracker.OnBlockFinalized(shardID, fees)
-	
-	// Should skip nil and compute average of 100 and 300
+
+	// Nil is skipped in both sum and count: (100 + 300) / 2 = 200
 	avg := tracker.GetAvgITXFee(shardID)
-	// With nil, sum = 400, count = 3, avg = 133
-	// But our implementation skips nil in sum but not count
-	// So: (100 + 0 + 300) / 3 = 133
-	want := big.NewInt(133)
+	want := big.NewInt(200)
 	if avg.Cmp(want) != 0 {
 		t.Errorf("Avg with nil fees = %v, want %v", avg, want)
 	}
 }
 
+// TestTracker_NilFees_CountAsZero tests the policy of counting nil fees as zero
+func TestTracker_NilFees_CountAsZero(t *testing.T) {
+	tracker := NewTracker(4)
+	tracker.CountNilAsZero = true
+	shardID := 0
+
+	fees := []*big.Int{
+		big.NewInt(100),
+		nil,
+		big.NewInt(300),
+	}
+	tracker.OnBlockFinalized(shardID, fees)
+
+	// Nil contributes zero to the sum but counts in the denominator: (100 + 0 + 300) / 3 = 133
+	avg := tracker.GetAvgITXFee(shardID)
+	want := big.NewInt(133)
+	if avg.Cmp(want) != 0 {
+		t.Errorf("Avg with nil fees counted as zero = %v, want %v", avg, want)
+	}
+
+	// A block of only nil fees averages to zero under either policy
+	tracker.Reset(shardID)
+	tracker.OnBlockFinalized(shardID, []*big.Int{nil, nil})
+	if avg := tracker.GetAvgITXFee(shardID); avg.Sign() != 0 {
+		t.Errorf("Avg of all-nil block = %v, want 0", avg)
+	}
+}
+
 // TestTracker_Bootstrap tests behavior when no data available
 func TestTracker_Bootstrap(t *testing.T) {
 	tracker := NewTracker(4)
@@ -279,6 +309,44 @@ func TestTracker_Concurrent(t *testing.T) {
 	// Should not panic
 }
 
+// TestTracker_FeeQuantileOf tests the fee quantile within a shard's window
+func TestTracker_FeeQuantileOf(t *testing.T) {
+	tracker := NewTracker(10)
+	shardID := 0
+
+	// Block averages 100, 200, ..., 1000
+	for i := int64(1); i <= 10; i++ {
+		tracker.OnBlockFinalized(shardID, []*big.Int{big.NewInt(i * 100)})
+	}
+
+	tests := []struct {
+		name string
+		fee  *big.Int
+		want float64
+	}{
+		{"median fee", big.NewInt(550), 0.5},
+		{"below all", big.NewInt(50), 0.0},
+		{"equal to lowest", big.NewInt(100), 0.0},
+		{"low fee", big.NewInt(300), 0.2},
+		{"above all", big.NewInt(5000), 1.0},
+		{"nil fee", nil, 0.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tracker.FeeQuantileOf(shardID, tt.fee)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("FeeQuantileOf(%v) = %v, want %v", tt.fee, got, tt.want)
+			}
+		})
+	}
+
+	// Unknown shard has no market to compare against
+	if got := tracker.FeeQuantileOf(999, big.NewInt(100)); got != 0 {
+		t.Errorf("FeeQuantileOf(unknown shard) = %v, want 0", got)
+	}
+}
+
 // BenchmarkOnBlockFinalized benchmarks block finalization
 func BenchmarkOnBlockFinalized(b *testing.B) {
 	tracker := NewTracker(16)
@@ -306,3 +374,333 @@ func BenchmarkGetAvgITXFee(b *testing.B) {
 		_ = tracker.GetAvgITXFee(0)
 	}
 }
+
+// TestTracker_LocalVsRemoteShards tests that fee-sync-only shards are reported as remote, not local
+func TestTracker_LocalVsRemoteShards(t *testing.T) {
+	tracker := NewTracker(4)
+	tracker.OnBlockFinalized(0, []*big.Int{big.NewInt(100)})
+	tracker.UpdateRemoteShardFee(1, big.NewInt(200))
+	// Shard 0 is also reported by fee sync but stays local
+	tracker.UpdateRemoteShardFee(0, big.NewInt(150))
+
+	if local := tracker.GetLocalShards(); len(local) != 1 || local[0] != 0 {
+		t.Errorf("Local shards = %v, want [0]", local)
+	}
+	if remote := tracker.GetRemoteShards(); len(remote) != 1 || remote[0] != 1 {
+		t.Errorf("Remote shards = %v, want [1]", remote)
+	}
+	// GetAllAvgFees still covers both
+	if all := tracker.GetAllAvgFees(); len(all) != 2 {
+		t.Errorf("GetAllAvgFees returned %d shards, want 2", len(all))
+	}
+
+	// A remote shard that later finalizes a block locally becomes local
+	tracker.OnBlockFinalized(1, []*big.Int{big.NewInt(300)})
+	if remote := tracker.GetRemoteShards(); len(remote) != 0 {
+		t.Errorf("Remote shards after local finalization = %v, want []", remote)
+	}
+
+	tracker.Reset(1)
+	if local := tracker.GetLocalShards(); len(local) != 1 || local[0] != 0 {
+		t.Errorf("Local shards after Reset(1) = %v, want [0]", local)
+	}
+}
+
+// TestTracker_RemoteFeeOutOfOrder tests that a fee sync update no newer than the stored one is rejected
+func TestTracker_RemoteFeeOutOfOrder(t *testing.T) {
+	tracker := NewTracker(4)
+	if err := tracker.UpdateRemoteShardFeeAt(1, big.NewInt(500), 10); err != nil {
+		t.Fatalf("First update rejected: %v", err)
+	}
+
+	// Older and duplicate heights must not overwrite the newer value
+	for _, height := range []uint64{9, 10} {
+		if err := tracker.UpdateRemoteShardFeeAt(1, big.NewInt(100), height); !errors.Is(err, ErrRemoteFeeOutOfOrder) {
+			t.Errorf("Update at height %d: err = %v, want ErrRemoteFeeOutOfOrder", height, err)
+		}
+	}
+	if avg := tracker.GetAvgITXFee(1); avg.Int64() != 500 {
+		t.Errorf("Average after reordered updates = %v, want 500", avg)
+	}
+
+	if err := tracker.UpdateRemoteShardFeeAt(1, big.NewInt(700), 11); err != nil {
+		t.Errorf("Newer update rejected: %v", err)
+	}
+	if avg := tracker.GetAvgITXFee(1); avg.Int64() != 700 {
+		t.Errorf("Average after newer update = %v, want 700", avg)
+	}
+
+	// Reset forgets the stored height
+	tracker.Reset(1)
+	if err := tracker.UpdateRemoteShardFeeAt(1, big.NewInt(300), 1); err != nil {
+		t.Errorf("Update after Reset rejected: %v", err)
+	}
+}
+
+// TestTracker_RemoteFeeStaleness tests that expired remote fees read as zero while local ones do not
+func TestTracker_RemoteFeeStaleness(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tracker := NewTracker(4)
+	tracker.now = func() time.Time { return now }
+
+	if _, ok := tracker.GetRemoteFeeAge(1); ok {
+		t.Error("Expected no remote fee age before any update")
+	}
+	tracker.OnBlockFinalized(0, []*big.Int{big.NewInt(100)})
+	tracker.UpdateRemoteShardFee(0, big.NewInt(150)) // Local shard, reported by fee sync too
+	tracker.UpdateRemoteShardFee(1, big.NewInt(400))
+
+	now = now.Add(5 * time.Second)
+	if age, ok := tracker.GetRemoteFeeAge(1); !ok || age != 5*time.Second {
+		t.Errorf("Remote fee age = %v (ok=%v), want 5s", age, ok)
+	}
+
+	// Without a max age stale data is still returned
+	if avg := tracker.GetAvgITXFee(1); avg.Int64() != 400 {
+		t.Errorf("Average without max age = %v, want 400", avg)
+	}
+
+	tracker.MaxRemoteFeeAge = 3 * time.Second
+	if avg := tracker.GetAvgITXFee(1); avg.Sign() != 0 {
+		t.Errorf("Stale remote average = %v, want 0", avg)
+	}
+	if avg := tracker.GetAvgITXFee(0); avg.Int64() != 150 {
+		t.Errorf("Local shard average = %v, want 150 (local data never expires)", avg)
+	}
+
+	// A fresh update revives the shard
+	tracker.UpdateRemoteShardFee(1, big.NewInt(450))
+	if avg := tracker.GetAvgITXFee(1); avg.Int64() != 450 {
+		t.Errorf("Average after fresh update = %v, want 450", avg)
+	}
+}
+
+// TestTracker_RemoteQueueLength tests that reported queue lengths are returned until they go stale
+func TestTracker_RemoteQueueLength(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tracker := NewTracker(4)
+	tracker.now = func() time.Time { return now }
+	tracker.MaxRemoteQueueAge = 3 * time.Second
+
+	if _, ok := tracker.GetRemoteQueueLength(1); ok {
+		t.Error("Expected no queue length before any report")
+	}
+	tracker.UpdateRemoteQueueLength(1, -1) // Not reported by the sender
+	if _, ok := tracker.GetRemoteQueueLength(1); ok {
+		t.Error("Expected a negative queue length to be ignored")
+	}
+
+	tracker.UpdateRemoteQueueLength(1, 700)
+	now = now.Add(2 * time.Second)
+	if q, ok := tracker.GetRemoteQueueLength(1); !ok || q != 700 {
+		t.Errorf("Queue length = %d (ok=%v), want 700", q, ok)
+	}
+	now = now.Add(2 * time.Second)
+	if _, ok := tracker.GetRemoteQueueLength(1); ok {
+		t.Error("Expected a stale queue length to read as unknown")
+	}
+
+	tracker.UpdateRemoteQueueLength(1, 50)
+	if q, ok := tracker.GetRemoteQueueLength(1); !ok || q != 50 {
+		t.Errorf("Queue length after fresh report = %d (ok=%v), want 50", q, ok)
+	}
+	tracker.Reset(1)
+	if _, ok := tracker.GetRemoteQueueLength(1); ok {
+		t.Error("Expected Reset to clear the queue length")
+	}
+}
+
+// TestTracker_GasWeightedAvg tests that the gas-weighted average weights fees by gas and falls back without gas data
+func TestTracker_GasWeightedAvg(t *testing.T) {
+	tracker := NewTracker(4)
+	fees := []*big.Int{big.NewInt(100), big.NewInt(1000)}
+	tracker.OnBlockFinalizedWithGas(0, fees, []uint64{1000, 10000})
+
+	// Count-weighted: (100+1000)/2 = 550; gas-weighted: (100*1000 + 1000*10000)/11000 = 918
+	if got := tracker.GetAvgITXFee(0); got.Cmp(big.NewInt(550)) != 0 {
+		t.Errorf("Count-weighted avg = %s, want 550", got)
+	}
+	if got := tracker.GetGasWeightedAvgITXFee(0); got.Cmp(big.NewInt(918)) != 0 {
+		t.Errorf("Gas-weighted avg = %s, want 918", got)
+	}
+
+	// A block without gas data contributes its count-weighted average: (918 + 550) / 2 = 734
+	tracker.OnBlockFinalized(0, fees)
+	if got := tracker.GetGasWeightedAvgITXFee(0); got.Cmp(big.NewInt(734)) != 0 {
+		t.Errorf("Gas-weighted avg after gasless block = %s, want 734", got)
+	}
+
+	// Remote-only shards fall back to the synced count-weighted average
+	tracker.UpdateRemoteShardFee(1, big.NewInt(300))
+	if got := tracker.GetGasWeightedAvgITXFee(1); got.Cmp(big.NewInt(300)) != 0 {
+		t.Errorf("Remote gas-weighted avg = %s, want 300", got)
+	}
+}
+
+// TestTracker_SnapshotRestore tests restoring a version-1 blob and rejecting an unknown version
+func TestTracker_SnapshotRestore(t *testing.T) {
+	blob := []byte(`{"kind":"expectation.tracker","version":1,"state":{"window_size":4,` +
+		`"itx_windows":{"0":[100,300]},"block_count":{"0":2},"avg":{"0":200,"2":500},"source":{"0":0,"2":1}}}`)
+
+	tracker := NewTracker(16)
+	if err := tracker.Restore(blob); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if tracker.WindowSize != 4 || tracker.GetBlockCount(0) != 2 {
+		t.Errorf("WindowSize %d, block count %d", tracker.WindowSize, tracker.GetBlockCount(0))
+	}
+	if got := tracker.GetAvgITXFee(0); got.Int64() != 200 {
+		t.Errorf("E(f_0) = %v, want 200", got)
+	}
+	if remote := tracker.GetRemoteShards(); len(remote) != 1 || remote[0] != 2 {
+		t.Errorf("remote shards = %v, want [2]", remote)
+	}
+
+	// Round trip, then a new block extends the restored window
+	data, err := tracker.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	restored := NewTracker(16)
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Restore(Snapshot()): %v", err)
+	}
+	restored.OnBlockFinalized(0, []*big.Int{big.NewInt(200)})
+	if got := restored.GetAvgITXFee(0); got.Int64() != 200 {
+		t.Errorf("E(f_0) after new block = %v, want 200", got)
+	}
+
+	bad := []byte(`{"kind":"expectation.tracker","version":3,"state":{}}`)
+	if err := restored.Restore(bad); !errors.Is(err, snapshot.ErrVersionMismatch) {
+		t.Errorf("Restore(v3) err = %v, want ErrVersionMismatch", err)
+	}
+	if restored.GetBlockCount(0) != 3 {
+		t.Error("rejected restore modified the tracker")
+	}
+}
+
+// TestTracker_GetFeeReference tests each reference statistic over a known skewed window
+func TestTracker_GetFeeReference(t *testing.T) {
+	tracker := NewTracker(10)
+	for _, fee := range []int64{100, 100, 100, 100, 100, 100, 200, 300, 1000, 5000} {
+		tracker.OnBlockFinalized(0, []*big.Int{big.NewInt(fee)})
+	}
+
+	tests := []struct {
+		mode ReferenceMode
+		want int64
+	}{
+		{ReferenceMean, 710},   // 7100 / 10
+		{ReferenceMedian, 100}, // average of the 5th and 6th values
+		{ReferenceP75, 300},    // rank ceil(7.5) = 8
+		{ReferenceP90, 1000},   // rank 9
+	}
+	for _, tt := range tests {
+		if got := tracker.GetFeeReference(0, tt.mode); got.Int64() != tt.want {
+			t.Errorf("GetFeeReference(mode %d) = %v, want %d", tt.mode, got, tt.want)
+		}
+	}
+
+	// Odd window: the median is the middle value
+	tracker.OnBlockFinalized(1, []*big.Int{big.NewInt(10)})
+	tracker.OnBlockFinalized(1, []*big.Int{big.NewInt(30)})
+	tracker.OnBlockFinalized(1, []*big.Int{big.NewInt(20)})
+	if got := tracker.GetFeeReference(1, ReferenceMedian); got.Int64() != 20 {
+		t.Errorf("odd-window median = %v, want 20", got)
+	}
+
+	// A remote-only shard has no window and falls back to the mean
+	tracker.UpdateRemoteShardFee(2, big.NewInt(777))
+	if got := tracker.GetFeeReference(2, ReferenceP90); got.Int64() != 777 {
+		t.Errorf("remote shard P90 = %v, want mean 777", got)
+	}
+}
+
+// TestTracker_PercentileITXFee tests median/percentile estimators over block averages and raw fees
+func TestTracker_PercentileITXFee(t *testing.T) {
+	tracker := NewTracker(4)
+	if got := tracker.GetMedianITXFee(0); got.Sign() != 0 {
+		t.Errorf("median with no data = %v, want 0", got)
+	}
+
+	// Without raw retention, percentiles run over per-block averages
+	for _, fee := range []int64{100, 400, 200, 300} {
+		tracker.OnBlockFinalized(0, []*big.Int{big.NewInt(fee)})
+	}
+	if got := tracker.GetMedianITXFee(0); got.Int64() != 250 {
+		t.Errorf("median of block averages = %v, want 250", got)
+	}
+	if got := tracker.GetPercentileITXFee(0, 75); got.Int64() != 300 {
+		t.Errorf("P75 of block averages = %v, want 300", got)
+	}
+
+	// With raw retention, a single block's fee distribution is visible
+	raw := NewTracker(4)
+	raw.RetainRawFees = 100
+	fees := make([]*big.Int, 0, 10)
+	for i := int64(1); i <= 10; i++ {
+		fees = append(fees, big.NewInt(i*10))
+	}
+	raw.OnBlockFinalized(1, fees)
+	if got := raw.GetMedianITXFee(1); got.Int64() != 55 {
+		t.Errorf("raw median = %v, want 55", got)
+	}
+	if got := raw.GetPercentileITXFee(1, 90); got.Int64() != 90 {
+		t.Errorf("raw P90 = %v, want 90", got)
+	}
+
+	// Returned values are copies
+	raw.GetPercentileITXFee(1, 100).SetInt64(0)
+	if got := raw.GetPercentileITXFee(1, 100); got.Int64() != 100 {
+		t.Errorf("max after mutating a result = %v, want 100", got)
+	}
+
+	// Retention is bounded per block
+	bounded := NewTracker(4)
+	bounded.RetainRawFees = 4
+	bounded.OnBlockFinalized(2, fees)
+	if n := len(bounded.rawWindows[2][0]); n != 4 {
+		t.Errorf("retained %d raw fees, want 4", n)
+	}
+}
+
+// TestTracker_EWMA tests the EWMA path: bootstrap, faster step response, and remote fee sync
+func TestTracker_EWMA(t *testing.T) {
+	ewma := NewTrackerEWMA(0.5)
+	windowed := NewTracker(16)
+
+	// Bootstrap: the first block sets the value directly
+	ewma.OnBlockFinalized(0, []*big.Int{big.NewInt(1000)})
+	if got := ewma.GetAvgITXFee(0); got.Int64() != 1000 {
+		t.Errorf("EWMA after first block = %v, want 1000", got)
+	}
+	for i := 0; i < 15; i++ {
+		ewma.OnBlockFinalized(0, []*big.Int{big.NewInt(1000)})
+	}
+	for i := 0; i < 16; i++ {
+		windowed.OnBlockFinalized(0, []*big.Int{big.NewInt(1000)})
+	}
+
+	// Step change 1000 -> 5000: after 4 blocks the EWMA is within 10% of the new level,
+	// while the 16-block windowed mean has moved only a quarter of the way
+	for i := 0; i < 4; i++ {
+		ewma.OnBlockFinalized(0, []*big.Int{big.NewInt(5000)})
+		windowed.OnBlockFinalized(0, []*big.Int{big.NewInt(5000)})
+	}
+	if got := ewma.GetAvgITXFee(0); got.Int64() != 4750 { // 5000 - 4000/2^4
+		t.Errorf("EWMA after step = %v, want 4750", got)
+	}
+	if got := windowed.GetAvgITXFee(0); got.Int64() != 2000 {
+		t.Errorf("windowed mean after step = %v, want 2000", got)
+	}
+
+	// Remote fee sync still sets the average directly; the first local block then replaces it
+	ewma.UpdateRemoteShardFee(1, big.NewInt(800))
+	if got := ewma.GetAvgITXFee(1); got.Int64() != 800 {
+		t.Errorf("remote EWMA shard = %v, want 800", got)
+	}
+	ewma.OnBlockFinalized(1, []*big.Int{big.NewInt(200)})
+	if got := ewma.GetAvgITXFee(1); got.Int64() != 200 {
+		t.Errorf("first local block after sync = %v, want 200", got)
+	}
+}
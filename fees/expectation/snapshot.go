@@ -0,0 +1,99 @@
+package expectation
+
+import (
+	"math/big"
+	"time"
+
+	"blockEmulator/utils/snapshot"
+)
+
+const (
+	// TrackerSnapshotKind tags Tracker snapshots in their envelope
+	TrackerSnapshotKind = "expectation.tracker"
+	// TrackerSnapshotVersion is the format written by Snapshot; bump it (and register a
+	// snapshot.Migration from the previous version) whenever trackerSnapshot changes
+	TrackerSnapshotVersion = 1
+)
+
+// trackerSnapshot is the serialized per-shard window and average state
+type trackerSnapshot struct {
+	WindowSize     int                  `json:"window_size"`
+	CountNilAsZero bool                 `json:"count_nil_as_zero"`
+	ITXWindows     map[int][]*big.Int   `json:"itx_windows"`
+	BlockCount     map[int]int          `json:"block_count"`
+	Avg            map[int]*big.Int     `json:"avg"`
+	Source         map[int]FeeSource    `json:"source"`
+	GasWindows     map[int][]*big.Int   `json:"gas_windows"`
+	GasAvg         map[int]*big.Int     `json:"gas_avg"`
+	RetainRawFees  int                  `json:"retain_raw_fees,omitempty"`
+	RawWindows     map[int][][]*big.Int `json:"raw_windows,omitempty"`
+	EWMAAlpha      float64              `json:"ewma_alpha,omitempty"`
+}
+
+// Snapshot serializes the tracker's windows and averages into a versioned blob
+func (t *Tracker) Snapshot() ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return snapshot.Encode(TrackerSnapshotKind, TrackerSnapshotVersion, trackerSnapshot{
+		WindowSize:     t.WindowSize,
+		CountNilAsZero: t.CountNilAsZero,
+		ITXWindows:     t.itxWindows,
+		BlockCount:     t.blockCount,
+		Avg:            t.avg,
+		Source:         t.source,
+		GasWindows:     t.gasWindows,
+		GasAvg:         t.gasAvg,
+		RetainRawFees:  t.RetainRawFees,
+		RawWindows:     t.rawWindows,
+		EWMAAlpha:      t.ewmaAlpha,
+	})
+}
+
+// Restore replaces the tracker state with a blob produced by Snapshot
+// An unknown version returns snapshot.ErrVersionMismatch and leaves the tracker untouched
+func (t *Tracker) Restore(data []byte) error {
+	var s trackerSnapshot
+	if err := snapshot.Decode(data, TrackerSnapshotKind, TrackerSnapshotVersion, &s); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s.WindowSize > 0 {
+		t.WindowSize = s.WindowSize
+	}
+	t.CountNilAsZero = s.CountNilAsZero
+	t.RetainRawFees = s.RetainRawFees
+	t.ewmaAlpha = s.EWMAAlpha
+	t.itxWindows = make(map[int][]*big.Int)
+	t.blockCount = make(map[int]int)
+	t.avg = make(map[int]*big.Int)
+	t.source = make(map[int]FeeSource)
+	t.gasWindows = make(map[int][]*big.Int)
+	t.gasAvg = make(map[int]*big.Int)
+	t.rawWindows = make(map[int][][]*big.Int)
+	t.remoteHeight = make(map[int]uint64)
+	t.remoteUpdated = make(map[int]time.Time)
+	for shard, w := range s.ITXWindows {
+		t.itxWindows[shard] = w
+	}
+	for shard, n := range s.BlockCount {
+		t.blockCount[shard] = n
+	}
+	for shard, v := range s.Avg {
+		t.avg[shard] = v
+	}
+	for shard, src := range s.Source {
+		t.source[shard] = src
+	}
+	for shard, w := range s.GasWindows {
+		t.gasWindows[shard] = w
+	}
+	for shard, v := range s.GasAvg {
+		t.gasAvg[shard] = v
+	}
+	for shard, w := range s.RawWindows {
+		t.rawWindows[shard] = w
+	}
+	return nil
+}
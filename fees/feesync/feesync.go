@@ -0,0 +1,25 @@
+// Package feesync builds the FeeInfoSync messages a shard sends to share its local average ITX fee.
+// It lives outside package fees because message depends on chain, which depends on fees
+package feesync
+
+import (
+	"blockEmulator/fees"
+	"blockEmulator/message"
+	"blockEmulator/params"
+)
+
+// BuildFeeSyncMessages reads the global tracker's average ITX fee of localShardID and returns
+// the signed FeeInfoSync messages to broadcast for blockHeight, carrying the local tx queue length
+// queueLen (-1 if unknown) for the receivers' dynamic subsidy modes. No message is produced while
+// the average is not positive, since receivers would reject it
+func BuildFeeSyncMessages(localShardID int, blockHeight uint64, queueLen int64) []*message.FeeInfoSync {
+	avgFee := fees.GetGlobalTracker().GetAvgITXFee(localShardID)
+	if avgFee == nil || avgFee.Sign() <= 0 {
+		return nil
+	}
+
+	feeMsg := message.NewFeeInfoSync(uint64(localShardID), avgFee, blockHeight)
+	feeMsg.QueueLength = queueLen
+	feeMsg.Sign([]byte(params.JustitiaFeeSyncKey))
+	return []*message.FeeInfoSync{feeMsg}
+}
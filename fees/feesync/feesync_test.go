@@ -0,0 +1,46 @@
+package feesync
+
+import (
+	"blockEmulator/fees"
+	"blockEmulator/message"
+	"blockEmulator/params"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+// TestBuildFeeSyncMessages tests that the message carries the tracker average and survives transport
+func TestBuildFeeSyncMessages(t *testing.T) {
+	fees.ResetGlobalTracker()
+	defer fees.ResetGlobalTracker()
+
+	// An empty tracker produces nothing
+	if msgs := BuildFeeSyncMessages(1, 7, -1); len(msgs) != 0 {
+		t.Fatalf("Expected no messages from an empty tracker, got %d", len(msgs))
+	}
+
+	fees.GetGlobalTracker().OnBlockFinalized(1, []*big.Int{big.NewInt(1000), big.NewInt(3000)})
+	want := fees.GetGlobalTracker().GetAvgITXFee(1)
+
+	msgs := BuildFeeSyncMessages(1, 42, 350)
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(msgs))
+	}
+
+	b, err := json.Marshal(msgs[0])
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	got := new(message.FeeInfoSync)
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if got.ShardID != 1 || got.BlockHeight != 42 || got.AvgITXFee.Cmp(want) != 0 || got.QueueLength != 350 {
+		t.Errorf("Round-tripped message = shard %d height %d avg %v queue %d, want shard 1 height 42 avg %v queue 350",
+			got.ShardID, got.BlockHeight, got.AvgITXFee, got.QueueLength, want)
+	}
+	if err := got.Validate(nil, []byte(params.JustitiaFeeSyncKey)); err != nil {
+		t.Errorf("Round-tripped message rejected: %v", err)
+	}
+}
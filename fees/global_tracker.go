@@ -5,6 +5,7 @@ import (
 	"blockEmulator/fees/expectation"
 	"blockEmulator/params"
 	"sync"
+	"time"
 )
 
 var (
@@ -21,6 +22,8 @@ func GetGlobalTracker() *expectation.Tracker {
 			windowSize = 16 // default
 		}
 		globalTracker = expectation.NewTracker(windowSize)
+		globalTracker.MaxRemoteFeeAge = time.Duration(params.JustitiaRemoteFeeMaxAgeMs) * time.Millisecond
+		globalTracker.MaxRemoteQueueAge = time.Duration(params.JustitiaRemoteQueueMaxAgeMs) * time.Millisecond
 	})
 	return globalTracker
 }
@@ -0,0 +1,107 @@
+package fees
+
+import (
+	"math/big"
+	"sync"
+	"time"
+)
+
+// SyncThrottle rate-limits FeeInfoSync broadcasts. Updates arriving within Interval of the last
+// broadcast are coalesced: they are not sent, and the next broadcast carries the latest average.
+// A change of more than ChangeThreshold (relative to the last broadcast value) is sent immediately.
+// Defer arranges a trailing flush, so a coalesced update still goes out once the interval has
+// passed even if no further update arrives
+type SyncThrottle struct {
+	Interval        time.Duration // Minimum time between broadcasts (0 = broadcast every update)
+	ChangeThreshold float64       // Relative change that bypasses the interval, e.g. 0.2 = 20% (0 = disabled)
+
+	mu        sync.Mutex
+	lastSent  time.Time
+	lastValue *big.Int    // Average carried by the last broadcast (nil = never broadcast)
+	pending   func()      // Trailing flush for the latest coalesced update (nil = none)
+	timer     *time.Timer // Fires pending once the interval has passed (nil = not armed)
+}
+
+// NewSyncThrottle creates a throttle with the given interval and change threshold
+func NewSyncThrottle(interval time.Duration, changeThreshold float64) *SyncThrottle {
+	return &SyncThrottle{
+		Interval:        interval,
+		ChangeThreshold: changeThreshold,
+	}
+}
+
+// ShouldBroadcast reports whether avg should be broadcast at time now. Nothing is recorded:
+// call Sent once a message carrying avg has actually been built and sent. nil avg is treated as zero
+func (st *SyncThrottle) ShouldBroadcast(avg *big.Int, now time.Time) bool {
+	if avg == nil {
+		avg = new(big.Int)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.lastValue == nil || st.Interval <= 0 ||
+		now.Sub(st.lastSent) >= st.Interval || st.changedBeyondThreshold(avg)
+}
+
+// Sent records avg as broadcast at time now and cancels any pending trailing flush
+func (st *SyncThrottle) Sent(avg *big.Int, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.lastSent = now
+	st.lastValue = new(big.Int)
+	if avg != nil {
+		st.lastValue.Set(avg)
+	}
+	st.pending = nil
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+}
+
+// Defer registers flush as the trailing broadcast for an update coalesced at time now. It runs
+// once Interval has passed since the last broadcast, unless Sent is called first. Only the most
+// recent flush is kept, so it carries the latest average
+func (st *SyncThrottle) Defer(now time.Time, flush func()) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.pending = flush
+	if st.timer != nil {
+		return
+	}
+	wait := st.Interval - now.Sub(st.lastSent)
+	if wait < 0 {
+		wait = 0
+	}
+	st.timer = time.AfterFunc(wait, st.flushPending)
+}
+
+// flushPending runs the pending trailing flush, if it was not cancelled by Sent
+func (st *SyncThrottle) flushPending() {
+	st.mu.Lock()
+	flush := st.pending
+	st.pending = nil
+	st.timer = nil
+	st.mu.Unlock()
+
+	if flush != nil {
+		flush()
+	}
+}
+
+// changedBeyondThreshold reports whether avg differs from the last broadcast value by more than
+// ChangeThreshold of that value (caller must hold lock)
+func (st *SyncThrottle) changedBeyondThreshold(avg *big.Int) bool {
+	if st.ChangeThreshold <= 0 {
+		return false
+	}
+	if st.lastValue.Sign() == 0 {
+		return avg.Sign() != 0
+	}
+	diff := new(big.Float).SetInt(new(big.Int).Abs(new(big.Int).Sub(avg, st.lastValue)))
+	limit := new(big.Float).SetInt(new(big.Int).Abs(st.lastValue))
+	limit.Mul(limit, big.NewFloat(st.ChangeThreshold))
+	return diff.Cmp(limit) > 0
+}
@@ -0,0 +1,120 @@
+package fees
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestSyncThrottle_BoundedBroadcasts tests that rapid average changes yield at most one broadcast per interval
+func TestSyncThrottle_BoundedBroadcasts(t *testing.T) {
+	st := NewSyncThrottle(time.Second, 0)
+	start := time.Unix(1700000000, 0)
+
+	// 100 updates, 50ms apart (5 s total), each with a different average
+	sent := 0
+	var lastSentAt time.Time
+	for i := 0; i < 100; i++ {
+		now := start.Add(time.Duration(i) * 50 * time.Millisecond)
+		if st.ShouldBroadcast(big.NewInt(int64(1000+i)), now) {
+			st.Sent(big.NewInt(int64(1000+i)), now)
+			if sent > 0 && now.Sub(lastSentAt) < time.Second {
+				t.Errorf("Broadcast at %v only %v after the previous one", now.Sub(start), now.Sub(lastSentAt))
+			}
+			sent++
+			lastSentAt = now
+		}
+	}
+	// One broadcast per elapsed second (0s, 1s, 2s, 3s, 4s)
+	if sent != 5 {
+		t.Errorf("Broadcasts = %d, want 5", sent)
+	}
+
+	// The next broadcast carries the latest coalesced value
+	if !st.ShouldBroadcast(big.NewInt(4242), lastSentAt.Add(time.Second)) {
+		t.Fatal("Expected a broadcast once the interval has passed")
+	}
+	st.Sent(big.NewInt(4242), lastSentAt.Add(time.Second))
+	if st.lastValue.Int64() != 4242 {
+		t.Errorf("Expected the latest value 4242 to be broadcast, last value = %v", st.lastValue)
+	}
+}
+
+// TestSyncThrottle_ChangeThreshold tests that a large change bypasses the interval
+func TestSyncThrottle_ChangeThreshold(t *testing.T) {
+	st := NewSyncThrottle(time.Minute, 0.2)
+	now := time.Unix(1700000000, 0)
+
+	if !st.ShouldBroadcast(big.NewInt(1000), now) {
+		t.Fatal("First update should always be broadcast")
+	}
+	st.Sent(big.NewInt(1000), now)
+	if st.ShouldBroadcast(big.NewInt(1150), now.Add(time.Second)) {
+		t.Error("A 15% change within the interval should be coalesced")
+	}
+	if !st.ShouldBroadcast(big.NewInt(1300), now.Add(2*time.Second)) {
+		t.Error("A 30% change should be broadcast immediately")
+	}
+	st.Sent(big.NewInt(1300), now.Add(2*time.Second))
+	if st.ShouldBroadcast(big.NewInt(1400), now.Add(3*time.Second)) {
+		t.Error("Change is measured from the last broadcast value (1300), so 1400 should be coalesced")
+	}
+
+	// Interval 0 keeps the per-block behaviour
+	every := NewSyncThrottle(0, 0)
+	for i := 0; i < 3; i++ {
+		if !every.ShouldBroadcast(big.NewInt(1000), now) {
+			t.Errorf("Update %d not broadcast with interval 0", i)
+		}
+		every.Sent(big.NewInt(1000), now)
+	}
+}
+
+// TestSyncThrottle_UnsentNotRecorded tests that an update that was never sent does not count as broadcast
+func TestSyncThrottle_UnsentNotRecorded(t *testing.T) {
+	st := NewSyncThrottle(time.Minute, 0)
+	now := time.Unix(1700000000, 0)
+
+	// No message was built (e.g. the average was not yet positive), so Sent is not called
+	if !st.ShouldBroadcast(big.NewInt(0), now) {
+		t.Fatal("First update should always be broadcast")
+	}
+	if !st.ShouldBroadcast(big.NewInt(1000), now.Add(time.Second)) {
+		t.Error("An update after an unsent one should still be broadcast")
+	}
+}
+
+// TestSyncThrottle_TrailingFlush tests that a coalesced update is flushed once the interval passes
+func TestSyncThrottle_TrailingFlush(t *testing.T) {
+	st := NewSyncThrottle(20*time.Millisecond, 0)
+	now := time.Now()
+	st.Sent(big.NewInt(1000), now)
+
+	flushed := make(chan int, 2)
+	st.Defer(now, func() { flushed <- 1 })
+	st.Defer(now, func() { flushed <- 2 }) // Replaces the first: only the latest update is flushed
+
+	select {
+	case got := <-flushed:
+		if got != 2 {
+			t.Errorf("Flushed update %d, want the latest (2)", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Coalesced update was never flushed")
+	}
+	select {
+	case got := <-flushed:
+		t.Errorf("Unexpected second flush of update %d", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A broadcast recorded before the interval passes cancels the flush
+	st.Sent(big.NewInt(1100), time.Now())
+	st.Defer(time.Now(), func() { flushed <- 3 })
+	st.Sent(big.NewInt(1200), time.Now())
+	select {
+	case got := <-flushed:
+		t.Errorf("Flush %d ran after a newer broadcast was sent", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
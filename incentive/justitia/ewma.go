@@ -0,0 +1,58 @@
+package justitia
+
+import "math/big"
+
+// PairKey identifies an ordered (source, destination) shard pair for per-pair mechanism state
+type PairKey struct {
+	From int
+	To   int
+}
+
+// NoPair is the key used when the caller has no shard pair context (CalculateRAB, PeekRAB, WhatIf)
+var NoPair = PairKey{From: -1, To: -1}
+
+// DefaultEBSmoothingAlpha is the weight of the newest EB used by DefaultConfig for SubsidyEWMADestAvg
+const DefaultEBSmoothingAlpha = 0.2
+
+// smoothEB advances pair's smoothed EB towards EB and returns the new value (caller must hold lock)
+// The first observation of a pair is taken as is; afterwards
+// smoothed = prev + EBSmoothingAlpha*(EB - prev). An alpha outside (0, 1) disables smoothing
+func (m *Mechanism) smoothEB(pair PairKey, EB *big.Int) *big.Int {
+	if EB == nil {
+		return big.NewInt(0)
+	}
+	if m.smoothedEB == nil {
+		m.smoothedEB = make(map[PairKey]*big.Int)
+	}
+
+	alpha := m.config.EBSmoothingAlpha
+	prev, ok := m.smoothedEB[pair]
+	var cur *big.Int
+	if !ok || alpha <= 0 || alpha >= 1 {
+		cur = new(big.Int).Set(EB)
+	} else {
+		delta := new(big.Float).SetInt(new(big.Int).Sub(EB, prev))
+		step, _ := delta.Mul(delta, big.NewFloat(alpha)).Int(nil)
+		cur = step.Add(step, prev)
+	}
+	m.smoothedEB[pair] = cur
+	return new(big.Int).Set(cur)
+}
+
+// GetSmoothedEB returns the current smoothed EB of pair (nil if the pair has not been seen)
+func (m *Mechanism) GetSmoothedEB(pair PairKey) *big.Int {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	if v, ok := m.smoothedEB[pair]; ok {
+		return new(big.Int).Set(v)
+	}
+	return nil
+}
+
+// ResetPair forgets the smoothed EB of pair, so its next subsidy starts from the raw EB again
+// (e.g. after one of the shards is split or merged). Other pairs are kept
+func (m *Mechanism) ResetPair(pair PairKey) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	delete(m.smoothedEB, pair)
+}
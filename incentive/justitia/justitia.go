@@ -3,8 +3,10 @@ package justitia
 
 import (
 	"fmt"
+	"log"
 	"math"
 	"math/big"
+	"reflect"
 	"sync"
 	"time"
 )
@@ -27,6 +29,12 @@ const (
 	SubsidyPID
 	// SubsidyLagrangian means use Lagrangian optimization for dynamic subsidy
 	SubsidyLagrangian
+	// SubsidyRL means use a learned (epsilon-greedy bandit) multiplier of EB per congestion level
+	SubsidyRL
+	// SubsidyEWMADestAvg means R = E(f_B) smoothed per shard pair by an exponentially weighted moving average
+	SubsidyEWMADestAvg
+	// SubsidyCap means R = min(E(f_B), Config.MaxSubsidyPerTx) (DestAvg with an absolute per-tx ceiling)
+	SubsidyCap
 )
 
 // String returns the string representation of the subsidy mode
@@ -46,6 +54,12 @@ func (m SubsidyMode) String() string {
 		return "PID"
 	case SubsidyLagrangian:
 		return "Lagrangian"
+	case SubsidyRL:
+		return "RL"
+	case SubsidyEWMADestAvg:
+		return "EWMADestAvg"
+	case SubsidyCap:
+		return "Cap"
 	default:
 		return "Unknown"
 	}
@@ -65,8 +79,12 @@ type PIDState struct {
 	Integral   float64   // Accumulated integral term
 	PrevError  float64   // Previous error for derivative calculation
 	LastUpdate time.Time // Last update timestamp
+	Saturated  bool      // Whether the integral hit its anti-windup clamp on the last update
 }
 
+// DefaultPIDMaxIntegral is the anti-windup bound used when PIDParams.MaxIntegral is not positive
+const DefaultPIDMaxIntegral = 10.0
+
 // PIDParams holds PID controller parameters
 type PIDParams struct {
 	Kp               float64 // Proportional gain
@@ -76,6 +94,8 @@ type PIDParams struct {
 	CapacityB        float64 // Capacity of destination shard queue
 	MinSubsidy       float64 // Minimum subsidy multiplier
 	MaxSubsidy       float64 // Maximum subsidy multiplier
+	MaxSubsidyWei    *big.Int // Absolute subsidy ceiling in wei, applied after the multiplier (nil or 0 = no ceiling)
+	MaxIntegral      float64 // Anti-windup bound on |Integral| (<= 0 = DefaultPIDMaxIntegral)
 }
 
 // LagrangianState holds the internal state for Lagrangian optimization
@@ -93,6 +113,7 @@ type LagrangianParams struct {
 	MinLambda        float64   // Minimum shadow price (prevents division by zero)
 	MaxLambda        float64   // Maximum shadow price (prevents extreme values)
 	CongestionExp    float64   // Exponent for congestion factor (default: 2.0 for quadratic)
+	ReliefWeight     float64   // Extra lambda step when overspending fails to reduce the queue (0 disables)
 }
 
 
@@ -107,26 +128,101 @@ type Config struct {
 	// Dynamic algorithm parameters
 	PIDParams        PIDParams        // PID controller parameters
 	LagrangianParams LagrangianParams // Lagrangian optimization parameters
+	RLParams         RLParams         // RL policy parameters
 	MaxInflation     *big.Int         // Maximum inflation limit per epoch
+	EpochBlocks      uint64           // Number of blocks per Lagrangian or RL epoch (0 disables automatic epoch updates)
+	BaseBlockReward  *big.Int         // Fixed per-block proposer reward on top of fees and subsidies
 	TargetQueueLen   int64            // Target queue length for dynamic algorithms (deprecated, use PIDParams.TargetUtilization)
+
+	// Dynamic modes (PID, Lagrangian) only scale the subsidy once QueueLengthB reaches MinQueueForSubsidy;
+	// below it they pay the plain DestAvg subsidy EB, or zero if ZeroBelowMinQueue is set (0 = always active)
+	MinQueueForSubsidy int64
+	ZeroBelowMinQueue  bool
+
+	// Use the gas-weighted E(f_s) (each ITX fee weighted by its gas) instead of the count-weighted one
+	UseGasWeightedExpectation bool
+
+	// When EA == EB the Case2 threshold EA-EB collapses to 0; if set, every CTX below EA is
+	// classified Case3 instead of deferring zero-utility CTX to Case2 (see ClassifyWithConfig)
+	EqualFeesSkipCase2 bool
+
+	// Statistic of each shard's fee window used as EA/EB when computing the subsidy R:
+	// 0 = mean, 1 = median, 2 = P75, 3 = P90 (see expectation.ReferenceMode).
+	// Classification and the Shapley split keep using the mean E(f_s)
+	FeeReferenceMode int
+
+	// Number of recent CalculateRAB samples kept for GetTelemetry (0 = telemetry disabled)
+	TelemetryBufferSize int
+
+	// Weight of the newest EB in SubsidyEWMADestAvg's per-pair moving average (outside (0, 1) = plain DestAvg)
+	EBSmoothingAlpha float64
+
+	// CTX whose user fee f_AB is below this floor receive no subsidy (nil or 0 = every CTX qualifies),
+	// so a zero-fee CTX cannot be paid for entirely by the subsidy. See ShouldSubsidize
+	MinUserFeeForSubsidy *big.Int
+
+	// Absolute per-tx subsidy ceiling in wei for SubsidyCap (nil or 0 = unlimited, i.e. plain DestAvg)
+	MaxSubsidyPerTx *big.Int
 }
 
+// TelemetrySample is one control-loop snapshot recorded by CalculateRAB
+type TelemetrySample struct {
+	Timestamp time.Time
+	Lambda    float64  // Lagrangian shadow price after the call
+	Integral  float64  // PID integral term after the call
+	R         *big.Int // Subsidy returned
+}
+
+// Clock supplies the current time for the PID time delta and the Lagrangian/telemetry timestamps
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the default Clock backed by time.Now
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// fixedClock always reports the same instant; estimates use it to pin the PID time delta
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
 // Mechanism holds the stateful Justitia incentive mechanism
 type Mechanism struct {
 	config          *Config
+	clock           Clock
 	pidState        *PIDState
 	lagrangianState *LagrangianState
+	rlState         *RLState
+	lastMultiplier  float64              // Effective R/EB of the last CalculateRAB call (0 if EB <= 0)
+	smoothedEB      map[PairKey]*big.Int // Per-pair smoothed EB for SubsidyEWMADestAvg
 	stateLock       sync.Mutex
+
+	// Ring buffer of the last Config.TelemetryBufferSize samples (guarded by stateLock)
+	telemetry      []TelemetrySample
+	telemetryHead  int // Next write position
+	telemetryCount int // Valid samples, at most len(telemetry)
 }
 
 // NewMechanism creates a new Justitia mechanism with the given configuration
 func NewMechanism(config *Config) *Mechanism {
+	return NewMechanismWithClock(config, nil)
+}
+
+// NewMechanismWithClock is NewMechanism with an injected clock (nil uses real time), so that
+// PID integral/derivative terms advance deterministically in tests and replayed experiments
+func NewMechanismWithClock(config *Config, clock Clock) *Mechanism {
 	if config == nil {
 		config = DefaultConfig()
 	}
-	now := time.Now()
+	if clock == nil {
+		clock = realClock{}
+	}
+	now := clock.Now()
 	m := &Mechanism{
 		config: config,
+		clock:  clock,
 		pidState: &PIDState{
 			Integral:   0.0,
 			PrevError:  0.0,
@@ -138,29 +234,52 @@ func NewMechanism(config *Config) *Mechanism {
 			LastUpdate:     now,
 			EpochStartTime: now,
 		},
+		rlState:    newRLState(config.RLParams),
+		smoothedEB: make(map[PairKey]*big.Int),
 	}
 	
 	return m
 }
 
+// defaultCongestionReference is the queue size used to normalize congestion when no
+// positive capacity/window is configured
+const defaultCongestionReference = 1000.0
+
+// normalizeCongestion returns queueLen / reference, using defaultCongestionReference when
+// reference is non-positive; negative queue lengths are treated as empty
+func normalizeCongestion(queueLen int64, reference float64) float64 {
+	if reference <= 0 {
+		reference = defaultCongestionReference
+	}
+	if queueLen <= 0 {
+		return 0
+	}
+	return float64(queueLen) / reference
+}
+
+// finiteMultiplier returns v, or 0 with a logged warning if v is NaN or infinite, so a
+// degenerate configuration (e.g. a zero base with a negative exponent) yields no subsidy
+// instead of a garbage big.Float conversion
+func finiteMultiplier(v float64, mode string) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		log.Printf("Justitia: %s subsidy multiplier is %v, falling back to zero subsidy\n", mode, v)
+		return 0
+	}
+	return v
+}
+
 // calcPIDSubsidy computes the PID-controlled subsidy based on queue metrics
-func calcPIDSubsidy(metrics *DynamicMetrics, config *Config, state *PIDState, EB *big.Int) *big.Int {
+// now is the current time of the mechanism's clock; dt is measured against state.LastUpdate
+func calcPIDSubsidy(metrics *DynamicMetrics, config *Config, state *PIDState, EB *big.Int, now time.Time) *big.Int {
 	if metrics == nil || EB == nil {
 		return big.NewInt(0)
 	}
 
 	params := config.PIDParams
-	now := time.Now()
 	
 	// Calculate current utilization (error signal)
 	// Error = QueueLengthB / CapacityB - TargetUtilization
-	var currentUtilization float64
-	if params.CapacityB > 0 {
-		currentUtilization = float64(metrics.QueueLengthB) / params.CapacityB
-	} else {
-		// Fallback: normalize by a reasonable default capacity (e.g., 1000)
-		currentUtilization = float64(metrics.QueueLengthB) / 1000.0
-	}
+	currentUtilization := finiteMultiplier(normalizeCongestion(metrics.QueueLengthB, params.CapacityB), "PID")
 	
 	error := currentUtilization - params.TargetUtilization
 	
@@ -173,11 +292,17 @@ func calcPIDSubsidy(metrics *DynamicMetrics, config *Config, state *PIDState, EB
 	// Update integral (with anti-windup)
 	state.Integral += error * dt
 	// Anti-windup: clamp integral to reasonable bounds
-	maxIntegral := 10.0
+	maxIntegral := params.MaxIntegral
+	if maxIntegral <= 0 {
+		maxIntegral = DefaultPIDMaxIntegral
+	}
+	state.Saturated = false
 	if state.Integral > maxIntegral {
 		state.Integral = maxIntegral
+		state.Saturated = true
 	} else if state.Integral < -maxIntegral {
 		state.Integral = -maxIntegral
+		state.Saturated = true
 	}
 	
 	// Calculate derivative
@@ -199,6 +324,7 @@ func calcPIDSubsidy(metrics *DynamicMetrics, config *Config, state *PIDState, EB
 	if multiplier > params.MaxSubsidy {
 		multiplier = params.MaxSubsidy
 	}
+	multiplier = finiteMultiplier(multiplier, "PID")
 	
 	// Convert EB to float, apply multiplier, convert back to big.Int
 	ebFloat := new(big.Float).SetInt(EB)
@@ -211,6 +337,11 @@ func calcPIDSubsidy(metrics *DynamicMetrics, config *Config, state *PIDState, EB
 	if result.Sign() < 0 {
 		return big.NewInt(0)
 	}
+
+	// Absolute ceiling: whichever of MaxSubsidy*EB and MaxSubsidyWei is smaller binds
+	if params.MaxSubsidyWei != nil && params.MaxSubsidyWei.Sign() > 0 && result.Cmp(params.MaxSubsidyWei) > 0 {
+		result.Set(params.MaxSubsidyWei)
+	}
 	
 	return result
 }
@@ -227,15 +358,7 @@ func calcLagrangianSubsidy(metrics *DynamicMetrics, config *Config, state *Lagra
 	
 	// Calculate congestion factor: (QueueLengthB / WindowSize)^CongestionExp
 	// This gives quadratic (or higher) preference to congested shards
-	var congestionFactor float64
-	if params.WindowSize > 0 {
-		utilization := float64(metrics.QueueLengthB) / params.WindowSize
-		congestionFactor = math.Pow(utilization, params.CongestionExp)
-	} else {
-		// Fallback: use normalized queue length with default window
-		utilization := float64(metrics.QueueLengthB) / 1000.0
-		congestionFactor = math.Pow(utilization, params.CongestionExp)
-	}
+	congestionFactor := math.Pow(normalizeCongestion(metrics.QueueLengthB, params.WindowSize), params.CongestionExp)
 	
 	// Apply shadow price (Lagrange multiplier)
 	// Higher lambda means we're approaching inflation limit, so reduce subsidy
@@ -249,7 +372,7 @@ func calcLagrangianSubsidy(metrics *DynamicMetrics, config *Config, state *Lagra
 	ebFloat := new(big.Float).SetInt(EB)
 	
 	// Apply congestion factor and shadow price
-	multiplier := congestionFactor / lambda
+	multiplier := finiteMultiplier(congestionFactor/lambda, "Lagrangian")
 	
 	// Calculate result
 	resultFloat := new(big.Float).Mul(ebFloat, big.NewFloat(multiplier))
@@ -268,10 +391,55 @@ func calcLagrangianSubsidy(metrics *DynamicMetrics, config *Config, state *Lagra
 // UpdateShadowPrice updates the Lagrange multiplier (shadow price) based on inflation constraint
 // This should be called periodically (e.g., at the end of each block or epoch)
 // Formula: Lambda_new = Lambda_old + Alpha * (TotalSubsidy - InflationLimit)
+//
+// Deprecated: the caller-supplied total can diverge from what the mechanism issued. Record each
+// subsidy with AccountSubsidy and call UpdateShadowPriceFromAccumulated instead
 func (m *Mechanism) UpdateShadowPrice(totalSubsidyIssued *big.Int, inflationLimit *big.Int) {
 	m.stateLock.Lock()
 	defer m.stateLock.Unlock()
-	
+
+	m.updateShadowPriceInternal(totalSubsidyIssued, inflationLimit, 1.0)
+}
+
+// UpdateShadowPriceFromAccumulated updates the shadow price like UpdateShadowPrice, using the
+// epoch total accumulated by AccountSubsidy as the issued subsidy
+func (m *Mechanism) UpdateShadowPriceFromAccumulated(inflationLimit *big.Int) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	total := new(big.Int).Set(m.lagrangianState.TotalSubsidy)
+	m.updateShadowPriceInternal(total, inflationLimit, 1.0)
+}
+
+// UpdateShadowPriceWithRelief updates the shadow price like UpdateShadowPrice, but attributes
+// overspending to its congestion outcome: if the subsidy did not reduce the destination queue
+// (queueAfter >= queueBefore), the upward lambda step is amplified by up to (1 + ReliefWeight)
+// Formula: failure = 1 - clamp((queueBefore - queueAfter) / queueBefore, 0, 1)
+//          Lambda_new = Lambda_old + Alpha * NormalizedViolation * (1 + ReliefWeight * failure)
+// Underspending (negative violation) is applied unchanged
+func (m *Mechanism) UpdateShadowPriceWithRelief(totalSubsidyIssued, inflationLimit *big.Int, queueBefore, queueAfter int64) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	if totalSubsidyIssued == nil || inflationLimit == nil {
+		return
+	}
+
+	multiplier := 1.0
+	if totalSubsidyIssued.Cmp(inflationLimit) > 0 {
+		relief := 0.0
+		if queueBefore > 0 {
+			relief = float64(queueBefore-queueAfter) / float64(queueBefore)
+		}
+		relief = math.Max(0, math.Min(1, relief))
+		multiplier += m.config.LagrangianParams.ReliefWeight * (1 - relief)
+	}
+
+	m.updateShadowPriceInternal(totalSubsidyIssued, inflationLimit, multiplier)
+}
+
+// updateShadowPriceInternal applies the shadow price update scaled by stepMultiplier (caller must hold lock)
+func (m *Mechanism) updateShadowPriceInternal(totalSubsidyIssued *big.Int, inflationLimit *big.Int, stepMultiplier float64) {
 	if totalSubsidyIssued == nil || inflationLimit == nil {
 		return
 	}
@@ -298,7 +466,7 @@ func (m *Mechanism) UpdateShadowPrice(totalSubsidyIssued *big.Int, inflationLimi
 	}
 	
 	// Update shadow price: Lambda = Lambda + Alpha * NormalizedViolation
-	newLambda := state.Lambda + params.Alpha*normalizedViolation
+	newLambda := state.Lambda + params.Alpha*normalizedViolation*stepMultiplier
 	
 	// Clamp lambda to reasonable bounds
 	if newLambda < params.MinLambda {
@@ -311,7 +479,7 @@ func (m *Mechanism) UpdateShadowPrice(totalSubsidyIssued *big.Int, inflationLimi
 	// Update state
 	state.Lambda = newLambda
 	state.TotalSubsidy = new(big.Int).Set(totalSubsidyIssued)
-	state.LastUpdate = time.Now()
+	state.LastUpdate = m.clock.Now()
 }
 
 // ResetEpoch resets the Lagrangian state for a new epoch
@@ -320,13 +488,59 @@ func (m *Mechanism) ResetEpoch() {
 	m.stateLock.Lock()
 	defer m.stateLock.Unlock()
 	
-	now := time.Now()
+	now := m.clock.Now()
 	m.lagrangianState.TotalSubsidy = big.NewInt(0)
 	m.lagrangianState.EpochStartTime = now
 	m.lagrangianState.LastUpdate = now
 	// Note: Lambda is NOT reset - it carries over to provide continuity
 }
 
+// FullReset restores the mechanism to its freshly constructed state
+// Unlike ResetEpoch, this also resets Lambda to its initial value, clears the PID
+// integral and derivative history, forgets the RL policy and the smoothed EB of every pair
+// (e.g. at experiment start or after a regime change)
+func (m *Mechanism) FullReset() {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	now := m.clock.Now()
+	m.pidState.Integral = 0.0
+	m.pidState.PrevError = 0.0
+	m.pidState.Saturated = false
+	m.pidState.LastUpdate = now
+
+	m.lagrangianState.Lambda = 1.0
+	m.lagrangianState.TotalSubsidy = big.NewInt(0)
+	m.lagrangianState.LastUpdate = now
+	m.lagrangianState.EpochStartTime = now
+
+	m.rlState = newRLState(m.config.RLParams)
+	m.smoothedEB = make(map[PairKey]*big.Int)
+
+	m.lastMultiplier = 0
+	m.telemetryHead, m.telemetryCount = 0, 0
+}
+
+// GetPIDState returns a copy of the PID controller state, including whether the integral
+// was clamped by the anti-windup bound on the last update
+func (m *Mechanism) GetPIDState() PIDState {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	return *m.pidState
+}
+
+// ResetPID clears the PID integral and derivative history (e.g. when switching fee regimes)
+// The Lagrangian and RL state are left untouched; see FullReset to reset everything
+func (m *Mechanism) ResetPID() {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	m.pidState.Integral = 0.0
+	m.pidState.PrevError = 0.0
+	m.pidState.Saturated = false
+	m.pidState.LastUpdate = m.clock.Now()
+}
+
 // GetShadowPrice returns the current shadow price (Lambda)
 // This is useful for monitoring and debugging
 func (m *Mechanism) GetShadowPrice() float64 {
@@ -335,6 +549,77 @@ func (m *Mechanism) GetShadowPrice() float64 {
 	return m.lagrangianState.Lambda
 }
 
+// AccountSubsidy adds an issued subsidy to the current epoch's total (non-positive R is ignored)
+// The total feeds UpdateShadowPriceFromAccumulated and is cleared by ResetEpoch
+func (m *Mechanism) AccountSubsidy(R *big.Int) {
+	if R == nil || R.Sign() <= 0 {
+		return
+	}
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	m.lagrangianState.TotalSubsidy.Add(m.lagrangianState.TotalSubsidy, R)
+}
+
+// RecordSubsidy adds an issued subsidy to the current epoch's total
+//
+// Deprecated: use AccountSubsidy
+func (m *Mechanism) RecordSubsidy(R *big.Int) {
+	m.AccountSubsidy(R)
+}
+
+// GetAccumulatedSubsidy returns a copy of the subsidy accounted in the current epoch
+func (m *Mechanism) GetAccumulatedSubsidy() *big.Int {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	return new(big.Int).Set(m.lagrangianState.TotalSubsidy)
+}
+
+// InflationUtilization returns the current epoch's totalSubsidy / MaxInflation, clamped to [0, inf)
+// Returns 0 if no inflation cap is configured
+func (m *Mechanism) InflationUtilization() float64 {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	limit := m.config.MaxInflation
+	total := m.lagrangianState.TotalSubsidy
+	if limit == nil || limit.Sign() <= 0 || total == nil || total.Sign() <= 0 {
+		return 0
+	}
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(total), new(big.Float).SetInt(limit)).Float64()
+	return ratio
+}
+
+// IsInflationBinding reports whether inflation utilization has reached threshold (e.g. 1.0 = at the cap)
+func (m *Mechanism) IsInflationBinding(threshold float64) bool {
+	return m.InflationUtilization() >= threshold
+}
+
+// MeetsMinUserFee reports whether a CTX paying fAB (nil = 0) reaches the subsidy fee floor
+// A nil or non-positive floor admits every CTX
+func MeetsMinUserFee(fAB, floor *big.Int) bool {
+	if floor == nil || floor.Sign() <= 0 {
+		return true
+	}
+	return fAB != nil && fAB.Cmp(floor) >= 0
+}
+
+// ShouldSubsidize reports whether a CTX paying fAB is eligible for a subsidy under
+// Config.MinUserFeeForSubsidy. CalculateRAB never sees f_AB, so callers check this first
+func (m *Mechanism) ShouldSubsidize(fAB *big.Int) bool {
+	return MeetsMinUserFee(fAB, m.config.MinUserFeeForSubsidy)
+}
+
+// SetClock replaces the mechanism's clock (nil restores real time). State timestamps are not
+// rewritten, so the next PID update measures dt from the last update against the new clock
+func (m *Mechanism) SetClock(clock Clock) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	if clock == nil {
+		clock = realClock{}
+	}
+	m.clock = clock
+}
+
 // GetConfig returns the mechanism's configuration
 func (m *Mechanism) GetConfig() *Config {
 	return m.config
@@ -348,14 +633,141 @@ func (m *Mechanism) GetConfig() *Config {
 // IMPORTANT: This function NEVER uses f_AB (the transaction fee)
 // Returns a new big.Int containing the subsidy amount
 func (m *Mechanism) CalculateRAB(EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
+	return m.CalculateRABForPair(NoPair, EA, EB, metrics)
+}
+
+// CalculateRABForPair is CalculateRAB for a CTX from shard pair.From to pair.To
+// Per-pair state (the smoothed EB of SubsidyEWMADestAvg) is tracked separately for each pair
+func (m *Mechanism) CalculateRABForPair(pair PairKey, EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
 	m.stateLock.Lock()
 	defer m.stateLock.Unlock()
 	
-	return m.calculateRABInternal(EA, EB, metrics)
+	R := m.calculateRABInternal(pair, EA, EB, metrics)
+	m.lastMultiplier = effectiveMultiplier(R, EB)
+	m.recordTelemetry(R)
+	return R
+}
+
+// recordTelemetry appends a sample to the telemetry ring buffer (caller must hold lock)
+// The buffer is allocated once at the configured size, so memory stays bounded
+func (m *Mechanism) recordTelemetry(R *big.Int) {
+	size := m.config.TelemetryBufferSize
+	if size <= 0 {
+		return
+	}
+	if len(m.telemetry) != size {
+		m.telemetry = make([]TelemetrySample, size)
+		m.telemetryHead, m.telemetryCount = 0, 0
+	}
+
+	m.telemetry[m.telemetryHead] = TelemetrySample{
+		Timestamp: m.clock.Now(),
+		Lambda:    m.lagrangianState.Lambda,
+		Integral:  m.pidState.Integral,
+		R:         new(big.Int).Set(R),
+	}
+	m.telemetryHead = (m.telemetryHead + 1) % size
+	if m.telemetryCount < size {
+		m.telemetryCount++
+	}
+}
+
+// GetTelemetry returns a copy of the retained telemetry samples, oldest first
+func (m *Mechanism) GetTelemetry() []TelemetrySample {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	out := make([]TelemetrySample, 0, m.telemetryCount)
+	start := m.telemetryHead - m.telemetryCount
+	if start < 0 {
+		start += len(m.telemetry)
+	}
+	for i := 0; i < m.telemetryCount; i++ {
+		sample := m.telemetry[(start+i)%len(m.telemetry)]
+		sample.R = new(big.Int).Set(sample.R)
+		out = append(out, sample)
+	}
+	return out
+}
+
+// PeekRAB computes the subsidy CalculateRAB would return without changing any mechanism state
+// (PID integral/derivative history, the pending RL decision, the smoothed EB and the last multiplier are left
+// untouched; the RL policy answers greedily, without exploring)
+// The PID term is evaluated at the time of the last PID update, so repeated peeks with the same inputs are
+// idempotent regardless of the clock. This is the API for estimates under the live configuration, e.g.
+// shadow scoring a secondary mechanism alongside the primary; use WhatIf to vary the configuration
+func (m *Mechanism) PeekRAB(EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
+	return m.PeekRABForPair(NoPair, EA, EB, metrics)
+}
+
+// PeekRABForPair is PeekRAB for a CTX from shard pair.From to pair.To, reading (but never
+// updating) the pair's smoothed EB as CalculateRABForPair would
+func (m *Mechanism) PeekRABForPair(pair PairKey, EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
+	return m.estimate(m.GetConfig(), pair, EA, EB, metrics)
+}
+
+// WhatIf computes the subsidy a mechanism configured with overrides would return from the current
+// PID/Lagrangian state, without touching the live mechanism. overrides replaces the whole config,
+// so start from a copy of *GetConfig() and change only the parameters under study (e.g. PIDParams.Kp)
+// WhatIf(*GetConfig(), ...) is PeekRAB
+func (m *Mechanism) WhatIf(overrides Config, EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
+	return m.estimate(&overrides, NoPair, EA, EB, metrics)
+}
+
+// EstimateRAB answers "what subsidy would CalculateRAB produce now?" for analysis and UI tooling.
+// It is kept as an alias of PeekRAB, which new callers should use
+func (m *Mechanism) EstimateRAB(EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
+	return m.PeekRAB(EA, EB, metrics)
+}
+
+// estimate evaluates config for pair on copies of the PID, Lagrangian, RL and smoothed EB state,
+// with the clock pinned to the last PID update so that no controller state advances and the
+// result does not drift with wall-clock time between calls
+func (m *Mechanism) estimate(config *Config, pair PairKey, EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
+	m.stateLock.Lock()
+	pid := *m.pidState
+	lag := *m.lagrangianState
+	rl := m.rlState.clone()
+	smoothed := make(map[PairKey]*big.Int, 1)
+	if v, ok := m.smoothedEB[pair]; ok {
+		smoothed[pair] = new(big.Int).Set(v)
+	}
+	m.stateLock.Unlock()
+	rl.rng, rl.readOnly = nil, true // Greedy; the Q table is only read
+	if lag.TotalSubsidy != nil {
+		lag.TotalSubsidy = new(big.Int).Set(lag.TotalSubsidy)
+	}
+
+	clone := &Mechanism{
+		config:          config,
+		clock:           fixedClock(pid.LastUpdate),
+		pidState:        &pid,
+		lagrangianState: &lag,
+		rlState:         rl,
+		smoothedEB:      smoothed,
+	}
+	return clone.calculateRABInternal(pair, EA, EB, metrics)
+}
+
+// GetLastMultiplier returns the effective subsidy multiplier R/EB applied by the last CalculateRAB call
+// Returns 0 if no subsidy has been calculated yet or EB was nil/non-positive
+func (m *Mechanism) GetLastMultiplier() float64 {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	return m.lastMultiplier
+}
+
+// effectiveMultiplier computes R/EB as a float, guarding EB == 0
+func effectiveMultiplier(R, EB *big.Int) float64 {
+	if R == nil || EB == nil || EB.Sign() <= 0 {
+		return 0
+	}
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(R), new(big.Float).SetInt(EB)).Float64()
+	return ratio
 }
 
 // calculateRABInternal is the internal implementation (caller must hold lock)
-func (m *Mechanism) calculateRABInternal(EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
+func (m *Mechanism) calculateRABInternal(pair PairKey, EA, EB *big.Int, metrics *DynamicMetrics) *big.Int {
 	zero := big.NewInt(0)
 	mode := m.config.Mode
 	customF := m.config.CustomF
@@ -402,19 +814,53 @@ func (m *Mechanism) calculateRABInternal(EA, EB *big.Int, metrics *DynamicMetric
 		return big.NewInt(1000000000000000000)
 	
 	case SubsidyPID:
+		if R, below := m.belowMinQueue(EB, metrics); below {
+			return R
+		}
 		// PID controller-based dynamic subsidy
-		return calcPIDSubsidy(metrics, m.config, m.pidState, EB)
+		return calcPIDSubsidy(metrics, m.config, m.pidState, EB, m.clock.Now())
 	
 	case SubsidyLagrangian:
+		if R, below := m.belowMinQueue(EB, metrics); below {
+			return R
+		}
 		// Lagrangian optimization-based dynamic subsidy
 		// Uses shadow price to enforce inflation constraint
 		return calcLagrangianSubsidy(metrics, m.config, m.lagrangianState, EB)
+
+	case SubsidyRL:
+		if R, below := m.belowMinQueue(EB, metrics); below {
+			return R
+		}
+		// Learned multiplier of EB for the current congestion level
+		return calcRLSubsidy(metrics, m.config, m.rlState, EB)
+
+	case SubsidyEWMADestAvg:
+		// DestAvg with EB smoothed per shard pair
+		return m.smoothEB(pair, EB)
+
+	case SubsidyCap:
+		// DestAvg clamped to the absolute per-tx ceiling
+		return CappedDestAvg(EB, m.config.MaxSubsidyPerTx)
 	
 	default:
 		return zero
 	}
 }
 
+// belowMinQueue reports whether the destination queue is too short for a dynamic subsidy,
+// and if so returns the baseline subsidy (EB, or zero if ZeroBelowMinQueue is set)
+// Controller state is left untouched while below the threshold
+func (m *Mechanism) belowMinQueue(EB *big.Int, metrics *DynamicMetrics) (*big.Int, bool) {
+	if m.config.MinQueueForSubsidy <= 0 || metrics == nil || metrics.QueueLengthB >= m.config.MinQueueForSubsidy {
+		return nil, false
+	}
+	if m.config.ZeroBelowMinQueue || EB == nil {
+		return big.NewInt(0), true
+	}
+	return new(big.Int).Set(EB), true
+}
+
 // RAB is a backward-compatible stateless function for subsidy calculation
 // For PID mode, this will not maintain state across calls (use Mechanism instead)
 // EA is E(f_A) (average ITX fee in source shard A)
@@ -486,11 +932,47 @@ func RAB(mode SubsidyMode, EA, EB *big.Int, metrics *DynamicMetrics, customF fun
 		}
 		return zero
 
+	case SubsidyRL:
+		// RL policy-based dynamic subsidy
+		// WARNING: Stateless RAB cannot maintain the learned policy
+		// Use Mechanism.CalculateRAB() for proper RL functionality
+		// Fallback to DestAvg
+		if EB != nil {
+			return new(big.Int).Set(EB)
+		}
+		return zero
+
+	case SubsidyEWMADestAvg:
+		// Stateless RAB cannot keep the per-pair moving average
+		// Use Mechanism.CalculateRABForPair() for smoothing
+		// Fallback to DestAvg
+		if EB != nil {
+			return new(big.Int).Set(EB)
+		}
+		return zero
+
+	case SubsidyCap:
+		// RAB takes no Config, so the ceiling is unlimited here (plain DestAvg)
+		// Use CappedDestAvg or Mechanism.CalculateRAB() to apply MaxSubsidyPerTx
+		return CappedDestAvg(EB, nil)
+
 	default:
 		return zero
 	}
 }
 
+// CappedDestAvg returns min(EB, maxPerTx) as a fresh big.Int, the stateless SubsidyCap subsidy
+// A nil or non-positive maxPerTx is unlimited (R = EB); a nil EB gives 0
+func CappedDestAvg(EB, maxPerTx *big.Int) *big.Int {
+	if EB == nil {
+		return big.NewInt(0)
+	}
+	if maxPerTx != nil && maxPerTx.Sign() > 0 && EB.Cmp(maxPerTx) > 0 {
+		return new(big.Int).Set(maxPerTx)
+	}
+	return new(big.Int).Set(EB)
+}
+
 // Split2 performs the 2-party Shapley value split for a cross-shard transaction
 // fAB: transaction fee paid by the user
 // R: subsidy R_AB (computed by RAB function)
@@ -549,6 +1031,87 @@ func Split2(fAB, R, EA, EB *big.Int) (uA, uB *big.Int) {
 	return uA, uB
 }
 
+// ShapleyN generalizes Split2 to n proposers (e.g. source, intermediate and destination shards
+// of a multi-hop CTX): party i receives total/n + (E[i] - mean(E)), with total = fAB + R.
+// For n = 2 this is exactly Split2's formula. Any rounding remainder goes to the first party
+// still receiving a share, so the outputs always sum to fAB + R. A party whose share would be
+// negative is clamped to 0 and the total is re-split among the remaining parties (as Split2
+// hands everything to the other party). Nil inputs are treated as 0; n = 0 returns nil
+func ShapleyN(fAB, R *big.Int, E []*big.Int) []*big.Int {
+	n := len(E)
+	if n == 0 {
+		return nil
+	}
+	total := new(big.Int)
+	if fAB != nil {
+		total.Add(total, fAB)
+	}
+	if R != nil {
+		total.Add(total, R)
+	}
+
+	shares := make([]*big.Int, n)
+	active := make([]int, 0, n)
+	for i := range E {
+		shares[i] = big.NewInt(0)
+		active = append(active, i)
+	}
+
+	for len(active) > 0 {
+		// u_i = (total + k*E_i - sum(E over active)) / k, k = number of active parties
+		k := big.NewInt(int64(len(active)))
+		sumE := new(big.Int)
+		for _, i := range active {
+			if E[i] != nil {
+				sumE.Add(sumE, E[i])
+			}
+		}
+
+		next := active[:0:0]
+		assigned := new(big.Int)
+		for _, i := range active {
+			u := new(big.Int).Sub(total, sumE)
+			if E[i] != nil {
+				u.Add(u, new(big.Int).Mul(k, E[i]))
+			}
+			u.Div(u, k)
+			if u.Sign() < 0 {
+				shares[i].SetInt64(0)
+				continue
+			}
+			shares[i] = u
+			assigned.Add(assigned, u)
+			next = append(next, i)
+		}
+
+		if len(next) == len(active) {
+			// Nothing clamped: hand the rounding remainder to the first active party
+			shares[active[0]].Add(shares[active[0]], assigned.Sub(total, assigned))
+			break
+		}
+		for _, i := range active {
+			shares[i].SetInt64(0)
+		}
+		active = next
+	}
+	return shares
+}
+
+// SplitBaseline is the naive "winner-takes-fee" reference split: the source shard A proposer
+// keeps the whole fee fAB and the destination shard B proposer receives the whole subsidy R
+// Comparing it with Split2 quantifies how much the Shapley split redistributes
+// Invariant: uA + uB = fAB + R (nil inputs are treated as 0)
+func SplitBaseline(fAB, R *big.Int) (uA, uB *big.Int) {
+	uA, uB = big.NewInt(0), big.NewInt(0)
+	if fAB != nil {
+		uA.Set(fAB)
+	}
+	if R != nil {
+		uB.Set(R)
+	}
+	return uA, uB
+}
+
 // Case represents the three decision cases for including a cross-shard transaction
 type Case int
 
@@ -578,6 +1141,15 @@ func (c Case) String() string {
 // Classify determines which case a cross-shard transaction falls into
 // based on the source shard proposer's utility uA
 func Classify(uA, EA, EB *big.Int) Case {
+	c, _, _ := ClassifyWithMargins(uA, EA, EB)
+	return c
+}
+
+// ClassifyWithMargins classifies like Classify and also returns how far uA is from each boundary:
+// lowerMargin = uA - (EA - EB) (Case2 iff <= 0) and upperMargin = EA - uA (Case1 iff <= 0).
+// When EB >= EA the Case2 boundary EA - EB would be non-positive; as in Classify it is taken
+// as 0, so lowerMargin = uA. Nil inputs are treated as 0
+func ClassifyWithMargins(uA, EA, EB *big.Int) (c Case, lowerMargin, upperMargin *big.Int) {
 	// Ensure all inputs are non-nil
 	if uA == nil {
 		uA = big.NewInt(0)
@@ -589,29 +1161,139 @@ func Classify(uA, EA, EB *big.Int) Case {
 		EB = big.NewInt(0)
 	}
 
-	// Case 1: uA >= EA → always include
-	if uA.Cmp(EA) >= 0 {
-		return Case1
+	// Case 2 boundary EA - EB; handle underflow: if EB >= EA, then EA - EB <= 0,
+	// and uA <= EA - EB is only considered met if uA <= 0
+	threshold := big.NewInt(0)
+	if EB.Cmp(EA) < 0 {
+		threshold.Sub(EA, EB)
+	}
+	lowerMargin = new(big.Int).Sub(uA, threshold)
+	upperMargin = new(big.Int).Sub(EA, uA)
+
+	switch {
+	case upperMargin.Sign() <= 0:
+		// Case 1: uA >= EA → always include
+		c = Case1
+	case lowerMargin.Sign() <= 0:
+		// Case 2: uA <= EA - EB → drop/defer
+		c = Case2
+	default:
+		// Case 3: EA - EB < uA < EA → include if space
+		c = Case3
 	}
+	return c, lowerMargin, upperMargin
+}
 
-	// Case 2: uA <= EA - EB → drop/defer
-	// Handle underflow: if EB >= EA, then EA - EB <= 0
-	if EB.Cmp(EA) >= 0 {
-		// EA - EB <= 0, so uA <= EA - EB only if uA <= 0
-		if uA.Sign() <= 0 {
-			return Case2
+// MarginalValue returns the proposer's net gain from including a CTX instead of the marginal
+// ITX it would displace: localUtility - displacedITXFee (uA at the source shard, uB at the
+// destination). Positive favors the CTX, negative the ITX; nil inputs are treated as 0
+func MarginalValue(localUtility, displacedITXFee *big.Int) *big.Int {
+	v := big.NewInt(0)
+	if localUtility != nil {
+		v.Set(localUtility)
+	}
+	if displacedITXFee != nil {
+		v.Sub(v, displacedITXFee)
+	}
+	return v
+}
+
+// MaxEBForCase1 returns the highest destination E(f_B) at which a CTX with fee fAB and subsidy R
+// still classifies as Case1 from source shard A (uA >= EA). From the Shapley split,
+// uA = floor((fAB + R + EA - EB) / 2) >= EA  <=>  EB <= fAB + R - EA
+// R is taken as given, so callers should pass the subsidy expected at the EB of interest.
+// A negative result means no non-negative EB yields Case1; nil means every EB does (EA <= 0)
+func MaxEBForCase1(fAB, R, EA *big.Int) *big.Int {
+	if EA == nil || EA.Sign() <= 0 {
+		return nil
+	}
+	bound := big.NewInt(0)
+	if fAB != nil {
+		bound.Add(bound, fAB)
+	}
+	if R != nil {
+		bound.Add(bound, R)
+	}
+	return bound.Sub(bound, EA)
+}
+
+// ClassifyWithConfig classifies like Classify, applying the configured special cases:
+// with cfg.EqualFeesSkipCase2 and EA == EB, uA >= EA is Case1 and everything below is Case3.
+// By default (flag unset) EA == EB follows Classify: Case1 if uA >= EA, Case2 if uA <= 0, else Case3.
+func ClassifyWithConfig(uA, EA, EB *big.Int, cfg *Config) Case {
+	if cfg != nil && cfg.EqualFeesSkipCase2 && EA != nil && EB != nil && EA.Cmp(EB) == 0 {
+		if uA != nil && uA.Cmp(EA) >= 0 {
+			return Case1
 		}
-		// Otherwise uA > 0 >= EA - EB, so it's Case3
 		return Case3
 	}
+	return Classify(uA, EA, EB)
+}
+
+// ExplainClassification returns a human-readable explanation of the case Classify assigns,
+// e.g. "Case3: max(EA-EB, 0) (20) < uA (50) < EA (100), include if space."
+// The Case2 threshold is clamped at 0 as in Classify, so EB > EA never yields a negative bound
+func ExplainClassification(uA, EA, EB *big.Int) string {
+	if uA == nil {
+		uA = big.NewInt(0)
+	}
+	if EA == nil {
+		EA = big.NewInt(0)
+	}
+	if EB == nil {
+		EB = big.NewInt(0)
+	}
+	// threshold = max(EA - EB, 0)
+	threshold := new(big.Int).Sub(EA, EB)
+	if threshold.Sign() < 0 {
+		threshold.SetInt64(0)
+	}
+
+	switch Classify(uA, EA, EB) {
+	case Case1:
+		return fmt.Sprintf("Case1: uA (%s) >= EA (%s), always include.", uA, EA)
+	case Case2:
+		return fmt.Sprintf("Case2: uA (%s) <= max(EA-EB, 0) (%s), defer to lowest priority.", uA, threshold)
+	case Case3:
+		return fmt.Sprintf("Case3: max(EA-EB, 0) (%s) < uA (%s) < EA (%s), include if space.", threshold, uA, EA)
+	default:
+		return "Unknown: unclassifiable inputs."
+	}
+}
+
+// SubsidyToEscapeCase2 returns the minimum subsidy R for which a CTX is no longer deferred
+// (Classify from the source shard returns Case3 instead of Case2)
+// Case2 holds while uA <= max(EA - EB, 0), and uA = floor((fAB + R + EA - EB) / 2),
+// so the smallest escaping R satisfies fAB + R + EA - EB >= 2*max(EA - EB, 0) + 2
+// Returns 0 if the CTX is already at or above Case3 without any subsidy
+// Note: when EB <= 1 the Case3 band is empty and the returned R lands directly in Case1
+func SubsidyToEscapeCase2(fAB, EA, EB *big.Int) *big.Int {
+	if fAB == nil {
+		fAB = big.NewInt(0)
+	}
+	if EA == nil {
+		EA = big.NewInt(0)
+	}
+	if EB == nil {
+		EB = big.NewInt(0)
+	}
 
+	// threshold = max(EA - EB, 0)
 	threshold := new(big.Int).Sub(EA, EB)
-	if uA.Cmp(threshold) <= 0 {
-		return Case2
+	if threshold.Sign() < 0 {
+		threshold.SetInt64(0)
 	}
 
-	// Case 3: EA - EB < uA < EA → include if space
-	return Case3
+	// R = 2*threshold + 2 - fAB - (EA - EB)
+	R := new(big.Int).Lsh(threshold, 1)
+	R.Add(R, big.NewInt(2))
+	R.Sub(R, fAB)
+	R.Sub(R, new(big.Int).Sub(EA, EB))
+
+	if R.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	return R
 }
 
 // TxScore computes the score for transaction selection
@@ -637,7 +1319,10 @@ func ComputeCTXScore(fAB, R, EA, EB *big.Int, isSourceShard bool) *big.Int {
 // ComputeCTXScore computes the score for a cross-shard transaction using the mechanism
 // This method automatically calculates the subsidy R_AB using the mechanism's state
 func (m *Mechanism) ComputeCTXScore(fAB, EA, EB *big.Int, metrics *DynamicMetrics, isSourceShard bool) *big.Int {
-	R := m.CalculateRAB(EA, EB, metrics)
+	R := big.NewInt(0)
+	if m.ShouldSubsidize(fAB) {
+		R = m.CalculateRAB(EA, EB, metrics)
+	}
 	uA, uB := Split2(fAB, R, EA, EB)
 	if isSourceShard {
 		return uA
@@ -659,9 +1344,90 @@ func ValidateConfig(cfg *Config) error {
 			return fmt.Errorf("GammaMin cannot exceed GammaMax")
 		}
 	}
+
+	switch cfg.Mode {
+	case SubsidyPID:
+		p := cfg.PIDParams
+		if p.MinSubsidy < 0 {
+			return fmt.Errorf("PIDParams.MinSubsidy must be non-negative, got %v", p.MinSubsidy)
+		}
+		if p.MaxSubsidy < p.MinSubsidy {
+			return fmt.Errorf("PIDParams.MaxSubsidy (%v) cannot be below MinSubsidy (%v)", p.MaxSubsidy, p.MinSubsidy)
+		}
+		if p.CapacityB <= 0 {
+			return fmt.Errorf("PIDParams.CapacityB must be positive, got %v", p.CapacityB)
+		}
+	case SubsidyLagrangian:
+		p := cfg.LagrangianParams
+		if p.MinLambda < 0 {
+			return fmt.Errorf("LagrangianParams.MinLambda must be non-negative, got %v", p.MinLambda)
+		}
+		if p.MaxLambda < p.MinLambda {
+			return fmt.Errorf("LagrangianParams.MaxLambda (%v) cannot be below MinLambda (%v)", p.MaxLambda, p.MinLambda)
+		}
+		if p.WindowSize <= 0 {
+			return fmt.Errorf("LagrangianParams.WindowSize must be positive, got %v", p.WindowSize)
+		}
+		if p.CongestionExp < 0 {
+			return fmt.Errorf("LagrangianParams.CongestionExp must be non-negative, got %v", p.CongestionExp)
+		}
+	}
+	if cfg.Mode == SubsidyPID || cfg.Mode == SubsidyLagrangian {
+		if cfg.MaxInflation == nil || cfg.MaxInflation.Sign() <= 0 {
+			return fmt.Errorf("MaxInflation must be set and positive when mode is %v", cfg.Mode)
+		}
+	}
 	return nil
 }
 
+// Diff returns the fields that differ between c and other as name -> [old, new]
+// Nested parameter structs are flattened (e.g. "PIDParams.Kp"); function fields are
+// compared by presence only. Useful for recording experiment provenance
+func (c *Config) Diff(other *Config) map[string][2]string {
+	before := make(map[string]string)
+	after := make(map[string]string)
+	if c != nil {
+		flattenConfig("", reflect.ValueOf(*c), before)
+	}
+	if other != nil {
+		flattenConfig("", reflect.ValueOf(*other), after)
+	}
+
+	diff := make(map[string][2]string)
+	for name, oldVal := range before {
+		if newVal := after[name]; newVal != oldVal {
+			diff[name] = [2]string{oldVal, newVal}
+		}
+	}
+	for name, newVal := range after {
+		if _, seen := before[name]; !seen {
+			diff[name] = [2]string{"", newVal}
+		}
+	}
+	return diff
+}
+
+// flattenConfig renders every field of a config struct into out as a string value
+func flattenConfig(prefix string, v reflect.Value, out map[string]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		name := prefix + t.Field(i).Name
+		switch field.Kind() {
+		case reflect.Struct:
+			flattenConfig(name+".", field, out)
+		case reflect.Func:
+			if field.IsNil() {
+				out[name] = "nil"
+			} else {
+				out[name] = "set"
+			}
+		default:
+			out[name] = fmt.Sprint(field.Interface())
+		}
+	}
+}
+
 // DefaultConfig returns a default Justitia configuration
 func DefaultConfig() *Config {
 	return &Config{
@@ -678,6 +1444,7 @@ func DefaultConfig() *Config {
 			CapacityB:         1000.0, // Default queue capacity
 			MinSubsidy:        0.0,    // Minimum subsidy multiplier (can be 0)
 			MaxSubsidy:        5.0,    // Maximum subsidy multiplier (5x EB)
+			MaxIntegral:       DefaultPIDMaxIntegral, // Anti-windup bound on the integral
 		},
 		LagrangianParams: LagrangianParams{
 			Alpha:         0.01,   // Learning rate for shadow price update
@@ -685,8 +1452,23 @@ func DefaultConfig() *Config {
 			MinLambda:     1.0,    // Minimum shadow price
 			MaxLambda:     10.0,   // Maximum shadow price (10x reduction at most)
 			CongestionExp: 2.0,    // Quadratic congestion preference
+			ReliefWeight:  1.0,    // Double the step when spending brings no relief
+		},
+		RLParams: RLParams{
+			Buckets:       5,      // Utilization buckets of 20% each
+			Actions:       5,      // Multipliers 0, 0.5, 1, 1.5, 2
+			MinMultiplier: 0.0,    // Smallest multiplier of EB
+			MaxMultiplier: 2.0,    // Largest multiplier of EB
+			LearningRate:  0.1,    // Value update step size
+			Epsilon:       0.1,    // Explore 10% of the time
+			CapacityB:     1000.0, // Default queue capacity
+			Seed:          1,      // Reproducible exploration
+			CostWeight:    0.1,    // Reward penalty per unit of multiplier
 		},
 		MaxInflation:   big.NewInt(1000000000000000000), // 1 ETH default
+		EpochBlocks:    10,
+		BaseBlockReward: big.NewInt(0),
 		TargetQueueLen: 100,
+		EBSmoothingAlpha: DefaultEBSmoothingAlpha,
 	}
 }
@@ -1,8 +1,15 @@
 package justitia
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"math/big"
+	"strings"
 	"testing"
+	"time"
+
+	"blockEmulator/utils/snapshot"
 )
 
 // TestRAB_Modes tests all subsidy modes
@@ -179,6 +186,36 @@ func TestSplit2_Symmetry(t *testing.T) {
 	}
 }
 
+// TestSplitBaseline tests the winner-takes-fee baseline split and its conservation
+func TestSplitBaseline(t *testing.T) {
+	fAB := big.NewInt(100)
+	R := big.NewInt(50)
+
+	uA, uB := SplitBaseline(fAB, R)
+	if uA.Cmp(fAB) != 0 {
+		t.Errorf("uA = %v, want fAB = %v", uA, fAB)
+	}
+	if uB.Cmp(R) != 0 {
+		t.Errorf("uB = %v, want R = %v", uB, R)
+	}
+	sum := new(big.Int).Add(uA, uB)
+	if want := new(big.Int).Add(fAB, R); sum.Cmp(want) != 0 {
+		t.Errorf("Conservation violated: uA + uB = %v, want %v", sum, want)
+	}
+
+	// Outputs are copies
+	uA.SetInt64(0)
+	if fAB.Int64() != 100 {
+		t.Error("SplitBaseline should not alias its inputs")
+	}
+
+	// Same total as the Shapley split, different division
+	sA, sB := Split2(fAB, R, big.NewInt(80), big.NewInt(70))
+	if new(big.Int).Add(sA, sB).Cmp(sum) != 0 {
+		t.Errorf("Split2 total %v differs from baseline total %v", new(big.Int).Add(sA, sB), sum)
+	}
+}
+
 // TestSplit2_EdgeCases tests edge cases
 func TestSplit2_EdgeCases(t *testing.T) {
 	tests := []struct {
@@ -326,6 +363,61 @@ func TestClassify_EBGreaterThanEA(t *testing.T) {
 	}
 }
 
+// classifySource classifies a CTX from the source shard given its fee and subsidy
+func classifySource(fAB, R, EA, EB *big.Int) Case {
+	uA, _ := Split2(fAB, R, EA, EB)
+	return Classify(uA, EA, EB)
+}
+
+// TestSubsidyToEscapeCase2 tests that the returned R is the minimum subsidy that lifts a CTX to Case3
+func TestSubsidyToEscapeCase2(t *testing.T) {
+	tests := []struct {
+		name        string
+		fAB, EA, EB *big.Int
+	}{
+		{"zero fee", big.NewInt(0), big.NewInt(100), big.NewInt(80)},
+		{"small fee", big.NewInt(10), big.NewInt(1000), big.NewInt(300)},
+		{"odd parity", big.NewInt(1), big.NewInt(1000), big.NewInt(300)},
+		{"EB greater than EA", big.NewInt(0), big.NewInt(80), big.NewInt(100)},
+	}
+
+	one := big.NewInt(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			R := SubsidyToEscapeCase2(tt.fAB, tt.EA, tt.EB)
+			if R.Sign() <= 0 {
+				t.Fatalf("Expected positive subsidy for a Case2 CTX, got %v", R)
+			}
+			if got := classifySource(tt.fAB, R, tt.EA, tt.EB); got != Case3 {
+				t.Errorf("With R=%v got %v, want Case3", R, got)
+			}
+			less := new(big.Int).Sub(R, one)
+			if got := classifySource(tt.fAB, less, tt.EA, tt.EB); got != Case2 {
+				t.Errorf("With R=%v got %v, want Case2", less, got)
+			}
+		})
+	}
+}
+
+// TestSubsidyToEscapeCase2_AlreadyEscaped tests that no subsidy is needed for Case3/Case1 CTX
+func TestSubsidyToEscapeCase2_AlreadyEscaped(t *testing.T) {
+	EA := big.NewInt(100)
+	EB := big.NewInt(80)
+
+	// uA = (150 + 20) / 2 = 85 -> Case3
+	if R := SubsidyToEscapeCase2(big.NewInt(150), EA, EB); R.Sign() != 0 {
+		t.Errorf("Case3 CTX: expected R=0, got %v", R)
+	}
+	// uA = (300 + 20) / 2 = 160 -> Case1
+	if R := SubsidyToEscapeCase2(big.NewInt(300), EA, EB); R.Sign() != 0 {
+		t.Errorf("Case1 CTX: expected R=0, got %v", R)
+	}
+	// nil inputs are treated as zero
+	if R := SubsidyToEscapeCase2(nil, nil, nil); R.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("nil inputs: expected R=2, got %v", R)
+	}
+}
+
 // TestComputeCTXScore tests CTX score computation
 func TestComputeCTXScore(t *testing.T) {
 	fAB := big.NewInt(100)
@@ -400,6 +492,152 @@ func TestValidateConfig(t *testing.T) {
 	}
 }
 
+// TestValidateConfig_DynamicParams tests the PID and Lagrangian parameter sanity checks
+func TestValidateConfig_DynamicParams(t *testing.T) {
+	withMode := func(mode SubsidyMode, mutate func(*Config)) *Config {
+		cfg := DefaultConfig()
+		cfg.Mode = mode
+		mutate(cfg)
+		return cfg
+	}
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr string // Substring of the expected error, "" for a valid config
+	}{
+		{"valid PID", withMode(SubsidyPID, func(c *Config) {}), ""},
+		{"valid Lagrangian", withMode(SubsidyLagrangian, func(c *Config) {}), ""},
+		{"PID negative MinSubsidy", withMode(SubsidyPID, func(c *Config) { c.PIDParams.MinSubsidy = -1 }), "MinSubsidy"},
+		{"PID MinSubsidy above MaxSubsidy", withMode(SubsidyPID, func(c *Config) { c.PIDParams.MinSubsidy = 6 }), "MaxSubsidy"},
+		{"PID zero CapacityB", withMode(SubsidyPID, func(c *Config) { c.PIDParams.CapacityB = 0 }), "CapacityB"},
+		{"PID nil MaxInflation", withMode(SubsidyPID, func(c *Config) { c.MaxInflation = nil }), "MaxInflation"},
+		{"Lagrangian negative MinLambda", withMode(SubsidyLagrangian, func(c *Config) { c.LagrangianParams.MinLambda = -1 }), "MinLambda"},
+		{"Lagrangian MinLambda above MaxLambda", withMode(SubsidyLagrangian, func(c *Config) { c.LagrangianParams.MinLambda = 20 }), "MaxLambda"},
+		{"Lagrangian zero WindowSize", withMode(SubsidyLagrangian, func(c *Config) { c.LagrangianParams.WindowSize = 0 }), "WindowSize"},
+		{"Lagrangian negative CongestionExp", withMode(SubsidyLagrangian, func(c *Config) { c.LagrangianParams.CongestionExp = -0.5 }), "CongestionExp"},
+		{"Lagrangian zero MaxInflation", withMode(SubsidyLagrangian, func(c *Config) { c.MaxInflation = big.NewInt(0) }), "MaxInflation"},
+		// Dynamic parameters are not checked for static modes
+		{"DestAvg ignores PID params", withMode(SubsidyDestAvg, func(c *Config) { c.PIDParams.CapacityB = 0; c.MaxInflation = nil }), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateConfig() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateConfig() = %v, want error mentioning %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestMechanism_ShouldSubsidize tests the user fee floor below, at and above the threshold
+func TestMechanism_ShouldSubsidize(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyDestAvg
+	cfg.MinUserFeeForSubsidy = big.NewInt(100)
+	m := NewMechanism(cfg)
+
+	tests := []struct {
+		name string
+		fAB  *big.Int
+		want bool
+	}{
+		{"nil fee", nil, false},
+		{"zero fee", big.NewInt(0), false},
+		{"below floor", big.NewInt(99), false},
+		{"at floor", big.NewInt(100), true},
+		{"above floor", big.NewInt(101), true},
+	}
+	EA, EB := big.NewInt(1000), big.NewInt(400)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.ShouldSubsidize(tt.fAB); got != tt.want {
+				t.Errorf("ShouldSubsidize(%v) = %v, want %v", tt.fAB, got, tt.want)
+			}
+			// Without a subsidy the destination utility is the Split2 share of fAB alone
+			fee := tt.fAB
+			if fee == nil {
+				fee = big.NewInt(0)
+			}
+			R := big.NewInt(0)
+			if tt.want {
+				R = EB
+			}
+			_, wantUB := Split2(fee, R, EA, EB)
+			if got := m.ComputeCTXScore(fee, EA, EB, nil, false); got.Cmp(wantUB) != 0 {
+				t.Errorf("ComputeCTXScore(%v) = %s, want %s", fee, got, wantUB)
+			}
+		})
+	}
+
+	// The default floor admits zero-fee CTX
+	if !NewMechanism(DefaultConfig()).ShouldSubsidize(big.NewInt(0)) {
+		t.Error("Expected no floor by default")
+	}
+}
+
+// TestSubsidyCap tests that SubsidyCap clamps EB to MaxSubsidyPerTx and returns a fresh copy
+func TestSubsidyCap(t *testing.T) {
+	ceiling := big.NewInt(500)
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyCap
+	cfg.MaxSubsidyPerTx = ceiling
+	m := NewMechanism(cfg)
+
+	tests := []struct {
+		name string
+		EB   *big.Int
+		want int64
+	}{
+		{"EB below ceiling", big.NewInt(300), 300},
+		{"EB equal to ceiling", big.NewInt(500), 500},
+		{"EB above ceiling", big.NewInt(900), 500},
+		{"nil EB", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, R := range map[string]*big.Int{
+				"CalculateRAB":  m.CalculateRAB(nil, tt.EB, nil),
+				"CappedDestAvg": CappedDestAvg(tt.EB, ceiling),
+			} {
+				if R.Cmp(big.NewInt(tt.want)) != 0 {
+					t.Errorf("%s = %s, want %d", name, R, tt.want)
+				}
+				if R == tt.EB || R == ceiling {
+					t.Errorf("%s returned an input pointer instead of a copy", name)
+				}
+			}
+		})
+	}
+
+	// Mutating the result leaves the ceiling untouched
+	m.CalculateRAB(nil, big.NewInt(900), nil).SetInt64(1)
+	if ceiling.Cmp(big.NewInt(500)) != 0 {
+		t.Errorf("Ceiling mutated to %s", ceiling)
+	}
+
+	// Without a ceiling the mode is plain DestAvg
+	for _, unlimited := range []*big.Int{nil, big.NewInt(0)} {
+		cfg.MaxSubsidyPerTx = unlimited
+		if R := NewMechanism(cfg).CalculateRAB(nil, big.NewInt(900), nil); R.Cmp(big.NewInt(900)) != 0 {
+			t.Errorf("Uncapped (%v) R = %s, want 900", unlimited, R)
+		}
+	}
+	// The stateless RAB has no Config and is never capped
+	if R := RAB(SubsidyCap, nil, big.NewInt(900), nil, nil); R.Cmp(big.NewInt(900)) != 0 {
+		t.Errorf("RAB(SubsidyCap) = %s, want 900", R)
+	}
+	if SubsidyCap.String() != "Cap" {
+		t.Errorf("SubsidyCap.String() = %q, want Cap", SubsidyCap.String())
+	}
+}
+
 // BenchmarkSplit2 benchmarks the Split2 function
 func BenchmarkSplit2(b *testing.B) {
 	fAB := big.NewInt(100)
@@ -424,3 +662,1061 @@ func BenchmarkClassify(b *testing.B) {
 		_ = Classify(uA, EA, EB)
 	}
 }
+
+// TestMechanism_FullReset tests that FullReset restores lambda while ResetEpoch preserves it
+func TestMechanism_FullReset(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyLagrangian
+	m := NewMechanism(cfg)
+	initial := m.GetShadowPrice()
+
+	// Overspend 3x the limit to push lambda up
+	limit := big.NewInt(1000)
+	for i := 0; i < 5; i++ {
+		m.UpdateShadowPrice(big.NewInt(3000), limit)
+	}
+	elevated := m.GetShadowPrice()
+	if elevated <= initial {
+		t.Fatalf("Expected lambda to rise above %v, got %v", initial, elevated)
+	}
+
+	// Drive some PID state as well
+	m.pidState.Integral = 5.0
+	m.pidState.PrevError = 0.3
+
+	m.ResetEpoch()
+	if got := m.GetShadowPrice(); got != elevated {
+		t.Errorf("ResetEpoch changed lambda: got %v, want %v", got, elevated)
+	}
+
+	m.FullReset()
+	if got := m.GetShadowPrice(); got != initial {
+		t.Errorf("FullReset lambda = %v, want initial %v", got, initial)
+	}
+	if m.lagrangianState.TotalSubsidy.Sign() != 0 {
+		t.Errorf("FullReset TotalSubsidy = %v, want 0", m.lagrangianState.TotalSubsidy)
+	}
+	if m.pidState.Integral != 0 || m.pidState.PrevError != 0 {
+		t.Errorf("FullReset PID state = (%v, %v), want (0, 0)", m.pidState.Integral, m.pidState.PrevError)
+	}
+}
+
+// TestConfig_Diff tests that changed config fields are reported with old and new values
+func TestConfig_Diff(t *testing.T) {
+	destAvg := DefaultConfig()
+	pid := DefaultConfig()
+	pid.Mode = SubsidyPID
+	pid.PIDParams.Kp = 2.0
+	pid.MaxInflation = big.NewInt(5000)
+	pid.CustomF = func(ea, eb *big.Int) *big.Int { return eb }
+
+	diff := destAvg.Diff(pid)
+
+	want := map[string][2]string{
+		"Mode":         {"DestAvg", "PID"},
+		"PIDParams.Kp": {"1.5", "2"},
+		"MaxInflation": {"1000000000000000000", "5000"},
+		"CustomF":      {"nil", "set"},
+	}
+	if len(diff) != len(want) {
+		t.Errorf("Diff() returned %d fields, want %d: %v", len(diff), len(want), diff)
+	}
+	for name, values := range want {
+		if got, ok := diff[name]; !ok || got != values {
+			t.Errorf("Diff()[%q] = %v, want %v", name, got, values)
+		}
+	}
+
+	if same := destAvg.Diff(DefaultConfig()); len(same) != 0 {
+		t.Errorf("Diff() of identical configs = %v, want empty", same)
+	}
+}
+
+// TestMechanism_UpdateShadowPriceWithRelief tests that failed congestion relief raises lambda faster
+func TestMechanism_UpdateShadowPriceWithRelief(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyLagrangian
+	cfg.LagrangianParams.ReliefWeight = 1.0
+
+	limit := big.NewInt(1000)
+	overspend := big.NewInt(2000)
+
+	relieved := NewMechanism(cfg)
+	relieved.UpdateShadowPriceWithRelief(overspend, limit, 800, 200) // Queue shrank
+	stuck := NewMechanism(cfg)
+	stuck.UpdateShadowPriceWithRelief(overspend, limit, 800, 900) // Queue grew
+	plain := NewMechanism(cfg)
+	plain.UpdateShadowPrice(overspend, limit)
+
+	initial := NewMechanism(cfg).GetShadowPrice()
+	relievedStep := relieved.GetShadowPrice() - initial
+	stuckStep := stuck.GetShadowPrice() - initial
+	plainStep := plain.GetShadowPrice() - initial
+
+	if stuckStep <= relievedStep {
+		t.Errorf("Expected larger lambda step without relief: stuck=%v relieved=%v", stuckStep, relievedStep)
+	}
+	// No relief doubles the step with ReliefWeight = 1
+	if math.Abs(stuckStep-2*plainStep) > 1e-9 {
+		t.Errorf("Stuck step = %v, want %v", stuckStep, 2*plainStep)
+	}
+	// 75% relief leaves a 25% amplification
+	if math.Abs(relievedStep-1.25*plainStep) > 1e-9 {
+		t.Errorf("Relieved step = %v, want %v", relievedStep, 1.25*plainStep)
+	}
+
+	// Underspending is not affected by relief attribution
+	under := NewMechanism(cfg)
+	under.UpdateShadowPrice(big.NewInt(5000), limit) // Raise lambda first
+	underPlain := NewMechanism(cfg)
+	underPlain.UpdateShadowPrice(big.NewInt(5000), limit)
+	under.UpdateShadowPriceWithRelief(big.NewInt(500), limit, 800, 900)
+	underPlain.UpdateShadowPrice(big.NewInt(500), limit)
+	if under.GetShadowPrice() != underPlain.GetShadowPrice() {
+		t.Errorf("Underspend with relief = %v, want %v", under.GetShadowPrice(), underPlain.GetShadowPrice())
+	}
+}
+
+// TestMechanism_GetLastMultiplier tests that the reported multiplier matches R/EB for a PID computation
+func TestMechanism_GetLastMultiplier(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyPID
+	cfg.PIDParams = PIDParams{
+		Kp:                2.0,
+		TargetUtilization: 0.5,
+		CapacityB:         1000,
+		MinSubsidy:        0.0,
+		MaxSubsidy:        5.0,
+	}
+	m := NewMechanism(cfg)
+	if got := m.GetLastMultiplier(); got != 0 {
+		t.Errorf("Initial multiplier = %v, want 0", got)
+	}
+
+	// Full queue: error = 1.0 - 0.5 = 0.5, output = Kp*error = 1.0, multiplier = 2.0
+	EB := big.NewInt(1000)
+	R := m.CalculateRAB(big.NewInt(500), EB, &DynamicMetrics{QueueLengthB: 1000})
+	if R.Cmp(big.NewInt(2000)) != 0 {
+		t.Fatalf("R = %s, want 2000", R)
+	}
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(R), new(big.Float).SetInt(EB)).Float64()
+	if got := m.GetLastMultiplier(); got != ratio || got != 2.0 {
+		t.Errorf("Multiplier = %v, want R/EB = %v", got, ratio)
+	}
+
+	// EB == 0 is guarded
+	m.CalculateRAB(big.NewInt(500), big.NewInt(0), &DynamicMetrics{QueueLengthB: 1000})
+	if got := m.GetLastMultiplier(); got != 0 {
+		t.Errorf("Multiplier with EB=0 = %v, want 0", got)
+	}
+}
+
+// fakeClock is a Clock advanced manually by tests
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// TestMechanism_Clock tests that the PID integral accumulates exactly error*dt under an injected clock
+func TestMechanism_Clock(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyPID
+	cfg.PIDParams = PIDParams{
+		Ki:                1.0,
+		TargetUtilization: 0.5,
+		CapacityB:         1000,
+		MinSubsidy:        0.0,
+		MaxSubsidy:        5.0,
+		MaxIntegral:       1.0,
+	}
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	m := NewMechanismWithClock(cfg, clock)
+	metrics := &DynamicMetrics{QueueLengthB: 750} // error = 0.75 - 0.5 = 0.25
+
+	for step := 1; step <= 4; step++ {
+		clock.Advance(time.Second)
+		m.CalculateRAB(nil, big.NewInt(1000), metrics)
+		st := m.GetPIDState()
+		if want := 0.25 * float64(step); st.Integral != want || st.Saturated {
+			t.Fatalf("Step %d: integral = %v (saturated %v), want %v", step, st.Integral, st.Saturated, want)
+		}
+		if !st.LastUpdate.Equal(clock.Now()) {
+			t.Errorf("Step %d: LastUpdate = %v, want clock time %v", step, st.LastUpdate, clock.Now())
+		}
+	}
+
+	// The fifth step would reach 1.25: anti-windup clamps to MaxIntegral
+	clock.Advance(time.Second)
+	m.CalculateRAB(nil, big.NewInt(1000), metrics)
+	if st := m.GetPIDState(); st.Integral != 1.0 || !st.Saturated {
+		t.Errorf("Integral = %v (saturated %v), want 1.0 saturated", st.Integral, st.Saturated)
+	}
+
+	// dt follows the clock: a 2s step after a reset accumulates 0.25 * 2
+	m.ResetPID()
+	clock.Advance(2 * time.Second)
+	m.CalculateRAB(nil, big.NewInt(1000), metrics)
+	if st := m.GetPIDState(); st.Integral != 0.5 {
+		t.Errorf("Integral after 2s step = %v, want 0.5", st.Integral)
+	}
+}
+
+// TestPIDSubsidy_MaxSubsidyWei tests that the absolute wei ceiling binds before the multiplier cap
+func TestPIDSubsidy_MaxSubsidyWei(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyPID
+	cfg.PIDParams = PIDParams{
+		Kp:                100.0, // Saturate the multiplier at MaxSubsidy
+		TargetUtilization: 0.5,
+		CapacityB:         1000,
+		MinSubsidy:        0.0,
+		MaxSubsidy:        5.0,
+	}
+	EB := big.NewInt(1000000)
+	metrics := &DynamicMetrics{QueueLengthB: 1000}
+
+	// Without an absolute ceiling the multiplier cap binds: 5 * EB
+	if R := NewMechanism(cfg).CalculateRAB(nil, EB, metrics); R.Cmp(big.NewInt(5000000)) != 0 {
+		t.Fatalf("Uncapped R = %s, want 5000000", R)
+	}
+
+	// The multiplier cap would allow 5,000,000 wei; the absolute ceiling is lower
+	cfg.PIDParams.MaxSubsidyWei = big.NewInt(1200000)
+	if R := NewMechanism(cfg).CalculateRAB(nil, EB, metrics); R.Cmp(big.NewInt(1200000)) != 0 {
+		t.Errorf("Capped R = %s, want 1200000", R)
+	}
+
+	// A ceiling above the multiplier cap does not bind
+	cfg.PIDParams.MaxSubsidyWei = big.NewInt(9000000)
+	if R := NewMechanism(cfg).CalculateRAB(nil, EB, metrics); R.Cmp(big.NewInt(5000000)) != 0 {
+		t.Errorf("R with loose ceiling = %s, want 5000000", R)
+	}
+}
+
+// TestMechanism_MinQueueForSubsidy tests that dynamic modes pay the baseline subsidy below the queue threshold
+func TestMechanism_MinQueueForSubsidy(t *testing.T) {
+	EB := big.NewInt(1000)
+	for _, mode := range []SubsidyMode{SubsidyPID, SubsidyLagrangian} {
+		t.Run(mode.String(), func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Mode = mode
+			cfg.PIDParams.Kp = 2.0
+			cfg.PIDParams.Ki = 0
+			cfg.PIDParams.Kd = 0
+			cfg.PIDParams.TargetUtilization = 0.5
+			cfg.MinQueueForSubsidy = 100
+
+			// Below threshold: plain DestAvg subsidy, controller state untouched
+			m := NewMechanism(cfg)
+			if R := m.CalculateRAB(nil, EB, &DynamicMetrics{QueueLengthB: 50}); R.Cmp(EB) != 0 {
+				t.Errorf("Below-threshold R = %s, want EB = %s", R, EB)
+			}
+			if m.pidState.PrevError != 0 {
+				t.Errorf("PID state updated below threshold: PrevError = %v", m.pidState.PrevError)
+			}
+
+			cfg.ZeroBelowMinQueue = true
+			if R := NewMechanism(cfg).CalculateRAB(nil, EB, &DynamicMetrics{QueueLengthB: 50}); R.Sign() != 0 {
+				t.Errorf("Below-threshold R with ZeroBelowMinQueue = %s, want 0", R)
+			}
+
+			// Above threshold: congestion-scaled subsidy
+			cfg.ZeroBelowMinQueue = false
+			R := NewMechanism(cfg).CalculateRAB(nil, EB, &DynamicMetrics{QueueLengthB: 2000})
+			if R.Cmp(EB) <= 0 {
+				t.Errorf("Above-threshold R = %s, want scaled above EB = %s", R, EB)
+			}
+		})
+	}
+}
+
+// TestMechanism_InflationUtilization tests that utilization tracks spending and the binding flag flips at the threshold
+func TestMechanism_InflationUtilization(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyLagrangian
+	cfg.MaxInflation = big.NewInt(1000)
+	m := NewMechanism(cfg)
+
+	if got := m.InflationUtilization(); got != 0 {
+		t.Errorf("Initial utilization = %v, want 0", got)
+	}
+
+	for i := 1; i <= 12; i++ {
+		m.RecordSubsidy(big.NewInt(100))
+		want := float64(i) / 10.0
+		if got := m.InflationUtilization(); math.Abs(got-want) > 1e-9 {
+			t.Errorf("After %d spends: utilization = %v, want %v", i, got, want)
+		}
+		if binding := m.IsInflationBinding(0.9); binding != (i >= 9) {
+			t.Errorf("After %d spends: IsInflationBinding(0.9) = %v", i, binding)
+		}
+	}
+
+	// Utilization may exceed 1 but never goes negative
+	m.RecordSubsidy(big.NewInt(-500))
+	if got := m.InflationUtilization(); math.Abs(got-1.2) > 1e-9 {
+		t.Errorf("Negative subsidy changed utilization to %v", got)
+	}
+
+	m.ResetEpoch()
+	if m.IsInflationBinding(0.9) {
+		t.Error("Expected no binding after ResetEpoch")
+	}
+
+	// No cap configured
+	cfg.MaxInflation = nil
+	uncapped := NewMechanism(cfg)
+	uncapped.RecordSubsidy(big.NewInt(100))
+	if got := uncapped.InflationUtilization(); got != 0 {
+		t.Errorf("Uncapped utilization = %v, want 0", got)
+	}
+}
+
+// TestExplainClassification tests that explanations name the case and its threshold values
+func TestExplainClassification(t *testing.T) {
+	tests := []struct {
+		name     string
+		uA       int64
+		EA       int64
+		EB       int64
+		contains []string
+	}{
+		{"case1", 150, 100, 80, []string{"Case1", "uA (150)", "EA (100)", "include"}},
+		{"case2", 10, 100, 80, []string{"Case2", "uA (10)", "max(EA-EB, 0) (20)", "defer"}},
+		{"case3", 50, 100, 80, []string{"Case3", "max(EA-EB, 0) (20) < uA (50) < EA (100)", "if space"}},
+		{"case2 with EB above EA", 0, 10, 30, []string{"Case2", "uA (0) <= max(EA-EB, 0) (0)"}},
+		{"case3 with EB above EA", 5, 10, 30, []string{"Case3", "max(EA-EB, 0) (0) < uA (5) < EA (10)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExplainClassification(big.NewInt(tt.uA), big.NewInt(tt.EA), big.NewInt(tt.EB))
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("Explanation %q does not contain %q", got, want)
+				}
+			}
+			wantCase := Classify(big.NewInt(tt.uA), big.NewInt(tt.EA), big.NewInt(tt.EB))
+			if !strings.HasPrefix(got, fmt.Sprintf("Case%d", int(wantCase))) {
+				t.Errorf("Explanation %q does not start with Classify result %s", got, wantCase)
+			}
+		})
+	}
+}
+
+// TestMechanism_PeekRAB tests that peeking returns the CalculateRAB result without advancing PID state
+func TestMechanism_PeekRAB(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyPID
+	// A frozen clock gives the peek and the calculation the same time delta
+	m := NewMechanismWithClock(cfg, &fakeClock{t: time.Unix(1700000000, 0)})
+	metrics := &DynamicMetrics{QueueLengthB: 900}
+	EB := big.NewInt(1000000)
+
+	before := *m.pidState
+	peeked := m.PeekRAB(nil, EB, metrics)
+	if *m.pidState != before {
+		t.Errorf("PeekRAB changed PID state: %+v -> %+v", before, *m.pidState)
+	}
+	if m.GetLastMultiplier() != 0 {
+		t.Error("PeekRAB should not record a multiplier")
+	}
+
+	if R := m.CalculateRAB(nil, EB, metrics); R.Sign() == 0 || R.Cmp(peeked) != 0 {
+		t.Errorf("Expected equal nonzero subsidies, got peek=%s calc=%s", peeked, R)
+	}
+	if *m.pidState == before {
+		t.Error("CalculateRAB should advance PID state")
+	}
+}
+
+// TestMechanism_WhatIf tests that a higher PID gain yields a larger subsidy without touching live state
+func TestMechanism_WhatIf(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyPID
+	// A frozen clock keeps dt identical across the Peek calls being compared
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	m := NewMechanismWithClock(cfg, clock)
+	metrics := &DynamicMetrics{QueueLengthB: 900}
+	EB := big.NewInt(1000000)
+
+	// Advance the live state once so the clone starts from non-trivial history
+	clock.Advance(time.Second)
+	m.CalculateRAB(nil, EB, metrics)
+	stateBefore := *m.pidState
+	multiplierBefore := m.GetLastMultiplier()
+	live := m.PeekRAB(nil, EB, metrics)
+
+	overrides := *m.GetConfig()
+	overrides.PIDParams.Kp = cfg.PIDParams.Kp * 4
+	whatIf := m.WhatIf(overrides, nil, EB, metrics)
+	if whatIf.Cmp(live) <= 0 {
+		t.Errorf("WhatIf with Kp=%.2f = %s, want more than live %s", overrides.PIDParams.Kp, whatIf, live)
+	}
+
+	if *m.pidState != stateBefore {
+		t.Errorf("WhatIf changed PID state: %+v -> %+v", stateBefore, *m.pidState)
+	}
+	if m.GetLastMultiplier() != multiplierBefore {
+		t.Error("WhatIf should not record a multiplier")
+	}
+	if m.GetConfig().PIDParams.Kp != cfg.PIDParams.Kp {
+		t.Errorf("Live Kp = %.2f, want %.2f", m.GetConfig().PIDParams.Kp, cfg.PIDParams.Kp)
+	}
+	if R := m.PeekRAB(nil, EB, metrics); R.Cmp(live) != 0 {
+		t.Errorf("Live output after WhatIf = %s, want %s", R, live)
+	}
+}
+
+// TestMechanism_EstimateRAB tests that estimates match CalculateRAB without advancing controller state
+func TestMechanism_EstimateRAB(t *testing.T) {
+	metrics := &DynamicMetrics{QueueLengthB: 900}
+	EA, EB := big.NewInt(300000), big.NewInt(1000000)
+
+	for _, mode := range []SubsidyMode{SubsidyDestAvg, SubsidyPID, SubsidyLagrangian} {
+		cfg := DefaultConfig()
+		cfg.Mode = mode
+		cfg.MaxInflation = big.NewInt(1000)
+		clock := &fakeClock{t: time.Unix(1700000000, 0)}
+		m := NewMechanismWithClock(cfg, clock)
+
+		// Give the controllers some history first
+		m.CalculateRAB(EA, EB, metrics)
+		m.UpdateShadowPrice(big.NewInt(5000), cfg.MaxInflation)
+		pidBefore := m.GetPIDState()
+		lambdaBefore := m.GetShadowPrice()
+
+		// Estimates are pinned to the last PID update, so they do not drift as the clock moves
+		first := m.EstimateRAB(EA, EB, metrics)
+		for i := 0; i < 3; i++ {
+			clock.Advance(time.Second)
+			if R := m.EstimateRAB(EA, EB, metrics); R.Cmp(first) != 0 {
+				t.Errorf("%s: repeated EstimateRAB = %s, want %s", mode, R, first)
+			}
+		}
+		if R := m.PeekRAB(EA, EB, metrics); R.Cmp(first) != 0 {
+			t.Errorf("%s: PeekRAB = %s, want EstimateRAB %s", mode, R, first)
+		}
+		if pid := m.GetPIDState(); pid.Integral != pidBefore.Integral || pid.PrevError != pidBefore.PrevError {
+			t.Errorf("%s: EstimateRAB changed PID state: %+v -> %+v", mode, pidBefore, pid)
+		}
+		if lambda := m.GetShadowPrice(); lambda != lambdaBefore {
+			t.Errorf("%s: EstimateRAB changed lambda %.4f -> %.4f", mode, lambdaBefore, lambda)
+		}
+
+		// With the clock back at the last update, CalculateRAB sees the same time delta as the estimate
+		clock.t = pidBefore.LastUpdate
+		if R := m.CalculateRAB(EA, EB, metrics); R.Cmp(first) != 0 {
+			t.Errorf("%s: CalculateRAB = %s, want estimate %s", mode, R, first)
+		}
+	}
+}
+
+// TestMechanism_Telemetry tests that the telemetry buffer caps at its size and keeps the newest samples in order
+func TestMechanism_Telemetry(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyPID
+	cfg.TelemetryBufferSize = 4
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	m := NewMechanismWithClock(cfg, clock)
+	EB := big.NewInt(1000000)
+
+	if len(m.GetTelemetry()) != 0 {
+		t.Fatal("Telemetry should start empty")
+	}
+
+	var outputs []*big.Int
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Second)
+		metrics := &DynamicMetrics{QueueLengthB: int64(100 * i)}
+		outputs = append(outputs, m.CalculateRAB(nil, EB, metrics))
+	}
+
+	samples := m.GetTelemetry()
+	if len(samples) != cfg.TelemetryBufferSize {
+		t.Fatalf("Telemetry has %d samples, want %d", len(samples), cfg.TelemetryBufferSize)
+	}
+	recent := outputs[len(outputs)-cfg.TelemetryBufferSize:]
+	for i, s := range samples {
+		if s.R.Cmp(recent[i]) != 0 {
+			t.Errorf("Sample %d R = %s, want %s", i, s.R, recent[i])
+		}
+		if i > 0 && !s.Timestamp.After(samples[i-1].Timestamp) {
+			t.Errorf("Sample %d is not newer than sample %d", i, i-1)
+		}
+	}
+	if last := samples[len(samples)-1]; last.Integral != m.pidState.Integral {
+		t.Errorf("Latest sample integral = %f, want %f", last.Integral, m.pidState.Integral)
+	}
+
+	// Disabled by default
+	off := NewMechanism(DefaultConfig())
+	off.CalculateRAB(nil, EB, nil)
+	if len(off.GetTelemetry()) != 0 {
+		t.Error("Telemetry should be disabled when TelemetryBufferSize is 0")
+	}
+}
+
+// TestMarginalValue tests that the sign of the marginal value picks between a Case3 CTX and the displaced ITX
+func TestMarginalValue(t *testing.T) {
+	EA, EB := big.NewInt(1000), big.NewInt(400)
+	uA, _ := Split2(big.NewInt(700), big.NewInt(400), EA, EB) // uA = 850, Case3
+	if c := Classify(uA, EA, EB); c != Case3 {
+		t.Fatalf("Setup: expected Case3, got %s", c)
+	}
+
+	// Marginal ITX paying less than uA: include the CTX
+	if mv := MarginalValue(uA, big.NewInt(800)); mv.Cmp(big.NewInt(50)) != 0 || mv.Sign() <= 0 {
+		t.Errorf("MarginalValue vs 800 = %s, want +50 (favor CTX)", mv)
+	}
+	// Marginal ITX paying more than uA: keep the ITX
+	if mv := MarginalValue(uA, big.NewInt(900)); mv.Cmp(big.NewInt(-50)) != 0 || mv.Sign() >= 0 {
+		t.Errorf("MarginalValue vs 900 = %s, want -50 (favor ITX)", mv)
+	}
+	// No displaced ITX (spare space): the full utility is gained
+	if mv := MarginalValue(uA, nil); mv.Cmp(uA) != 0 {
+		t.Errorf("MarginalValue with no displaced ITX = %s, want %s", mv, uA)
+	}
+	if uA.Cmp(big.NewInt(850)) != 0 {
+		t.Error("MarginalValue should not modify its inputs")
+	}
+}
+
+// TestMaxEBForCase1 tests that the returned EB is the last one at which the CTX stays Case1
+func TestMaxEBForCase1(t *testing.T) {
+	tests := []struct {
+		name       string
+		fAB, R, EA int64
+	}{
+		{"fee only", 300, 0, 100},
+		{"with subsidy", 150, 80, 100},
+		{"odd total", 151, 0, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fAB, R, EA := big.NewInt(tt.fAB), big.NewInt(tt.R), big.NewInt(tt.EA)
+			EB := MaxEBForCase1(fAB, R, EA)
+			if EB == nil || EB.Sign() < 0 {
+				t.Fatalf("MaxEBForCase1 = %v, want a non-negative bound", EB)
+			}
+
+			uA, _ := Split2(fAB, R, EA, EB)
+			if c := Classify(uA, EA, EB); c != Case1 {
+				t.Errorf("At EB=%s: %s (uA=%s), want Case1", EB, c, uA)
+			}
+			above := new(big.Int).Add(EB, big.NewInt(1))
+			uA, _ = Split2(fAB, R, EA, above)
+			if c := Classify(uA, EA, above); c == Case1 {
+				t.Errorf("At EB=%s: still Case1 (uA=%s)", above, uA)
+			}
+		})
+	}
+
+	if EB := MaxEBForCase1(big.NewInt(50), big.NewInt(0), big.NewInt(100)); EB.Sign() >= 0 {
+		t.Errorf("Fee below EA: MaxEBForCase1 = %s, want negative", EB)
+	}
+	if EB := MaxEBForCase1(big.NewInt(50), nil, big.NewInt(0)); EB != nil {
+		t.Errorf("EA = 0: MaxEBForCase1 = %s, want nil (unbounded)", EB)
+	}
+}
+
+// TestClassifyWithConfig_EqualFees tests EA == EB classification under the default and flagged modes
+func TestClassifyWithConfig_EqualFees(t *testing.T) {
+	flagged := DefaultConfig()
+	flagged.EqualFeesSkipCase2 = true
+
+	tests := []struct {
+		name        string
+		uA, EA, EB  int64
+		wantDefault Case
+		wantFlagged Case
+	}{
+		{"above EA", 150, 100, 100, Case1, Case1},
+		{"at EA", 100, 100, 100, Case1, Case1},
+		{"below EA", 50, 100, 100, Case3, Case3},
+		{"zero utility", 0, 100, 100, Case2, Case3},
+		{"unequal fees unaffected", 10, 100, 80, Case2, Case2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uA, EA, EB := big.NewInt(tt.uA), big.NewInt(tt.EA), big.NewInt(tt.EB)
+			if got := ClassifyWithConfig(uA, EA, EB, DefaultConfig()); got != tt.wantDefault {
+				t.Errorf("Default: got %s, want %s", got, tt.wantDefault)
+			}
+			if got := ClassifyWithConfig(uA, EA, EB, nil); got != Classify(uA, EA, EB) {
+				t.Errorf("Nil config should match Classify, got %s", got)
+			}
+			if got := ClassifyWithConfig(uA, EA, EB, flagged); got != tt.wantFlagged {
+				t.Errorf("Flagged: got %s, want %s", got, tt.wantFlagged)
+			}
+		})
+	}
+}
+
+// TestNormalizeCongestion tests queue normalization with zero, normal and large inputs
+func TestNormalizeCongestion(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueLen  int64
+		reference float64
+		want      float64
+	}{
+		{"zero reference falls back to default", 500, 0, 0.5},
+		{"negative reference falls back to default", 2000, -10, 2.0},
+		{"normal reference", 300, 600, 0.5},
+		{"empty queue", 0, 600, 0},
+		{"negative queue", -5, 600, 0},
+		{"very large queue", math.MaxInt64, 1000, float64(math.MaxInt64) / 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeCongestion(tt.queueLen, tt.reference)
+			if math.Abs(got-tt.want) > 1e-9*math.Max(1, tt.want) {
+				t.Errorf("normalizeCongestion(%d, %v) = %v, want %v", tt.queueLen, tt.reference, got, tt.want)
+			}
+			if math.IsInf(got, 0) || math.IsNaN(got) {
+				t.Errorf("normalizeCongestion(%d, %v) is not finite", tt.queueLen, tt.reference)
+			}
+		})
+	}
+}
+
+// TestDynamicSubsidy_DegenerateCongestion tests that negative queue lengths and degenerate
+// parameters yield a finite, non-negative subsidy in the Lagrangian and PID modes
+func TestDynamicSubsidy_DegenerateCongestion(t *testing.T) {
+	EB := big.NewInt(1000000)
+
+	cfg := DefaultConfig()
+	cfg.LagrangianParams.CongestionExp = 2.5
+	for _, q := range []int64{-1, -1000, math.MinInt64} {
+		R := calcLagrangianSubsidy(&DynamicMetrics{QueueLengthB: q}, cfg, &LagrangianState{Lambda: 1.0}, EB)
+		if R.Sign() != 0 {
+			t.Errorf("Lagrangian R with QueueLengthB=%d = %s, want 0", q, R)
+		}
+	}
+
+	// An empty queue with a negative exponent gives an infinite factor: no subsidy
+	cfg.LagrangianParams.CongestionExp = -1
+	if R := calcLagrangianSubsidy(&DynamicMetrics{QueueLengthB: 0}, cfg, &LagrangianState{Lambda: 1.0}, EB); R.Sign() != 0 {
+		t.Errorf("Lagrangian R with infinite congestion factor = %s, want 0", R)
+	}
+
+	// A NaN capacity would make the PID utilization NaN; it is treated as empty
+	cfg.PIDParams.CapacityB = math.NaN()
+	now := time.Unix(1700000000, 0)
+	for _, q := range []int64{-500, 500} {
+		R := calcPIDSubsidy(&DynamicMetrics{QueueLengthB: q}, cfg, &PIDState{LastUpdate: now}, EB, now)
+		if R.Sign() < 0 {
+			t.Errorf("PID R with QueueLengthB=%d = %s, want non-negative", q, R)
+		}
+	}
+
+	// A NaN gain makes the PID output NaN, which passes the min/max clamp; it falls back to zero
+	cfg.PIDParams.CapacityB = 1000
+	cfg.PIDParams.Kp = math.NaN()
+	R := calcPIDSubsidy(&DynamicMetrics{QueueLengthB: -500}, cfg, &PIDState{LastUpdate: now}, EB, now)
+	if R.Sign() != 0 {
+		t.Errorf("PID R with NaN output = %s, want 0", R)
+	}
+}
+
+func TestMechanism_SnapshotRestore(t *testing.T) {
+	// A version-1 blob restores into the controller state
+	blob := []byte(`{"kind":"justitia.mechanism","version":1,"state":{"pid_integral":2.5,"pid_prev_error":0.1,` +
+		`"lambda":3,"total_subsidy":12345,"last_multiplier":1.5}}`)
+	m := NewMechanism(DefaultConfig())
+	if err := m.Restore(blob); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if m.GetShadowPrice() != 3 {
+		t.Errorf("Lambda = %v, want 3", m.GetShadowPrice())
+	}
+	if m.pidState.Integral != 2.5 || m.lagrangianState.TotalSubsidy.Int64() != 12345 {
+		t.Errorf("restored state = %+v / %+v", *m.pidState, *m.lagrangianState)
+	}
+
+	// Round trip through Snapshot
+	data, err := m.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	m2 := NewMechanism(DefaultConfig())
+	if err := m2.Restore(data); err != nil {
+		t.Fatalf("Restore(Snapshot()): %v", err)
+	}
+	if m2.lastMultiplier != 1.5 || m2.lagrangianState.TotalSubsidy.Int64() != 12345 {
+		t.Errorf("round trip lost state: multiplier %v, total %v", m2.lastMultiplier, m2.lagrangianState.TotalSubsidy)
+	}
+
+	// An unknown version is rejected without touching the state
+	bad := []byte(`{"kind":"justitia.mechanism","version":99,"state":{"lambda":7}}`)
+	if err := m2.Restore(bad); !errors.Is(err, snapshot.ErrVersionMismatch) {
+		t.Errorf("Restore(v99) err = %v, want ErrVersionMismatch", err)
+	}
+	if m2.GetShadowPrice() != 3 {
+		t.Errorf("Lambda changed to %v after rejected restore", m2.GetShadowPrice())
+	}
+}
+
+func TestMechanism_MarshalRestoreState(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyLagrangian
+	m := NewMechanism(cfg)
+	EA, EB := big.NewInt(800), big.NewInt(1000)
+	metrics := &DynamicMetrics{QueueLengthB: 700}
+	for i := 0; i < 5; i++ {
+		m.RecordSubsidy(m.CalculateRAB(EA, EB, metrics))
+		m.UpdateShadowPrice(big.NewInt(1200), big.NewInt(1000))
+	}
+	// An amount beyond int64/float64 precision must survive exactly
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890123", 10)
+	m.RecordSubsidy(huge)
+
+	data, err := m.MarshalState()
+	if err != nil {
+		t.Fatalf("MarshalState: %v", err)
+	}
+	m2 := NewMechanism(cfg)
+	if err := m2.RestoreState(data); err != nil {
+		t.Fatalf("RestoreState: %v", err)
+	}
+	if m2.lagrangianState.TotalSubsidy.Cmp(m.lagrangianState.TotalSubsidy) != 0 {
+		t.Errorf("TotalSubsidy = %v, want %v", m2.lagrangianState.TotalSubsidy, m.lagrangianState.TotalSubsidy)
+	}
+	if m2.pidState.Integral != m.pidState.Integral || m2.pidState.PrevError != m.pidState.PrevError ||
+		!m2.pidState.LastUpdate.Equal(m.pidState.LastUpdate) || m2.GetShadowPrice() != m.GetShadowPrice() {
+		t.Errorf("restored state = %+v / lambda %v, want %+v / lambda %v",
+			*m2.pidState, m2.GetShadowPrice(), *m.pidState, m.GetShadowPrice())
+	}
+	for i := 0; i < 3; i++ {
+		if got, want := m2.CalculateRAB(EA, EB, metrics), m.CalculateRAB(EA, EB, metrics); got.Cmp(want) != 0 {
+			t.Errorf("call %d after restore: R = %v, want %v", i, got, want)
+		}
+	}
+
+	// State saved under another mode is rejected without touching the controller
+	pidCfg := DefaultConfig()
+	pidCfg.Mode = SubsidyPID
+	m3 := NewMechanism(pidCfg)
+	if err := m3.RestoreState(data); !errors.Is(err, ErrModeMismatch) {
+		t.Errorf("RestoreState(Lagrangian into PID) err = %v, want ErrModeMismatch", err)
+	}
+	if m3.GetShadowPrice() != NewMechanism(pidCfg).GetShadowPrice() {
+		t.Errorf("Lambda changed to %v after rejected restore", m3.GetShadowPrice())
+	}
+}
+
+func TestMechanism_SnapshotEWMAAndRL(t *testing.T) {
+	EA := big.NewInt(500)
+	ab, ba := PairKey{From: 0, To: 1}, PairKey{From: 1, To: 0}
+
+	// The per-pair smoothed EB survives a round trip, so smoothing continues where it stopped
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyEWMADestAvg
+	cfg.EBSmoothingAlpha = 0.5
+	m := NewMechanism(cfg)
+	m.CalculateRABForPair(ab, EA, big.NewInt(1000), nil)
+	m.CalculateRABForPair(ab, EA, big.NewInt(2000), nil) // 1500
+	m.CalculateRABForPair(ba, EA, big.NewInt(4000), nil)
+	data, err := m.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	restored := NewMechanism(cfg)
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	for _, pair := range []PairKey{ab, ba} {
+		if got, want := restored.GetSmoothedEB(pair), m.GetSmoothedEB(pair); got == nil || got.Cmp(want) != 0 {
+			t.Errorf("restored smoothed EB of %v = %v, want %v", pair, got, want)
+		}
+	}
+	if R := restored.CalculateRABForPair(ab, EA, big.NewInt(2000), nil); R.Int64() != 1750 {
+		t.Errorf("R after restore = %v, want smoothed 1750", R)
+	}
+
+	// The RL action values and counts survive a round trip
+	rlCfg := DefaultConfig()
+	rlCfg.Mode = SubsidyRL
+	rlCfg.RLParams = RLParams{Buckets: 2, Actions: 3, MinMultiplier: 0, MaxMultiplier: 2, LearningRate: 0.5, CapacityB: 100}
+	rl := NewMechanism(rlCfg)
+	busy := &DynamicMetrics{QueueLengthB: 90}
+	for i := 0; i < 6; i++ {
+		multiplier := float64(rl.CalculateRAB(EA, big.NewInt(1000), busy).Int64()) / 1000
+		rl.UpdateReward(multiplier)
+	}
+	data, err = rl.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	rlRestored := NewMechanism(rlCfg)
+	if err := rlRestored.Restore(data); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got, want := rlRestored.GetRLPolicy(), rl.GetRLPolicy(); got[1] != want[1] || got[1] != 2 {
+		t.Errorf("restored policy = %v, want %v", got, want)
+	}
+	for a, n := range rl.rlState.Counts[1] {
+		if rlRestored.rlState.Counts[1][a] != n {
+			t.Errorf("restored count of action %d = %d, want %d", a, rlRestored.rlState.Counts[1][a], n)
+		}
+	}
+
+	// A table of another shape is rejected without touching the state
+	otherCfg := rlCfg
+	otherCfg.RLParams.Actions = 4
+	other := NewMechanism(otherCfg)
+	if err := other.Restore(data); !errors.Is(err, ErrRLShapeMismatch) {
+		t.Errorf("Restore(3 actions into 4) err = %v, want ErrRLShapeMismatch", err)
+	}
+
+	// A version-2 blob carries neither and restores with an empty history
+	v2 := []byte(`{"kind":"justitia.mechanism","version":2,"state":{"mode":"EWMADestAvg","lambda":2,"total_subsidy":"7"}}`)
+	if err := restored.Restore(v2); err != nil {
+		t.Fatalf("Restore(v2): %v", err)
+	}
+	if restored.GetSmoothedEB(ab) != nil || restored.GetShadowPrice() != 2 {
+		t.Errorf("after v2 restore: smoothed EB %v, lambda %v, want none and 2", restored.GetSmoothedEB(ab), restored.GetShadowPrice())
+	}
+}
+
+func TestMechanism_EWMADestAvg(t *testing.T) {
+	if SubsidyEWMADestAvg.String() != "EWMADestAvg" {
+		t.Errorf("SubsidyEWMADestAvg.String() = %q, want EWMADestAvg", SubsidyEWMADestAvg.String())
+	}
+	EA := big.NewInt(500)
+	if R := RAB(SubsidyEWMADestAvg, EA, big.NewInt(1000), nil, nil); R.Int64() != 1000 {
+		t.Errorf("stateless RAB(EWMADestAvg) = %v, want DestAvg fallback 1000", R)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyEWMADestAvg
+	cfg.EBSmoothingAlpha = 0.5
+	m := NewMechanism(cfg)
+	ab, ba := PairKey{From: 0, To: 1}, PairKey{From: 1, To: 0}
+
+	// Steady EB is passed through; after a step from 1000 to 2000 the subsidy closes
+	// half of the remaining gap per call
+	for i := 0; i < 3; i++ {
+		if R := m.CalculateRABForPair(ab, EA, big.NewInt(1000), nil); R.Int64() != 1000 {
+			t.Fatalf("steady call %d: R = %v, want 1000", i, R)
+		}
+	}
+	for i, want := range []int64{1500, 1750, 1875, 1937} {
+		if R := m.CalculateRABForPair(ab, EA, big.NewInt(2000), nil); R.Int64() != want {
+			t.Errorf("call %d after step: R = %v, want %d", i, R, want)
+		}
+	}
+
+	// Pairs are smoothed independently, and PeekRAB leaves the state untouched
+	if R := m.CalculateRABForPair(ba, EA, big.NewInt(4000), nil); R.Int64() != 4000 {
+		t.Errorf("first call for another pair: R = %v, want 4000", R)
+	}
+	if got := m.GetSmoothedEB(ab); got == nil || got.Int64() != 1937 {
+		t.Errorf("smoothed EB of %v = %v, want 1937", ab, got)
+	}
+	m.CalculateRAB(EA, big.NewInt(1000), nil)
+	m.PeekRAB(EA, big.NewInt(3000), nil)
+	if got := m.GetSmoothedEB(NoPair); got == nil || got.Int64() != 1000 {
+		t.Errorf("smoothed EB after PeekRAB = %v, want 1000", got)
+	}
+
+	m.ResetPair(ab)
+	if m.GetSmoothedEB(ab) != nil {
+		t.Error("ResetPair should forget the pair's smoothed EB")
+	}
+	if got := m.GetSmoothedEB(ba); got == nil || got.Int64() != 4000 {
+		t.Errorf("smoothed EB of %v after resetting %v = %v, want 4000", ba, ab, got)
+	}
+
+	m.FullReset()
+	if m.GetSmoothedEB(ba) != nil {
+		t.Error("FullReset should forget the smoothed EB")
+	}
+}
+
+func TestMechanism_PIDSaturationAndReset(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyPID
+	cfg.PIDParams.MaxIntegral = 2.0
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	m := NewMechanismWithClock(cfg, clock)
+	EA, EB := big.NewInt(500), big.NewInt(1000)
+	congested := &DynamicMetrics{QueueLengthB: 1000} // Utilization 1.0, error +0.3
+
+	// An hour since the last update winds the integral far past the bound
+	clock.Advance(time.Hour)
+	m.CalculateRAB(EA, EB, congested)
+	st := m.GetPIDState()
+	if !st.Saturated || st.Integral != 2.0 {
+		t.Errorf("after wind-up: integral %v saturated %v, want 2.0/true", st.Integral, st.Saturated)
+	}
+	if st.PrevError < 0.29 || st.PrevError > 0.31 {
+		t.Errorf("PrevError = %v, want 0.3", st.PrevError)
+	}
+
+	// The copy is detached from the live state
+	st.Integral = 99
+	if m.GetPIDState().Integral != 2.0 {
+		t.Error("GetPIDState should return a copy")
+	}
+
+	m.ResetPID()
+	st = m.GetPIDState()
+	if st.Integral != 0 || st.PrevError != 0 || st.Saturated {
+		t.Errorf("after ResetPID: %+v, want zeroed and unsaturated", st)
+	}
+
+	// A short interval stays inside the bound
+	clock.Advance(time.Second)
+	m.CalculateRAB(EA, EB, congested)
+	if st := m.GetPIDState(); st.Saturated || st.Integral <= 0 || st.Integral >= 2.0 {
+		t.Errorf("after short update: integral %v saturated %v, want within (0, 2) and unsaturated", st.Integral, st.Saturated)
+	}
+
+	// Without a configured bound the default applies
+	cfg.PIDParams.MaxIntegral = 0
+	m = NewMechanismWithClock(cfg, clock)
+	clock.Advance(time.Hour)
+	m.CalculateRAB(EA, EB, congested)
+	if st := m.GetPIDState(); st.Integral != DefaultPIDMaxIntegral || !st.Saturated {
+		t.Errorf("default bound: integral %v saturated %v, want %v/true", st.Integral, st.Saturated, DefaultPIDMaxIntegral)
+	}
+}
+
+func TestMechanism_RLPolicy(t *testing.T) {
+	if SubsidyRL.String() != "RL" {
+		t.Errorf("SubsidyRL.String() = %q, want RL", SubsidyRL.String())
+	}
+	EA, EB := big.NewInt(500), big.NewInt(1000)
+	if R := RAB(SubsidyRL, EA, EB, nil, nil); R.Cmp(EB) != 0 {
+		t.Errorf("stateless RAB(RL) = %v, want DestAvg fallback %v", R, EB)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Mode = SubsidyRL
+	cfg.RLParams = RLParams{Buckets: 2, Actions: 3, MinMultiplier: 0, MaxMultiplier: 2, LearningRate: 0.5, CapacityB: 100}
+	m := NewMechanism(cfg)
+
+	// Subsidizing pays off only when the destination queue is congested
+	quiet := &DynamicMetrics{QueueLengthB: 10}
+	busy := &DynamicMetrics{QueueLengthB: 90}
+	for i := 0; i < 30; i++ {
+		for _, metrics := range []*DynamicMetrics{quiet, busy} {
+			multiplier := float64(m.CalculateRAB(EA, EB, metrics).Int64()) / 1000
+			if metrics == busy {
+				m.UpdateReward(multiplier)
+			} else {
+				m.UpdateReward(-multiplier)
+			}
+		}
+	}
+
+	policy := m.GetRLPolicy()
+	if len(policy) != 2 || policy[0] != 0 || policy[1] != 2 {
+		t.Errorf("learned policy = %v, want [0 2]", policy)
+	}
+	if R := m.CalculateRAB(EA, EB, busy); R.Int64() != 2000 {
+		t.Errorf("greedy RL subsidy under congestion = %v, want 2000", R)
+	}
+
+	// PeekRAB and WhatIf record no decision
+	m.PeekRAB(EA, EB, quiet)
+	m.WhatIf(*m.GetConfig(), EA, EB, quiet)
+	if got := m.rlState.EpochActions; got[0] != -1 || got[1] != 2 {
+		t.Errorf("epoch actions after PeekRAB/WhatIf = %v, want [-1 2]", got)
+	}
+
+	// Every subsidy of the epoch in a bucket shares its decision, rewarded once when the epoch closes
+	if R := m.CalculateRAB(EA, EB, busy); R.Int64() != 2000 {
+		t.Errorf("second busy subsidy of the epoch = %v, want 2000", R)
+	}
+	before := m.rlState.Counts[1][2]
+	if n := m.UpdateReward(1); n != 1 || m.rlState.Counts[1][2] != before+1 {
+		t.Errorf("UpdateReward rewarded %d decisions (count %d -> %d), want 1", n, before, m.rlState.Counts[1][2])
+	}
+	if n := m.UpdateReward(1); n != 0 {
+		t.Errorf("UpdateReward without decisions rewarded %d, want 0", n)
+	}
+
+	m.FullReset()
+	if m.rlState.Counts[1][2] != 0 {
+		t.Error("FullReset should forget the learned policy")
+	}
+}
+
+func TestShapleyN(t *testing.T) {
+	sum := func(shares []*big.Int) *big.Int {
+		total := new(big.Int)
+		for _, s := range shares {
+			total.Add(total, s)
+		}
+		return total
+	}
+
+	// n = 2 matches Split2 (including its clamping)
+	cases2 := [][4]int64{{100, 50, 80, 70}, {100, 50, 70, 80}, {10, 0, 500, 20}, {10, 0, 20, 500}, {0, 0, 0, 0}}
+	for _, c := range cases2 {
+		fAB, R, EA, EB := big.NewInt(c[0]), big.NewInt(c[1]), big.NewInt(c[2]), big.NewInt(c[3])
+		uA, uB := Split2(fAB, R, EA, EB)
+		shares := ShapleyN(fAB, R, []*big.Int{EA, EB})
+		if shares[0].Cmp(uA) != 0 || shares[1].Cmp(uB) != 0 {
+			t.Errorf("ShapleyN%v = %v, want Split2 (%v, %v)", c, shares, uA, uB)
+		}
+	}
+
+	// n = 3: 300/3 + (E_i - 100) with mean 100
+	shares := ShapleyN(big.NewInt(200), big.NewInt(100), []*big.Int{big.NewInt(150), big.NewInt(100), big.NewInt(50)})
+	if shares[0].Int64() != 150 || shares[1].Int64() != 100 || shares[2].Int64() != 50 {
+		t.Errorf("ShapleyN n=3 = %v, want [150 100 50]", shares)
+	}
+
+	// n = 4 with a rounding remainder: 10/4 leaves 2 wei for the first party
+	shares = ShapleyN(big.NewInt(7), big.NewInt(3), []*big.Int{big.NewInt(1), big.NewInt(1), big.NewInt(1), big.NewInt(1)})
+	if shares[0].Int64() != 4 || sum(shares).Int64() != 10 {
+		t.Errorf("ShapleyN n=4 remainder = %v, want first party 4 and sum 10", shares)
+	}
+
+	// Clamping: a party whose share would be negative gets 0 and the rest re-split; sum conserved
+	E := []*big.Int{big.NewInt(1000), big.NewInt(10), nil, big.NewInt(20)}
+	shares = ShapleyN(big.NewInt(90), big.NewInt(10), E)
+	if sum(shares).Int64() != 100 {
+		t.Errorf("ShapleyN clamped sum = %v, want 100", sum(shares))
+	}
+	for i, s := range shares {
+		if s.Sign() < 0 {
+			t.Errorf("share %d = %v, want non-negative", i, s)
+		}
+	}
+
+	if ShapleyN(big.NewInt(1), nil, nil) != nil {
+		t.Error("ShapleyN with no parties should return nil")
+	}
+}
+
+func TestClassifyWithMargins(t *testing.T) {
+	tests := []struct {
+		uA, EA, EB   int64
+		want         Case
+		lower, upper int64
+	}{
+		{120, 100, 30, Case1, 50, -20}, // uA >= EA
+		{60, 100, 30, Case2, -10, 40},  // below EA-EB = 70
+		{70, 100, 30, Case2, 0, 30},    // exactly on the Case2 boundary
+		{85, 100, 30, Case3, 15, 15},   // strictly between
+		{40, 100, 150, Case3, 40, 60},  // EB >= EA: boundary taken as 0
+		{0, 100, 150, Case2, 0, 100},   // EB >= EA and uA <= 0
+	}
+	for _, tt := range tests {
+		c, lower, upper := ClassifyWithMargins(big.NewInt(tt.uA), big.NewInt(tt.EA), big.NewInt(tt.EB))
+		if c != tt.want || lower.Int64() != tt.lower || upper.Int64() != tt.upper {
+			t.Errorf("ClassifyWithMargins(%d, %d, %d) = (%s, %v, %v), want (%s, %d, %d)",
+				tt.uA, tt.EA, tt.EB, c, lower, upper, tt.want, tt.lower, tt.upper)
+		}
+		if got := Classify(big.NewInt(tt.uA), big.NewInt(tt.EA), big.NewInt(tt.EB)); got != c {
+			t.Errorf("Classify(%d, %d, %d) = %s, want %s", tt.uA, tt.EA, tt.EB, got, c)
+		}
+	}
+}
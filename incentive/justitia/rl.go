@@ -0,0 +1,191 @@
+package justitia
+
+import (
+	"math/big"
+	"math/rand"
+)
+
+// RLParams holds the parameters of the RL subsidy policy: an epsilon-greedy contextual bandit
+// that learns, per destination-queue utilization bucket, which multiplier of EB to pay
+type RLParams struct {
+	Buckets       int     // Number of queue utilization buckets over [0, 1); utilization >= 1 uses the last one
+	Actions       int     // Number of candidate multipliers, evenly spaced over [MinMultiplier, MaxMultiplier]
+	MinMultiplier float64 // Smallest subsidy multiplier of EB
+	MaxMultiplier float64 // Largest subsidy multiplier of EB
+	LearningRate  float64 // Step size of the value update (0-1)
+	Epsilon       float64 // Exploration probability (0 = always greedy)
+	CapacityB     float64 // Queue size that counts as full utilization
+	Seed          int64   // Seed of the exploration RNG (reproducible runs)
+	CostWeight    float64 // Reward penalty per unit of multiplier paid: reward = benefit - CostWeight*multiplier
+}
+
+// RLState holds the learned action values and the decisions of the current epoch awaiting a reward
+// Each bucket decides once per epoch; every subsidy of the epoch in that bucket uses the same
+// action, and UpdateReward credits all of them when the epoch closes
+type RLState struct {
+	Q            [][]float64 // Estimated reward per [bucket][action]
+	Counts       [][]int     // Rewards received per [bucket][action]
+	EpochActions []int       // Action chosen per bucket in the current epoch (-1 = none yet)
+	rng          *rand.Rand  // Exploration source; nil disables exploration (used by PeekRAB/WhatIf)
+	readOnly     bool        // Choose from the table without recording decisions (used by PeekRAB/WhatIf)
+}
+
+// newRLState allocates an empty action-value table for params
+func newRLState(params RLParams) *RLState {
+	buckets, actions := rlDims(params)
+	state := &RLState{
+		Q:            make([][]float64, buckets),
+		Counts:       make([][]int, buckets),
+		EpochActions: make([]int, buckets),
+		rng:          rand.New(rand.NewSource(params.Seed)),
+	}
+	for b := range state.Q {
+		state.Q[b] = make([]float64, actions)
+		state.Counts[b] = make([]int, actions)
+		state.EpochActions[b] = -1
+	}
+	return state
+}
+
+// rlDims returns the table dimensions, at least one bucket and one action
+func rlDims(params RLParams) (buckets, actions int) {
+	buckets, actions = params.Buckets, params.Actions
+	if buckets < 1 {
+		buckets = 1
+	}
+	if actions < 1 {
+		actions = 1
+	}
+	return buckets, actions
+}
+
+// rlMultiplier returns the subsidy multiplier of action
+func rlMultiplier(params RLParams, action int) float64 {
+	_, actions := rlDims(params)
+	if actions == 1 {
+		return params.MinMultiplier
+	}
+	return params.MinMultiplier + (params.MaxMultiplier-params.MinMultiplier)*float64(action)/float64(actions-1)
+}
+
+// rlBucket maps the destination queue utilization to a bucket index
+func rlBucket(metrics *DynamicMetrics, params RLParams, buckets int) int {
+	b := int(normalizeCongestion(metrics.QueueLengthB, params.CapacityB) * float64(buckets))
+	if b >= buckets {
+		b = buckets - 1
+	}
+	return b
+}
+
+// chooseAction picks an action for bucket: untried actions first, then epsilon-greedy on Q
+func (s *RLState) chooseAction(bucket int, epsilon float64) int {
+	q := s.Q[bucket]
+	if s.rng != nil && epsilon > 0 && s.rng.Float64() < epsilon {
+		return s.rng.Intn(len(q))
+	}
+	for a, n := range s.Counts[bucket] {
+		if n == 0 {
+			return a
+		}
+	}
+	best := 0
+	for a := range q {
+		if q[a] > q[best] {
+			best = a
+		}
+	}
+	return best
+}
+
+// calcRLSubsidy computes the RL subsidy R = EB * multiplier, where the multiplier is the action the
+// policy picked for the current queue utilization bucket in this epoch (chosen on the bucket's
+// first subsidy of the epoch and kept for UpdateReward)
+func calcRLSubsidy(metrics *DynamicMetrics, config *Config, state *RLState, EB *big.Int) *big.Int {
+	if metrics == nil || EB == nil || len(state.Q) == 0 {
+		return big.NewInt(0)
+	}
+
+	params := config.RLParams
+	bucket := rlBucket(metrics, params, len(state.Q))
+	action := state.EpochActions[bucket]
+	if action < 0 {
+		action = state.chooseAction(bucket, params.Epsilon)
+		if !state.readOnly {
+			state.EpochActions[bucket] = action
+		}
+	}
+
+	multiplier := rlMultiplier(params, action)
+	if multiplier <= 0 {
+		return big.NewInt(0)
+	}
+	result, _ := new(big.Float).Mul(new(big.Float).SetInt(EB), big.NewFloat(multiplier)).Int(nil)
+	if result.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	return result
+}
+
+// UpdateReward closes the current RL epoch: every bucket that decided an action in it is credited
+// reward = benefit - CostWeight*multiplier, moving that action's value towards it, and the next
+// subsidy of each bucket decides afresh. benefit is the realized latency reduction of the epoch
+// (the scheduler feeds the relative drop in CTX left waiting per block). Returns the number of decisions rewarded; calls outside RL
+// mode are ignored
+func (m *Mechanism) UpdateReward(benefit float64) int {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	if m.config.Mode != SubsidyRL {
+		return 0
+	}
+	state := m.rlState
+	params := m.config.RLParams
+	rewarded := 0
+	for b, a := range state.EpochActions {
+		if a < 0 {
+			continue
+		}
+		reward := benefit - params.CostWeight*rlMultiplier(params, a)
+		rate := params.LearningRate
+		if rate <= 0 || rate > 1 {
+			// Sample average when no valid learning rate is configured
+			rate = 1.0 / float64(state.Counts[b][a]+1)
+		}
+		state.Q[b][a] += rate * (reward - state.Q[b][a])
+		state.Counts[b][a]++
+		state.EpochActions[b] = -1
+		rewarded++
+	}
+	return rewarded
+}
+
+// clone returns a copy of s that shares no slices with it
+func (s *RLState) clone() *RLState {
+	c := *s
+	c.Q = make([][]float64, len(s.Q))
+	c.Counts = make([][]int, len(s.Counts))
+	for b := range s.Q {
+		c.Q[b] = append([]float64(nil), s.Q[b]...)
+		c.Counts[b] = append([]int(nil), s.Counts[b]...)
+	}
+	c.EpochActions = append([]int(nil), s.EpochActions...)
+	return &c
+}
+
+// GetRLPolicy returns the greedy multiplier of EB the RL policy currently prefers in each bucket
+func (m *Mechanism) GetRLPolicy() []float64 {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	policy := make([]float64, len(m.rlState.Q))
+	for b, q := range m.rlState.Q {
+		best := 0
+		for a := range q {
+			if q[a] > q[best] {
+				best = a
+			}
+		}
+		policy[b] = rlMultiplier(m.config.RLParams, best)
+	}
+	return policy
+}
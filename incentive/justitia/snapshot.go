@@ -0,0 +1,188 @@
+package justitia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"blockEmulator/utils/snapshot"
+)
+
+const (
+	// MechanismSnapshotKind tags Mechanism snapshots in their envelope
+	MechanismSnapshotKind = "justitia.mechanism"
+	// MechanismSnapshotVersion is the format written by Snapshot; bump it (and register a
+	// snapshot.Migration from the previous version) whenever mechanismSnapshot changes
+	MechanismSnapshotVersion = 3
+)
+
+// ErrModeMismatch is returned when restoring controller state saved under a different subsidy mode
+var ErrModeMismatch = errors.New("justitia: snapshot subsidy mode does not match config")
+
+// ErrRLShapeMismatch is returned when a saved RL table does not fit the configured buckets and actions
+var ErrRLShapeMismatch = errors.New("justitia: snapshot RL table does not match RLParams")
+
+func init() {
+	// v1 -> v2: total_subsidy becomes a decimal string; the mode is unknown (accepted by any config)
+	snapshot.RegisterMigration(MechanismSnapshotKind, 1, func(state json.RawMessage) (json.RawMessage, error) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(state, &fields); err != nil {
+			return nil, err
+		}
+		if raw, ok := fields["total_subsidy"]; ok && string(raw) != "null" {
+			quoted, err := json.Marshal(string(raw))
+			if err != nil {
+				return nil, err
+			}
+			fields["total_subsidy"] = quoted
+		}
+		return json.Marshal(fields)
+	})
+	// v2 -> v3: adds the per-pair smoothed EB and the RL action values; v2 blobs carry neither,
+	// so they restore with no smoothing history and an untrained RL table
+	snapshot.RegisterMigration(MechanismSnapshotKind, 2, func(state json.RawMessage) (json.RawMessage, error) {
+		return state, nil
+	})
+}
+
+// mechanismSnapshot is the serialized controller state (telemetry is diagnostic and not kept).
+// Amounts are decimal strings so they round-trip exactly through any JSON tooling
+type mechanismSnapshot struct {
+	Mode           string    `json:"mode,omitempty"` // SubsidyMode.String() of the saving config
+	PIDIntegral    float64   `json:"pid_integral"`
+	PIDPrevError   float64   `json:"pid_prev_error"`
+	PIDLastUpdate  time.Time `json:"pid_last_update"`
+	Lambda         float64   `json:"lambda"`
+	TotalSubsidy   string    `json:"total_subsidy"`
+	LagLastUpdate  time.Time `json:"lag_last_update"`
+	EpochStartTime time.Time `json:"epoch_start_time"`
+	LastMultiplier float64   `json:"last_multiplier"`
+
+	SmoothedEB []smoothedEBSnapshot `json:"smoothed_eb,omitempty"` // EWMADestAvg state, sorted by pair
+	RLQ        [][]float64          `json:"rl_q,omitempty"`        // RL action values per [bucket][action]
+	RLCounts   [][]int              `json:"rl_counts,omitempty"`   // RL rewards received per [bucket][action]
+}
+
+// smoothedEBSnapshot is the smoothed EB of one shard pair
+type smoothedEBSnapshot struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	EB   string `json:"eb"`
+}
+
+// Snapshot serializes the PID, Lagrangian, EWMADestAvg and RL state into a versioned blob
+// A pending RL decision that has not been rewarded yet is not kept
+func (m *Mechanism) Snapshot() ([]byte, error) {
+	m.stateLock.Lock()
+	s := mechanismSnapshot{
+		Mode:           m.config.Mode.String(),
+		PIDIntegral:    m.pidState.Integral,
+		PIDPrevError:   m.pidState.PrevError,
+		PIDLastUpdate:  m.pidState.LastUpdate,
+		Lambda:         m.lagrangianState.Lambda,
+		TotalSubsidy:   m.lagrangianState.TotalSubsidy.String(),
+		LagLastUpdate:  m.lagrangianState.LastUpdate,
+		EpochStartTime: m.lagrangianState.EpochStartTime,
+		LastMultiplier: m.lastMultiplier,
+	}
+	for pair, eb := range m.smoothedEB {
+		s.SmoothedEB = append(s.SmoothedEB, smoothedEBSnapshot{From: pair.From, To: pair.To, EB: eb.String()})
+	}
+	sort.Slice(s.SmoothedEB, func(i, j int) bool {
+		if s.SmoothedEB[i].From != s.SmoothedEB[j].From {
+			return s.SmoothedEB[i].From < s.SmoothedEB[j].From
+		}
+		return s.SmoothedEB[i].To < s.SmoothedEB[j].To
+	})
+	if m.rlState != nil {
+		s.RLQ = make([][]float64, len(m.rlState.Q))
+		s.RLCounts = make([][]int, len(m.rlState.Counts))
+		for b := range m.rlState.Q {
+			s.RLQ[b] = append([]float64(nil), m.rlState.Q[b]...)
+			s.RLCounts[b] = append([]int(nil), m.rlState.Counts[b]...)
+		}
+	}
+	m.stateLock.Unlock()
+	return snapshot.Encode(MechanismSnapshotKind, MechanismSnapshotVersion, s)
+}
+
+// Restore replaces the controller state with a blob produced by Snapshot
+// An unknown version returns snapshot.ErrVersionMismatch, a blob saved under a different
+// subsidy mode returns ErrModeMismatch and an RL table of another shape returns
+// ErrRLShapeMismatch; in all cases the state is left untouched
+func (m *Mechanism) Restore(data []byte) error {
+	var s mechanismSnapshot
+	if err := snapshot.Decode(data, MechanismSnapshotKind, MechanismSnapshotVersion, &s); err != nil {
+		return err
+	}
+	total := big.NewInt(0)
+	if s.TotalSubsidy != "" {
+		if _, ok := total.SetString(s.TotalSubsidy, 10); !ok {
+			return fmt.Errorf("justitia: invalid total_subsidy %q", s.TotalSubsidy)
+		}
+	}
+	smoothed := make(map[PairKey]*big.Int, len(s.SmoothedEB))
+	for _, e := range s.SmoothedEB {
+		eb, ok := new(big.Int).SetString(e.EB, 10)
+		if !ok {
+			return fmt.Errorf("justitia: invalid smoothed_eb %q for pair %d->%d", e.EB, e.From, e.To)
+		}
+		smoothed[PairKey{From: e.From, To: e.To}] = eb
+	}
+
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	if s.Mode != "" && s.Mode != m.config.Mode.String() {
+		return fmt.Errorf("%w: saved %s, config %s", ErrModeMismatch, s.Mode, m.config.Mode)
+	}
+	rl := newRLState(m.config.RLParams)
+	if s.RLQ != nil || s.RLCounts != nil {
+		if !sameShape(rl.Q, s.RLQ) || len(s.RLCounts) != len(s.RLQ) {
+			return fmt.Errorf("%w: saved %d buckets", ErrRLShapeMismatch, len(s.RLQ))
+		}
+		for b := range s.RLQ {
+			if len(s.RLCounts[b]) != len(s.RLQ[b]) {
+				return fmt.Errorf("%w: bucket %d", ErrRLShapeMismatch, b)
+			}
+			copy(rl.Q[b], s.RLQ[b])
+			copy(rl.Counts[b], s.RLCounts[b])
+		}
+	}
+	m.pidState.Integral = s.PIDIntegral
+	m.pidState.PrevError = s.PIDPrevError
+	m.pidState.LastUpdate = s.PIDLastUpdate
+	m.lagrangianState.Lambda = s.Lambda
+	m.lagrangianState.TotalSubsidy = total
+	m.lagrangianState.LastUpdate = s.LagLastUpdate
+	m.lagrangianState.EpochStartTime = s.EpochStartTime
+	m.lastMultiplier = s.LastMultiplier
+	m.smoothedEB = smoothed
+	m.rlState = rl
+	return nil
+}
+
+// sameShape reports whether got has exactly the bucket and action dimensions of want
+func sameShape(want, got [][]float64) bool {
+	if len(want) != len(got) {
+		return false
+	}
+	for b := range want {
+		if len(want[b]) != len(got[b]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalState checkpoints the adaptive controller state as JSON (same format as Snapshot)
+func (m *Mechanism) MarshalState() ([]byte, error) {
+	return m.Snapshot()
+}
+
+// RestoreState restores a checkpoint written by MarshalState (same rules as Restore)
+func (m *Mechanism) RestoreState(data []byte) error {
+	return m.Restore(data)
+}
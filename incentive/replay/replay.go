@@ -0,0 +1,87 @@
+// Package replay scores a transaction dataset through the Justitia pipeline offline
+// It lives outside package justitia because ethcsv depends (via utils and params) on justitia
+package replay
+
+import (
+	"blockEmulator/fees/expectation"
+	"blockEmulator/incentive/justitia"
+	"blockEmulator/ingest/ethcsv"
+	"math/big"
+)
+
+// ScoredTx is the subsidy, utility split and case the scheduler would assign to a CTX
+type ScoredTx struct {
+	TxHash      string
+	BlockNumber uint64
+	FromShard   int
+	ToShard     int
+	Fee         *big.Int      // f_AB (proposer fee)
+	EA          *big.Int      // E(f_A) at scoring time
+	EB          *big.Int      // E(f_B) at scoring time
+	R           *big.Int      // Subsidy R_AB
+	UtilityA    *big.Int      // uA
+	UtilityB    *big.Int      // uB
+	Case        justitia.Case // Case1/Case2/Case3
+}
+
+// ReplayDataset replays rows in arrival order and scores every cross-shard transaction
+// Addresses are mapped to shards with ethcsv.MapShard; ITX fees of each dataset block are fed
+// into a fee tracker when the block ends, so a CTX is scored against E(f_s) of earlier blocks
+// only, as in the emulator. Dynamic modes (PID, Lagrangian) are scored without queue metrics.
+func ReplayDataset(rows []ethcsv.TxRow, numShards int, cfg *justitia.Config) []ScoredTx {
+	if cfg == nil {
+		cfg = justitia.DefaultConfig()
+	}
+	tracker := expectation.NewTracker(cfg.WindowBlocks)
+	mechanism := justitia.NewMechanism(cfg)
+
+	scored := make([]ScoredTx, 0)
+	blockFees := make(map[int][]*big.Int) // shard -> ITX fees of the current dataset block
+	currentBlock := uint64(0)
+	started := false
+
+	flush := func() {
+		for shardID, fees := range blockFees {
+			tracker.OnBlockFinalized(shardID, fees)
+		}
+		blockFees = make(map[int][]*big.Int)
+	}
+
+	for _, row := range rows {
+		if started && row.BlockNumber != currentBlock {
+			flush()
+		}
+		currentBlock = row.BlockNumber
+		started = true
+
+		fee := ethcsv.ComputeProposerFee(row)
+		fromShard := ethcsv.MapShard(row.From, numShards)
+		toShard := ethcsv.MapShard(ethcsv.ToAddress(row), numShards)
+
+		if fromShard == toShard {
+			blockFees[fromShard] = append(blockFees[fromShard], fee)
+			continue
+		}
+
+		EA := tracker.GetAvgITXFee(fromShard)
+		EB := tracker.GetAvgITXFee(toShard)
+		R := mechanism.CalculateRAB(EA, EB, nil)
+		uA, uB := justitia.Split2(fee, R, EA, EB)
+
+		scored = append(scored, ScoredTx{
+			TxHash:      row.TxHash,
+			BlockNumber: row.BlockNumber,
+			FromShard:   fromShard,
+			ToShard:     toShard,
+			Fee:         fee,
+			EA:          EA,
+			EB:          EB,
+			R:           R,
+			UtilityA:    uA,
+			UtilityB:    uB,
+			Case:        justitia.Classify(uA, EA, EB),
+		})
+	}
+
+	return scored
+}
@@ -0,0 +1,221 @@
+package ethcsv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Columns maps CSV column names to their indices
+type Columns map[string]int
+
+// DefaultColumns is the fixed layout of datasets without a header row:
+// blockNumber,timestamp,transactionHash,from,to,toCreate,fromIsContract,toIsContract,value,gasLimit,
+// gasPrice,gasUsed,callingFunction,isError,eip2718type,baseFeePerGas,maxFeePerGas,maxPriorityFeePerGas
+var DefaultColumns = Columns{
+	"blockNumber": 0, "timestamp": 1, "transactionHash": 2, "from": 3, "to": 4,
+	"toCreate": 5, "fromIsContract": 6, "toIsContract": 7, "value": 8, "gasLimit": 9,
+	"gasPrice": 10, "gasUsed": 11, "callingFunction": 12, "isError": 13, "eip2718type": 14,
+	"baseFeePerGas": 15, "maxFeePerGas": 16, "maxPriorityFeePerGas": 17,
+}
+
+// Index returns the column index for name, or -1 if the layout has no such column
+func (c Columns) Index(name string) int {
+	if idx, ok := c[name]; ok {
+		return idx
+	}
+	return -1
+}
+
+// Field returns the raw value of column name, or false if the column is missing or empty/None
+func (c Columns) Field(record []string, name string) (string, bool) {
+	idx := c.Index(name)
+	if idx < 0 || idx >= len(record) || record[idx] == "" || record[idx] == "None" {
+		return "", false
+	}
+	return record[idx], true
+}
+
+// IsHeader reports whether a record is a header row, i.e. names the blockNumber column anywhere
+func IsHeader(record []string) bool {
+	for _, name := range record {
+		if strings.TrimSpace(name) == "blockNumber" {
+			return true
+		}
+	}
+	return false
+}
+
+// HeaderColumns builds the layout named by a header row
+func HeaderColumns(header []string) Columns {
+	cols := make(Columns, len(header))
+	for i, name := range header {
+		cols[strings.TrimSpace(name)] = i
+	}
+	return cols
+}
+
+// FieldError reports a CSV field that was present but could not be parsed
+type FieldError struct {
+	Field string // Column name
+	Value string // Raw value
+	Err   error  // Underlying parse error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field %s: cannot parse %q: %v", e.Field, e.Value, e.Err)
+}
+
+// RowError collects the FieldErrors of one record
+type RowError struct {
+	Fields []*FieldError
+}
+
+func (e *RowError) Error() string {
+	if len(e.Fields) == 1 {
+		return e.Fields[0].Error()
+	}
+	return fmt.Sprintf("%d malformed fields, first: %v", len(e.Fields), e.Fields[0])
+}
+
+// ParseRow parses a record in the DefaultColumns layout (see ParseRowWithColumns)
+func ParseRow(record []string) (TxRow, error) {
+	return ParseRowWithColumns(record, DefaultColumns)
+}
+
+// ParseRowWithColumns converts a CSV record into a TxRow using the given column layout.
+// Missing, empty and "None" columns are left at their zero value; columns that are present
+// but malformed are also left unset and reported in a *RowError, so the row stays usable
+func ParseRowWithColumns(record []string, cols Columns) (TxRow, error) {
+	p := rowParser{record: record, cols: cols}
+	row := TxRow{}
+
+	// Basic fields
+	row.BlockNumber, _ = p.uint("blockNumber", 64)
+	row.Timestamp, _ = p.uint("timestamp", 64)
+	row.TxHash, _ = cols.Field(record, "transactionHash")
+	row.From, _ = cols.Field(record, "from")
+	row.To, _ = cols.Field(record, "to")
+	row.ToCreate, _ = cols.Field(record, "toCreate")
+	row.Value = p.big("value")
+	if isError, ok := p.uint("isError", 1); ok {
+		row.IsError = isError == 1
+	}
+
+	// Gas fields (critical for fee computation)
+	row.GasLimit, _ = p.uint("gasLimit", 64)
+	row.GasPrice = p.big("gasPrice")
+	row.GasUsed, _ = p.uint("gasUsed", 64)
+
+	// EIP-2718 type (0=legacy, 2=EIP-1559, etc.) and EIP-1559 fields
+	if eipType, ok := p.uint("eip2718type", 8); ok {
+		row.EIP2718Type = uint8(eipType)
+	}
+	row.BaseFeePerGas = p.big("baseFeePerGas")
+	row.MaxFeePerGas = p.big("maxFeePerGas")
+	row.MaxPriorityFeePerGas = p.big("maxPriorityFeePerGas")
+
+	// EIP-4844 blob fields (only present in datasets whose header names them)
+	row.BlobGasUsed, _ = p.uint("blobGasUsed", 64)
+	row.BlobBaseFeePerGas = p.big("blobBaseFeePerGas")
+	row.MaxFeePerBlobGas = p.big("maxFeePerBlobGas")
+	row.MaxPriorityFeePerBlobGas = p.big("maxPriorityFeePerBlobGas")
+
+	if len(p.errs) > 0 {
+		return row, &RowError{Fields: p.errs}
+	}
+	return row, nil
+}
+
+// rowParser parses typed columns of one record, collecting FieldErrors
+type rowParser struct {
+	record []string
+	cols   Columns
+	errs   []*FieldError
+}
+
+// uint parses an unsigned integer column, recording an error if it is malformed
+func (p *rowParser) uint(name string, bitSize int) (uint64, bool) {
+	raw, ok := p.cols.Field(p.record, name)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(raw, 10, bitSize)
+	if err != nil {
+		p.errs = append(p.errs, &FieldError{Field: name, Value: raw, Err: err})
+		return 0, false
+	}
+	return v, true
+}
+
+// big parses a big integer column, recording an error if it is malformed (nil if unset)
+func (p *rowParser) big(name string) *big.Int {
+	raw, ok := p.cols.Field(p.record, name)
+	if !ok {
+		return nil
+	}
+	v, ok := new(big.Int).SetString(raw, 10)
+	if !ok {
+		p.errs = append(p.errs, &FieldError{Field: name, Value: raw, Err: strconv.ErrSyntax})
+		return nil
+	}
+	return v
+}
+
+// RowReader reads TxRows one at a time from a CSV stream. A header row (see IsHeader) switches
+// the layout for the rows after it; without one DefaultColumns applies
+type RowReader struct {
+	csv  *csv.Reader
+	cols Columns
+}
+
+// NewRowReader returns a RowReader over r
+func NewRowReader(r io.Reader) *RowReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // Rows may omit trailing columns
+	return &RowReader{csv: cr, cols: DefaultColumns}
+}
+
+// Next returns the next data row. A *RowError comes with a usable row whose malformed fields
+// are unset; any other error (io.EOF at the end of the stream) ends the iteration
+func (rr *RowReader) Next() (TxRow, error) {
+	for {
+		record, err := rr.csv.Read()
+		if err != nil {
+			return TxRow{}, err
+		}
+		if IsHeader(record) {
+			rr.cols = HeaderColumns(record)
+			continue
+		}
+		return ParseRowWithColumns(record, rr.cols)
+	}
+}
+
+// StreamRows parses r in a background goroutine and yields its rows without loading the whole
+// file. Rows with malformed fields are still sent (with those fields unset). The error channel
+// receives at most one read error; both channels are closed when the stream ends
+func StreamRows(r io.Reader) (<-chan TxRow, <-chan error) {
+	rows := make(chan TxRow, 64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(rows)
+		defer close(errc)
+		rr := NewRowReader(r)
+		for {
+			row, err := rr.Next()
+			if err == io.EOF {
+				return
+			}
+			if _, partial := err.(*RowError); err != nil && !partial {
+				errc <- err
+				return
+			}
+			rows <- row
+		}
+	}()
+	return rows, errc
+}
@@ -0,0 +1,114 @@
+package ethcsv
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestParseRow_Sentinels tests that empty and "None" columns and short rows parse without errors
+func TestParseRow_Sentinels(t *testing.T) {
+	record := []string{
+		"100", "1700000000", "0xhash", "0xfrom", "None", "0xcreated", "0", "1", "",
+		"50000", "None", "21000", "", "1", "2", "None", "30000000000", "",
+	}
+	row, err := ParseRow(record)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if row.BlockNumber != 100 || row.Timestamp != 1700000000 || row.TxHash != "0xhash" || !row.IsError {
+		t.Errorf("Basic fields not parsed: %+v", row)
+	}
+	if row.To != "" || row.ToCreate != "0xcreated" || row.Value != nil || row.GasPrice != nil ||
+		row.BaseFeePerGas != nil || row.MaxPriorityFeePerGas != nil {
+		t.Errorf("Sentinel fields should be unset: %+v", row)
+	}
+	if row.EIP2718Type != 2 || row.MaxFeePerGas.Int64() != 30000000000 || row.GasUsed != 21000 {
+		t.Errorf("EIP-1559 fields not parsed: %+v", row)
+	}
+
+	// Missing trailing columns are not errors
+	if row, err := ParseRow([]string{"7"}); err != nil || row.BlockNumber != 7 {
+		t.Errorf("Short row: row=%+v err=%v", row, err)
+	}
+}
+
+// TestParseRow_Malformed tests that malformed fields are reported and left unset while the rest parses
+func TestParseRow_Malformed(t *testing.T) {
+	record := []string{
+		"12x45", "1700000000", "0xhash", "0xfrom", "0xto", "", "0", "0", "1000",
+		"21000", "1.5e9", "abc", "", "2", "300",
+	}
+	row, err := ParseRow(record)
+
+	var re *RowError
+	if !errors.As(err, &re) {
+		t.Fatalf("Expected a *RowError, got %v", err)
+	}
+	want := map[string]bool{"blockNumber": true, "gasPrice": true, "gasUsed": true, "isError": true, "eip2718type": true}
+	if len(re.Fields) != len(want) {
+		t.Errorf("Got %d field errors, want %d: %v", len(re.Fields), len(want), re.Fields)
+	}
+	for _, fe := range re.Fields {
+		if !want[fe.Field] {
+			t.Errorf("Unexpected field error: %v", fe)
+		}
+	}
+	if row.BlockNumber != 0 || row.GasPrice != nil || row.GasUsed != 0 || row.EIP2718Type != 0 || row.IsError {
+		t.Errorf("Malformed fields should be unset: %+v", row)
+	}
+	if row.Value.Int64() != 1000 || row.GasLimit != 21000 {
+		t.Errorf("Valid fields not parsed: %+v", row)
+	}
+}
+
+// TestStreamRows tests that a header switches the layout and malformed rows are still yielded
+func TestStreamRows(t *testing.T) {
+	data := "gasUsed,blockNumber,gasPrice\n" +
+		"21000,1,20000000000\n" +
+		"abc,2,None\n" +
+		"50000,3\n"
+	rows, errc := StreamRows(strings.NewReader(data))
+
+	var got []TxRow
+	for row := range rows {
+		got = append(got, row)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Unexpected stream error: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Got %d rows, want 3", len(got))
+	}
+	if got[0].BlockNumber != 1 || got[0].GasUsed != 21000 || got[0].GasPrice.Int64() != 20000000000 {
+		t.Errorf("Row 1 = %+v", got[0])
+	}
+	if got[1].BlockNumber != 2 || got[1].GasUsed != 0 || got[1].GasPrice != nil {
+		t.Errorf("Row 2 = %+v", got[1])
+	}
+	if got[2].BlockNumber != 3 || got[2].GasUsed != 50000 {
+		t.Errorf("Row 3 = %+v", got[2])
+	}
+
+	// The iterator reports the malformed field and then io.EOF
+	rr := NewRowReader(strings.NewReader(data))
+	if _, err := rr.Next(); err != nil {
+		t.Errorf("Row 1: %v", err)
+	}
+	if _, err := rr.Next(); err == nil {
+		t.Error("Row 2: expected a field error")
+	}
+	rr.Next()
+	if _, err := rr.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last row, got %v", err)
+	}
+
+	// A CSV syntax error ends the stream through the error channel
+	rows, errc = StreamRows(strings.NewReader("1,\"unterminated\n"))
+	for range rows {
+	}
+	if err := <-errc; err == nil {
+		t.Error("Expected a read error for malformed CSV")
+	}
+}
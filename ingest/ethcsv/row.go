@@ -11,24 +11,26 @@ import (
 
 // TxRow represents a transaction row from the Ethereum CSV dataset
 type TxRow struct {
-	BlockNumber          uint64
-	Timestamp            uint64
-	TxHash               string
-	From                 string
-	To                   string
-	ToCreate             string // Contract creation address
-	Value                *big.Int
-	GasLimit             uint64
-	GasPrice             *big.Int // For legacy/EIP-2930 transactions
-	GasUsed              uint64
-	EIP2718Type          uint8 // 0=legacy, 1=EIP-2930, 2=EIP-1559, 3=EIP-4844
-	BaseFeePerGas        *big.Int
-	MaxFeePerGas         *big.Int
-	MaxPriorityFeePerGas *big.Int
-	IsError              bool
-	BlobHashes           []string // EIP-4844 blob hashes
-	BlobBaseFeePerGas    *big.Int // EIP-4844 blob base fee
-	BlobGasUsed          uint64   // EIP-4844 blob gas used
+	BlockNumber              uint64
+	Timestamp                uint64
+	TxHash                   string
+	From                     string
+	To                       string
+	ToCreate                 string // Contract creation address
+	Value                    *big.Int
+	GasLimit                 uint64
+	GasPrice                 *big.Int // For legacy/EIP-2930 transactions
+	GasUsed                  uint64
+	EIP2718Type              uint8 // 0=legacy, 1=EIP-2930, 2=EIP-1559, 3=EIP-4844
+	BaseFeePerGas            *big.Int
+	MaxFeePerGas             *big.Int
+	MaxPriorityFeePerGas     *big.Int
+	IsError                  bool
+	BlobHashes               []string // EIP-4844 blob hashes
+	BlobBaseFeePerGas        *big.Int // EIP-4844 blob base fee
+	BlobGasUsed              uint64   // EIP-4844 blob gas used
+	MaxFeePerBlobGas         *big.Int // EIP-4844 blob fee cap (nil if not in the dataset)
+	MaxPriorityFeePerBlobGas *big.Int // EIP-4844 blob tip cap (nil if not in the dataset)
 }
 
 // ComputeProposerFee returns the proposer (block builder) revenue in wei.
@@ -60,25 +62,20 @@ func ComputeProposerFee(r TxRow) *big.Int {
 			return zero
 		}
 		
-		// effectiveGasPrice = min(maxFeePerGas, baseFeePerGas + maxPriorityFeePerGas)
-		sum := new(big.Int).Add(r.BaseFeePerGas, r.MaxPriorityFeePerGas)
-		effective := new(big.Int).Set(r.MaxFeePerGas)
-		if sum.Cmp(effective) < 0 {
-			effective = sum
-		}
-		
-		// tip = max(effectiveGasPrice - baseFeePerGas, 0)
-		tip := new(big.Int).Sub(effective, r.BaseFeePerGas)
-		if tip.Sign() < 0 {
-			tip = zero
-		}
+		tip := effectiveTip(r.BaseFeePerGas, r.MaxFeePerGas, r.MaxPriorityFeePerGas)
 		
 		// proposerFee = gasUsed * tip (for regular execution gas)
-		// NOTE: For type 3 (blob txs), blob gas fees are separate:
-		// - Blob base fee is burned (like regular base fee)
-		// - Blob tip would require maxFeePerBlobGas / maxPriorityFeePerBlobGas fields
-		// - Since we don't have those fields in the dataset, we only count execution gas tip
-		return new(big.Int).Mul(gu, tip)
+		fee := new(big.Int).Mul(gu, tip)
+
+		// For type 3 (blob txs) the blob base fee is burned like the regular base fee; the
+		// proposer additionally earns blobGasUsed * blobTip when the dataset carries the blob
+		// fee caps (otherwise only the execution gas tip is counted)
+		if r.EIP2718Type == 3 && r.BlobGasUsed > 0 && r.BlobBaseFeePerGas != nil &&
+			r.MaxFeePerBlobGas != nil && r.MaxPriorityFeePerBlobGas != nil {
+			blobTip := effectiveTip(r.BlobBaseFeePerGas, r.MaxFeePerBlobGas, r.MaxPriorityFeePerBlobGas)
+			fee.Add(fee, new(big.Int).Mul(new(big.Int).SetUint64(r.BlobGasUsed), blobTip))
+		}
+		return fee
 		
 	default:
 		// Future transaction types: return zero to be conservative
@@ -86,6 +83,41 @@ func ComputeProposerFee(r TxRow) *big.Int {
 	}
 }
 
+// effectiveTip returns the per-gas tip paid to the proposer:
+// max(min(maxFee, baseFee + maxPriorityFee) - baseFee, 0)
+func effectiveTip(baseFee, maxFee, maxPriorityFee *big.Int) *big.Int {
+	// effectiveGasPrice = min(maxFeePerGas, baseFeePerGas + maxPriorityFeePerGas)
+	effective := new(big.Int).Add(baseFee, maxPriorityFee)
+	if maxFee.Cmp(effective) < 0 {
+		effective.Set(maxFee)
+	}
+
+	// tip = max(effectiveGasPrice - baseFeePerGas, 0)
+	tip := effective.Sub(effective, baseFee)
+	if tip.Sign() < 0 {
+		return tip.SetInt64(0)
+	}
+	return tip
+}
+
+// ComputeProposerFeeWithFloor returns the proposer fee like ComputeProposerFee, but models
+// proposers that enforce a minimum priority fee: if the tip per gas paid to the proposer
+// (effective tip for EIP-1559/4844, gasPrice for legacy) is below minTipPerGas, the tx would
+// not be included and zero is returned. A nil or non-positive floor disables the check.
+func ComputeProposerFeeWithFloor(r TxRow, minTipPerGas *big.Int) *big.Int {
+	fee := ComputeProposerFee(r)
+	if minTipPerGas == nil || minTipPerGas.Sign() <= 0 || r.GasUsed == 0 {
+		return fee
+	}
+
+	// fee = gasUsed * tipPerGas, so the division is exact
+	tipPerGas := new(big.Int).Div(fee, new(big.Int).SetUint64(r.GasUsed))
+	if tipPerGas.Cmp(minTipPerGas) < 0 {
+		return big.NewInt(0)
+	}
+	return fee
+}
+
 // ToAddress returns the destination address for this transaction.
 // For contract creation, returns the ToCreate address.
 // For regular transactions, returns the To address.
@@ -139,6 +139,44 @@ func TestComputeProposerFee_EIP1559(t *testing.T) {
 	}
 }
 
+// TestComputeProposerFeeWithFloor tests tip floor enforcement for an EIP-1559 transaction
+func TestComputeProposerFeeWithFloor(t *testing.T) {
+	gwei := func(x int64) *big.Int { return big.NewInt(x * 1_000_000_000) }
+
+	// Effective tip = min(maxFee, baseFee + priorityTip) - baseFee = 2 gwei
+	row := TxRow{
+		GasUsed:              21000,
+		EIP2718Type:          2,
+		BaseFeePerGas:        gwei(30),
+		MaxFeePerGas:         gwei(100),
+		MaxPriorityFeePerGas: gwei(2),
+	}
+	normal := ComputeProposerFee(row)
+
+	tests := []struct {
+		name  string
+		floor *big.Int
+		want  *big.Int
+	}{
+		{"no floor", nil, normal},
+		{"floor below tip", gwei(1), normal},
+		{"floor at tip", gwei(2), normal},
+		{"floor above tip", gwei(3), big.NewInt(0)},
+		{"floor just above tip", new(big.Int).Add(gwei(2), big.NewInt(1)), big.NewInt(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComputeProposerFeeWithFloor(row, tt.floor); got.Cmp(tt.want) != 0 {
+				t.Errorf("ComputeProposerFeeWithFloor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// ComputeProposerFee itself is unaffected by the floor
+	if got := ComputeProposerFee(row); got.Cmp(new(big.Int).Mul(gwei(2), big.NewInt(21000))) != 0 {
+		t.Errorf("ComputeProposerFee() = %v, want 2 gwei * 21000", got)
+	}
+}
 // TestComputeProposerFee_FailedTx verifies that failed transactions still pay fees
 func TestComputeProposerFee_FailedTx(t *testing.T) {
 	row := TxRow{
@@ -165,7 +203,7 @@ func TestComputeProposerFee_BlobTx(t *testing.T) {
 		BaseFeePerGas:        big.NewInt(30_000_000_000),  // 30 gwei
 		MaxFeePerGas:         big.NewInt(100_000_000_000), // 100 gwei
 		MaxPriorityFeePerGas: big.NewInt(2_000_000_000),   // 2 gwei tip
-		// Blob gas fields (not used for execution gas tip calculation)
+		// Blob gas fields (no blob fee caps, so no blob tip can be derived)
 		BlobGasUsed:       131072,                        // 128 KB blob
 		BlobBaseFeePerGas: big.NewInt(1_000_000_000),     // 1 gwei (burned)
 	}
@@ -178,8 +216,20 @@ func TestComputeProposerFee_BlobTx(t *testing.T) {
 	if got.Cmp(want) != 0 {
 		t.Errorf("Blob tx execution gas fee: got %v, want %v", got, want)
 	}
-	
-	t.Logf("Blob tx: execution gas tip = %v wei (blob fees not included)", got)
+
+	// With the blob fee caps the blob tip is added: blobTip = min(3, 1+1) - 1 = 1 gwei
+	row.MaxFeePerBlobGas = big.NewInt(3_000_000_000)
+	row.MaxPriorityFeePerBlobGas = big.NewInt(1_000_000_000)
+	want = new(big.Int).Add(want, big.NewInt(131072*1_000_000_000))
+	if got := ComputeProposerFee(row); got.Cmp(want) != 0 {
+		t.Errorf("Blob tx with blob tip: got %v, want %v", got, want)
+	}
+
+	// A blob fee cap below the blob base fee pays no blob tip
+	row.MaxFeePerBlobGas = big.NewInt(500_000_000)
+	if got := ComputeProposerFee(row); got.Cmp(big.NewInt(42_000_000_000_000)) != 0 {
+		t.Errorf("Blob tx with capped blob fee: got %v, want execution tip only", got)
+	}
 }
 
 // TestMapShard tests deterministic shard mapping
@@ -295,6 +345,43 @@ func TestToAddress(t *testing.T) {
 	}
 }
 
+// TestContractCreationRow tests fee and destination extraction for a contract-creation row
+// and that a self-transfer stays intra-shard
+func TestContractCreationRow(t *testing.T) {
+	gwei := func(x int64) *big.Int { return big.NewInt(x * 1_000_000_000) }
+	from := "0x1234567890abcdef1234567890abcdef12345678"
+	created := "0xc0ffee0000000000000000000000000000000001"
+
+	row := TxRow{
+		From:                 from,
+		To:                   "",
+		ToCreate:             created,
+		GasUsed:              1_500_000,
+		EIP2718Type:          2,
+		BaseFeePerGas:        gwei(20),
+		MaxFeePerGas:         gwei(30),
+		MaxPriorityFeePerGas: gwei(3),
+	}
+	if got := ToAddress(row); got != created {
+		t.Errorf("ToAddress() = %v, want created address %v", got, created)
+	}
+	if got, want := ComputeProposerFee(row), new(big.Int).Mul(big.NewInt(1_500_000), gwei(3)); got.Cmp(want) != 0 {
+		t.Errorf("ComputeProposerFee() = %v, want %v", got, want)
+	}
+	if got, want := IsCrossShard(from, ToAddress(row), 4), MapShard(from, 4) != MapShard(created, 4); got != want {
+		t.Errorf("IsCrossShard() = %v, want %v", got, want)
+	}
+
+	// Self-transfer: destination is the sender, so always an ITX
+	self := TxRow{From: from, To: from, GasUsed: 21000, GasPrice: gwei(10)}
+	if IsCrossShard(self.From, ToAddress(self), 4) {
+		t.Error("self-transfer should not be cross-shard")
+	}
+	if got := ComputeProposerFee(self); got.Cmp(new(big.Int).Mul(big.NewInt(21000), gwei(10))) != 0 {
+		t.Errorf("self-transfer fee = %v", got)
+	}
+}
+
 // BenchmarkComputeProposerFee_Legacy benchmarks legacy fee calculation
 func BenchmarkComputeProposerFee_Legacy(b *testing.B) {
 	row := TxRow{
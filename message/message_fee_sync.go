@@ -1,6 +1,10 @@
 package message
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"math/big"
 	"time"
 )
@@ -10,6 +14,14 @@ const (
 	CFeeInfoSync MessageType = "FeeInfoSync"
 )
 
+// Errors returned by FeeInfoSync.Validate
+var (
+	ErrFeeSyncNonPositive = errors.New("fee sync: average ITX fee must be positive")
+	ErrFeeSyncTooLarge    = errors.New("fee sync: average ITX fee exceeds ceiling")
+	ErrFeeSyncNoChecksum  = errors.New("fee sync: checksum required but missing")
+	ErrFeeSyncBadChecksum = errors.New("fee sync: checksum mismatch")
+)
+
 // FeeInfoSync is sent by each shard to broadcast its average ITX fee E(f_s)
 // This enables cross-shard subsidy calculation in multi-process architecture
 type FeeInfoSync struct {
@@ -17,6 +29,8 @@ type FeeInfoSync struct {
 	AvgITXFee   *big.Int  // E(f_s): Average ITX fee for this shard
 	BlockHeight uint64    // Current block height when this info was generated
 	Timestamp   time.Time // When this info was generated
+	QueueLength int64     // Tx queue length of the shard at BlockHeight (-1 = not reported)
+	Checksum    []byte    `json:",omitempty"` // Optional HMAC-SHA256 (or plain SHA-256 without a key) over the fields above
 }
 
 // NewFeeInfoSync creates a new fee info sync message
@@ -26,5 +40,49 @@ func NewFeeInfoSync(shardID uint64, avgFee *big.Int, blockHeight uint64) *FeeInf
 		AvgITXFee:   new(big.Int).Set(avgFee), // Make a copy to avoid concurrent modification
 		BlockHeight: blockHeight,
 		Timestamp:   time.Now(),
+		QueueLength: -1,
+	}
+}
+
+// computeChecksum hashes the message fields, keyed with HMAC when a key is given
+func (m *FeeInfoSync) computeChecksum(key []byte) []byte {
+	fee := "<nil>"
+	if m.AvgITXFee != nil {
+		fee = m.AvgITXFee.String()
+	}
+	payload := fmt.Sprintf("%d|%s|%d|%d|%d", m.ShardID, fee, m.BlockHeight, m.Timestamp.UnixNano(), m.QueueLength)
+	if len(key) == 0 {
+		sum := sha256.Sum256([]byte(payload))
+		return sum[:]
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Sign sets the checksum; an empty key produces an unkeyed SHA-256 integrity checksum
+func (m *FeeInfoSync) Sign(key []byte) {
+	m.Checksum = m.computeChecksum(key)
+}
+
+// Validate sanity-checks a received message. The average fee must be positive and, when
+// maxAvgFee is positive, no larger than it. With a non-empty key the checksum is mandatory;
+// without one a present checksum is still verified as plain SHA-256
+func (m *FeeInfoSync) Validate(maxAvgFee *big.Int, key []byte) error {
+	if m.AvgITXFee == nil || m.AvgITXFee.Sign() <= 0 {
+		return ErrFeeSyncNonPositive
+	}
+	if maxAvgFee != nil && maxAvgFee.Sign() > 0 && m.AvgITXFee.Cmp(maxAvgFee) > 0 {
+		return ErrFeeSyncTooLarge
+	}
+	if len(m.Checksum) == 0 {
+		if len(key) > 0 {
+			return ErrFeeSyncNoChecksum
+		}
+		return nil
+	}
+	if !hmac.Equal(m.Checksum, m.computeChecksum(key)) {
+		return ErrFeeSyncBadChecksum
 	}
+	return nil
 }
@@ -0,0 +1,81 @@
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// roundTrip serializes and deserializes a fee sync message as the network layer does
+func roundTrip(t *testing.T, m *FeeInfoSync) *FeeInfoSync {
+	t.Helper()
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	out := new(FeeInfoSync)
+	if err := json.Unmarshal(b, out); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	return out
+}
+
+// TestFeeInfoSync_ValidAccepted tests that a signed, in-bounds message survives transport and validates
+func TestFeeInfoSync_ValidAccepted(t *testing.T) {
+	key := []byte("shared-secret")
+	ceiling := big.NewInt(1e18)
+
+	signed := NewFeeInfoSync(1, big.NewInt(5000), 42)
+	signed.Sign(key)
+	if err := roundTrip(t, signed).Validate(ceiling, key); err != nil {
+		t.Errorf("Signed message rejected: %v", err)
+	}
+
+	// Without a key, an unsigned message passes the bounds check alone
+	unsigned := NewFeeInfoSync(1, big.NewInt(5000), 42)
+	if err := roundTrip(t, unsigned).Validate(ceiling, nil); err != nil {
+		t.Errorf("Unsigned message rejected without a key: %v", err)
+	}
+}
+
+// TestFeeInfoSync_Rejected tests out-of-bounds averages and missing or bad checksums
+func TestFeeInfoSync_Rejected(t *testing.T) {
+	key := []byte("shared-secret")
+	ceiling := big.NewInt(1e18)
+
+	tampered := NewFeeInfoSync(1, big.NewInt(5000), 42)
+	tampered.Sign(key)
+	tampered = roundTrip(t, tampered)
+	tampered.AvgITXFee = big.NewInt(6000)
+
+	tamperedQueue := NewFeeInfoSync(1, big.NewInt(5000), 42)
+	tamperedQueue.QueueLength = 300
+	tamperedQueue.Sign(key)
+	tamperedQueue = roundTrip(t, tamperedQueue)
+	tamperedQueue.QueueLength = 3000
+
+	wrongKey := NewFeeInfoSync(1, big.NewInt(5000), 42)
+	wrongKey.Sign([]byte("other-secret"))
+
+	tests := []struct {
+		name string
+		msg  *FeeInfoSync
+		key  []byte
+		want error
+	}{
+		{"zero fee", NewFeeInfoSync(1, big.NewInt(0), 42), nil, ErrFeeSyncNonPositive},
+		{"negative fee", NewFeeInfoSync(1, big.NewInt(-1), 42), nil, ErrFeeSyncNonPositive},
+		{"nil fee", &FeeInfoSync{ShardID: 1}, nil, ErrFeeSyncNonPositive},
+		{"above ceiling", NewFeeInfoSync(1, new(big.Int).Add(ceiling, big.NewInt(1)), 42), nil, ErrFeeSyncTooLarge},
+		{"missing checksum", NewFeeInfoSync(1, big.NewInt(5000), 42), key, ErrFeeSyncNoChecksum},
+		{"tampered fee", tampered, key, ErrFeeSyncBadChecksum},
+		{"tampered queue length", tamperedQueue, key, ErrFeeSyncBadChecksum},
+		{"wrong key", wrongKey, key, ErrFeeSyncBadChecksum},
+	}
+	for _, tt := range tests {
+		if err := tt.msg.Validate(ceiling, tt.key); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
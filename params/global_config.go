@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/big"
 	"os"
 )
 
@@ -45,11 +46,36 @@ var (
 
 	// Justitia incentive mechanism parameters
 	EnableJustitia       = 0            // Enable Justitia incentive mechanism (1: enabled, 0: disabled)
-	JustitiaSubsidyMode  = 1            // Subsidy mode: 0=None, 1=DestAvg, 2=SumAvg, 3=Custom, 4=ExtremeFixed, 5=PID, 6=Lagrangian, 7=RL
+	JustitiaSubsidyMode  = 1            // Subsidy mode: 0=None, 1=DestAvg, 2=SumAvg, 3=Custom, 4=ExtremeFixed, 5=PID, 6=Lagrangian, 7=RL, 8=EWMADestAvg, 9=Cap
 	JustitiaWindowBlocks = 16           // Number of blocks for rolling average E(f_s)
 	JustitiaGammaMin     = uint64(0)    // Minimum subsidy budget per block (0=no limit)
 	JustitiaGammaMax     = uint64(0)    // Maximum subsidy budget per block (0=no limit)
 	JustitiaRewardBase   = 100.0        // Legacy: Base reward R (deprecated, use mode instead)
+	JustitiaSubsidyPreview = 0          // Annotate injected CTX with a predicted subsidy and case (1: enabled, 0: disabled)
+	JustitiaBaseBlockReward = uint64(0) // Fixed per-block proposer reward in wei (0=fees and subsidies only)
+	JustitiaWarmupEpochs = 0            // Leading epochs excluded from aggregate Justitia metrics while E(f_s) stabilizes
+	JustitiaFairnessThreshold = 0       // Blocks a CTX may be skipped before forced inclusion (0=disabled)
+	JustitiaFairnessMaxForced = 0.25    // Maximum fraction of block space for forced CTX (0 = no forced CTX)
+	JustitiaUseGasWeighted = 0          // E(f_s) weighting: 0=per transaction, 1=by gas used
+	JustitiaEqualFeesSkipCase2 = 0      // When EA == EB, classify CTX below EA as Case3 instead of Case2 (1: enabled)
+	JustitiaFeeSyncMaxAvgFee = uint64(1000000000000000000) // Reject FeeInfoSync averages above this many wei (0=no ceiling)
+	JustitiaFeeSyncKey = ""             // Shared HMAC key for FeeInfoSync checksums (empty=checksum optional)
+	JustitiaTelemetryBufferSize = 0     // Recent subsidy samples kept by the Mechanism for plotting (0=disabled)
+	JustitiaDeadlineHorizonMs = 0       // Txs within this many ms of their Deadline move up one selection phase (0=disabled)
+	JustitiaDeadlineImminentMs = 0      // Txs within this many ms of their Deadline are force-included (0=disabled)
+	JustitiaSubsidySmoothingAlpha = 0.0 // EMA weight of the new raw subsidy per shard pair (0 or 1=no smoothing)
+	JustitiaFeeSyncIntervalMs = 0       // Minimum ms between FeeInfoSync broadcasts; updates in between are coalesced (0=every block)
+	JustitiaFeeSyncChangeThreshold = 0.0 // Relative E(f_s) change that triggers a broadcast before the interval (0=disabled)
+	JustitiaRemoteFeeMaxAgeMs = 0       // Remote E(f_s) older than this many ms reads as zero (0=never expires)
+	JustitiaRemoteQueueMaxAgeMs = 5000  // Remote queue lengths older than this many ms read as unknown (0=never expire)
+	JustitiaRelayFIFO = 0               // Relay pool packing order: 0=highest UtilityB first, 1=FIFO (as without Justitia)
+	JustitiaPhase1Policy = 0            // Phase-1 CTX sort key: 0=utility, 1=utility minus subsidy share, 2=utility*JustitiaCTXUtilityWeight
+	JustitiaCTXUtilityWeight = 1.0      // CTX utility weight for JustitiaPhase1Policy=2
+	JustitiaFeeReferenceMode = 0        // Fee reference for subsidy EA/EB: 0=mean, 1=median, 2=P75, 3=P90
+	JustitiaEBSmoothingAlpha = 0.2      // Weight of the newest EB in the per-pair moving average of mode 8 (1=no smoothing)
+	JustitiaMinUserFeeForSubsidy = uint64(0) // CTX paying a fee below this many wei get no subsidy (0=no floor)
+	JustitiaMaxSubsidyPerTx = uint64(0)      // Per-tx subsidy ceiling in wei for mode 9 (0=unlimited)
+	JustitiaSchedulerDebug = 0          // Print the scheduler's per-selection and per-CTX debug output to stdout (1: enabled)
 	
 	// PID Controller parameters (mode=5)
 	JustitiaPID_Kp                = 1.5    // PID proportional gain
@@ -59,6 +85,12 @@ var (
 	JustitiaPID_CapacityB         = 1000.0 // Queue capacity for destination shard
 	JustitiaPID_MinSubsidy        = 0.0    // Minimum subsidy multiplier
 	JustitiaPID_MaxSubsidy        = 5.0    // Maximum subsidy multiplier
+	JustitiaPID_MaxSubsidyWei     = uint64(0) // Absolute PID subsidy ceiling in wei (0=no ceiling)
+	JustitiaPID_MaxIntegral       = 10.0   // Anti-windup bound on the PID integral term
+
+	// Dynamic mode activation (mode=5,6,7)
+	JustitiaMinQueueForSubsidy = int64(0) // Minimum destination queue length before PID/Lagrangian scale subsidies (0=always)
+	JustitiaZeroBelowMinQueue  = 0        // Below the minimum queue: 0=pay DestAvg subsidy EB, 1=pay nothing
 	
 	// Lagrangian Optimization parameters (mode=6)
 	JustitiaLag_Alpha         = 0.01   // Learning rate for shadow price update
@@ -67,6 +99,25 @@ var (
 	JustitiaLag_MaxLambda     = 10.0   // Maximum shadow price
 	JustitiaLag_CongestionExp = 2.0    // Exponent for congestion factor (2.0=quadratic)
 	JustitiaLag_MaxInflation  = uint64(5000000000000000000) // Maximum inflation per epoch (5 ETH in wei)
+	JustitiaLag_EpochBlocks   = uint64(10)                  // Number of blocks per Lagrangian or RL epoch (0 = no block-driven epochs)
+	JustitiaLag_ReliefWeight  = 1.0                         // Extra lambda step when subsidy spending fails to relieve congestion
+
+	// RL policy parameters (mode=7)
+	JustitiaRL_Buckets       = 5      // Destination queue utilization buckets
+	JustitiaRL_Actions       = 5      // Candidate multipliers, evenly spaced over [MinMultiplier, MaxMultiplier]
+	JustitiaRL_MinMultiplier = 0.0    // Smallest subsidy multiplier of EB
+	JustitiaRL_MaxMultiplier = 2.0    // Largest subsidy multiplier of EB
+	JustitiaRL_LearningRate  = 0.1    // Value update step size (0-1)
+	JustitiaRL_Epsilon       = 0.1    // Exploration probability
+	JustitiaRL_CapacityB     = 1000.0 // Queue size counted as full utilization
+	JustitiaRL_Seed          = int64(1) // Exploration RNG seed
+	JustitiaRL_CostWeight    = 0.1    // Reward penalty per unit of subsidy multiplier paid
+
+	// Arbitrary-precision overrides of the uint64 amounts above (nil = use the uint64 value)
+	// Set from the "...Wei" string fields of paramsConfig.json for caps beyond 2^64 wei (~18 ETH)
+	JustitiaGammaMinWei         *big.Int
+	JustitiaGammaMaxWei         *big.Int
+	JustitiaLag_MaxInflationWei *big.Int
 )
 
 // network layer
@@ -109,6 +160,31 @@ type globalConfig struct {
 	JustitiaGammaMin     uint64  `json:"JustitiaGammaMin"`
 	JustitiaGammaMax     uint64  `json:"JustitiaGammaMax"`
 	JustitiaRewardBase   float64 `json:"JustitiaRewardBase"`
+	JustitiaSubsidyPreview int   `json:"JustitiaSubsidyPreview"`
+	JustitiaBaseBlockReward uint64 `json:"JustitiaBaseBlockReward"`
+	JustitiaWarmupEpochs int       `json:"JustitiaWarmupEpochs"`
+	JustitiaFairnessThreshold int  `json:"JustitiaFairnessThreshold"`
+	JustitiaFairnessMaxForced *float64 `json:"JustitiaFairnessMaxForced"` // nil = absent, keeping the default; 0 disables forcing
+	JustitiaUseGasWeighted int     `json:"JustitiaUseGasWeighted"`
+	JustitiaEqualFeesSkipCase2 int `json:"JustitiaEqualFeesSkipCase2"`
+	JustitiaFeeSyncMaxAvgFee uint64 `json:"JustitiaFeeSyncMaxAvgFee"`
+	JustitiaFeeSyncKey string     `json:"JustitiaFeeSyncKey"`
+	JustitiaTelemetryBufferSize int `json:"JustitiaTelemetryBufferSize"`
+	JustitiaDeadlineHorizonMs int   `json:"JustitiaDeadlineHorizonMs"`
+	JustitiaDeadlineImminentMs int  `json:"JustitiaDeadlineImminentMs"`
+	JustitiaSubsidySmoothingAlpha float64 `json:"JustitiaSubsidySmoothingAlpha"`
+	JustitiaFeeSyncIntervalMs int   `json:"JustitiaFeeSyncIntervalMs"`
+	JustitiaFeeSyncChangeThreshold float64 `json:"JustitiaFeeSyncChangeThreshold"`
+	JustitiaRemoteFeeMaxAgeMs int   `json:"JustitiaRemoteFeeMaxAgeMs"`
+	JustitiaRemoteQueueMaxAgeMs int `json:"JustitiaRemoteQueueMaxAgeMs"`
+	JustitiaRelayFIFO int           `json:"JustitiaRelayFIFO"`
+	JustitiaPhase1Policy int        `json:"JustitiaPhase1Policy"`
+	JustitiaCTXUtilityWeight float64 `json:"JustitiaCTXUtilityWeight"`
+	JustitiaFeeReferenceMode int    `json:"JustitiaFeeReferenceMode"`
+	JustitiaEBSmoothingAlpha float64 `json:"JustitiaEBSmoothingAlpha"`
+	JustitiaMinUserFeeForSubsidy uint64 `json:"JustitiaMinUserFeeForSubsidy"`
+	JustitiaMaxSubsidyPerTx uint64  `json:"JustitiaMaxSubsidyPerTx"`
+	JustitiaSchedulerDebug int      `json:"JustitiaSchedulerDebug"`
 	
 	// PID parameters
 	JustitiaPID_Kp                float64 `json:"JustitiaPID_Kp"`
@@ -118,6 +194,12 @@ type globalConfig struct {
 	JustitiaPID_CapacityB         float64 `json:"JustitiaPID_CapacityB"`
 	JustitiaPID_MinSubsidy        float64 `json:"JustitiaPID_MinSubsidy"`
 	JustitiaPID_MaxSubsidy        float64 `json:"JustitiaPID_MaxSubsidy"`
+	JustitiaPID_MaxSubsidyWei     uint64  `json:"JustitiaPID_MaxSubsidyWei"`
+	JustitiaPID_MaxIntegral       float64 `json:"JustitiaPID_MaxIntegral"`
+
+	// Dynamic mode activation
+	JustitiaMinQueueForSubsidy int64 `json:"JustitiaMinQueueForSubsidy"`
+	JustitiaZeroBelowMinQueue  int   `json:"JustitiaZeroBelowMinQueue"`
 	
 	// Lagrangian parameters
 	JustitiaLag_Alpha         float64 `json:"JustitiaLag_Alpha"`
@@ -126,6 +208,39 @@ type globalConfig struct {
 	JustitiaLag_MaxLambda     float64 `json:"JustitiaLag_MaxLambda"`
 	JustitiaLag_CongestionExp float64 `json:"JustitiaLag_CongestionExp"`
 	JustitiaLag_MaxInflation  uint64  `json:"JustitiaLag_MaxInflation"`
+	JustitiaLag_EpochBlocks   *uint64 `json:"JustitiaLag_EpochBlocks"` // nil = absent, keeping the default; 0 disables epochs
+	JustitiaLag_ReliefWeight  float64 `json:"JustitiaLag_ReliefWeight"`
+
+	// RL parameters
+	JustitiaRL_Buckets       int     `json:"JustitiaRL_Buckets"`
+	JustitiaRL_Actions       int     `json:"JustitiaRL_Actions"`
+	JustitiaRL_MinMultiplier float64 `json:"JustitiaRL_MinMultiplier"`
+	JustitiaRL_MaxMultiplier float64 `json:"JustitiaRL_MaxMultiplier"`
+	JustitiaRL_LearningRate  float64 `json:"JustitiaRL_LearningRate"`
+	JustitiaRL_Epsilon       float64 `json:"JustitiaRL_Epsilon"`
+	JustitiaRL_CapacityB     float64 `json:"JustitiaRL_CapacityB"`
+	JustitiaRL_Seed          int64   `json:"JustitiaRL_Seed"`
+	JustitiaRL_CostWeight    float64 `json:"JustitiaRL_CostWeight"`
+
+	// Decimal wei strings, preferred over the uint64 fields when non-empty
+	JustitiaGammaMinWei         string `json:"JustitiaGammaMinWei"`
+	JustitiaGammaMaxWei         string `json:"JustitiaGammaMaxWei"`
+	JustitiaLag_MaxInflationWei string `json:"JustitiaLag_MaxInflationWei"`
+}
+
+// parseWeiString parses a non-negative decimal wei amount; an empty string yields nil (no override)
+func parseWeiString(field, value string) (*big.Int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	wei, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid wei amount %q", field, value)
+	}
+	if wei.Sign() < 0 {
+		return nil, fmt.Errorf("%s: negative wei amount %q", field, value)
+	}
+	return wei, nil
 }
 
 func ReadConfigFile() {
@@ -143,6 +258,13 @@ func ReadConfigFile() {
 	// output configurations
 	fmt.Printf("Config: %+v\n", config)
 
+	if err := applyGlobalConfig(&config); err != nil {
+		log.Fatalf("Error applying config: %v", err)
+	}
+}
+
+// applyGlobalConfig sets the global params from a parsed configuration
+func applyGlobalConfig(config *globalConfig) error {
 	// set configurations to params
 	// consensus params
 	ConsensusMethod = config.ConsensusMethod
@@ -183,6 +305,41 @@ func ReadConfigFile() {
 	JustitiaGammaMin = config.JustitiaGammaMin
 	JustitiaGammaMax = config.JustitiaGammaMax
 	JustitiaRewardBase = config.JustitiaRewardBase
+	JustitiaSubsidyPreview = config.JustitiaSubsidyPreview
+	JustitiaBaseBlockReward = config.JustitiaBaseBlockReward
+	JustitiaWarmupEpochs = config.JustitiaWarmupEpochs
+	JustitiaFairnessThreshold = config.JustitiaFairnessThreshold
+	JustitiaUseGasWeighted = config.JustitiaUseGasWeighted
+	JustitiaEqualFeesSkipCase2 = config.JustitiaEqualFeesSkipCase2
+	if config.JustitiaFairnessMaxForced != nil {
+		JustitiaFairnessMaxForced = *config.JustitiaFairnessMaxForced
+	}
+	if config.JustitiaFeeSyncMaxAvgFee > 0 {
+		JustitiaFeeSyncMaxAvgFee = config.JustitiaFeeSyncMaxAvgFee
+	}
+	JustitiaFeeSyncKey = config.JustitiaFeeSyncKey
+	JustitiaTelemetryBufferSize = config.JustitiaTelemetryBufferSize
+	JustitiaDeadlineHorizonMs = config.JustitiaDeadlineHorizonMs
+	JustitiaDeadlineImminentMs = config.JustitiaDeadlineImminentMs
+	JustitiaSubsidySmoothingAlpha = config.JustitiaSubsidySmoothingAlpha
+	JustitiaFeeSyncIntervalMs = config.JustitiaFeeSyncIntervalMs
+	JustitiaFeeSyncChangeThreshold = config.JustitiaFeeSyncChangeThreshold
+	JustitiaRemoteFeeMaxAgeMs = config.JustitiaRemoteFeeMaxAgeMs
+	if config.JustitiaRemoteQueueMaxAgeMs > 0 {
+		JustitiaRemoteQueueMaxAgeMs = config.JustitiaRemoteQueueMaxAgeMs
+	}
+	JustitiaRelayFIFO = config.JustitiaRelayFIFO
+	JustitiaPhase1Policy = config.JustitiaPhase1Policy
+	if config.JustitiaCTXUtilityWeight > 0 {
+		JustitiaCTXUtilityWeight = config.JustitiaCTXUtilityWeight
+	}
+	JustitiaFeeReferenceMode = config.JustitiaFeeReferenceMode
+	if config.JustitiaEBSmoothingAlpha > 0 {
+		JustitiaEBSmoothingAlpha = config.JustitiaEBSmoothingAlpha
+	}
+	JustitiaMinUserFeeForSubsidy = config.JustitiaMinUserFeeForSubsidy
+	JustitiaMaxSubsidyPerTx = config.JustitiaMaxSubsidyPerTx
+	JustitiaSchedulerDebug = config.JustitiaSchedulerDebug
 	
 	// PID params
 	JustitiaPID_Kp = config.JustitiaPID_Kp
@@ -192,6 +349,14 @@ func ReadConfigFile() {
 	JustitiaPID_CapacityB = config.JustitiaPID_CapacityB
 	JustitiaPID_MinSubsidy = config.JustitiaPID_MinSubsidy
 	JustitiaPID_MaxSubsidy = config.JustitiaPID_MaxSubsidy
+	JustitiaPID_MaxSubsidyWei = config.JustitiaPID_MaxSubsidyWei
+	if config.JustitiaPID_MaxIntegral > 0 {
+		JustitiaPID_MaxIntegral = config.JustitiaPID_MaxIntegral
+	}
+
+	// Dynamic mode activation
+	JustitiaMinQueueForSubsidy = config.JustitiaMinQueueForSubsidy
+	JustitiaZeroBelowMinQueue = config.JustitiaZeroBelowMinQueue
 	
 	// Lagrangian params
 	JustitiaLag_Alpha = config.JustitiaLag_Alpha
@@ -200,4 +365,48 @@ func ReadConfigFile() {
 	JustitiaLag_MaxLambda = config.JustitiaLag_MaxLambda
 	JustitiaLag_CongestionExp = config.JustitiaLag_CongestionExp
 	JustitiaLag_MaxInflation = config.JustitiaLag_MaxInflation
+	JustitiaLag_ReliefWeight = config.JustitiaLag_ReliefWeight
+	if config.JustitiaLag_EpochBlocks != nil {
+		JustitiaLag_EpochBlocks = *config.JustitiaLag_EpochBlocks
+	}
+
+	// RL params (keep the defaults when absent from the config file)
+	if config.JustitiaRL_Buckets > 0 {
+		JustitiaRL_Buckets = config.JustitiaRL_Buckets
+	}
+	if config.JustitiaRL_Actions > 0 {
+		JustitiaRL_Actions = config.JustitiaRL_Actions
+	}
+	if config.JustitiaRL_MaxMultiplier > 0 {
+		JustitiaRL_MinMultiplier = config.JustitiaRL_MinMultiplier
+		JustitiaRL_MaxMultiplier = config.JustitiaRL_MaxMultiplier
+	}
+	if config.JustitiaRL_LearningRate > 0 {
+		JustitiaRL_LearningRate = config.JustitiaRL_LearningRate
+	}
+	if config.JustitiaRL_Epsilon > 0 {
+		JustitiaRL_Epsilon = config.JustitiaRL_Epsilon
+	}
+	if config.JustitiaRL_CapacityB > 0 {
+		JustitiaRL_CapacityB = config.JustitiaRL_CapacityB
+	}
+	if config.JustitiaRL_Seed != 0 {
+		JustitiaRL_Seed = config.JustitiaRL_Seed
+	}
+	if config.JustitiaRL_CostWeight > 0 {
+		JustitiaRL_CostWeight = config.JustitiaRL_CostWeight
+	}
+
+	// big.Int overrides
+	var err error
+	if JustitiaGammaMinWei, err = parseWeiString("JustitiaGammaMinWei", config.JustitiaGammaMinWei); err != nil {
+		return err
+	}
+	if JustitiaGammaMaxWei, err = parseWeiString("JustitiaGammaMaxWei", config.JustitiaGammaMaxWei); err != nil {
+		return err
+	}
+	if JustitiaLag_MaxInflationWei, err = parseWeiString("JustitiaLag_MaxInflationWei", config.JustitiaLag_MaxInflationWei); err != nil {
+		return err
+	}
+	return nil
 }
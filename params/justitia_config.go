@@ -11,8 +11,8 @@ func GetJustitiaConfig() *justitia.Config {
 		Mode:         justitia.SubsidyMode(JustitiaSubsidyMode),
 		WindowBlocks: JustitiaWindowBlocks,
 		CustomF:      nil,
-		GammaMin:     big.NewInt(int64(JustitiaGammaMin)),
-		GammaMax:     big.NewInt(int64(JustitiaGammaMax)),
+		GammaMin:     weiOrUint64(JustitiaGammaMinWei, JustitiaGammaMin),
+		GammaMax:     weiOrUint64(JustitiaGammaMaxWei, JustitiaGammaMax),
 		
 		// PID parameters
 		PIDParams: justitia.PIDParams{
@@ -23,6 +23,8 @@ func GetJustitiaConfig() *justitia.Config {
 			CapacityB:         JustitiaPID_CapacityB,
 			MinSubsidy:        JustitiaPID_MinSubsidy,
 			MaxSubsidy:        JustitiaPID_MaxSubsidy,
+			MaxSubsidyWei:     new(big.Int).SetUint64(JustitiaPID_MaxSubsidyWei),
+			MaxIntegral:       JustitiaPID_MaxIntegral,
 		},
 		
 		// Lagrangian parameters
@@ -32,15 +34,52 @@ func GetJustitiaConfig() *justitia.Config {
 			MinLambda:     JustitiaLag_MinLambda,
 			MaxLambda:     JustitiaLag_MaxLambda,
 			CongestionExp: JustitiaLag_CongestionExp,
+			ReliefWeight:  JustitiaLag_ReliefWeight,
 		},
-		MaxInflation: new(big.Int).SetUint64(JustitiaLag_MaxInflation),
+
+		// RL parameters
+		RLParams: justitia.RLParams{
+			Buckets:       JustitiaRL_Buckets,
+			Actions:       JustitiaRL_Actions,
+			MinMultiplier: JustitiaRL_MinMultiplier,
+			MaxMultiplier: JustitiaRL_MaxMultiplier,
+			LearningRate:  JustitiaRL_LearningRate,
+			Epsilon:       JustitiaRL_Epsilon,
+			CapacityB:     JustitiaRL_CapacityB,
+			Seed:          JustitiaRL_Seed,
+			CostWeight:    JustitiaRL_CostWeight,
+		},
+
+		MaxInflation: weiOrUint64(JustitiaLag_MaxInflationWei, JustitiaLag_MaxInflation),
+		EpochBlocks:  JustitiaLag_EpochBlocks,
+
+		BaseBlockReward: new(big.Int).SetUint64(JustitiaBaseBlockReward),
 		
 		TargetQueueLen: 100, // Legacy parameter
+
+		MinQueueForSubsidy: JustitiaMinQueueForSubsidy,
+		ZeroBelowMinQueue:  JustitiaZeroBelowMinQueue == 1,
+
+		UseGasWeightedExpectation: JustitiaUseGasWeighted == 1,
+		EqualFeesSkipCase2:        JustitiaEqualFeesSkipCase2 == 1,
+		TelemetryBufferSize:       JustitiaTelemetryBufferSize,
+		FeeReferenceMode:          JustitiaFeeReferenceMode,
+		EBSmoothingAlpha:          JustitiaEBSmoothingAlpha,
+		MinUserFeeForSubsidy:      new(big.Int).SetUint64(JustitiaMinUserFeeForSubsidy),
+		MaxSubsidyPerTx:           new(big.Int).SetUint64(JustitiaMaxSubsidyPerTx),
 	}
 	
 	return config
 }
 
+// weiOrUint64 returns a copy of the big.Int override if set, otherwise the uint64 value
+func weiOrUint64(override *big.Int, value uint64) *big.Int {
+	if override != nil {
+		return new(big.Int).Set(override)
+	}
+	return new(big.Int).SetUint64(value)
+}
+
 // GetJustitiaMechanism creates a Justitia mechanism from global parameters
 func GetJustitiaMechanism() *justitia.Mechanism {
 	config := GetJustitiaConfig()
@@ -0,0 +1,188 @@
+package params
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+)
+
+// TestGetJustitiaConfig_MaxInflationWei tests that a wei string above 2^64 overrides the uint64 cap
+func TestGetJustitiaConfig_MaxInflationWei(t *testing.T) {
+	restoreGlobals(t)
+
+	data, err := os.ReadFile("../paramsConfig.json")
+	if err != nil {
+		t.Fatalf("Failed to read paramsConfig.json: %v", err)
+	}
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("Failed to parse paramsConfig.json: %v", err)
+	}
+
+	// 100 ETH, well above the uint64 limit of ~18.4 ETH
+	const capWei = "100000000000000000000"
+	raw["JustitiaLag_MaxInflationWei"] = capWei
+	raw["JustitiaGammaMaxWei"] = capWei
+	data, _ = json.Marshal(raw)
+
+	var config globalConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+	if err := applyGlobalConfig(&config); err != nil {
+		t.Fatalf("applyGlobalConfig failed: %v", err)
+	}
+
+	want, _ := new(big.Int).SetString(capWei, 10)
+	cfg := GetJustitiaConfig()
+	if cfg.MaxInflation.Cmp(want) != 0 {
+		t.Errorf("MaxInflation = %s, want %s", cfg.MaxInflation, want)
+	}
+	if cfg.GammaMax.Cmp(want) != 0 {
+		t.Errorf("GammaMax = %s, want %s", cfg.GammaMax, want)
+	}
+	// GammaMin has no override and falls back to the uint64 field
+	if cfg.GammaMin.Cmp(new(big.Int).SetUint64(JustitiaGammaMin)) != 0 {
+		t.Errorf("GammaMin = %s, want %d", cfg.GammaMin, JustitiaGammaMin)
+	}
+
+	// The config holds a copy, so mutating it leaves the global override intact
+	cfg.MaxInflation.SetInt64(0)
+	if JustitiaLag_MaxInflationWei.Cmp(want) != 0 {
+		t.Error("GetJustitiaConfig should copy the override")
+	}
+}
+
+// TestApplyGlobalConfig_EpochBlocks tests that an explicit JustitiaLag_EpochBlocks of 0 disables
+// block-driven epochs while an absent field keeps the default
+func TestApplyGlobalConfig_EpochBlocks(t *testing.T) {
+	restoreGlobals(t)
+	def := JustitiaLag_EpochBlocks
+
+	for _, tc := range []struct {
+		json string
+		want uint64
+	}{
+		{`{}`, def},
+		{`{"JustitiaLag_EpochBlocks": 25}`, 25},
+		{`{"JustitiaLag_EpochBlocks": 0}`, 0},
+	} {
+		JustitiaLag_EpochBlocks = def
+		var config globalConfig
+		if err := json.Unmarshal([]byte(tc.json), &config); err != nil {
+			t.Fatalf("%s: unmarshal failed: %v", tc.json, err)
+		}
+		if err := applyGlobalConfig(&config); err != nil {
+			t.Fatalf("%s: applyGlobalConfig failed: %v", tc.json, err)
+		}
+		if JustitiaLag_EpochBlocks != tc.want {
+			t.Errorf("%s: EpochBlocks = %d, want %d", tc.json, JustitiaLag_EpochBlocks, tc.want)
+		}
+		if got := GetJustitiaConfig().EpochBlocks; got != tc.want {
+			t.Errorf("%s: Config.EpochBlocks = %d, want %d", tc.json, got, tc.want)
+		}
+	}
+}
+
+// TestApplyGlobalConfig_FairnessMaxForced tests that an explicit JustitiaFairnessMaxForced of 0
+// disables forced inclusion while an absent field keeps the default
+func TestApplyGlobalConfig_FairnessMaxForced(t *testing.T) {
+	restoreGlobals(t)
+	def := JustitiaFairnessMaxForced
+
+	for _, tc := range []struct {
+		json string
+		want float64
+	}{
+		{`{}`, def},
+		{`{"JustitiaFairnessMaxForced": 0.5}`, 0.5},
+		{`{"JustitiaFairnessMaxForced": 0}`, 0},
+	} {
+		JustitiaFairnessMaxForced = def
+		var config globalConfig
+		if err := json.Unmarshal([]byte(tc.json), &config); err != nil {
+			t.Fatalf("%s: unmarshal failed: %v", tc.json, err)
+		}
+		if err := applyGlobalConfig(&config); err != nil {
+			t.Fatalf("%s: applyGlobalConfig failed: %v", tc.json, err)
+		}
+		if JustitiaFairnessMaxForced != tc.want {
+			t.Errorf("%s: FairnessMaxForced = %v, want %v", tc.json, JustitiaFairnessMaxForced, tc.want)
+		}
+	}
+}
+
+// TestRestoreGlobals tests that globals changed by applyGlobalConfig are restored after the test
+func TestRestoreGlobals(t *testing.T) {
+	origDir, origWei := ExpDataRootDir, JustitiaGammaMaxWei
+	t.Run("apply", func(t *testing.T) {
+		restoreGlobals(t)
+		config := globalConfig{ExpDataRootDir: "restore-test", JustitiaGammaMaxWei: "1000"}
+		if err := applyGlobalConfig(&config); err != nil {
+			t.Fatalf("applyGlobalConfig failed: %v", err)
+		}
+	})
+	if ExpDataRootDir != origDir || DataWrite_path != origDir+"/result/" || JustitiaGammaMaxWei != origWei {
+		t.Errorf("Globals not restored: ExpDataRootDir=%q DataWrite_path=%q JustitiaGammaMaxWei=%v",
+			ExpDataRootDir, DataWrite_path, JustitiaGammaMaxWei)
+	}
+}
+
+// TestParseWeiString tests validation of wei string fields
+func TestParseWeiString(t *testing.T) {
+	if v, err := parseWeiString("f", ""); v != nil || err != nil {
+		t.Errorf("Empty string should yield no override, got %v, %v", v, err)
+	}
+	for _, bad := range []string{"5e18", "-1", "0x10", "abc"} {
+		if _, err := parseWeiString("f", bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+// restoreGlobals saves every global that applyGlobalConfig assigns and restores them when t ends
+func restoreGlobals(t *testing.T) {
+	restore := []func(){
+		keep(&ConsensusMethod), keep(&PbftViewChangeTimeOut), keep(&ExpDataRootDir),
+		keep(&DataWrite_path), keep(&LogWrite_path), keep(&DatabaseWrite_path), keep(&Block_Interval),
+		keep(&MaxBlockSize_global), keep(&BlocksizeInBytes), keep(&UseBlocksizeInBytes),
+		keep(&InjectSpeed), keep(&TotalDataSize), keep(&TxBatchSize), keep(&BrokerNum),
+		keep(&RelayWithMerkleProof), keep(&DatasetFile), keep(&ReconfigTimeGap), keep(&Delay),
+		keep(&JitterRange), keep(&Bandwidth), keep(&EnableJustitia), keep(&JustitiaSubsidyMode),
+		keep(&JustitiaWindowBlocks), keep(&JustitiaGammaMin), keep(&JustitiaGammaMax),
+		keep(&JustitiaRewardBase), keep(&JustitiaSubsidyPreview), keep(&JustitiaBaseBlockReward),
+		keep(&JustitiaWarmupEpochs), keep(&JustitiaFairnessThreshold), keep(&JustitiaUseGasWeighted),
+		keep(&JustitiaEqualFeesSkipCase2), keep(&JustitiaFairnessMaxForced),
+		keep(&JustitiaFeeSyncMaxAvgFee), keep(&JustitiaFeeSyncKey), keep(&JustitiaTelemetryBufferSize),
+		keep(&JustitiaDeadlineHorizonMs), keep(&JustitiaDeadlineImminentMs),
+		keep(&JustitiaSubsidySmoothingAlpha), keep(&JustitiaFeeSyncIntervalMs),
+		keep(&JustitiaFeeSyncChangeThreshold), keep(&JustitiaRemoteFeeMaxAgeMs),
+		keep(&JustitiaRemoteQueueMaxAgeMs), keep(&JustitiaRelayFIFO), keep(&JustitiaPhase1Policy),
+		keep(&JustitiaCTXUtilityWeight), keep(&JustitiaFeeReferenceMode),
+		keep(&JustitiaEBSmoothingAlpha), keep(&JustitiaMinUserFeeForSubsidy),
+		keep(&JustitiaMaxSubsidyPerTx), keep(&JustitiaSchedulerDebug), keep(&JustitiaPID_Kp),
+		keep(&JustitiaPID_Ki), keep(&JustitiaPID_Kd), keep(&JustitiaPID_TargetUtilization),
+		keep(&JustitiaPID_CapacityB), keep(&JustitiaPID_MinSubsidy), keep(&JustitiaPID_MaxSubsidy),
+		keep(&JustitiaPID_MaxSubsidyWei), keep(&JustitiaPID_MaxIntegral),
+		keep(&JustitiaMinQueueForSubsidy), keep(&JustitiaZeroBelowMinQueue), keep(&JustitiaLag_Alpha),
+		keep(&JustitiaLag_WindowSize), keep(&JustitiaLag_MinLambda), keep(&JustitiaLag_MaxLambda),
+		keep(&JustitiaLag_CongestionExp), keep(&JustitiaLag_MaxInflation),
+		keep(&JustitiaLag_ReliefWeight), keep(&JustitiaLag_EpochBlocks), keep(&JustitiaRL_Buckets),
+		keep(&JustitiaRL_Actions), keep(&JustitiaRL_MinMultiplier), keep(&JustitiaRL_MaxMultiplier),
+		keep(&JustitiaRL_LearningRate), keep(&JustitiaRL_Epsilon), keep(&JustitiaRL_CapacityB),
+		keep(&JustitiaRL_Seed), keep(&JustitiaRL_CostWeight), keep(&JustitiaGammaMinWei),
+		keep(&JustitiaGammaMaxWei), keep(&JustitiaLag_MaxInflationWei),
+	}
+	t.Cleanup(func() {
+		for _, r := range restore {
+			r()
+		}
+	})
+}
+
+// keep returns a function that sets *p back to its current value
+func keep[T any](p *T) func() {
+	v := *p
+	return func() { *p = v }
+}
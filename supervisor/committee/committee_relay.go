@@ -2,6 +2,8 @@ package committee
 
 import (
 	"blockEmulator/core"
+	"blockEmulator/fees"
+	"blockEmulator/incentive/justitia"
 	"blockEmulator/ingest/ethcsv"
 	"blockEmulator/message"
 	"blockEmulator/networks"
@@ -15,7 +17,7 @@ import (
 	"log"
 	"math/big"
 	"os"
-	"strconv"
+	"sync"
 	"time"
 )
 
@@ -27,6 +29,10 @@ type RelayCommitteeModule struct {
 	IpNodeTable  map[uint64]map[uint64]string
 	sl           *supervisor_log.SupervisorLog
 	Ss           *signal.StopSignal // to control the stop message sending
+
+	// IncludeContractTxs also injects rows involving contracts (calls and creations, the latter
+	// sent to the created address) and self-transfers, which map to an ITX; off by default
+	IncludeContractTxs bool
 }
 
 func NewRelayCommitteeModule(Ip_nodeTable map[uint64]map[uint64]string, Ss *signal.StopSignal, slog *supervisor_log.SupervisorLog, csvFilePath string, dataNum, batchNum int) *RelayCommitteeModule {
@@ -44,30 +50,55 @@ func NewRelayCommitteeModule(Ip_nodeTable map[uint64]map[uint64]string, Ss *sign
 // transfrom, data to transaction
 // check whether it is a legal txs meesage. if so, read txs and put it into the txlist
 // CSV format: blockNumber,timestamp,transactionHash,from,to,toCreate,fromIsContract,toIsContract,value,gasLimit,gasPrice,gasUsed,callingFunction,isError,eip2718type,baseFeePerGas,maxFeePerGas,maxPriorityFeePerGas,...
+// A header row switches later rows to the column order it names (see setCSVHeader)
 func data2tx(data []string, nonce uint64) (*core.Transaction, bool) {
-	// Skip header row
-	if data[0] == "blockNumber" {
+	return data2txWithContracts(data, nonce, false)
+}
+
+// data2txWithContracts is data2tx that, if includeContracts is set, also accepts contract
+// interactions and self-transfers; a contract creation's recipient is the created address
+// (ethcsv.ToAddress), so shard mapping follows it
+func data2txWithContracts(data []string, nonce uint64, includeContracts bool) (*core.Transaction, bool) {
+	// Header row: remember its column layout and skip it
+	if isCSVHeader(data) {
+		setCSVHeader(data)
 		return &core.Transaction{}, false
 	}
+	cols := currentCSVColumns()
 
 	// Check basic validity: not contract creation, valid addresses
-	if data[6] == "0" && data[7] == "0" && len(data[3]) > 16 && len(data[4]) > 16 && data[3] != data[4] {
+	from, _ := cols.Field(data, "from")
+	to, _ := cols.Field(data, "to")
+	fromIsContract, _ := cols.Field(data, "fromIsContract")
+	toIsContract, _ := cols.Field(data, "toIsContract")
+	valid := fromIsContract == "0" && toIsContract == "0" && len(from) > 16 && len(to) > 16 && from != to
+	if includeContracts {
+		toCreate, _ := cols.Field(data, "toCreate")
+		to = ethcsv.ToAddress(ethcsv.TxRow{To: to, ToCreate: toCreate})
+		valid = len(from) > 16 && len(to) > 16
+	}
+	if valid {
 		// Parse value
-		val, ok := new(big.Int).SetString(data[8], 10)
+		rawVal, _ := cols.Field(data, "value")
+		val, ok := new(big.Int).SetString(rawVal, 10)
 		if !ok {
 			log.Panic("new int failed\n")
 		}
 
 		// Create basic transaction
-		tx := core.NewTransaction(data[3][2:], data[4][2:], val, nonce, time.Now())
+		tx := core.NewTransaction(from[2:], to[2:], val, nonce, time.Now())
 
 		// Parse and set fee using ethcsv package for accurate fee computation
-		if len(data) >= 12 { // Ensure we have gasPrice field
+		if gp := cols.Index("gasPrice"); gp >= 0 && len(data) > gp { // Ensure we have gasPrice field
 			// Parse CSV row into ethcsv.TxRow for proper fee calculation
-			row := parseCSVRow(data)
+			row, errs := parseCSVRowWithColumns(data, cols)
+			if len(errs) > 0 {
+				recordCSVParseErrors(errs)
+			}
 
 			// Compute proposer fee using the ONLY source of truth
 			proposerFee := ethcsv.ComputeProposerFee(row)
+			tx.GasUsed = row.GasUsed
 
 			// Set the fee (this is the actual fee from the dataset)
 			if proposerFee != nil && proposerFee.Sign() > 0 {
@@ -86,73 +117,92 @@ func data2tx(data []string, nonce uint64) (*core.Transaction, bool) {
 	return &core.Transaction{}, false
 }
 
-// parseCSVRow converts CSV string array to ethcsv.TxRow for fee computation
-func parseCSVRow(data []string) ethcsv.TxRow {
-	row := ethcsv.TxRow{}
+// csvLayout holds the column layout taken from the most recent header row (nil = ethcsv.DefaultColumns)
+var csvLayout = struct {
+	sync.Mutex
+	cols ethcsv.Columns
+}{}
 
-	// Parse basic fields
-	if len(data) > 0 {
-		if bn, err := strconv.ParseUint(data[0], 10, 64); err == nil {
-			row.BlockNumber = bn
-		}
-	}
-	if len(data) > 2 {
-		row.TxHash = data[2]
-	}
-	if len(data) > 3 {
-		row.From = data[3]
-	}
-	if len(data) > 4 {
-		row.To = data[4]
-	}
-	if len(data) > 8 {
-		if val, ok := new(big.Int).SetString(data[8], 10); ok {
-			row.Value = val
-		}
-	}
+// isCSVHeader reports whether a row is a header, i.e. names the blockNumber column anywhere
+func isCSVHeader(data []string) bool {
+	return ethcsv.IsHeader(data)
+}
 
-	// Parse gas fields (critical for fee computation)
-	if len(data) > 9 {
-		if gl, err := strconv.ParseUint(data[9], 10, 64); err == nil {
-			row.GasLimit = gl
-		}
+// setCSVHeader builds the name->index map from a header row and uses it for subsequent rows
+func setCSVHeader(header []string) {
+	cols := ethcsv.HeaderColumns(header)
+	csvLayout.Lock()
+	csvLayout.cols = cols
+	csvLayout.Unlock()
+}
+
+// resetCSVHeader reverts to the fixed default layout
+func resetCSVHeader() {
+	csvLayout.Lock()
+	csvLayout.cols = nil
+	csvLayout.Unlock()
+}
+
+// currentCSVColumns returns the header-derived layout, falling back to ethcsv.DefaultColumns
+func currentCSVColumns() ethcsv.Columns {
+	csvLayout.Lock()
+	defer csvLayout.Unlock()
+	if csvLayout.cols == nil {
+		return ethcsv.DefaultColumns
 	}
-	if len(data) > 10 && data[10] != "" && data[10] != "None" {
-		if gp, ok := new(big.Int).SetString(data[10], 10); ok {
-			row.GasPrice = gp
+	return csvLayout.cols
+}
+
+// csvParseStats counts parse failures per field so data2tx can report them without flooding the log
+var csvParseStats = struct {
+	sync.Mutex
+	failedRows int
+	fields     map[string]int
+}{fields: make(map[string]int)}
+
+// csvParseLogEvery bounds the parse-failure summary to one log line per this many failed rows
+const csvParseLogEvery = 1000
+
+// recordCSVParseErrors accumulates per-field failure counts and periodically logs a summary
+func recordCSVParseErrors(errs []error) {
+	csvParseStats.Lock()
+	defer csvParseStats.Unlock()
+
+	csvParseStats.failedRows++
+	for _, err := range errs {
+		if fe, ok := err.(*ethcsv.FieldError); ok {
+			csvParseStats.fields[fe.Field]++
 		}
 	}
-	if len(data) > 11 {
-		if gu, err := strconv.ParseUint(data[11], 10, 64); err == nil {
-			row.GasUsed = gu
-		}
+	if csvParseStats.failedRows == 1 || csvParseStats.failedRows%csvParseLogEvery == 0 {
+		log.Printf("CSV parse failures: %d rows so far, per field: %v (latest: %v)\n",
+			csvParseStats.failedRows, csvParseStats.fields, errs[0])
 	}
+}
 
-	// Parse EIP-2718 type (0=legacy, 2=EIP-1559, etc.)
-	if len(data) > 14 && data[14] != "" && data[14] != "None" {
-		if eipType, err := strconv.ParseUint(data[14], 10, 8); err == nil {
-			row.EIP2718Type = uint8(eipType)
-		}
-	}
+// parseCSVRow converts CSV string array to ethcsv.TxRow for fee computation
+// Missing, empty and "None" columns are left at their zero value; columns that are
+// present but malformed are also left unset and reported in the returned errors
+// Columns are located using the current header layout (see setCSVHeader)
+func parseCSVRow(data []string) (ethcsv.TxRow, []error) {
+	return parseCSVRowWithColumns(data, currentCSVColumns())
+}
 
-	// Parse EIP-1559 fields (for type 2 transactions)
-	if len(data) > 15 && data[15] != "" && data[15] != "None" {
-		if baseFee, ok := new(big.Int).SetString(data[15], 10); ok {
-			row.BaseFeePerGas = baseFee
-		}
+// parseCSVRowWithColumns is parseCSVRow with an explicit column layout
+func parseCSVRowWithColumns(data []string, cols ethcsv.Columns) (ethcsv.TxRow, []error) {
+	row, err := ethcsv.ParseRowWithColumns(data, cols)
+	if err == nil {
+		return row, nil
 	}
-	if len(data) > 16 && data[16] != "" && data[16] != "None" {
-		if maxFee, ok := new(big.Int).SetString(data[16], 10); ok {
-			row.MaxFeePerGas = maxFee
+	var errs []error
+	if re, ok := err.(*ethcsv.RowError); ok {
+		for _, fe := range re.Fields {
+			errs = append(errs, fe)
 		}
+	} else {
+		errs = append(errs, err)
 	}
-	if len(data) > 17 && data[17] != "" && data[17] != "None" {
-		if maxPriority, ok := new(big.Int).SetString(data[17], 10); ok {
-			row.MaxPriorityFeePerGas = maxPriority
-		}
-	}
-
-	return row
+	return row, errs
 }
 
 func (rthm *RelayCommitteeModule) HandleOtherMessage([]byte) {}
@@ -161,6 +211,12 @@ func (rthm *RelayCommitteeModule) txSending(txlist []*core.Transaction) {
 	// the txs will be sent
 	sendToShard := make(map[uint64][]*core.Transaction)
 
+	// Justitia: optional injection-time subsidy preview (informational only)
+	var preview *SubsidyPreview
+	if params.EnableJustitia == 1 && params.JustitiaSubsidyPreview == 1 {
+		preview = NewSubsidyPreview(justitia.SubsidyMode(params.JustitiaSubsidyMode), fees.GetGlobalTracker().GetAllAvgFees())
+	}
+
 	for idx := 0; idx <= len(txlist); idx++ {
 		if idx > 0 && (idx%params.InjectSpeed == 0 || idx == len(txlist)) {
 			// send to shard
@@ -203,6 +259,10 @@ func (rthm *RelayCommitteeModule) txSending(txlist []*core.Transaction) {
 			tx.ArrivalTime = time.Now()
 		}
 
+		if preview != nil {
+			preview.Annotate(tx)
+		}
+
 		sendToShard[sendersid] = append(sendToShard[sendersid], tx)
 	}
 }
@@ -225,7 +285,7 @@ func (rthm *RelayCommitteeModule) MsgSendingControl() {
 		if err != nil {
 			log.Panic(err)
 		}
-		if tx, ok := data2tx(data, uint64(rthm.nowDataNum)); ok {
+		if tx, ok := data2txWithContracts(data, uint64(rthm.nowDataNum), rthm.IncludeContractTxs); ok {
 			txlist = append(txlist, tx)
 			rthm.nowDataNum++
 		}
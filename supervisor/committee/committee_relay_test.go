@@ -0,0 +1,191 @@
+package committee
+
+import (
+	"blockEmulator/ingest/ethcsv"
+	"math/big"
+	"testing"
+)
+
+// TestParseCSVRow_MalformedFields tests that malformed numeric fields are reported while valid ones still parse
+func TestParseCSVRow_MalformedFields(t *testing.T) {
+	data := []string{
+		"12x45",                  // blockNumber (malformed)
+		"1700000000",             // timestamp
+		"0xhash",                 // transactionHash
+		"0xfrom0000000000000000", // from
+		"0xto000000000000000000", // to
+		"",                       // toCreate
+		"0",                      // fromIsContract
+		"0",                      // toIsContract
+		"1000",                   // value
+		"21000",                  // gasLimit
+		"1.5e9",                  // gasPrice (malformed)
+		"abc",                    // gasUsed (malformed)
+		"",                       // callingFunction
+		"0",                      // isError
+		"300",                    // eip2718type (out of uint8 range)
+		"None",                   // baseFeePerGas (absent, not an error)
+		"30000000000",            // maxFeePerGas
+		"2000000000",             // maxPriorityFeePerGas
+	}
+
+	row, errs := parseCSVRow(data)
+
+	wantFailed := map[string]bool{"blockNumber": true, "gasPrice": true, "gasUsed": true, "eip2718type": true}
+	if len(errs) != len(wantFailed) {
+		t.Errorf("Expected %d parse errors, got %d: %v", len(wantFailed), len(errs), errs)
+	}
+	for _, err := range errs {
+		fe, ok := err.(*ethcsv.FieldError)
+		if !ok {
+			t.Errorf("Unexpected error type %T: %v", err, err)
+			continue
+		}
+		if !wantFailed[fe.Field] {
+			t.Errorf("Unexpected parse error for field %s: %v", fe.Field, err)
+		}
+	}
+
+	// Malformed fields stay unset
+	if row.BlockNumber != 0 || row.GasPrice != nil || row.GasUsed != 0 || row.EIP2718Type != 0 {
+		t.Errorf("Malformed fields should be unset, got %+v", row)
+	}
+	// Valid fields are still parsed
+	if row.Value == nil || row.Value.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Value = %v, want 1000", row.Value)
+	}
+	if row.GasLimit != 21000 {
+		t.Errorf("GasLimit = %d, want 21000", row.GasLimit)
+	}
+	if row.MaxFeePerGas == nil || row.MaxFeePerGas.Cmp(big.NewInt(30000000000)) != 0 {
+		t.Errorf("MaxFeePerGas = %v, want 30000000000", row.MaxFeePerGas)
+	}
+	if row.MaxPriorityFeePerGas == nil || row.MaxPriorityFeePerGas.Cmp(big.NewInt(2000000000)) != 0 {
+		t.Errorf("MaxPriorityFeePerGas = %v, want 2000000000", row.MaxPriorityFeePerGas)
+	}
+	if row.BaseFeePerGas != nil {
+		t.Errorf("BaseFeePerGas = %v, want nil for None", row.BaseFeePerGas)
+	}
+}
+
+// TestParseCSVRow_ShortRow tests that missing trailing columns are not reported as errors
+func TestParseCSVRow_ShortRow(t *testing.T) {
+	row, errs := parseCSVRow([]string{"100", "1700000000", "0xhash"})
+	if len(errs) != 0 {
+		t.Errorf("Expected no errors for a short row, got %v", errs)
+	}
+	if row.BlockNumber != 100 || row.TxHash != "0xhash" {
+		t.Errorf("Unexpected row: %+v", row)
+	}
+}
+
+// TestData2tx_ReorderedHeader tests that a header row remaps columns so fees parse correctly
+func TestData2tx_ReorderedHeader(t *testing.T) {
+	defer resetCSVHeader()
+
+	canonical := []string{
+		"100", "1700000000", "0xhash", "0xfrom0000000000000000", "0xto000000000000000000", "",
+		"0", "0", "1000", "50000", "20000000000", "21000", "", "0", "2",
+		"15000000000", "30000000000", "2000000000",
+	}
+	want, errs := parseCSVRowWithColumns(canonical, ethcsv.DefaultColumns)
+	if len(errs) != 0 {
+		t.Fatalf("Canonical row failed to parse: %v", errs)
+	}
+	wantFee := ethcsv.ComputeProposerFee(want)
+
+	// Same row with the columns reversed and an extra unknown column in front
+	header := []string{"extra"}
+	row := []string{"ignored"}
+	names := make([]string, len(ethcsv.DefaultColumns))
+	for name, idx := range ethcsv.DefaultColumns {
+		names[idx] = name
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		header = append(header, names[i])
+		row = append(row, canonical[i])
+	}
+
+	if _, ok := data2tx(header, 0); ok {
+		t.Fatal("Header row should not produce a transaction")
+	}
+	tx, ok := data2tx(row, 0)
+	if !ok {
+		t.Fatal("Reordered row should produce a transaction")
+	}
+	if tx.FeeToProposer.Cmp(wantFee) != 0 {
+		t.Errorf("FeeToProposer = %s, want %s", tx.FeeToProposer, wantFee)
+	}
+	if tx.GasUsed != 21000 {
+		t.Errorf("GasUsed = %d, want 21000", tx.GasUsed)
+	}
+	if tx.Value.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Value = %s, want 1000", tx.Value)
+	}
+
+	// Without a header the fixed indices apply
+	resetCSVHeader()
+	tx, ok = data2tx(canonical, 0)
+	if !ok || tx.FeeToProposer.Cmp(wantFee) != 0 {
+		t.Errorf("Headerless row: ok=%v fee=%v, want %s", ok, tx.FeeToProposer, wantFee)
+	}
+}
+
+// TestData2tx_ContractRows tests that contract and self-transfer rows are only accepted when enabled
+func TestData2tx_ContractRows(t *testing.T) {
+	resetCSVHeader()
+	from := "0xfrom0000000000000000"
+	creation := []string{
+		"100", "1700000000", "0xhash", from, "", "0xcreated000000000000",
+		"0", "1", "0", "500000", "20000000000", "400000", "", "0", "0",
+	}
+	self := []string{
+		"100", "1700000000", "0xhash2", from, from, "",
+		"0", "0", "5", "50000", "20000000000", "21000", "", "0", "0",
+	}
+
+	for _, row := range [][]string{creation, self} {
+		if _, ok := data2tx(row, 0); ok {
+			t.Errorf("row %s accepted without IncludeContractTxs", row[2])
+		}
+	}
+
+	tx, ok := data2txWithContracts(creation, 0, true)
+	if !ok {
+		t.Fatal("contract creation rejected with IncludeContractTxs")
+	}
+	if tx.Recipient != "created000000000000" {
+		t.Errorf("Recipient = %s, want the created address", tx.Recipient)
+	}
+	if want := big.NewInt(400000 * 20000000000); tx.FeeToProposer.Cmp(want) != 0 {
+		t.Errorf("FeeToProposer = %v, want %v", tx.FeeToProposer, want)
+	}
+
+	tx, ok = data2txWithContracts(self, 1, true)
+	if !ok || tx.Sender != tx.Recipient {
+		t.Errorf("self-transfer: ok=%v sender=%s recipient=%s", ok, tx.Sender, tx.Recipient)
+	}
+}
+
+// TestParseCSVRow_BlobFields tests that blob fee columns are parsed when a header names them
+func TestParseCSVRow_BlobFields(t *testing.T) {
+	defer resetCSVHeader()
+
+	setCSVHeader([]string{"blockNumber", "eip2718type", "blobGasUsed", "blobBaseFeePerGas",
+		"maxFeePerBlobGas", "maxPriorityFeePerBlobGas"})
+	row, errs := parseCSVRow([]string{"100", "3", "131072", "1000000000", "3000000000", "1000000000"})
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if row.BlobGasUsed != 131072 || row.BlobBaseFeePerGas.Int64() != 1000000000 ||
+		row.MaxFeePerBlobGas.Int64() != 3000000000 || row.MaxPriorityFeePerBlobGas.Int64() != 1000000000 {
+		t.Errorf("Blob fields not parsed: %+v", row)
+	}
+
+	// The default layout has no blob columns
+	resetCSVHeader()
+	row, _ = parseCSVRow([]string{"100"})
+	if row.MaxFeePerBlobGas != nil || row.BlobGasUsed != 0 {
+		t.Errorf("Headerless row should have no blob fields: %+v", row)
+	}
+}
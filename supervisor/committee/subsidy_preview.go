@@ -0,0 +1,64 @@
+package committee
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/incentive/justitia"
+	"math/big"
+)
+
+// SubsidyPreview predicts the Justitia subsidy and case of a CTX at injection time.
+// The prediction mirrors the scheduler's source-shard scoring with the stateless RAB,
+// so dynamic modes (PID, Lagrangian) are previewed with their DestAvg fallback.
+// Results are stored in tx.PredictedSubsidyR / tx.PredictedCase and are purely informational.
+type SubsidyPreview struct {
+	Mode    justitia.SubsidyMode
+	CustomF func(*big.Int, *big.Int) *big.Int
+	avgFees map[int]*big.Int // shard -> E(f_s) snapshot
+}
+
+// NewSubsidyPreview creates a preview from a fee tracker snapshot (see expectation.Tracker.GetAllAvgFees)
+func NewSubsidyPreview(mode justitia.SubsidyMode, avgFees map[int]*big.Int) *SubsidyPreview {
+	if avgFees == nil {
+		avgFees = make(map[int]*big.Int)
+	}
+	return &SubsidyPreview{
+		Mode:    mode,
+		avgFees: avgFees,
+	}
+}
+
+// avgFee returns the snapshot E(f_s) for a shard, or 0 if unknown
+func (sp *SubsidyPreview) avgFee(shardID int) *big.Int {
+	if avg, ok := sp.avgFees[shardID]; ok && avg != nil {
+		return avg
+	}
+	return big.NewInt(0)
+}
+
+// Annotate sets the predicted subsidy and case on a cross-shard transaction
+// ITX are left untouched; FromShard/ToShard/IsCrossShard must already be set
+func (sp *SubsidyPreview) Annotate(tx *core.Transaction) {
+	if tx == nil || !tx.IsCrossShard {
+		return
+	}
+
+	EA := sp.avgFee(tx.FromShard)
+	EB := sp.avgFee(tx.ToShard)
+	R := justitia.RAB(sp.Mode, EA, EB, nil, sp.CustomF)
+
+	fee := tx.FeeToProposer
+	if fee == nil {
+		fee = big.NewInt(0)
+	}
+	uA, _ := justitia.Split2(fee, R, EA, EB)
+
+	tx.PredictedSubsidyR = new(big.Int).Set(R)
+	tx.PredictedCase = int(justitia.Classify(uA, EA, EB))
+}
+
+// AnnotateAll annotates every cross-shard transaction in txs
+func (sp *SubsidyPreview) AnnotateAll(txs []*core.Transaction) {
+	for _, tx := range txs {
+		sp.Annotate(tx)
+	}
+}
@@ -0,0 +1,65 @@
+package committee
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/fees/expectation"
+	"blockEmulator/incentive/justitia"
+	"blockEmulator/txpool/scheduler"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newPreviewTx creates a transaction from shard `from` to shard `to` with the given fee
+func newPreviewTx(hash string, from, to int, fee int64) *core.Transaction {
+	tx := core.NewTransaction("sender", "recipient", big.NewInt(0), 0, time.Now())
+	tx.TxHash = []byte(hash)
+	tx.FromShard = from
+	tx.ToShard = to
+	tx.IsCrossShard = from != to
+	tx.FeeToProposer = big.NewInt(fee)
+	return tx
+}
+
+// TestSubsidyPreview_MatchesScheduler tests that predicted fields agree with the source-shard scheduler
+func TestSubsidyPreview_MatchesScheduler(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(300))
+
+	modes := []justitia.SubsidyMode{justitia.SubsidyNone, justitia.SubsidyDestAvg, justitia.SubsidySumAvg}
+	for _, mode := range modes {
+		t.Run(mode.String(), func(t *testing.T) {
+			txs := []*core.Transaction{
+				newPreviewTx("low", 0, 1, 10),    // Case2 without enough subsidy
+				newPreviewTx("mid", 0, 1, 900),   // Case3 range
+				newPreviewTx("high", 0, 1, 5000), // Case1
+				newPreviewTx("itx", 0, 0, 100),   // ITX is not previewed
+			}
+
+			preview := NewSubsidyPreview(mode, tracker.GetAllAvgFees())
+			preview.AnnotateAll(txs)
+
+			sched := scheduler.NewScheduler(0, 2, tracker, mode)
+			sched.SelectForBlock(len(txs), txs)
+
+			for _, tx := range txs {
+				if !tx.IsCrossShard {
+					if tx.PredictedSubsidyR != nil || tx.PredictedCase != 0 {
+						t.Errorf("ITX %s should not be previewed", tx.TxHash)
+					}
+					continue
+				}
+				if tx.PredictedSubsidyR == nil || tx.PredictedCase == 0 {
+					t.Fatalf("CTX %s: predicted fields not populated", tx.TxHash)
+				}
+				if tx.PredictedSubsidyR.Cmp(tx.SubsidyR) != 0 {
+					t.Errorf("CTX %s: predicted R=%s, scheduler R=%s", tx.TxHash, tx.PredictedSubsidyR, tx.SubsidyR)
+				}
+				if tx.PredictedCase != tx.JustitiaCase {
+					t.Errorf("CTX %s: predicted case=%d, scheduler case=%d", tx.TxHash, tx.PredictedCase, tx.JustitiaCase)
+				}
+			}
+		})
+	}
+}
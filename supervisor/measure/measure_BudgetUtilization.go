@@ -0,0 +1,115 @@
+package measure
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/message"
+	"blockEmulator/params"
+	"math/big"
+	"strconv"
+)
+
+// budgetBlockRecord is the subsidy budget usage of one block
+type budgetBlockRecord struct {
+	BlockSeq    int      // Sequence number of the block (in order received by the supervisor)
+	ShardID     uint64   // Shard that committed the block
+	Epoch       int      // Epoch of the block
+	Issued      *big.Int // Sum of SubsidyR over the fresh CTX included in the block
+	Utilization float64  // Issued / Bmax (0 when Bmax is unset)
+}
+
+// TestModule_BudgetUtilization records, per block, the subsidy assigned to the block's CTX against
+// the per-block budget Bmax, showing whether the budget is a binding constraint
+// A CTX is counted once, in the source block whose selection applied Bmax (relay1 / broker1 legs);
+// the destination legs only carry the already budgeted R along
+type TestModule_BudgetUtilization struct {
+	Bmax    *big.Int // Per-block subsidy budget (nil or 0 = unlimited)
+	records []budgetBlockRecord
+}
+
+func NewTestModule_BudgetUtilization() *TestModule_BudgetUtilization {
+	return &TestModule_BudgetUtilization{
+		Bmax:    params.GetJustitiaConfig().GammaMax,
+		records: make([]budgetBlockRecord, 0),
+	}
+}
+
+func (tmbu *TestModule_BudgetUtilization) OutputMetricName() string {
+	return "Subsidy_Budget_Utilization"
+}
+
+func (tmbu *TestModule_BudgetUtilization) UpdateMeasureRecord(b *message.BlockInfoMsg) {
+	if b.BlockBodyLength == 0 { // empty block
+		return
+	}
+
+	issued := new(big.Int)
+	for _, txs := range [][]*core.Transaction{b.Relay1Txs, b.Broker1Txs} {
+		for _, tx := range txs {
+			if tx.SubsidyR != nil {
+				issued.Add(issued, tx.SubsidyR)
+			}
+		}
+	}
+
+	utilization := 0.0
+	if tmbu.Bmax != nil && tmbu.Bmax.Sign() > 0 {
+		utilization, _ = new(big.Float).Quo(new(big.Float).SetInt(issued), new(big.Float).SetInt(tmbu.Bmax)).Float64()
+	}
+
+	tmbu.records = append(tmbu.records, budgetBlockRecord{
+		BlockSeq:    len(tmbu.records),
+		ShardID:     b.SenderShardID,
+		Epoch:       b.Epoch,
+		Issued:      issued,
+		Utilization: utilization,
+	})
+}
+
+func (tmbu *TestModule_BudgetUtilization) HandleExtraMessage([]byte) {}
+
+// OutputRecord returns the utilization of each block and the average utilization
+func (tmbu *TestModule_BudgetUtilization) OutputRecord() (perBlockUtilization []float64, avgUtilization float64) {
+	tmbu.writeToCSV()
+
+	perBlockUtilization = make([]float64, 0, len(tmbu.records))
+	sum := 0.0
+	for _, r := range tmbu.records {
+		perBlockUtilization = append(perBlockUtilization, r.Utilization)
+		sum += r.Utilization
+	}
+	if len(tmbu.records) > 0 {
+		avgUtilization = sum / float64(len(tmbu.records))
+	}
+	return perBlockUtilization, avgUtilization
+}
+
+func (tmbu *TestModule_BudgetUtilization) writeToCSV() {
+	fileName := tmbu.OutputMetricName()
+	measureName := []string{
+		"BlockSeq",
+		"ShardID",
+		"EpochID",
+		"Issued Subsidy (wei)",
+		"Bmax (wei)",
+		"Utilization",
+	}
+
+	bmax := "0"
+	if tmbu.Bmax != nil {
+		bmax = tmbu.Bmax.String()
+	}
+	measureVals := make([][]string, 0, len(tmbu.records))
+	for _, r := range tmbu.records {
+		csvLine := []string{
+			strconv.Itoa(r.BlockSeq),
+			strconv.FormatUint(r.ShardID, 10),
+			strconv.Itoa(r.Epoch),
+			r.Issued.String(),
+			bmax,
+			strconv.FormatFloat(r.Utilization, 'f', 4, 64),
+		}
+		measureVals = append(measureVals, csvLine)
+	}
+
+	WriteMetricsToCSV(fileName, measureName, measureVals)
+}
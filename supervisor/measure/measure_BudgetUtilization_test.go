@@ -0,0 +1,89 @@
+package measure
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/message"
+	"blockEmulator/params"
+	"encoding/csv"
+	"math"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+// subsidyBlock builds a block including one fresh relay1 CTX per subsidy value
+func subsidyBlock(epoch int, subsidies ...int64) *message.BlockInfoMsg {
+	relay1 := make([]*core.Transaction, 0, len(subsidies))
+	for i, r := range subsidies {
+		tx := core.NewTransaction("a", "b", big.NewInt(0), uint64(i), time.Now())
+		tx.SubsidyR = big.NewInt(r)
+		relay1 = append(relay1, tx)
+	}
+	// A relay2 leg was budgeted in its source block and must not count again
+	relay2 := core.NewTransaction("a", "b", big.NewInt(0), 0, time.Now())
+	relay2.SubsidyR = big.NewInt(1_000_000)
+
+	return &message.BlockInfoMsg{
+		BlockBodyLength: len(subsidies) + 1,
+		Epoch:           epoch,
+		SenderShardID:   1,
+		Relay1Txs:       relay1,
+		Relay2Txs:       []*core.Transaction{relay2},
+	}
+}
+
+// TestBudgetUtilization_PerBlock tests the per-block utilization column against Bmax
+func TestBudgetUtilization_PerBlock(t *testing.T) {
+	oldPath := params.DataWrite_path
+	params.DataWrite_path = t.TempDir() + "/"
+	defer func() { params.DataWrite_path = oldPath }()
+
+	tmbu := NewTestModule_BudgetUtilization()
+	tmbu.Bmax = big.NewInt(1000)
+	tmbu.UpdateMeasureRecord(subsidyBlock(0, 100, 150))      // 25%
+	tmbu.UpdateMeasureRecord(&message.BlockInfoMsg{})        // empty, skipped
+	tmbu.UpdateMeasureRecord(subsidyBlock(0, 400, 600))      // 100%, binding
+	tmbu.UpdateMeasureRecord(subsidyBlock(1))                // no CTX: 0%
+	tmbu.UpdateMeasureRecord(subsidyBlock(1, 500, 500, 500)) // 150%, over budget
+
+	perBlock, avg := tmbu.OutputRecord()
+	want := []float64{0.25, 1.0, 0, 1.5}
+	if len(perBlock) != len(want) {
+		t.Fatalf("Expected %d blocks, got %d", len(want), len(perBlock))
+	}
+	for i, w := range want {
+		if math.Abs(perBlock[i]-w) > 1e-9 {
+			t.Errorf("Block %d utilization = %.4f, want %.4f", i, perBlock[i], w)
+		}
+	}
+	if math.Abs(avg-0.6875) > 1e-9 {
+		t.Errorf("Average utilization = %.4f, want 0.6875", avg)
+	}
+
+	file, err := os.Open(params.DataWrite_path + "supervisor_measureOutput/" + tmbu.OutputMetricName() + ".csv")
+	if err != nil {
+		t.Fatalf("CSV not written: %v", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Reading CSV failed: %v", err)
+	}
+	if len(rows) != len(want)+1 {
+		t.Fatalf("CSV has %d rows, want header + %d", len(rows), len(want))
+	}
+	wantCol := []string{"0.2500", "1.0000", "0.0000", "1.5000"}
+	for i, w := range wantCol {
+		row := rows[i+1]
+		if row[5] != w {
+			t.Errorf("CSV row %d utilization = %s, want %s", i, row[5], w)
+		}
+		if row[4] != "1000" {
+			t.Errorf("CSV row %d Bmax = %s, want 1000", i, row[4])
+		}
+	}
+	if rows[2][3] != "1000" {
+		t.Errorf("CSV issued subsidy for block 1 = %s, want 1000", rows[2][3])
+	}
+}
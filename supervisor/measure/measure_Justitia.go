@@ -20,6 +20,10 @@ type TestModule_Justitia struct {
 	ctxRelay2Latency   []int64   // sum of relay2 phase latency (ms)
 	ctxEndToEndLatency []int64   // sum of end-to-end latency from original proposal to relay2 commit (ms)
 
+	// CTX end-to-end latency by JustitiaCase (index 0 = unclassified, 1-3 = Case1-Case3)
+	caseCount   [][4]int   // count of relay2 CTX per case per epoch
+	caseLatency [][4]int64 // sum of end-to-end latency per case per epoch (ms)
+
 	// Inner-shard transaction metrics
 	innerTxCount        []int     // count of inner-shard transactions per epoch
 	innerTxTotalLatency []float64 // total latency of inner-shard txs per epoch (in seconds)
@@ -32,6 +36,14 @@ type TestModule_Justitia struct {
 
 	// Track relay1 commit times for matching with relay2
 	relay1CommitTS map[string]time.Time
+
+	// Number of leading epochs excluded from aggregate metrics (still written to CSV)
+	// Early epochs are noisy because E(f_s) has not stabilized yet
+	WarmupEpochs int
+
+	// Aggregates over post-warm-up epochs, computed by OutputRecord
+	aggPriorityRate     float64
+	aggLatencyReduction float64
 }
 
 func NewTestModule_Justitia() *TestModule_Justitia {
@@ -44,6 +56,9 @@ func NewTestModule_Justitia() *TestModule_Justitia {
 		ctxRelay2Latency:   make([]int64, 0),
 		ctxEndToEndLatency: make([]int64, 0),
 
+		caseCount:   make([][4]int, 0),
+		caseLatency: make([][4]int64, 0),
+
 		innerTxCount:        make([]int, 0),
 		innerTxTotalLatency: make([]float64, 0),
 		innerTxAvgLatency:   make([]float64, 0),
@@ -53,6 +68,8 @@ func NewTestModule_Justitia() *TestModule_Justitia {
 		priorityRate:     make([]float64, 0),
 
 		relay1CommitTS: make(map[string]time.Time),
+
+		WarmupEpochs: params.JustitiaWarmupEpochs,
 	}
 }
 
@@ -75,6 +92,8 @@ func (tmj *TestModule_Justitia) UpdateMeasureRecord(b *message.BlockInfoMsg) {
 		tmj.ctxRelay1Latency = append(tmj.ctxRelay1Latency, 0)
 		tmj.ctxRelay2Latency = append(tmj.ctxRelay2Latency, 0)
 		tmj.ctxEndToEndLatency = append(tmj.ctxEndToEndLatency, 0)
+		tmj.caseCount = append(tmj.caseCount, [4]int{})
+		tmj.caseLatency = append(tmj.caseLatency, [4]int64{})
 
 		tmj.innerTxCount = append(tmj.innerTxCount, 0)
 		tmj.innerTxTotalLatency = append(tmj.innerTxTotalLatency, 0)
@@ -151,6 +170,14 @@ func (tmj *TestModule_Justitia) UpdateMeasureRecord(b *message.BlockInfoMsg) {
 		
 		tmj.ctxEndToEndLatency[epochid] += endToEndLatency
 		tmj.ctxTotalLatency[epochid] += float64(endToEndLatency) / 1000.0 // convert to seconds
+
+		// Bucket by the case assigned at selection; unknown values count as unclassified
+		txCase := r2tx.JustitiaCase
+		if txCase < 0 || txCase > 3 {
+			txCase = 0
+		}
+		tmj.caseCount[epochid][txCase]++
+		tmj.caseLatency[epochid][txCase] += endToEndLatency
 	}
 
 	// Calculate average latencies and effectiveness metrics
@@ -192,6 +219,10 @@ func (tmj *TestModule_Justitia) OutputRecord() (perEpochLatency []float64, totLa
 		// Return the latency reduction per epoch for analysis
 		perEpochLatency = append(perEpochLatency, tmj.latencyReduction[eid])
 
+		// Warm-up epochs are reported per epoch but excluded from aggregates
+		if eid < tmj.WarmupEpochs {
+			continue
+		}
 		totalCtxLatency += tmj.ctxTotalLatency[eid]
 		totalCtxCount += tmj.ctxCount[eid]
 		totalInnerLatency += tmj.innerTxTotalLatency[eid]
@@ -203,9 +234,38 @@ func (tmj *TestModule_Justitia) OutputRecord() (perEpochLatency []float64, totLa
 		totLatency = (totalCtxLatency + totalInnerLatency) / float64(totalCtxCount+totalInnerCount)
 	}
 
+	// Aggregate priority rate: share of CTX among all post-warm-up txs
+	tmj.aggPriorityRate = 0
+	if totalCtxCount+totalInnerCount > 0 {
+		tmj.aggPriorityRate = float64(totalCtxCount) / float64(totalCtxCount+totalInnerCount) * 100.0
+	}
+
+	// Aggregate latency reduction from post-warm-up average latencies
+	tmj.aggLatencyReduction = 0
+	if totalCtxCount > 0 && totalInnerCount > 0 && totalInnerLatency > 0 {
+		ctxAvg := totalCtxLatency / float64(totalCtxCount)
+		innerAvg := totalInnerLatency / float64(totalInnerCount)
+		tmj.aggLatencyReduction = (ctxAvg - innerAvg) / innerAvg * 100.0
+	}
+
 	return
 }
 
+// CaseAvgLatency returns the average end-to-end latency (ms) of the CTX of the given JustitiaCase
+// committed in epoch (case 0 = unclassified); 0 if there were none
+func (tmj *TestModule_Justitia) CaseAvgLatency(epoch, txCase int) float64 {
+	if epoch < 0 || epoch >= len(tmj.caseCount) || txCase < 0 || txCase > 3 || tmj.caseCount[epoch][txCase] == 0 {
+		return 0
+	}
+	return float64(tmj.caseLatency[epoch][txCase]) / float64(tmj.caseCount[epoch][txCase])
+}
+
+// AggregateMetrics returns the CTX priority rate (%) and latency reduction (%) over
+// post-warm-up epochs, as computed by the last call to OutputRecord
+func (tmj *TestModule_Justitia) AggregateMetrics() (priorityRate, latencyReduction float64) {
+	return tmj.aggPriorityRate, tmj.aggLatencyReduction
+}
+
 func (tmj *TestModule_Justitia) writeToCSV() {
 	if params.EnableJustitia != 1 {
 		return // Only write CSV if Justitia is enabled
@@ -225,6 +285,10 @@ func (tmj *TestModule_Justitia) writeToCSV() {
 		"CTX Priority Rate (%)",
 		"Justitia Reward",
 		"Justitia Status",
+		"Case1 CTX Avg Latency (ms)",
+		"Case2 CTX Avg Latency (ms)",
+		"Case3 CTX Avg Latency (ms)",
+		"Unclassified CTX Avg Latency (ms)",
 	}
 
 	measureVals := make([][]string, 0)
@@ -251,6 +315,10 @@ func (tmj *TestModule_Justitia) writeToCSV() {
 			strconv.FormatFloat(tmj.priorityRate[eid], 'f', 2, 64),
 			strconv.FormatFloat(params.JustitiaRewardBase, 'f', 2, 64),
 			justitiaStatus,
+			strconv.FormatFloat(tmj.CaseAvgLatency(eid, 1), 'f', 2, 64),
+			strconv.FormatFloat(tmj.CaseAvgLatency(eid, 2), 'f', 2, 64),
+			strconv.FormatFloat(tmj.CaseAvgLatency(eid, 3), 'f', 2, 64),
+			strconv.FormatFloat(tmj.CaseAvgLatency(eid, 0), 'f', 2, 64),
 		}
 		measureVals = append(measureVals, csvLine)
 	}
@@ -0,0 +1,129 @@
+package measure
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/message"
+	"blockEmulator/params"
+	"encoding/csv"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// justitiaEpochBlock builds a block with nInner ITX and nCTX relay2 CTX committed in the given epoch
+func justitiaEpochBlock(epoch, nInner, nCTX int) *message.BlockInfoMsg {
+	commit := time.Now()
+	inner := make([]*core.Transaction, 0, nInner)
+	for i := 0; i < nInner; i++ {
+		inner = append(inner, core.NewTransaction("a", "b", big.NewInt(0), uint64(i), commit.Add(-time.Second)))
+	}
+	relay2 := make([]*core.Transaction, 0, nCTX)
+	for i := 0; i < nCTX; i++ {
+		tx := core.NewTransaction("a", "b", big.NewInt(0), uint64(i), commit.Add(-time.Second))
+		tx.TxHash = []byte("ctx" + strconv.Itoa(epoch) + strconv.Itoa(i))
+		relay2 = append(relay2, tx)
+	}
+	return &message.BlockInfoMsg{
+		BlockBodyLength: nInner + nCTX,
+		Epoch:           epoch,
+		CommitTime:      commit,
+		InnerShardTxs:   inner,
+		Relay2Txs:       relay2,
+	}
+}
+
+// TestJustitia_WarmupEpochs tests that aggregates skip warm-up epochs while the CSV keeps every epoch
+func TestJustitia_WarmupEpochs(t *testing.T) {
+	oldPath, oldEnable := params.DataWrite_path, params.EnableJustitia
+	params.DataWrite_path = t.TempDir() + "/"
+	params.EnableJustitia = 1
+	defer func() { params.DataWrite_path, params.EnableJustitia = oldPath, oldEnable }()
+
+	tmj := NewTestModule_Justitia()
+	tmj.WarmupEpochs = 2
+	tmj.UpdateMeasureRecord(justitiaEpochBlock(0, 9, 1)) // warm-up: 10% CTX
+	tmj.UpdateMeasureRecord(justitiaEpochBlock(1, 9, 1)) // warm-up: 10% CTX
+	tmj.UpdateMeasureRecord(justitiaEpochBlock(2, 5, 5)) // 50% CTX
+	tmj.UpdateMeasureRecord(justitiaEpochBlock(3, 5, 5)) // 50% CTX
+
+	perEpoch, _ := tmj.OutputRecord()
+	if len(perEpoch) != 4 {
+		t.Errorf("Expected 4 per-epoch values, got %d", len(perEpoch))
+	}
+	if rate, _ := tmj.AggregateMetrics(); math.Abs(rate-50.0) > 1e-9 {
+		t.Errorf("Aggregate priority rate = %.2f%%, want 50%% (warm-up excluded)", rate)
+	}
+
+	file, err := os.Open(params.DataWrite_path + "supervisor_measureOutput/" + tmj.OutputMetricName() + ".csv")
+	if err != nil {
+		t.Fatalf("Failed to open CSV: %v", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(rows) != 5 { // header + 4 epochs
+		t.Fatalf("Expected header and 4 epoch rows, got %d rows", len(rows))
+	}
+	if rows[1][0] != "0" || rows[1][9] != "10.00" {
+		t.Errorf("Warm-up epoch 0 row = %v, want epoch 0 with 10.00%% priority rate", rows[1])
+	}
+
+	// Without warm-up the aggregate includes every epoch: 12 CTX of 40 txs
+	tmj.WarmupEpochs = 0
+	tmj.OutputRecord()
+	if rate, _ := tmj.AggregateMetrics(); math.Abs(rate-30.0) > 1e-9 {
+		t.Errorf("Aggregate priority rate without warm-up = %.2f%%, want 30%%", rate)
+	}
+}
+
+// TestJustitia_CaseLatency tests that CTX latency is bucketed by JustitiaCase and written as extra CSV columns
+func TestJustitia_CaseLatency(t *testing.T) {
+	oldPath, oldEnable := params.DataWrite_path, params.EnableJustitia
+	params.DataWrite_path = t.TempDir() + "/"
+	params.EnableJustitia = 1
+	defer func() { params.DataWrite_path, params.EnableJustitia = oldPath, oldEnable }()
+
+	b := justitiaEpochBlock(0, 2, 5)
+	cases := []int{1, 1, 3, 0, 7} // 7 is out of range and counts as unclassified
+	waits := []time.Duration{time.Second, 3 * time.Second, 4 * time.Second, 2 * time.Second, 6 * time.Second}
+	for i, tx := range b.Relay2Txs {
+		tx.JustitiaCase = cases[i]
+		tx.Time = b.CommitTime.Add(-waits[i])
+		tx.OriginalPropTime = tx.Time
+	}
+
+	tmj := NewTestModule_Justitia()
+	tmj.UpdateMeasureRecord(b)
+
+	want := map[int]float64{1: 2000, 2: 0, 3: 4000, 0: 4000}
+	for txCase, ms := range want {
+		if got := tmj.CaseAvgLatency(0, txCase); math.Abs(got-ms) > 1 {
+			t.Errorf("Case %d avg latency = %.1f ms, want %.0f", txCase, got, ms)
+		}
+	}
+
+	tmj.OutputRecord()
+	file, err := os.Open(params.DataWrite_path + "supervisor_measureOutput/" + tmj.OutputMetricName() + ".csv")
+	if err != nil {
+		t.Fatalf("Failed to open CSV: %v", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(rows) != 2 || len(rows[0]) != 16 {
+		t.Fatalf("Expected a header and one row of 16 columns, got %v", rows)
+	}
+	if rows[0][12] != "Case1 CTX Avg Latency (ms)" || rows[0][15] != "Unclassified CTX Avg Latency (ms)" {
+		t.Errorf("Unexpected case column headers: %v", rows[0][12:])
+	}
+	if rows[1][13] != "0.00" {
+		t.Errorf("Case2 column = %s, want 0.00 without Case2 CTX", rows[1][13])
+	}
+}
@@ -0,0 +1,132 @@
+package measure
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/incentive/justitia"
+	"blockEmulator/message"
+	"strconv"
+	"time"
+)
+
+// ModeTransition records a change of the dominant subsidy mode among CTX in a shard
+type ModeTransition struct {
+	BlockSeq   int       // Sequence number of the block (in order received by the supervisor)
+	ShardID    uint64    // Shard that committed the block
+	Epoch      int       // Epoch of the block
+	FromMode   int       // Dominant subsidy mode before the transition
+	ToMode     int       // Dominant subsidy mode from this block on
+	CommitTime time.Time // Commit time of the block
+}
+
+// TestModule_ModeTimeline detects mid-experiment subsidy mode changes from CTX provenance
+// For each block it records the dominant SubsidyMode among scored CTX and reports
+// the blocks at which that mode changes, for correlation with latency shifts
+type TestModule_ModeTimeline struct {
+	blockSeq      int            // Number of non-empty blocks seen
+	dominantModes []int          // Dominant mode per block (-1 if the block has no scored CTX)
+	lastMode      map[uint64]int // shard -> last dominant mode
+	transitions   []ModeTransition
+}
+
+func NewTestModule_ModeTimeline() *TestModule_ModeTimeline {
+	return &TestModule_ModeTimeline{
+		blockSeq:      0,
+		dominantModes: make([]int, 0),
+		lastMode:      make(map[uint64]int),
+		transitions:   make([]ModeTransition, 0),
+	}
+}
+
+func (tmmt *TestModule_ModeTimeline) OutputMetricName() string {
+	return "Subsidy_Mode_Timeline"
+}
+
+func (tmmt *TestModule_ModeTimeline) UpdateMeasureRecord(b *message.BlockInfoMsg) {
+	if b.BlockBodyLength == 0 { // empty block
+		return
+	}
+
+	// Count scored CTX per subsidy mode (relay and broker legs)
+	modeCount := make(map[int]int)
+	for _, txs := range [][]*core.Transaction{b.Relay1Txs, b.Relay2Txs, b.Broker1Txs, b.Broker2Txs} {
+		for _, tx := range txs {
+			if tx.JustitiaCase != 0 {
+				modeCount[tx.SubsidyMode]++
+			}
+		}
+	}
+
+	seq := tmmt.blockSeq
+	tmmt.blockSeq++
+
+	// Dominant mode: highest count, lowest mode value on ties for determinism
+	dominant, best := -1, 0
+	for mode, count := range modeCount {
+		if count > best || (count == best && mode < dominant) {
+			dominant, best = mode, count
+		}
+	}
+	tmmt.dominantModes = append(tmmt.dominantModes, dominant)
+	if dominant < 0 {
+		return
+	}
+
+	if prev, ok := tmmt.lastMode[b.SenderShardID]; ok && prev != dominant {
+		tmmt.transitions = append(tmmt.transitions, ModeTransition{
+			BlockSeq:   seq,
+			ShardID:    b.SenderShardID,
+			Epoch:      b.Epoch,
+			FromMode:   prev,
+			ToMode:     dominant,
+			CommitTime: b.CommitTime,
+		})
+	}
+	tmmt.lastMode[b.SenderShardID] = dominant
+}
+
+func (tmmt *TestModule_ModeTimeline) HandleExtraMessage([]byte) {}
+
+// Transitions returns the detected mode transitions in order
+func (tmmt *TestModule_ModeTimeline) Transitions() []ModeTransition {
+	result := make([]ModeTransition, len(tmmt.transitions))
+	copy(result, tmmt.transitions)
+	return result
+}
+
+// OutputRecord returns the dominant mode per block and the number of transitions
+func (tmmt *TestModule_ModeTimeline) OutputRecord() (perBlockMode []float64, transitionCount float64) {
+	tmmt.writeToCSV()
+
+	perBlockMode = make([]float64, 0, len(tmmt.dominantModes))
+	for _, mode := range tmmt.dominantModes {
+		perBlockMode = append(perBlockMode, float64(mode))
+	}
+	return perBlockMode, float64(len(tmmt.transitions))
+}
+
+func (tmmt *TestModule_ModeTimeline) writeToCSV() {
+	fileName := tmmt.OutputMetricName()
+	measureName := []string{
+		"BlockSeq",
+		"ShardID",
+		"EpochID",
+		"From Mode",
+		"To Mode",
+		"Commit Time (unix ms)",
+	}
+
+	measureVals := make([][]string, 0)
+	for _, tr := range tmmt.transitions {
+		csvLine := []string{
+			strconv.Itoa(tr.BlockSeq),
+			strconv.FormatUint(tr.ShardID, 10),
+			strconv.Itoa(tr.Epoch),
+			justitia.SubsidyMode(tr.FromMode).String(),
+			justitia.SubsidyMode(tr.ToMode).String(),
+			strconv.FormatInt(tr.CommitTime.UnixMilli(), 10),
+		}
+		measureVals = append(measureVals, csvLine)
+	}
+
+	WriteMetricsToCSV(fileName, measureName, measureVals)
+}
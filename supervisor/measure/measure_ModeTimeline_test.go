@@ -0,0 +1,70 @@
+package measure
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/fees/expectation"
+	"blockEmulator/incentive/justitia"
+	"blockEmulator/message"
+	"blockEmulator/txpool/scheduler"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// scoredCTXBlock builds a block of CTX scored by a source-shard scheduler in the given mode
+func scoredCTXBlock(mode justitia.SubsidyMode, epoch int, n int) *message.BlockInfoMsg {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(400))
+
+	txs := make([]*core.Transaction, 0, n)
+	for i := 0; i < n; i++ {
+		tx := core.NewTransaction("sender", "recipient", big.NewInt(0), uint64(i), time.Now())
+		tx.TxHash = []byte(mode.String() + strconv.Itoa(epoch) + strconv.Itoa(i))
+		tx.FromShard = 0
+		tx.ToShard = 1
+		tx.IsCrossShard = true
+		tx.FeeToProposer = big.NewInt(500)
+		txs = append(txs, tx)
+	}
+	scheduler.NewScheduler(0, 2, tracker, mode).SelectForBlock(n, txs)
+
+	return &message.BlockInfoMsg{
+		BlockBodyLength: n,
+		Epoch:           epoch,
+		SenderShardID:   0,
+		CommitTime:      time.Now(),
+		Relay1Txs:       txs,
+	}
+}
+
+// TestModeTimeline_DetectsTransition tests that a change of subsidy mode between blocks is captured
+func TestModeTimeline_DetectsTransition(t *testing.T) {
+	tm := NewTestModule_ModeTimeline()
+
+	tm.UpdateMeasureRecord(scoredCTXBlock(justitia.SubsidyDestAvg, 0, 5))
+	tm.UpdateMeasureRecord(scoredCTXBlock(justitia.SubsidyDestAvg, 0, 5))
+	tm.UpdateMeasureRecord(&message.BlockInfoMsg{BlockBodyLength: 3, SenderShardID: 0}) // ITX only
+	tm.UpdateMeasureRecord(scoredCTXBlock(justitia.SubsidySumAvg, 1, 5))
+	tm.UpdateMeasureRecord(scoredCTXBlock(justitia.SubsidySumAvg, 1, 5))
+
+	transitions := tm.Transitions()
+	if len(transitions) != 1 {
+		t.Fatalf("Expected 1 transition, got %d: %+v", len(transitions), transitions)
+	}
+	tr := transitions[0]
+	if tr.BlockSeq != 3 || tr.Epoch != 1 || tr.ShardID != 0 {
+		t.Errorf("Transition at block %d epoch %d shard %d, want block 3 epoch 1 shard 0", tr.BlockSeq, tr.Epoch, tr.ShardID)
+	}
+	if tr.FromMode != int(justitia.SubsidyDestAvg) || tr.ToMode != int(justitia.SubsidySumAvg) {
+		t.Errorf("Transition %d->%d, want %d->%d", tr.FromMode, tr.ToMode, justitia.SubsidyDestAvg, justitia.SubsidySumAvg)
+	}
+
+	want := []int{int(justitia.SubsidyDestAvg), int(justitia.SubsidyDestAvg), -1, int(justitia.SubsidySumAvg), int(justitia.SubsidySumAvg)}
+	for i, mode := range want {
+		if tm.dominantModes[i] != mode {
+			t.Errorf("Block %d dominant mode = %d, want %d", i, tm.dominantModes[i], mode)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package measure
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/message"
+	"blockEmulator/utils"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+// TestModule_SubsidyFairness measures how evenly subsidies are spread over shard pairs.
+// Per epoch it accumulates the SubsidyR of settled CTX per (FromShard, ToShard) pair and computes
+// the Gini coefficient of the per-pair totals (0 = perfectly even, towards 1 = one hot pair)
+// A CTX is counted once, in the destination block that settles it (relay2 / broker2 legs)
+type TestModule_SubsidyFairness struct {
+	epochID   int
+	pairTotal []map[[2]int]*big.Int // per epoch: subsidy per (FromShard, ToShard)
+}
+
+func NewTestModule_SubsidyFairness() *TestModule_SubsidyFairness {
+	return &TestModule_SubsidyFairness{
+		epochID:   -1,
+		pairTotal: make([]map[[2]int]*big.Int, 0),
+	}
+}
+
+func (tmsf *TestModule_SubsidyFairness) OutputMetricName() string {
+	return "Subsidy_Fairness"
+}
+
+func (tmsf *TestModule_SubsidyFairness) UpdateMeasureRecord(b *message.BlockInfoMsg) {
+	if b.BlockBodyLength == 0 { // empty block
+		return
+	}
+
+	epochid := b.Epoch
+	for tmsf.epochID < epochid {
+		tmsf.pairTotal = append(tmsf.pairTotal, make(map[[2]int]*big.Int))
+		tmsf.epochID++
+	}
+
+	for _, txs := range [][]*core.Transaction{b.Relay2Txs, b.Broker2Txs} {
+		for _, tx := range txs {
+			if tx.SubsidyR == nil || tx.SubsidyR.Sign() <= 0 {
+				continue
+			}
+			pair := [2]int{tx.FromShard, tx.ToShard}
+			if tx.OriginalSender != "" && tx.FinalRecipient != "" {
+				// A broker leg keeps its own shards; its subsidy belongs to the original CTX's pair
+				pair = [2]int{utils.Addr2Shard(tx.OriginalSender), utils.Addr2Shard(tx.FinalRecipient)}
+			}
+			if tmsf.pairTotal[epochid][pair] == nil {
+				tmsf.pairTotal[epochid][pair] = new(big.Int)
+			}
+			tmsf.pairTotal[epochid][pair].Add(tmsf.pairTotal[epochid][pair], tx.SubsidyR)
+		}
+	}
+}
+
+func (tmsf *TestModule_SubsidyFairness) HandleExtraMessage([]byte) {}
+
+// OutputRecord returns the Gini coefficient of each epoch and their average over epochs with subsidies
+func (tmsf *TestModule_SubsidyFairness) OutputRecord() (perEpochGini []float64, avgGini float64) {
+	tmsf.writeToCSV()
+
+	perEpochGini = make([]float64, 0, len(tmsf.pairTotal))
+	sum, active := 0.0, 0
+	for eid := range tmsf.pairTotal {
+		g := tmsf.epochGini(eid)
+		perEpochGini = append(perEpochGini, g)
+		if len(tmsf.pairTotal[eid]) > 0 {
+			sum += g
+			active++
+		}
+	}
+	if active > 0 {
+		avgGini = sum / float64(active)
+	}
+	return perEpochGini, avgGini
+}
+
+// epochGini returns the Gini coefficient of the per-pair subsidy totals of an epoch
+func (tmsf *TestModule_SubsidyFairness) epochGini(eid int) float64 {
+	values := make([]float64, 0, len(tmsf.pairTotal[eid]))
+	for _, total := range tmsf.pairTotal[eid] {
+		v, _ := new(big.Float).SetInt(total).Float64()
+		values = append(values, v)
+	}
+	return giniCoefficient(values)
+}
+
+// giniCoefficient computes G = 2*sum(i*x_i) / (n*sum(x)) - (n+1)/n over the values sorted
+// ascending (i starting at 1). Returns 0 for fewer than two values or a zero total
+func giniCoefficient(values []float64) float64 {
+	n := len(values)
+	if n < 2 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	total, weighted := 0.0, 0.0
+	for i, v := range sorted {
+		total += v
+		weighted += float64(i+1) * v
+	}
+	if total <= 0 {
+		return 0
+	}
+	return 2*weighted/(float64(n)*total) - float64(n+1)/float64(n)
+}
+
+func (tmsf *TestModule_SubsidyFairness) writeToCSV() {
+	fileName := tmsf.OutputMetricName()
+	measureName := []string{
+		"EpochID",
+		"Active Shard Pairs",
+		"Total Subsidy (wei)",
+		"Gini",
+	}
+
+	measureVals := make([][]string, 0, len(tmsf.pairTotal))
+	for eid, pairs := range tmsf.pairTotal {
+		total := new(big.Int)
+		for _, v := range pairs {
+			total.Add(total, v)
+		}
+		csvLine := []string{
+			strconv.Itoa(eid),
+			strconv.Itoa(len(pairs)),
+			total.String(),
+			strconv.FormatFloat(tmsf.epochGini(eid), 'f', 4, 64),
+		}
+		measureVals = append(measureVals, csvLine)
+	}
+
+	WriteMetricsToCSV(fileName, measureName, measureVals)
+}
@@ -0,0 +1,89 @@
+package measure
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/message"
+	"blockEmulator/params"
+	"blockEmulator/utils"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestGiniCoefficient tests the Gini computation on known distributions
+func TestGiniCoefficient(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{[]float64{5, 5, 5, 5}, 0},     // Perfectly even
+		{[]float64{0, 0, 0, 10}, 0.75}, // Everything on one of four pairs: (n-1)/n
+		{[]float64{4, 1, 3, 2}, 0.25},  // Order does not matter
+		{[]float64{7}, 0},              // A single pair
+		{[]float64{0, 0}, 0},           // No subsidy
+	}
+	for _, tt := range tests {
+		if got := giniCoefficient(tt.values); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("giniCoefficient(%v) = %.4f, want %.4f", tt.values, got, tt.want)
+		}
+	}
+}
+
+// TestSubsidyFairness_PerPair tests that settled subsidies are accumulated per shard pair and epoch
+func TestSubsidyFairness_PerPair(t *testing.T) {
+	oldPath := params.DataWrite_path
+	params.DataWrite_path = t.TempDir() + "/"
+	defer func() { params.DataWrite_path = oldPath }()
+
+	relay2 := func(from, to int, r int64) *core.Transaction {
+		tx := core.NewTransaction("a", "b", big.NewInt(0), 0, time.Now())
+		tx.FromShard, tx.ToShard = from, to
+		tx.SubsidyR = big.NewInt(r)
+		return tx
+	}
+	tmsf := NewTestModule_SubsidyFairness()
+	tmsf.UpdateMeasureRecord(&message.BlockInfoMsg{
+		BlockBodyLength: 4,
+		Epoch:           0,
+		Relay1Txs:       []*core.Transaction{relay2(0, 1, 1000)}, // Not settled yet
+		Relay2Txs:       []*core.Transaction{relay2(0, 1, 100), relay2(1, 0, 100), relay2(0, 1, 0)},
+	})
+	tmsf.UpdateMeasureRecord(&message.BlockInfoMsg{
+		BlockBodyLength: 2,
+		Epoch:           1,
+		Relay2Txs:       []*core.Transaction{relay2(0, 1, 300)},
+		Broker2Txs:      []*core.Transaction{relay2(2, 1, 100)},
+	})
+
+	perEpoch, avg := tmsf.OutputRecord()
+	if len(perEpoch) != 2 {
+		t.Fatalf("Expected 2 epochs, got %d", len(perEpoch))
+	}
+	if perEpoch[0] != 0 {
+		t.Errorf("Epoch 0 Gini = %.4f, want 0 for two equal pairs", perEpoch[0])
+	}
+	// Two pairs 100 and 300: 2*(100+600)/(2*400) - 3/2 = 0.25
+	if math.Abs(perEpoch[1]-0.25) > 1e-9 || math.Abs(avg-0.125) > 1e-9 {
+		t.Errorf("Epoch 1 Gini = %.4f, average = %.4f, want 0.25 and 0.125", perEpoch[1], avg)
+	}
+}
+
+// TestSubsidyFairness_BrokerPair tests that a broker2 leg's subsidy is keyed by the original CTX's shards
+func TestSubsidyFairness_BrokerPair(t *testing.T) {
+	origin := utils.Address("00000000000000000000000000000000000000") // shard 0
+	final := utils.Address("00000000000000000000000000000000000001")  // shard 1
+	broker2 := core.NewTransaction(utils.Address("0000000000000000000000000000000000ff00"), final, big.NewInt(0), 0, time.Now())
+	broker2.OriginalSender, broker2.FinalRecipient = origin, final
+	broker2.SubsidyR = big.NewInt(100)
+
+	tmsf := NewTestModule_SubsidyFairness()
+	tmsf.UpdateMeasureRecord(&message.BlockInfoMsg{
+		BlockBodyLength: 1,
+		Epoch:           0,
+		Broker2Txs:      []*core.Transaction{broker2},
+	})
+	if got := tmsf.pairTotal[0][[2]int{0, 1}]; got == nil || got.Int64() != 100 {
+		t.Errorf("Subsidy for pair 0->1 = %v, want 100 (totals %v)", got, tmsf.pairTotal[0])
+	}
+}
@@ -90,6 +90,12 @@ func (d *Supervisor) NewSupervisor(ip string, pcc *params.ChainConfig, committee
 			d.testMeasureMods = append(d.testMeasureMods, measure.NewTestModule_Justitia())
 		case "CTX_Fee_Latency":
 			d.testMeasureMods = append(d.testMeasureMods, measure.NewTestModule_CTX_FeeLatency())
+		case "Mode_Timeline":
+			d.testMeasureMods = append(d.testMeasureMods, measure.NewTestModule_ModeTimeline())
+		case "Budget_Utilization":
+			d.testMeasureMods = append(d.testMeasureMods, measure.NewTestModule_BudgetUtilization())
+		case "Subsidy_Fairness":
+			d.testMeasureMods = append(d.testMeasureMods, measure.NewTestModule_SubsidyFairness())
 		default:
 		}
 	}
@@ -0,0 +1,79 @@
+package scheduler
+
+import "blockEmulator/core"
+
+// blockFill tracks how much of a block has been used while selecting transactions.
+// In count mode every tx costs 1 against maxTxs; in byte mode (maxBytes > 0) every tx
+// costs len(tx.Encode()) against maxBytes.
+type blockFill struct {
+	maxTxs   int
+	maxBytes int
+	used     int
+	sizes    map[*core.Transaction]int // Encoded sizes, computed lazily (byte mode only)
+}
+
+// countFill returns a blockFill limited to capacity transactions
+func countFill(capacity int) *blockFill {
+	return &blockFill{maxTxs: capacity}
+}
+
+// byteFill returns a blockFill limited to maxBytes of encoded transactions
+func byteFill(maxBytes int) *blockFill {
+	return &blockFill{maxBytes: maxBytes, sizes: make(map[*core.Transaction]int)}
+}
+
+// limit returns the block capacity in the fill's unit (txs or bytes)
+func (b *blockFill) limit() int {
+	if b.maxBytes > 0 {
+		return b.maxBytes
+	}
+	return b.maxTxs
+}
+
+// quota returns a fill in the same unit limited to n and sharing the size cache
+func (b *blockFill) quota(n int) *blockFill {
+	if b.maxBytes > 0 {
+		return &blockFill{maxBytes: n, sizes: b.sizes}
+	}
+	return &blockFill{maxTxs: n}
+}
+
+// full reports whether no further tx can be added
+func (b *blockFill) full() bool {
+	return b.used >= b.limit()
+}
+
+// cost returns the space tx takes in the fill's unit
+func (b *blockFill) cost(tx *core.Transaction) int {
+	if b.maxBytes <= 0 {
+		return 1
+	}
+	size, ok := b.sizes[tx]
+	if !ok {
+		size = len(tx.Encode())
+		b.sizes[tx] = size
+	}
+	return size
+}
+
+// fits reports whether tx fits into the remaining space
+func (b *blockFill) fits(tx *core.Transaction) bool {
+	return b.used+b.cost(tx) <= b.limit()
+}
+
+// tryAdd accounts tx if it fits into the remaining space and reports whether it did
+func (b *blockFill) tryAdd(tx *core.Transaction) bool {
+	if !b.fits(tx) {
+		return false
+	}
+	b.used += b.cost(tx)
+	return true
+}
+
+// minInt returns the smaller of a and b
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
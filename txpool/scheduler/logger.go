@@ -0,0 +1,56 @@
+package scheduler
+
+import "fmt"
+
+// Logger receives the scheduler's output. Debugf gets the per-selection phase and case counts,
+// per-CTX scoring details, aged-CTX promotions, budget scaling, A/B comparisons and
+// Lagrangian epoch summaries; Warnf gets the one-time configuration warnings
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// nopLogger discards all output (the Scheduler default)
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+
+// StdoutLogger prints debug output and warnings to stdout. It replaces the removed
+// Scheduler.Verbose field: code that set Verbose = true now calls SetLogger(StdoutLogger{})
+type StdoutLogger struct{}
+
+func (StdoutLogger) Debugf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+func (StdoutLogger) Warnf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+// StdoutWarnLogger prints only warnings to stdout and discards debug output
+type StdoutWarnLogger struct{}
+
+func (StdoutWarnLogger) Debugf(string, ...interface{}) {}
+
+func (StdoutWarnLogger) Warnf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+// SetLogger sets the logger (nil discards all output)
+func (s *Scheduler) SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	s.logger = l
+}
+
+// debugEnabled reports whether debug output is consumed, so callers can skip work that only
+// feeds a Debugf call
+func (s *Scheduler) debugEnabled() bool {
+	switch s.logger.(type) {
+	case nopLogger, StdoutWarnLogger:
+		return false
+	}
+	return true
+}
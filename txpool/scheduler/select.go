@@ -3,12 +3,16 @@ package scheduler
 
 import (
 	"blockEmulator/core"
+	"blockEmulator/economics/subsidy_budget"
 	"blockEmulator/fees/expectation"
 	"blockEmulator/incentive/justitia"
 	"blockEmulator/params"
-	"fmt"
+	"blockEmulator/utils"
+	"math"
 	"math/big"
 	"sort"
+	"sync"
+	"time"
 )
 
 // TxWithScore wraps a transaction with its computed score for selection
@@ -18,6 +22,15 @@ type TxWithScore struct {
 	Case  justitia.Case // Only relevant for CTX
 }
 
+// Phase1Policy selects how Case1 CTX utility is compared with ITX fees in the phase-1 sort
+type Phase1Policy int
+
+const (
+	Phase1ByScore    Phase1Policy = iota // Raw score: CTX utility (subsidy included) vs ITX fee
+	Phase1ByUserFee                      // CTX utility minus its subsidy share R/2, i.e. the user-paid part
+	Phase1ByWeighted                     // CTX utility scaled by CTXUtilityWeight
+)
+
 // Scheduler handles transaction selection using Justitia incentive mechanism
 type Scheduler struct {
 	ShardID       int
@@ -25,32 +38,307 @@ type Scheduler struct {
 	FeeTracker    *expectation.Tracker
 	SubsidyMode   justitia.SubsidyMode
 	CustomSubsidy func(*big.Int, *big.Int) *big.Int
-	Mechanism     *justitia.Mechanism // For dynamic subsidy modes (PID, Lagrangian)
+	Mechanism     *justitia.Mechanism // For dynamic subsidy modes (PID, Lagrangian, RL, EWMADestAvg)
+
+	// LazyMechanism controls what happens when a dynamic mode has no Mechanism:
+	// if true, one is created from global params on first use; otherwise a one-time
+	// warning is logged and the stateless RAB fallback (DestAvg) is used
+	LazyMechanism   bool
+	mechanismWarned bool // Whether the missing-mechanism warning has been logged
+	mislabelWarned  bool // Whether the mislabeled-CTX warning has been logged
+
+	// QueueLenProvider returns the current tx queue length of a shard; it fills DynamicMetrics
+	// QueueLengthA (local shard) and QueueLengthB (tx.ToShard) for dynamic subsidy modes.
+	// A negative result means unknown. Without a provider QueueLengthB is assumed to be
+	// DefaultQueueLengthB and a one-time warning is logged
+	QueueLenProvider func(shardID int) int64
+	queueWarned      bool // Whether the missing-provider warning has been logged
+
+	// Broker-mode support: broker legs (OriginalSender/FinalRecipient set) are intra-shard
+	// transactions carrying a cross-shard payment, scored as CTX when ScoreBrokerTxs is true
+	ScoreBrokerTxs bool
+	ShardOf        func(utils.Address) int // Address -> shard mapping used for broker legs
+
+	BaseBlockReward *big.Int // Fixed per-block proposer reward (from Config.BaseBlockReward)
+
+	// Per-block subsidy budget (from Config.GammaMin/GammaMax); after selection the subsidies of the
+	// block's fresh CTX are scaled into [Bmin, Bmax] and their utilities recomputed (nil = no budget)
+	Budget       *subsidy_budget.Budget
+	budgetErr    error // Why the configured budget was ignored, warned about on the first selection
+	budgetWarned bool  // Whether the ignored-budget warning has been logged
+
+	// Receives the debug output and warnings (default: discarded, see SetLogger)
+	logger Logger
+
+	UseGasWeightedExpectation bool // Query gas-weighted E(f_s) (from Config.UseGasWeightedExpectation)
+	EqualFeesSkipCase2        bool // Classify EA == EB CTX below EA as Case3 (from Config.EqualFeesSkipCase2)
+
+	// Fee statistic used as EA/EB for the subsidy R (from Config.FeeReferenceMode); classification
+	// and the Shapley split keep the mean E(f_s)
+	FeeReferenceMode expectation.ReferenceMode
+
+	// Warm-standby A/B comparison: the secondary mechanism is scored alongside the primary
+	// (via PeekRABForPair, so its state is never advanced) and its outputs are logged, but only
+	// the primary drives selection until PromoteSecondary swaps them
+	SecondaryMechanism *justitia.Mechanism
+	secondaryRecords   []SecondaryRecord // Secondary outputs from the most recent SelectForBlock
+
+	// Starvation-free fairness layer: every CTX left out of a block accrues one credit
+	// (keyed by tx hash); once its credits reach FairnessThreshold it is force-included
+	// ahead of all phases. Forced txs may take at most MaxForcedFraction of the block
+	// (at least one slot if positive, none if 0), so the phase ordering still governs the rest of the block
+	FairnessCredits   map[string]int
+	creditPairs       map[string][2]int // (FromShard, ToShard) of each credited CTX, for ResetPair
+	FairnessThreshold int               // Credits needed for forced inclusion (0 = disabled)
+	MaxForcedFraction float64           // Cap on block space used by forced txs (0.0-1.0, 0 = no forced txs)
 
-	// Epoch tracking for Lagrangian
-	epochSubsidyTotal *big.Int // Total subsidy issued in current epoch
-	epochTxCount      int      // Transaction count in current epoch
+	// Deadline-aware selection for txs with a non-zero Deadline: within DeadlineHorizon of it a tx
+	// moves up one phase (Case2 -> Phase2, Phase2 -> Phase1); within DeadlineImminent it is
+	// force-included like a fairness-forced tx, earliest deadline first (0 disables either rule)
+	DeadlineHorizon  time.Duration
+	DeadlineImminent time.Duration
+
+	// Aging: a CTX whose ArrivalTime is more than maxDeferAge ago is promoted ahead of Phase1
+	// regardless of its case (oldest first), so Case2 CTX cannot starve in a full shard (0 = disabled)
+	maxDeferAge time.Duration
+
+	// CTX quota: at least minCTXFraction of the block is reserved for Phase1/Phase2 CTX (relay CTX
+	// and broker legs) before ITX are considered, when enough such CTX are pending (0 = disabled)
+	minCTXFraction float64
+
+	// Subsidy smoothing: the committed R for a (FromShard, ToShard) pair is
+	// prev + SubsidySmoothingAlpha*(raw - prev), where prev is the pair's committed R as of
+	// the previous block, so a jump in the raw subsidy is spread over several blocks
+	// (alpha <= 0 or >= 1 disables smoothing)
+	SubsidySmoothingAlpha float64
+	smoothedPrev          map[[2]int]*big.Int // Committed R per pair as of the previous block
+	smoothedCur           map[[2]int]*big.Int // Latest committed R per pair in the current block
+
+	// Phase-1 sort key for CTX; ITX always rank by fee (phase membership is unaffected)
+	Phase1Policy     Phase1Policy
+	CTXUtilityWeight float64 // Multiplier for Phase1ByWeighted (<= 0 treated as 1)
+
+	// Case2 CTX left out of the most recent block, keyed by tx hash
+	deferrals map[string]*DeferredTx
+
+	// mu serializes selections with each other and with epoch updates: a selection holds it
+	// throughout, since the pool packing path may select on several goroutines while
+	// UpdateEpoch/GetEpochStats run on another. It guards the selection state (deferrals,
+	// FairnessCredits/creditPairs, subsidy smoothing, secondary records), the Mechanism
+	// assignment and the epoch counters below, so the Mechanism's subsidy accounting is atomic
+	// with them
+	mu sync.Mutex
+
+	// Epoch tracking for Lagrangian and RL
+	epochTxCount   int    // Transaction count in current epoch
+	rlSelections   int     // Selections made in the current RL epoch (RL mode)
+	rlWaiting      int     // Scored CTX those selections left out, i.e. CTX-blocks of latency accrued
+	rlPrevWait     float64 // rlWaiting per selection in the previous RL epoch
+	rlHavePrev     bool    // Whether rlPrevWait is set (an RL epoch with selections has closed)
+	lastEpochBlock uint64  // Block number of the last epoch boundary
+
+	// Cumulative R assigned per (FromShard, ToShard) in every subsidy mode; cleared by UpdateEpoch
+	subsidyByPair map[[2]int]*big.Int
 }
 
 // NewScheduler creates a new Justitia-based transaction scheduler
 func NewScheduler(shardID, numShards int, feeTracker *expectation.Tracker, mode justitia.SubsidyMode) *Scheduler {
+	config := params.GetJustitiaConfig()
+
 	// Create Mechanism for dynamic subsidy modes
 	var mechanism *justitia.Mechanism
-	if mode == justitia.SubsidyPID || mode == justitia.SubsidyLagrangian {
-		config := params.GetJustitiaConfig()
+	if needsMechanism(mode) {
 		mechanism = justitia.NewMechanism(config)
-		fmt.Printf("[Scheduler] Shard %d: Created Justitia Mechanism (mode=%s)\n", shardID, mode.String())
 	}
+	budget, budgetErr := blockBudget(config)
 
-	return &Scheduler{
-		ShardID:           shardID,
-		NumShards:         numShards,
-		FeeTracker:        feeTracker,
-		SubsidyMode:       mode,
-		CustomSubsidy:     nil,
-		Mechanism:         mechanism,
-		epochSubsidyTotal: big.NewInt(0),
-		epochTxCount:      0,
+	s := &Scheduler{
+		ShardID:                   shardID,
+		NumShards:                 numShards,
+		FeeTracker:                feeTracker,
+		SubsidyMode:               mode,
+		CustomSubsidy:             nil,
+		Mechanism:                 mechanism,
+		LazyMechanism:             true,
+		ScoreBrokerTxs:            true,
+		logger:                    nopLogger{},
+		ShardOf:                   utils.Addr2Shard,
+		BaseBlockReward:           config.BaseBlockReward,
+		Budget:                    budget,
+		budgetErr:                 budgetErr,
+		UseGasWeightedExpectation: config.UseGasWeightedExpectation,
+		EqualFeesSkipCase2:        config.EqualFeesSkipCase2,
+		FeeReferenceMode:          expectation.ReferenceMode(config.FeeReferenceMode),
+		FairnessCredits:           make(map[string]int),
+		deferrals:                 make(map[string]*DeferredTx),
+		FairnessThreshold:         params.JustitiaFairnessThreshold,
+		MaxForcedFraction:         params.JustitiaFairnessMaxForced,
+		DeadlineHorizon:           time.Duration(params.JustitiaDeadlineHorizonMs) * time.Millisecond,
+		DeadlineImminent:          time.Duration(params.JustitiaDeadlineImminentMs) * time.Millisecond,
+		SubsidySmoothingAlpha:     params.JustitiaSubsidySmoothingAlpha,
+		Phase1Policy:              Phase1Policy(params.JustitiaPhase1Policy),
+		CTXUtilityWeight:          params.JustitiaCTXUtilityWeight,
+		smoothedPrev:              make(map[[2]int]*big.Int),
+		smoothedCur:               make(map[[2]int]*big.Int),
+		epochTxCount:              0,
+		subsidyByPair:             make(map[[2]int]*big.Int),
+	}
+	if mechanism != nil {
+		s.logger.Debugf("[Scheduler] Shard %d: Created Justitia Mechanism (mode=%s)\n", shardID, mode.String())
+	}
+	return s
+}
+
+// DeferredTx describes a Case2 CTX in the deferral backlog
+type DeferredTx struct {
+	TxHash        []byte
+	FromShard     int
+	ToShard       int
+	DeferralCount int       // Consecutive selections that left this CTX out as Case2
+	FirstDeferred time.Time // When it was first deferred
+}
+
+// GetDeferralBacklog returns the Case2 CTX deferred by the most recent selection, oldest first
+// (ties broken by higher deferral count, then tx hash)
+func (s *Scheduler) GetDeferralBacklog() []DeferredTx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backlog := make([]DeferredTx, 0, len(s.deferrals))
+	for _, d := range s.deferrals {
+		backlog = append(backlog, *d)
+	}
+	sort.Slice(backlog, func(i, j int) bool {
+		if !backlog[i].FirstDeferred.Equal(backlog[j].FirstDeferred) {
+			return backlog[i].FirstDeferred.Before(backlog[j].FirstDeferred)
+		}
+		if backlog[i].DeferralCount != backlog[j].DeferralCount {
+			return backlog[i].DeferralCount > backlog[j].DeferralCount
+		}
+		return string(backlog[i].TxHash) < string(backlog[j].TxHash)
+	})
+	return backlog
+}
+
+// recordDeferrals rebuilds the deferral backlog after a selection: Case2 CTX left out of the block
+// are added or have their count bumped, while selected or departed txs drop out
+func (s *Scheduler) recordDeferrals(scored []TxWithScore, selected []*core.Transaction) {
+	inBlock := make(map[string]bool, len(selected))
+	for _, tx := range selected {
+		inBlock[string(tx.TxHash)] = true
+	}
+
+	now := time.Now()
+	deferrals := make(map[string]*DeferredTx)
+	for _, st := range scored {
+		hash := string(st.Tx.TxHash)
+		if st.Case != justitia.Case2 || inBlock[hash] {
+			continue
+		}
+		d, ok := s.deferrals[hash]
+		if !ok {
+			from, to := s.shardPair(st.Tx)
+			d = &DeferredTx{TxHash: st.Tx.TxHash, FromShard: from, ToShard: to, FirstDeferred: now}
+		}
+		d.DeferralCount++
+		deferrals[hash] = d
+	}
+	s.deferrals = deferrals
+}
+
+// SecondaryRecord compares the primary and secondary mechanism outputs for one CTX
+type SecondaryRecord struct {
+	TxHash        []byte
+	PrimaryR      *big.Int
+	SecondaryR    *big.Int
+	PrimaryCase   justitia.Case
+	SecondaryCase justitia.Case
+}
+
+// SetSecondaryMechanism installs a warm-standby mechanism for A/B comparison (nil removes it)
+func (s *Scheduler) SetSecondaryMechanism(m *justitia.Mechanism) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.SecondaryMechanism = m
+	s.secondaryRecords = nil
+}
+
+// PromoteSecondary swaps the primary and secondary mechanisms and switches SubsidyMode to the
+// promoted mechanism's mode. A static primary without a Mechanism is demoted as a new Mechanism
+// in its mode, so it can be promoted back. Returns false if no secondary is installed.
+func (s *Scheduler) PromoteSecondary() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.SecondaryMechanism == nil {
+		return false
+	}
+
+	demoted := s.Mechanism
+	if demoted == nil {
+		config := params.GetJustitiaConfig()
+		config.Mode = s.SubsidyMode
+		config.CustomF = s.CustomSubsidy
+		demoted = justitia.NewMechanism(config)
+	}
+
+	s.Mechanism = s.SecondaryMechanism
+	s.SubsidyMode = s.Mechanism.GetConfig().Mode
+	s.SecondaryMechanism = demoted
+	s.secondaryRecords = nil
+
+	s.logger.Debugf("[Scheduler] Shard %d: Promoted secondary mechanism (mode=%s), demoted mode=%s\n",
+		s.ShardID, s.SubsidyMode.String(), demoted.GetConfig().Mode.String())
+	return true
+}
+
+// SecondaryRecords returns the secondary mechanism outputs logged during the most recent SelectForBlock
+func (s *Scheduler) SecondaryRecords() []SecondaryRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.secondaryRecords
+}
+
+// DefaultQueueLengthB is the destination queue length assumed when no QueueLenProvider is set
+// (moderately high congestion)
+const DefaultQueueLengthB int64 = 600
+
+// dynamicMetrics builds the metrics fed to dynamic subsidy modes for a CTX to shard toShard
+func (s *Scheduler) dynamicMetrics(toShard int) *justitia.DynamicMetrics {
+	if s.QueueLenProvider == nil {
+		if !s.queueWarned {
+			s.queueWarned = true
+			s.logger.Warnf("[Scheduler] Shard %d: WARNING: no QueueLenProvider set, assuming QueueLengthB=%d\n",
+				s.ShardID, DefaultQueueLengthB)
+		}
+		return &justitia.DynamicMetrics{QueueLengthB: DefaultQueueLengthB}
+	}
+
+	metrics := &justitia.DynamicMetrics{
+		QueueLengthA: s.QueueLenProvider(s.ShardID),
+		QueueLengthB: s.QueueLenProvider(toShard),
+	}
+	if metrics.QueueLengthA < 0 {
+		metrics.QueueLengthA = 0
+	}
+	if metrics.QueueLengthB < 0 {
+		metrics.QueueLengthB = DefaultQueueLengthB
+	}
+	return metrics
+}
+
+// TrackerQueueLenProvider builds a QueueLenProvider that reads the local shard's queue length from
+// local and every other shard's from the last fee sync report in tracker. Remote shards with no
+// report, or a stale one, yield -1 so dynamicMetrics falls back to DefaultQueueLengthB
+func TrackerQueueLenProvider(localShardID int, local func() int64, tracker *expectation.Tracker) func(shardID int) int64 {
+	return func(shardID int) int64 {
+		if shardID == localShardID {
+			return local()
+		}
+		if queueLen, ok := tracker.GetRemoteQueueLength(shardID); ok {
+			return queueLen
+		}
+		return -1
 	}
 }
 
@@ -64,22 +352,55 @@ func (s *Scheduler) SetCustomSubsidy(f func(*big.Int, *big.Int) *big.Int) {
 // txPool: available transactions (ITX and CTX)
 // Returns: selected transactions in priority order
 func (s *Scheduler) SelectForBlock(capacity int, txPool []*core.Transaction) []*core.Transaction {
+	return s.selectForBlock(capacity, txPool, nil)
+}
+
+// SelectForBlockBytes runs the same three-phase selection as SelectForBlock, but fills the
+// block by encoded size (len(tx.Encode())) up to maxBytes instead of by tx count.
+// A tx that does not fit into the remaining space is skipped and smaller txs of the same
+// phase are still tried.
+func (s *Scheduler) SelectForBlockBytes(maxBytes int, txPool []*core.Transaction) []*core.Transaction {
+	if maxBytes <= 0 || len(txPool) == 0 {
+		return nil
+	}
+	return s.selectWithFill(byteFill(maxBytes), txPool, nil)
+}
+
+// selectForBlock implements SelectForBlock, recording intermediate data into trace if non-nil
+func (s *Scheduler) selectForBlock(capacity int, txPool []*core.Transaction, trace *SelectionTrace) []*core.Transaction {
 	if capacity <= 0 || len(txPool) == 0 {
 		return nil
 	}
+	return s.selectWithFill(countFill(capacity), txPool, trace)
+}
+
+// selectWithFill runs the three-phase selection until fill reports the block full
+func (s *Scheduler) selectWithFill(fill *blockFill, txPool []*core.Transaction, trace *SelectionTrace) []*core.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Get current average ITX fee for this shard
-	EA := s.FeeTracker.GetAvgITXFee(s.ShardID)
+	EA := s.expectedFee(s.ShardID)
+	s.secondaryRecords = nil
+	s.advanceSubsidySmoothing()
+	if trace != nil {
+		trace.EA = EA.String()
+	}
+
+	if s.budgetErr != nil && !s.budgetWarned {
+		s.budgetWarned = true
+		s.logger.Warnf("[Scheduler] WARNING: Shard %d: ignoring subsidy budget: %v\n", s.ShardID, s.budgetErr)
+	}
 
 	// DEBUG: Log EA value at start of selection
-	fmt.Printf("[SELECT] Shard %d: Starting selection with EA=%s, txPool size=%d\n",
-		s.ShardID, EA.String(), len(txPool))
+	s.logger.Debugf("[SELECT] Shard %d: Starting selection with EA=%s, txPool size=%d\n",
+		s.ShardID, EA, len(txPool))
 
 	// Compute scores for all transactions
 	scored := make([]TxWithScore, 0, len(txPool))
 
 	for _, tx := range txPool {
-		if tx.IsCrossShard {
+		if isCrossShard(tx) {
 			// Cross-shard transaction (CTX)
 			score, txCase := s.scoreCTX(tx, EA)
 			scored = append(scored, TxWithScore{
@@ -87,6 +408,14 @@ func (s *Scheduler) SelectForBlock(capacity int, txPool []*core.Transaction) []*
 				Score: score,
 				Case:  txCase,
 			})
+		} else if s.isBrokerCTX(tx) {
+			// Broker leg of a cross-shard transaction
+			score, txCase := s.scoreBrokerCTX(tx, EA)
+			scored = append(scored, TxWithScore{
+				Tx:    tx,
+				Score: score,
+				Case:  txCase,
+			})
 		} else {
 			// Intra-shard transaction (ITX)
 			// Ensure FeeToProposer is not nil
@@ -111,8 +440,8 @@ func (s *Scheduler) SelectForBlock(capacity int, txPool []*core.Transaction) []*
 	phase3 := make([]TxWithScore, 0) // Case2 CTX - lowest priority but still considered
 
 	for _, scored := range scored {
-		if scored.Tx.IsCrossShard {
-			// CTX classification
+		if scored.Case != 0 {
+			// CTX classification (relay CTX and broker legs)
 			switch scored.Case {
 			case justitia.Case1:
 				phase1 = append(phase1, scored)
@@ -132,33 +461,45 @@ func (s *Scheduler) SelectForBlock(capacity int, txPool []*core.Transaction) []*
 		}
 	}
 
-	// DEBUG: Log phase distribution
-	fmt.Printf("[SELECT] Shard %d: Phase distribution - P1:%d P2:%d P3:%d\n",
-		s.ShardID, len(phase1), len(phase2), len(phase3))
+	// Promote txs whose deadline is approaching
+	phase1, phase2, phase3 = s.promoteNearDeadline(phase1, phase2, phase3, time.Now())
 
-	// Count CTX by case
-	case1Count, case2Count, case3Count := 0, 0, 0
-	for _, tx := range phase1 {
-		if tx.Tx.IsCrossShard {
-			case1Count++
-		}
-	}
-	for _, tx := range phase2 {
-		if tx.Tx.IsCrossShard {
-			case3Count++
-		}
-	}
-	for _, tx := range phase3 {
-		if tx.Tx.IsCrossShard {
-			case2Count++
+	// Promote CTX that have waited longer than maxDeferAge
+	var aged []TxWithScore
+	aged, phase1, phase2, phase3 = s.promoteAged(phase1, phase2, phase3, time.Now())
+
+	// DEBUG: Log phase distribution and CTX count by case
+	if s.debugEnabled() {
+		s.logger.Debugf("[SELECT] Shard %d: Phase distribution - P1:%d P2:%d P3:%d\n",
+			s.ShardID, len(phase1), len(phase2), len(phase3))
+
+		case1Count, case2Count, case3Count := 0, 0, 0
+		for _, tx := range scored {
+			switch tx.Case {
+			case justitia.Case1:
+				case1Count++
+			case justitia.Case2:
+				case2Count++
+			case justitia.Case3:
+				case3Count++
+			}
 		}
+		s.logger.Debugf("[SELECT] Shard %d: CTX distribution - Case1:%d Case2:%d Case3:%d\n",
+			s.ShardID, case1Count, case2Count, case3Count)
 	}
-	fmt.Printf("[SELECT] Shard %d: CTX distribution - Case1:%d Case2:%d Case3:%d\n",
-		s.ShardID, case1Count, case2Count, case3Count)
 
-	// Sort Phase1 by descending score (highest score first)
+	// Force-include txs at their deadline and CTX that have been deferred for too long
+	selected := make([]*core.Transaction, 0, minInt(fill.limit(), len(txPool)))
+	forcedTxs, taken := s.forcedInclusions(scored, fill, time.Now())
+	selected = append(selected, forcedTxs...)
+
+	// Sort Phase1 by descending score (highest score first), with CTX normalized per Phase1Policy
+	keys := make(map[*core.Transaction]*big.Int, len(phase1))
+	for _, st := range phase1 {
+		keys[st.Tx] = s.phase1Key(st)
+	}
 	sort.Slice(phase1, func(i, j int) bool {
-		cmp := phase1[i].Score.Cmp(phase1[j].Score)
+		cmp := keys[phase1[i].Tx].Cmp(keys[phase1[j].Tx])
 		if cmp != 0 {
 			return cmp > 0 // Descending order
 		}
@@ -166,17 +507,26 @@ func (s *Scheduler) SelectForBlock(capacity int, txPool []*core.Transaction) []*
 		return phase1[i].Tx.ArrivalTime.Before(phase1[j].Tx.ArrivalTime)
 	})
 
+	// Aged CTX go ahead of the score-ordered Phase1
+	if len(aged) > 0 {
+		phase1 = append(aged, phase1...)
+	}
+
+	// Reserve the CTX quota, best Phase1 CTX first, then Phase2 CTX
+	selected = append(selected, s.reserveCTX(scored, phase1, phase2, fill, taken)...)
+
 	// Fill block with Phase1 transactions
-	selected := make([]*core.Transaction, 0, capacity)
 	for _, scored := range phase1 {
-		if len(selected) >= capacity {
+		if fill.full() {
 			break
 		}
-		selected = append(selected, scored.Tx)
+		if !taken[string(scored.Tx.TxHash)] && fill.tryAdd(scored.Tx) {
+			selected = append(selected, scored.Tx)
+		}
 	}
 
 	// If block not full, fill with Phase2 transactions
-	if len(selected) < capacity {
+	if !fill.full() {
 		// Sort Phase2 by descending score
 		sort.Slice(phase2, func(i, j int) bool {
 			cmp := phase2[i].Score.Cmp(phase2[j].Score)
@@ -187,16 +537,18 @@ func (s *Scheduler) SelectForBlock(capacity int, txPool []*core.Transaction) []*
 		})
 
 		for _, scored := range phase2 {
-			if len(selected) >= capacity {
+			if fill.full() {
 				break
 			}
-			selected = append(selected, scored.Tx)
+			if !taken[string(scored.Tx.TxHash)] && fill.tryAdd(scored.Tx) {
+				selected = append(selected, scored.Tx)
+			}
 		}
 	}
 
 	// If block still not full, fill with Phase3 transactions (Case2 CTX)
 	// These have lowest priority but should not be permanently dropped
-	if len(selected) < capacity && len(phase3) > 0 {
+	if !fill.full() && len(phase3) > 0 {
 		// Sort Phase3 by descending score
 		sort.Slice(phase3, func(i, j int) bool {
 			cmp := phase3[i].Score.Cmp(phase3[j].Score)
@@ -207,67 +559,374 @@ func (s *Scheduler) SelectForBlock(capacity int, txPool []*core.Transaction) []*
 		})
 
 		for _, scored := range phase3 {
-			if len(selected) >= capacity {
+			if fill.full() {
 				break
 			}
-			selected = append(selected, scored.Tx)
+			if !taken[string(scored.Tx.TxHash)] && fill.tryAdd(scored.Tx) {
+				selected = append(selected, scored.Tx)
+			}
 		}
 	}
 
+	s.accrueFairnessCredits(scored, selected)
+	s.recordDeferrals(scored, selected)
+	s.applyBlockBudget(selected)
+	s.accountSelected(scored, selected)
+
 	// DEBUG: Log final selection stats
-	ctxSelected := 0
-	for _, tx := range selected {
-		if tx.IsCrossShard {
-			ctxSelected++
+	if s.debugEnabled() {
+		ctxSelected := 0
+		for _, tx := range selected {
+			if isCrossShard(tx) {
+				ctxSelected++
+			}
 		}
+		s.logger.Debugf("[SELECT] Shard %d: Selected %d txs, used %d/%d (CTX:%d, ITX:%d)\n",
+			s.ShardID, len(selected), fill.used, fill.limit(), ctxSelected, len(selected)-ctxSelected)
+	}
+
+	if trace != nil {
+		trace.recordPhase(1, phase1, s.shardPair)
+		trace.recordPhase(2, phase2, s.shardPair)
+		trace.recordPhase(3, phase3, s.shardPair)
+		trace.recordSelected(selected)
 	}
-	fmt.Printf("[SELECT] Shard %d: Selected %d/%d txs (CTX:%d, ITX:%d)\n",
-		s.ShardID, len(selected), capacity, ctxSelected, len(selected)-ctxSelected)
 
 	return selected
 }
 
+// forcedInclusions returns the txs to force into the block and the set of their tx hashes:
+// txs within DeadlineImminent of their deadline (earliest first), then CTX whose fairness
+// credits reached FairnessThreshold (longest-waiting first), limited to MaxForcedFraction of the block
+// (none if MaxForcedFraction is 0).
+// Forced txs are accounted against fill.
+func (s *Scheduler) forcedInclusions(scored []TxWithScore, fill *blockFill, now time.Time) ([]*core.Transaction, map[string]bool) {
+	forced := make(map[string]bool)
+	urgent := s.imminentDeadlines(scored, now)
+	fairness := s.fairnessCandidates(scored)
+	if len(urgent) == 0 && len(fairness) == 0 || s.MaxForcedFraction <= 0 {
+		return nil, forced
+	}
+
+	// A positive fraction forces at least one tx, even when it rounds down to zero slots
+	capacity := fill.limit()
+	limit := int(s.MaxForcedFraction * float64(capacity))
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > capacity {
+		limit = capacity
+	}
+
+	quota := fill.quota(limit)
+	candidates := make([]*core.Transaction, 0, minInt(limit, len(urgent)+len(fairness)))
+	for _, tx := range append(urgent, fairness...) {
+		if quota.full() {
+			break
+		}
+		if !forced[string(tx.TxHash)] && quota.fits(tx) && fill.tryAdd(tx) {
+			quota.tryAdd(tx)
+			forced[string(tx.TxHash)] = true
+			candidates = append(candidates, tx)
+		}
+	}
+	return candidates, forced
+}
+
+// fairnessCandidates returns the CTX whose fairness credits reached FairnessThreshold, longest-waiting first
+func (s *Scheduler) fairnessCandidates(scored []TxWithScore) []*core.Transaction {
+	if s.FairnessThreshold <= 0 || s.FairnessCredits == nil {
+		return nil
+	}
+
+	candidates := make([]*core.Transaction, 0)
+	for _, st := range scored {
+		if st.Case != 0 && s.FairnessCredits[string(st.Tx.TxHash)] >= s.FairnessThreshold {
+			candidates = append(candidates, st.Tx)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := s.FairnessCredits[string(candidates[i].TxHash)], s.FairnessCredits[string(candidates[j].TxHash)]
+		if ci != cj {
+			return ci > cj
+		}
+		return candidates[i].ArrivalTime.Before(candidates[j].ArrivalTime)
+	})
+	return candidates
+}
+
+// withinDeadline reports whether tx has a deadline no more than window away from now
+func withinDeadline(tx *core.Transaction, window time.Duration, now time.Time) bool {
+	return window > 0 && !tx.Deadline.IsZero() && tx.Deadline.Sub(now) <= window
+}
+
+// imminentDeadlines returns the txs within DeadlineImminent of their deadline, earliest deadline first
+func (s *Scheduler) imminentDeadlines(scored []TxWithScore, now time.Time) []*core.Transaction {
+	if s.DeadlineImminent <= 0 {
+		return nil
+	}
+
+	urgent := make([]*core.Transaction, 0)
+	for _, st := range scored {
+		if withinDeadline(st.Tx, s.DeadlineImminent, now) {
+			urgent = append(urgent, st.Tx)
+		}
+	}
+	sort.Slice(urgent, func(i, j int) bool {
+		if !urgent[i].Deadline.Equal(urgent[j].Deadline) {
+			return urgent[i].Deadline.Before(urgent[j].Deadline)
+		}
+		return urgent[i].ArrivalTime.Before(urgent[j].ArrivalTime)
+	})
+	return urgent
+}
+
+// phase1Key returns the phase-1 sort key of st: the score for ITX, or the CTX utility
+// normalized by Phase1Policy so it is comparable with an ITX fee
+func (s *Scheduler) phase1Key(st TxWithScore) *big.Int {
+	if st.Case == 0 {
+		return st.Score
+	}
+	switch s.Phase1Policy {
+	case Phase1ByUserFee:
+		// uA and uB each carry R/2 of the subsidy under the Shapley split
+		if st.Tx.SubsidyR == nil {
+			return st.Score
+		}
+		key := new(big.Int).Rsh(st.Tx.SubsidyR, 1)
+		return key.Sub(st.Score, key)
+	case Phase1ByWeighted:
+		if s.CTXUtilityWeight <= 0 || s.CTXUtilityWeight == 1 {
+			return st.Score
+		}
+		key, _ := new(big.Float).Mul(new(big.Float).SetInt(st.Score), big.NewFloat(s.CTXUtilityWeight)).Int(nil)
+		return key
+	default:
+		return st.Score
+	}
+}
+
+// promoteNearDeadline moves txs within DeadlineHorizon of their deadline up one phase
+func (s *Scheduler) promoteNearDeadline(phase1, phase2, phase3 []TxWithScore, now time.Time) ([]TxWithScore, []TxWithScore, []TxWithScore) {
+	if s.DeadlineHorizon <= 0 {
+		return phase1, phase2, phase3
+	}
+
+	keep2 := make([]TxWithScore, 0, len(phase2))
+	for _, st := range phase2 {
+		if withinDeadline(st.Tx, s.DeadlineHorizon, now) {
+			phase1 = append(phase1, st)
+		} else {
+			keep2 = append(keep2, st)
+		}
+	}
+	keep3 := make([]TxWithScore, 0, len(phase3))
+	for _, st := range phase3 {
+		if withinDeadline(st.Tx, s.DeadlineHorizon, now) {
+			keep2 = append(keep2, st)
+		} else {
+			keep3 = append(keep3, st)
+		}
+	}
+	return phase1, keep2, keep3
+}
+
+// SetMaxDeferAge sets the age (since ArrivalTime) after which a CTX is promoted ahead of Phase1
+// regardless of its case (0 disables aging)
+func (s *Scheduler) SetMaxDeferAge(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxDeferAge = d
+}
+
+// SetMinCTXFraction reserves fraction (clamped to [0, 1]) of every block for Phase1/Phase2 CTX
+// so a flood of high-fee ITX cannot crowd them out (0 disables the quota)
+func (s *Scheduler) SetMinCTXFraction(fraction float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minCTXFraction = math.Max(0, math.Min(1, fraction))
+}
+
+// reserveCTX fills the CTX quota from phase1 (already ordered) and then phase2 by descending score.
+// Forced CTX count towards the quota. Reserved txs are accounted against fill and marked in taken
+// so the phase loops skip them
+func (s *Scheduler) reserveCTX(scored, phase1, phase2 []TxWithScore, fill *blockFill, taken map[string]bool) []*core.Transaction {
+	reserve := int(s.minCTXFraction * float64(fill.limit()))
+	if reserve <= 0 {
+		return nil
+	}
+	quota := fill.quota(reserve)
+	for _, st := range scored {
+		if st.Case != 0 && taken[string(st.Tx.TxHash)] {
+			quota.tryAdd(st.Tx)
+		}
+	}
+
+	ctx2 := make([]TxWithScore, 0)
+	for _, st := range phase2 {
+		if st.Case != 0 {
+			ctx2 = append(ctx2, st)
+		}
+	}
+	sort.SliceStable(ctx2, func(i, j int) bool {
+		return ctx2[i].Score.Cmp(ctx2[j].Score) > 0
+	})
+
+	reserved := make([]*core.Transaction, 0)
+	for _, st := range append(append([]TxWithScore{}, phase1...), ctx2...) {
+		if quota.full() || fill.full() {
+			break
+		}
+		if st.Case == 0 || taken[string(st.Tx.TxHash)] || !quota.fits(st.Tx) {
+			continue
+		}
+		if fill.tryAdd(st.Tx) {
+			quota.tryAdd(st.Tx)
+			taken[string(st.Tx.TxHash)] = true
+			reserved = append(reserved, st.Tx)
+		}
+	}
+	return reserved
+}
+
+// promoteAged removes CTX older than maxDeferAge from all phases and returns them oldest first,
+// together with the remaining phases
+func (s *Scheduler) promoteAged(phase1, phase2, phase3 []TxWithScore, now time.Time) ([]TxWithScore, []TxWithScore, []TxWithScore, []TxWithScore) {
+	if s.maxDeferAge <= 0 {
+		return nil, phase1, phase2, phase3
+	}
+
+	var aged []TxWithScore
+	split := func(phase []TxWithScore) []TxWithScore {
+		keep := phase[:0]
+		for _, st := range phase {
+			if st.Case != 0 && !st.Tx.ArrivalTime.IsZero() && now.Sub(st.Tx.ArrivalTime) > s.maxDeferAge {
+				s.logger.Debugf("[SELECT] Shard %d: Promoting aged CTX %x (case=%d, age=%v)\n",
+					s.ShardID, st.Tx.TxHash, st.Case, now.Sub(st.Tx.ArrivalTime))
+				aged = append(aged, st)
+			} else {
+				keep = append(keep, st)
+			}
+		}
+		return keep
+	}
+	phase1, phase2, phase3 = split(phase1), split(phase2), split(phase3)
+
+	sort.SliceStable(aged, func(i, j int) bool {
+		return aged[i].Tx.ArrivalTime.Before(aged[j].Tx.ArrivalTime)
+	})
+	return aged, phase1, phase2, phase3
+}
+
+// accrueFairnessCredits adds one credit to every CTX left out of the block
+// Credits of selected or departed transactions are dropped
+func (s *Scheduler) accrueFairnessCredits(scored []TxWithScore, selected []*core.Transaction) {
+	if s.FairnessThreshold <= 0 {
+		return
+	}
+
+	inBlock := make(map[string]bool, len(selected))
+	for _, tx := range selected {
+		inBlock[string(tx.TxHash)] = true
+	}
+
+	credits := make(map[string]int)
+	pairs := make(map[string][2]int)
+	for _, st := range scored {
+		hash := string(st.Tx.TxHash)
+		if st.Case != 0 && !inBlock[hash] {
+			from, to := s.shardPair(st.Tx)
+			credits[hash] = s.FairnessCredits[hash] + 1
+			pairs[hash] = [2]int{from, to}
+		}
+	}
+	s.FairnessCredits = credits
+	s.creditPairs = pairs
+}
+
+// ResetPair clears the per-pair state accumulated for CTX from shard `from` to shard `to`
+// (smoothed subsidy, subsidy total, fairness credits, deferral backlog and the mechanisms'
+// smoothed EB), e.g. after one of the shards is split or merged. State for every other pair,
+// and the mechanisms' global state, is kept
+func (s *Scheduler) ResetPair(from, to int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair := [2]int{from, to}
+	delete(s.smoothedPrev, pair)
+	delete(s.smoothedCur, pair)
+	delete(s.subsidyByPair, pair)
+	for _, m := range []*justitia.Mechanism{s.Mechanism, s.SecondaryMechanism} {
+		if m != nil {
+			m.ResetPair(justitia.PairKey{From: from, To: to})
+		}
+	}
+
+	for hash, p := range s.creditPairs {
+		if p == pair {
+			delete(s.FairnessCredits, hash)
+			delete(s.creditPairs, hash)
+		}
+	}
+	for hash, d := range s.deferrals {
+		if d.FromShard == from && d.ToShard == to {
+			delete(s.deferrals, hash)
+		}
+	}
+}
+
 // scoreCTX computes the score and case classification for a cross-shard transaction
 // from the perspective of the current shard
 func (s *Scheduler) scoreCTX(tx *core.Transaction, EA *big.Int) (score *big.Int, txCase justitia.Case) {
+	// A CTX whose endpoints map to the same shard (e.g. after re-partitioning) is really an ITX,
+	// unless ForceCrossShard explicitly requests the CTX path
+	if tx.FromShard == tx.ToShard && tx.ForceCrossShard == nil {
+		return s.scoreMislabeledITX(tx), 0
+	}
+	return s.scorePair(tx, tx.FromShard, tx.ToShard, EA)
+}
+
+// scorePair scores tx as a CTX from shard `from` (A) to shard `to` (B). It sets the tx's subsidy,
+// utilities and case, but not its FromShard/ToShard
+func (s *Scheduler) scorePair(tx *core.Transaction, from, to int, EA *big.Int) (score *big.Int, txCase justitia.Case) {
 	// Determine if this shard is source (A) or destination (B)
-	isSourceShard := (tx.FromShard == s.ShardID)
+	isSourceShard := (from == s.ShardID)
 
 	// Get average fees for both shards
 	var EB *big.Int
 	if isSourceShard {
 		// This is shard A (source), get EB from destination shard
-		EB = s.FeeTracker.GetAvgITXFee(tx.ToShard)
+		EB = s.expectedFee(to)
 	} else {
 		// This is shard B (destination), get EA from source shard
-		EA = s.FeeTracker.GetAvgITXFee(tx.FromShard)
-		EB = s.FeeTracker.GetAvgITXFee(s.ShardID) // Local shard is B
+		EA = s.expectedFee(from)
+		EB = s.expectedFee(s.ShardID) // Local shard is B
 	}
 
-	// Compute subsidy R_AB (CRITICAL: This NEVER uses tx.FeeToProposer)
-	var R *big.Int
-	if s.Mechanism != nil {
-		// Create metrics for dynamic subsidy modes (PID, Lagrangian)
-		// For Lagrangian, we need QueueLengthB for congestion calculation
-		// Use moderately high congestion assumption
-		metrics := &justitia.DynamicMetrics{
-			QueueLengthB: 600, // Moderately high congestion
-			// Add other metrics if needed for PID mode
-		}
-		R = s.Mechanism.CalculateRAB(EA, EB, metrics)
-	} else {
-		// Use stateless RAB for static subsidy modes
-		R = justitia.RAB(s.SubsidyMode, EA, EB, nil, s.CustomSubsidy)
+	// Dynamic modes need a stateful mechanism (e.g. scheduler built before mode was set)
+	s.ensureMechanism()
+
+	// Create metrics for dynamic subsidy modes (PID, Lagrangian, RL)
+	metrics := s.dynamicMetrics(to)
+
+	// Compute subsidy R_AB (CRITICAL: the amount NEVER depends on tx.FeeToProposer; the fee
+	// only gates eligibility, so CTX below the floor get nothing and do not advance controller state)
+	refEA, refEB := s.subsidyReferences(from, to, EA, EB)
+	R := big.NewInt(0)
+	if s.shouldSubsidize(tx.FeeToProposer) {
+		if s.Mechanism != nil {
+			pair := justitia.PairKey{From: from, To: to}
+			R = s.Mechanism.CalculateRABForPair(pair, refEA, refEB, metrics)
+		} else {
+			// Use stateless RAB for static subsidy modes
+			R = justitia.RAB(s.SubsidyMode, refEA, refEB, nil, s.CustomSubsidy)
+		}
+		R = s.smoothSubsidy(from, to, R)
 	}
 
 	// Always update transaction with subsidy (scheduler is authoritative)
 	tx.SubsidyR = new(big.Int).Set(R)
-
-	// Accumulate subsidy for epoch tracking (Lagrangian)
-	if s.Mechanism != nil && s.SubsidyMode == justitia.SubsidyLagrangian {
-		s.epochSubsidyTotal.Add(s.epochSubsidyTotal, R)
-		s.epochTxCount++
-	}
+	tx.SubsidyMode = int(s.SubsidyMode)
 
 	// Ensure FeeToProposer is not nil
 	fee := tx.FeeToProposer
@@ -287,42 +946,244 @@ func (s *Scheduler) scoreCTX(tx *core.Transaction, EA *big.Int) (score *big.Int,
 	if isSourceShard {
 		utility = uA
 		// Classify from source shard perspective
-		txCase = justitia.Classify(uA, EA, EB)
+		txCase = s.classify(uA, EA, EB)
 		tx.JustitiaCase = int(txCase)
 
 		// DEBUG: Log CTX scoring details for source shard
-		fmt.Printf("[DEBUG] CTX Score (Source S%d->S%d): Fee=%s, EA=%s, EB=%s, R=%s, uA=%s, uB=%s, Case=%s\n",
-			tx.FromShard, tx.ToShard, fee.String(), EA.String(), EB.String(),
-			R.String(), uA.String(), uB.String(), txCase.String())
+		s.logger.Debugf("[DEBUG] CTX Score (Source S%d->S%d): Fee=%s, EA=%s, EB=%s, R=%s, uA=%s, uB=%s, Case=%s\n",
+			from, to, fee, EA, EB, R, uA, uB, txCase)
 	} else {
 		utility = uB
 		// Classify from destination shard perspective
 		// Use EB as the local expectation, EA as the remote expectation
-		txCase = justitia.Classify(uB, EB, EA)
+		txCase = s.classify(uB, EB, EA)
 		if tx.JustitiaCase == 0 {
 			tx.JustitiaCase = int(txCase)
 		}
 
 		// DEBUG: Log CTX scoring details for destination shard
-		fmt.Printf("[DEBUG] CTX Score (Dest S%d<-S%d): Fee=%s, EA=%s, EB=%s, R=%s, uA=%s, uB=%s, Case=%s\n",
-			s.ShardID, tx.FromShard, fee.String(), EA.String(), EB.String(),
-			R.String(), uA.String(), uB.String(), txCase.String())
+		s.logger.Debugf("[DEBUG] CTX Score (Dest S%d<-S%d): Fee=%s, EA=%s, EB=%s, R=%s, uA=%s, uB=%s, Case=%s\n",
+			s.ShardID, from, fee, EA, EB, R, uA, uB, txCase)
+	}
+
+	if s.SecondaryMechanism != nil {
+		s.scoreSecondary(tx, justitia.PairKey{From: from, To: to}, fee, EA, EB, refEA, refEB, R, txCase, isSourceShard, metrics)
 	}
 
 	return new(big.Int).Set(utility), txCase
 }
 
+// smoothSubsidy blends the raw subsidy with the pair's committed value from the previous block
+// and records the result as the pair's latest committed value
+func (s *Scheduler) smoothSubsidy(fromShard, toShard int, raw *big.Int) *big.Int {
+	if s.SubsidySmoothingAlpha <= 0 || s.SubsidySmoothingAlpha >= 1 {
+		return raw
+	}
+	if s.smoothedPrev == nil {
+		s.smoothedPrev = make(map[[2]int]*big.Int)
+		s.smoothedCur = make(map[[2]int]*big.Int)
+	}
+
+	pair := [2]int{fromShard, toShard}
+	committed := raw
+	if prev, ok := s.smoothedPrev[pair]; ok {
+		// committed = prev + alpha * (raw - prev)
+		delta := new(big.Float).SetInt(new(big.Int).Sub(raw, prev))
+		delta.Mul(delta, big.NewFloat(s.SubsidySmoothingAlpha))
+		step, _ := delta.Int(nil)
+		committed = step.Add(step, prev)
+	}
+	s.smoothedCur[pair] = new(big.Int).Set(committed)
+	return committed
+}
+
+// advanceSubsidySmoothing makes the values committed in the last block the baseline for this one
+func (s *Scheduler) advanceSubsidySmoothing() {
+	for pair, r := range s.smoothedCur {
+		s.smoothedPrev[pair] = r
+	}
+	s.smoothedCur = make(map[[2]int]*big.Int)
+}
+
+// shouldSubsidize reports whether a CTX paying fee clears Config.MinUserFeeForSubsidy, as read
+// from the Mechanism's config. Static modes without a Mechanism read the floor from the global config
+func (s *Scheduler) shouldSubsidize(fee *big.Int) bool {
+	if s.Mechanism != nil {
+		return s.Mechanism.ShouldSubsidize(fee)
+	}
+	return justitia.MeetsMinUserFee(fee, new(big.Int).SetUint64(params.JustitiaMinUserFeeForSubsidy))
+}
+
+// scoreSecondary scores a CTX with the secondary mechanism without advancing its state and logs
+// the result next to the primary's; the transaction itself is not modified
+// The secondary sees the same pair and reference fees as the primary and applies its own fee floor
+func (s *Scheduler) scoreSecondary(tx *core.Transaction, pair justitia.PairKey, fee, EA, EB, refEA, refEB, primaryR *big.Int,
+	primaryCase justitia.Case, isSourceShard bool, metrics *justitia.DynamicMetrics) {
+	R := big.NewInt(0)
+	if s.SecondaryMechanism.ShouldSubsidize(fee) {
+		R = s.SecondaryMechanism.PeekRABForPair(pair, refEA, refEB, metrics)
+	}
+	uA, uB := justitia.Split2(fee, R, EA, EB)
+
+	var txCase justitia.Case
+	if isSourceShard {
+		txCase = justitia.Classify(uA, EA, EB)
+	} else {
+		txCase = justitia.Classify(uB, EB, EA)
+	}
+
+	s.secondaryRecords = append(s.secondaryRecords, SecondaryRecord{
+		TxHash:        tx.TxHash,
+		PrimaryR:      new(big.Int).Set(primaryR),
+		SecondaryR:    R,
+		PrimaryCase:   primaryCase,
+		SecondaryCase: txCase,
+	})
+
+	s.logger.Debugf("[A/B] Shard %d: CTX S%d->S%d primary(%s) R=%s %s | secondary(%s) R=%s %s\n",
+		s.ShardID, pair.From, pair.To, s.SubsidyMode, primaryR, primaryCase,
+		s.SecondaryMechanism.GetConfig().Mode, R, txCase)
+}
+
+// Classification options passed to justitia.ClassifyWithConfig, shared by all classify calls
+var (
+	classifyConfig          = &justitia.Config{}
+	classifyConfigSkipCase2 = &justitia.Config{EqualFeesSkipCase2: true}
+)
+
+// classify applies justitia.ClassifyWithConfig with the scheduler's classification options
+func (s *Scheduler) classify(u, localE, remoteE *big.Int) justitia.Case {
+	if s.EqualFeesSkipCase2 {
+		return justitia.ClassifyWithConfig(u, localE, remoteE, classifyConfigSkipCase2)
+	}
+	return justitia.ClassifyWithConfig(u, localE, remoteE, classifyConfig)
+}
+
+// subsidyReferences returns the EA/EB the subsidy is computed from: the given expectations
+// under the mean reference, otherwise the FeeReferenceMode statistic of shards `from` and `to`
+func (s *Scheduler) subsidyReferences(from, to int, EA, EB *big.Int) (*big.Int, *big.Int) {
+	if s.FeeReferenceMode == expectation.ReferenceMean {
+		return EA, EB
+	}
+	return s.FeeTracker.GetFeeReference(from, s.FeeReferenceMode),
+		s.FeeTracker.GetFeeReference(to, s.FeeReferenceMode)
+}
+
+// expectedFee returns E(f_s) for a shard, gas-weighted if UseGasWeightedExpectation is set
+func (s *Scheduler) expectedFee(shardID int) *big.Int {
+	if s.UseGasWeightedExpectation {
+		return s.FeeTracker.GetGasWeightedAvgITXFee(shardID)
+	}
+	return s.FeeTracker.GetAvgITXFee(shardID)
+}
+
+// scoreMislabeledITX scores a transaction labeled cross-shard but with FromShard == ToShard
+// as an ITX: no subsidy, score = fee. A warning is logged the first time this happens
+func (s *Scheduler) scoreMislabeledITX(tx *core.Transaction) *big.Int {
+	if !s.mislabelWarned {
+		s.mislabelWarned = true
+		s.logger.Warnf("[Scheduler] WARNING: Shard %d: tx marked cross-shard but FromShard == ToShard == %d, scoring as ITX\n",
+			s.ShardID, tx.FromShard)
+	}
+
+	tx.SubsidyR = big.NewInt(0)
+	tx.UtilityA = nil
+	tx.UtilityB = nil
+	tx.JustitiaCase = 0
+
+	if tx.FeeToProposer == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(tx.FeeToProposer)
+}
+
+// isCrossShard reports whether the scheduler treats tx as a CTX: tx.ForceCrossShard if set,
+// otherwise tx.IsCrossShard
+func isCrossShard(tx *core.Transaction) bool {
+	if tx.ForceCrossShard != nil {
+		return *tx.ForceCrossShard
+	}
+	return tx.IsCrossShard
+}
+
+// isBrokerCTX reports whether tx is a broker leg whose original sender and final recipient
+// live in different shards
+func (s *Scheduler) isBrokerCTX(tx *core.Transaction) bool {
+	if !s.ScoreBrokerTxs || s.ShardOf == nil || isCrossShard(tx) {
+		return false
+	}
+	if tx.OriginalSender == "" || tx.FinalRecipient == "" {
+		return false
+	}
+	return s.ShardOf(tx.OriginalSender) != s.ShardOf(tx.FinalRecipient)
+}
+
+// scoreBrokerCTX scores a broker leg as a CTX from the original sender's shard (A)
+// to the final recipient's shard (B), so broker1 is scored by the source shard and
+// broker2 by the destination shard. The leg's own FromShard/ToShard are left unchanged
+func (s *Scheduler) scoreBrokerCTX(tx *core.Transaction, EA *big.Int) (score *big.Int, txCase justitia.Case) {
+	from, to := s.shardPair(tx)
+	return s.scorePair(tx, from, to, EA)
+}
+
+// shardPair returns the (A, B) shard pair tx is scored for: the shards of the original sender and
+// final recipient for a broker leg, otherwise its FromShard/ToShard
+func (s *Scheduler) shardPair(tx *core.Transaction) (from, to int) {
+	if s.isBrokerCTX(tx) {
+		return s.ShardOf(tx.OriginalSender), s.ShardOf(tx.FinalRecipient)
+	}
+	return tx.FromShard, tx.ToShard
+}
+
+// needsMechanism reports whether mode keeps state in a Mechanism (PID, Lagrangian, RL, EWMADestAvg)
+// or reads its Config (Cap, whose per-tx ceiling the stateless RAB cannot see)
+func needsMechanism(mode justitia.SubsidyMode) bool {
+	switch mode {
+	case justitia.SubsidyPID, justitia.SubsidyLagrangian, justitia.SubsidyRL, justitia.SubsidyEWMADestAvg, justitia.SubsidyCap:
+		return true
+	}
+	return false
+}
+
+// ensureMechanism handles a stateful subsidy mode (PID, Lagrangian, RL, EWMADestAvg) configured without a Mechanism
+// Depending on LazyMechanism, it either constructs the mechanism or warns once about the fallback
+// The caller must hold mu
+func (s *Scheduler) ensureMechanism() {
+	if s.Mechanism != nil {
+		return
+	}
+	if !needsMechanism(s.SubsidyMode) {
+		return
+	}
+
+	if s.LazyMechanism {
+		config := params.GetJustitiaConfig()
+		config.Mode = s.SubsidyMode
+		mechanism := justitia.NewMechanism(config)
+		s.Mechanism = mechanism
+		s.logger.Debugf("[Scheduler] Shard %d: Lazily created Justitia Mechanism (mode=%s)\n", s.ShardID, s.SubsidyMode.String())
+		return
+	}
+
+	if !s.mechanismWarned {
+		s.mechanismWarned = true
+		s.logger.Warnf("[Scheduler] WARNING: Shard %d: mode=%s has no Mechanism, falling back to stateless DestAvg subsidy\n",
+			s.ShardID, s.SubsidyMode.String())
+	}
+}
+
 // EstimateBlockReward estimates the total reward for proposing a block with given transactions
 func (s *Scheduler) EstimateBlockReward(txs []*core.Transaction) *big.Int {
 	totalReward := big.NewInt(0)
 
 	for _, tx := range txs {
-		if tx.FromShard == s.ShardID {
+		from, to := s.shardPair(tx)
+		if from == s.ShardID {
 			// Source shard: get uA
 			if tx.UtilityA != nil {
 				totalReward.Add(totalReward, tx.UtilityA)
 			}
-		} else if tx.ToShard == s.ShardID {
+		} else if to == s.ShardID {
 			// Destination shard: get uB
 			if tx.UtilityB != nil {
 				totalReward.Add(totalReward, tx.UtilityB)
@@ -333,34 +1194,284 @@ func (s *Scheduler) EstimateBlockReward(txs []*core.Transaction) *big.Int {
 	return totalReward
 }
 
-// UpdateEpoch should be called periodically (e.g., every N blocks) for Lagrangian mode
-// It updates the shadow price based on budget constraint and resets epoch counters
+// EstimateTotalProposerRevenue estimates a proposer's total revenue for a block:
+// the base block reward (added once per block) plus ITX fees and CTX utilities
+// isSourceShard selects uA (source shard proposer) or uB (destination shard proposer) for CTX
+func (s *Scheduler) EstimateTotalProposerRevenue(txs []*core.Transaction, isSourceShard bool) *big.Int {
+	total := big.NewInt(0)
+	if s.BaseBlockReward != nil {
+		total.Add(total, s.BaseBlockReward)
+	}
+
+	for _, tx := range txs {
+		// Scored broker legs are CTX too (JustitiaCase set)
+		if !isCrossShard(tx) && tx.JustitiaCase == 0 {
+			if tx.FeeToProposer != nil {
+				total.Add(total, tx.FeeToProposer)
+			}
+			continue
+		}
+		if isSourceShard {
+			if tx.UtilityA != nil {
+				total.Add(total, tx.UtilityA)
+			}
+		} else if tx.UtilityB != nil {
+			total.Add(total, tx.UtilityB)
+		}
+	}
+
+	return total
+}
+
+// blockBudget builds the per-block subsidy budget from cfg.GammaMin/GammaMax
+// Returns nil (no budget) if GammaMax is unset, and nil with the reason if the bounds are inconsistent
+func blockBudget(cfg *justitia.Config) (*subsidy_budget.Budget, error) {
+	if cfg == nil || cfg.GammaMax == nil || cfg.GammaMax.Sign() <= 0 {
+		return nil, nil
+	}
+	return subsidy_budget.NewBudget(clampUint64(cfg.GammaMin), clampUint64(cfg.GammaMax))
+}
+
+// clampUint64 converts a non-negative amount to uint64, saturating at math.MaxUint64 (nil = 0)
+func clampUint64(v *big.Int) uint64 {
+	if v == nil || v.Sign() <= 0 {
+		return 0
+	}
+	if !v.IsUint64() {
+		return math.MaxUint64
+	}
+	return v.Uint64()
+}
+
+// applyBlockBudget scales the SubsidyR of the fresh CTX in selected so the block's total stays
+// within Budget, then recomputes their Shapley utilities from the scaled R, so uA + uB = fee + R
+// still holds. Relay2/broker2 txs settle an already committed subsidy and are left alone
+func (s *Scheduler) applyBlockBudget(selected []*core.Transaction) {
+	if s.Budget == nil || s.Budget.Bmax == 0 {
+		return
+	}
+
+	ctxs := make([]*core.Transaction, 0)
+	subsidies := make([]uint64, 0)
+	for _, tx := range selected {
+		if s.isFreshCTX(tx) && tx.SubsidyR != nil {
+			ctxs = append(ctxs, tx)
+			subsidies = append(subsidies, clampUint64(tx.SubsidyR))
+		}
+	}
+	if len(ctxs) == 0 {
+		return
+	}
+
+	scaled, sf := subsidy_budget.ApplyBudgetToBlock(s.Budget, subsidies)
+	if !sf.IsScalingNeeded() {
+		return
+	}
+	for i, tx := range ctxs {
+		tx.SubsidyR = new(big.Int).SetUint64(scaled[i])
+		fee := tx.FeeToProposer
+		if fee == nil {
+			fee = big.NewInt(0)
+		}
+		from, to := s.shardPair(tx)
+		tx.UtilityA, tx.UtilityB = justitia.Split2(fee, tx.SubsidyR, s.expectedFee(from), s.expectedFee(to))
+
+		// The next block smooths from what was actually committed, not the unscaled R
+		pair := [2]int{from, to}
+		if _, ok := s.smoothedCur[pair]; ok {
+			s.smoothedCur[pair] = new(big.Int).Set(tx.SubsidyR)
+		}
+	}
+	s.logger.Debugf("[SELECT] Shard %d: Subsidy budget scaled %d CTX by %s\n", s.ShardID, len(ctxs), sf)
+}
+
+// BlockSubsidyCommitment returns the total subsidy R a block commits to: the sum of SubsidyR over
+// CTX introduced by this block. Relay2 transactions (and broker2 legs) settle a subsidy already
+// committed by the source shard, so they are excluded
+func (s *Scheduler) BlockSubsidyCommitment(selected []*core.Transaction) *big.Int {
+	total := big.NewInt(0)
+	for _, tx := range selected {
+		if s.isFreshCTX(tx) && tx.SubsidyR != nil {
+			total.Add(total, tx.SubsidyR)
+		}
+	}
+	return total
+}
+
+// isFreshCTX reports whether tx is a CTX entering the system in this shard (relay1 or broker1)
+func (s *Scheduler) isFreshCTX(tx *core.Transaction) bool {
+	if tx.IsRelay2 || tx.Relayed || tx.SenderIsBroker {
+		return false
+	}
+	if isCrossShard(tx) {
+		return tx.FromShard == s.ShardID
+	}
+	// Scored broker1 leg
+	return tx.JustitiaCase != 0
+}
+
+// accountSelected records the final SubsidyR (after block budget scaling) of every selected CTX
+// scored in this selection. Unselected CTX are rescored next block, so they are not accounted
+// The caller must hold mu
+func (s *Scheduler) accountSelected(scored []TxWithScore, selected []*core.Transaction) {
+	inBlock := make(map[*core.Transaction]bool, len(selected))
+	for _, tx := range selected {
+		inBlock[tx] = true
+	}
+
+	rl := s.Mechanism != nil && s.SubsidyMode == justitia.SubsidyRL
+	if rl {
+		s.rlSelections++
+	}
+	for _, st := range scored {
+		if st.Case == 0 {
+			continue
+		}
+		if rl && !inBlock[st.Tx] {
+			s.rlWaiting++
+		}
+		if inBlock[st.Tx] && st.Tx.SubsidyR != nil {
+			from, to := s.shardPair(st.Tx)
+			s.accountEpochSubsidy(from, to, st.Tx.SubsidyR)
+		}
+	}
+}
+
+// accountEpochSubsidy records the subsidy R assigned to a CTX from shard `from` to `to`
+// in the per-pair totals and, in Lagrangian mode, in the epoch count and the Mechanism's total
+// The caller must hold mu
+func (s *Scheduler) accountEpochSubsidy(from, to int, R *big.Int) {
+	// Accumulate subsidy per shard pair
+	if R.Sign() > 0 {
+		pair := [2]int{from, to}
+		if s.subsidyByPair[pair] == nil {
+			s.subsidyByPair[pair] = new(big.Int)
+		}
+		s.subsidyByPair[pair].Add(s.subsidyByPair[pair], R)
+	}
+
+	// Accumulate subsidy for epoch tracking (Lagrangian)
+	if s.Mechanism != nil && s.SubsidyMode == justitia.SubsidyLagrangian {
+		s.epochTxCount++
+		s.Mechanism.AccountSubsidy(R)
+	}
+}
+
+// UpdateEpoch should be called periodically (e.g., every N blocks) for Lagrangian and RL modes
+// In Lagrangian mode it updates the shadow price based on budget constraint and resets epoch
+// counters; in RL mode it rewards the epoch's decisions with the realized CTX latency reduction
+// In every mode it clears the per-pair subsidy totals of GetSubsidyByPair
 func (s *Scheduler) UpdateEpoch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeEpoch()
+}
+
+// closeEpoch implements UpdateEpoch and returns the subsidy total and tx count of the closed
+// epoch (zero if the scheduler is not in Lagrangian mode). The caller must hold mu
+func (s *Scheduler) closeEpoch() (total *big.Int, txCount int) {
+	// Per-pair totals cover one epoch in every mode
+	s.subsidyByPair = make(map[[2]int]*big.Int)
+
+	if s.Mechanism != nil && s.SubsidyMode == justitia.SubsidyRL {
+		s.closeRLEpoch()
+		return big.NewInt(0), 0
+	}
 	if s.Mechanism == nil || s.SubsidyMode != justitia.SubsidyLagrangian {
-		return
+		return big.NewInt(0), 0
 	}
 
 	// Get inflation limit from config
 	inflationLimit := s.Mechanism.GetConfig().MaxInflation
 
-	// Update shadow price based on total subsidy issued
-	s.Mechanism.UpdateShadowPrice(s.epochSubsidyTotal, inflationLimit)
+	// Update shadow price based on the subsidy the mechanism accounted this epoch
+	total = s.Mechanism.GetAccumulatedSubsidy()
+	txCount = s.epochTxCount
+	s.Mechanism.UpdateShadowPriceFromAccumulated(inflationLimit)
 
 	// Log epoch summary
-	lambda := s.Mechanism.GetShadowPrice()
-	fmt.Printf("[Lagrangian] Shard %d Epoch Update: TotalSubsidy=%s, Limit=%s, Lambda=%.4f, TxCount=%d\n",
-		s.ShardID, s.epochSubsidyTotal.String(), inflationLimit.String(), lambda, s.epochTxCount)
+	s.logger.Debugf("[Lagrangian] Shard %d Epoch Update: TotalSubsidy=%s, Limit=%s, Lambda=%.4f, TxCount=%d\n",
+		s.ShardID, total, inflationLimit, s.Mechanism.GetShadowPrice(), txCount)
 
 	// Reset epoch counters
 	s.Mechanism.ResetEpoch()
-	s.epochSubsidyTotal = big.NewInt(0)
 	s.epochTxCount = 0
+	return total, txCount
+}
+
+// closeRLEpoch rewards the RL decisions of the closing epoch with the realized CTX latency
+// reduction and starts a new epoch. The caller must hold mu
+// Latency is measured as the CTX left waiting per selection (by Little's law proportional to
+// the mean CTX wait at a given arrival rate), and the benefit is its relative drop from the
+// previous epoch; UpdateReward nets out the subsidy spent via RLParams.CostWeight
+func (s *Scheduler) closeRLEpoch() {
+	if s.rlSelections == 0 {
+		// Nothing was scored under this epoch's decisions; they are rewarded with the next epoch
+		return
+	}
+	wait := float64(s.rlWaiting) / float64(s.rlSelections)
+	benefit := 0.0
+	if s.rlHavePrev {
+		benefit = latencyBenefit(s.rlPrevWait, wait)
+	}
+	rewarded := s.Mechanism.UpdateReward(benefit)
+	s.logger.Debugf("[RL] Shard %d Epoch Update: Waiting=%.4f (prev %.4f), Benefit=%.4f, Decisions=%d, Policy=%v\n",
+		s.ShardID, wait, s.rlPrevWait, benefit, rewarded, s.Mechanism.GetRLPolicy())
+	s.rlPrevWait, s.rlHavePrev = wait, true
+	s.rlSelections, s.rlWaiting = 0, 0
+}
+
+// latencyBenefit returns the relative drop from prev to cur CTX waiting, in [-1, 1]: 1 when the
+// backlog cleared, -1 when it appeared from nothing, 0 when it did not change
+func latencyBenefit(prev, cur float64) float64 {
+	scale := math.Max(prev, cur)
+	if scale <= 0 {
+		return 0
+	}
+	return (prev - cur) / scale
 }
 
-// GetEpochStats returns current epoch statistics
+// MaybeUpdateEpoch calls UpdateEpoch once EpochBlocks blocks have elapsed since the last epoch boundary
+// This should be called for every committed block; returns true if an epoch update was performed
+func (s *Scheduler) MaybeUpdateEpoch(currentBlock uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Mechanism == nil || (s.SubsidyMode != justitia.SubsidyLagrangian && s.SubsidyMode != justitia.SubsidyRL) {
+		return false
+	}
+
+	epochBlocks := s.Mechanism.GetConfig().EpochBlocks
+	if epochBlocks == 0 || currentBlock < s.lastEpochBlock+epochBlocks {
+		return false
+	}
+
+	s.closeEpoch()
+	s.lastEpochBlock = currentBlock
+	return true
+}
+
+// GetSubsidyByPair returns a deep copy of the cumulative subsidy R assigned per (FromShard, ToShard)
+// since the last epoch update, or since the scheduler was created if no epoch has closed yet
+func (s *Scheduler) GetSubsidyByPair() map[[2]int]*big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[[2]int]*big.Int, len(s.subsidyByPair))
+	for pair, total := range s.subsidyByPair {
+		out[pair] = new(big.Int).Set(total)
+	}
+	return out
+}
+
+// GetEpochStats returns current epoch statistics as one consistent snapshot: no CTX is
+// accounted and no epoch closes between reading the total, the count and lambda
 func (s *Scheduler) GetEpochStats() (totalSubsidy *big.Int, txCount int, lambda float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.Mechanism != nil && s.SubsidyMode == justitia.SubsidyLagrangian {
-		return new(big.Int).Set(s.epochSubsidyTotal), s.epochTxCount, s.Mechanism.GetShadowPrice()
+		return s.Mechanism.GetAccumulatedSubsidy(), s.epochTxCount, s.Mechanism.GetShadowPrice()
 	}
 	return big.NewInt(0), 0, 0.0
 }
@@ -0,0 +1,1719 @@
+package scheduler
+
+import (
+	"blockEmulator/core"
+	"blockEmulator/fees/expectation"
+	"blockEmulator/incentive/justitia"
+	"blockEmulator/params"
+	"blockEmulator/utils"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLagrangianScheduler creates a Lagrangian scheduler with the given mechanism config
+func newLagrangianScheduler(cfg *justitia.Config) *Scheduler {
+	s := NewScheduler(0, 2, expectation.NewTracker(16), justitia.SubsidyLagrangian)
+	s.Mechanism = justitia.NewMechanism(cfg)
+	return s
+}
+
+// TestScheduler_MaybeUpdateEpoch tests that the shadow price is updated at the configured cadence
+func TestScheduler_MaybeUpdateEpoch(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyLagrangian
+	cfg.EpochBlocks = 5
+	cfg.MaxInflation = big.NewInt(1000)
+	s := newLagrangianScheduler(cfg)
+
+	fired := make([]uint64, 0)
+	for block := uint64(1); block <= 20; block++ {
+		// Overshoot the inflation limit so every shadow price update raises lambda
+		s.Mechanism.AccountSubsidy(big.NewInt(2000))
+
+		lambdaBefore := s.Mechanism.GetShadowPrice()
+		if s.MaybeUpdateEpoch(block) {
+			fired = append(fired, block)
+			if s.Mechanism.GetShadowPrice() <= lambdaBefore {
+				t.Errorf("Block %d: expected lambda to increase, got %.4f (before %.4f)",
+					block, s.Mechanism.GetShadowPrice(), lambdaBefore)
+			}
+			if total, count, _ := s.GetEpochStats(); total.Sign() != 0 || count != 0 {
+				t.Errorf("Block %d: expected epoch counters reset, got total=%s count=%d", block, total, count)
+			}
+		} else if s.Mechanism.GetShadowPrice() != lambdaBefore {
+			t.Errorf("Block %d: lambda changed without an epoch update", block)
+		}
+	}
+
+	want := []uint64{5, 10, 15, 20}
+	if len(fired) != len(want) {
+		t.Fatalf("Epoch updates fired at %v, want %v", fired, want)
+	}
+	for i := range want {
+		if fired[i] != want[i] {
+			t.Errorf("Epoch update %d fired at block %d, want %d", i, fired[i], want[i])
+		}
+	}
+}
+
+// TestScheduler_ConcurrentEpochUpdate tests that epoch accounting stays consistent and conserved
+// while several goroutines run SelectForBlock and another runs UpdateEpoch, GetEpochStats and the
+// per-pair/deferral/fairness accessors (run with -race)
+func TestScheduler_ConcurrentEpochUpdate(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyLagrangian
+	cfg.LagrangianParams.Alpha = 0 // Constant lambda, so every CTX gets the same R
+	newScheduler := func() *Scheduler {
+		s := newLagrangianScheduler(cfg)
+		s.Budget = nil
+		s.FairnessThreshold = 3 // CTX left out of a block accrue credits
+		s.FeeTracker.UpdateRemoteShardFee(1, big.NewInt(400))
+		return s
+	}
+
+	probe := newCTX("probe", 0, 1, 100)
+	newScheduler().scoreCTX(probe, big.NewInt(0))
+	R := probe.SubsidyR
+	if R.Sign() <= 0 {
+		t.Fatal("Expected a positive per-CTX subsidy")
+	}
+
+	const selectors, rounds, poolSize, capacity = 4, 100, 8, 6
+	s := newScheduler()
+	epochs := &epochLogger{total: new(big.Int)}
+	s.SetLogger(epochs)
+
+	var wg sync.WaitGroup
+	var selected int64
+	for g := 0; g < selectors; g++ {
+		pool := make([]*core.Transaction, poolSize)
+		for i := range pool {
+			pool[i] = newCTX(fmt.Sprintf("g%dctx%d", g, i), 0, 1, int64(100+i))
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				atomic.AddInt64(&selected, int64(len(s.SelectForBlock(capacity, pool))))
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		total, count, _ := s.GetEpochStats()
+		if want := new(big.Int).Mul(R, big.NewInt(int64(count))); total.Cmp(want) != 0 {
+			t.Errorf("Inconsistent snapshot: total %s for %d CTX, want %s", total, count, want)
+		}
+		s.GetSubsidyByPair()
+		s.GetDeferralBacklog()
+		s.ResetPair(1, 0) // Unused pair: walks the fairness and deferral state without changing it
+		s.UpdateEpoch()
+	}
+
+	// Every selected CTX is counted exactly once, either in a closed epoch or in the open one
+	total, count, _ := s.GetEpochStats()
+	epochs.mu.Lock()
+	drained, drainedCount := new(big.Int).Add(epochs.total, total), epochs.count+count
+	epochs.mu.Unlock()
+	if want := int(atomic.LoadInt64(&selected)); drainedCount != want || want != selectors*rounds*capacity {
+		t.Errorf("Accounted %d CTX, selected %d, want %d", drainedCount, want, selectors*rounds*capacity)
+	}
+	if want := new(big.Int).Mul(R, big.NewInt(int64(drainedCount))); drained.Cmp(want) != 0 {
+		t.Errorf("Accounted subsidy %s, want %s", drained, want)
+	}
+}
+
+// epochLogger sums the subsidy total and tx count of every closed Lagrangian epoch
+type epochLogger struct {
+	mu    sync.Mutex
+	total *big.Int
+	count int
+}
+
+func (l *epochLogger) Debugf(format string, args ...interface{}) {
+	if !strings.HasPrefix(format, "[Lagrangian]") {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total.Add(l.total, args[1].(*big.Int))
+	l.count += args[4].(int)
+}
+
+func (l *epochLogger) Warnf(string, ...interface{}) {}
+
+// TestScheduler_MaybeUpdateEpoch_Disabled tests that no update fires when EpochBlocks is 0 or the mode has no epochs
+func TestScheduler_MaybeUpdateEpoch_Disabled(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyLagrangian
+	cfg.EpochBlocks = 0
+	s := newLagrangianScheduler(cfg)
+	for block := uint64(1); block <= 50; block++ {
+		if s.MaybeUpdateEpoch(block) {
+			t.Fatalf("Expected no epoch update with EpochBlocks=0, fired at block %d", block)
+		}
+	}
+
+	static := NewScheduler(0, 2, expectation.NewTracker(16), justitia.SubsidyDestAvg)
+	if static.MaybeUpdateEpoch(100) {
+		t.Error("Expected no epoch update for a mode without epochs")
+	}
+}
+
+// TestScheduler_RLEpochReward tests that closing an epoch rewards the RL policy, so it moves off
+// the untried zero multiplier instead of paying nothing forever
+func TestScheduler_RLEpochReward(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyRL
+	cfg.EpochBlocks = 2
+	cfg.RLParams.Epsilon = 0
+	s := NewScheduler(0, 2, expectation.NewTracker(16), justitia.SubsidyRL)
+	s.Mechanism = justitia.NewMechanism(cfg)
+	s.QueueLenProvider = func(int) int64 { return 500 }
+	s.FeeTracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	s.FeeTracker.UpdateRemoteShardFee(1, big.NewInt(400))
+
+	// Each epoch tries the next untried multiplier (0, 0.5, 1, 1.5, 2 of EB) for its bucket
+	block := uint64(0)
+	for epoch, want := range []int64{0, 200, 400, 600, 800} {
+		for i := 0; i < 2; i++ {
+			block++
+			ctx := newCTX(fmt.Sprintf("ctx-%d", block), 0, 1, 2000)
+			s.SelectForBlock(10, []*core.Transaction{ctx})
+			if ctx.SubsidyR.Int64() != want {
+				t.Errorf("epoch %d block %d: R = %v, want %d", epoch, block, ctx.SubsidyR, want)
+			}
+			if fired := s.MaybeUpdateEpoch(block); fired != (i == 1) {
+				t.Errorf("block %d: epoch update fired = %v, want %v", block, fired, i == 1)
+			}
+		}
+	}
+
+	// Every CTX was included, so the cost penalty makes the cheapest multiplier the greedy choice
+	if policy := s.Mechanism.GetRLPolicy(); policy[2] != 0 {
+		t.Errorf("learned multiplier for the bucket = %v, want 0", policy[2])
+	}
+}
+
+// TestScheduler_RLLatencyBenefit tests that an RL epoch is rewarded with the relative drop in CTX
+// left waiting per block since the previous epoch
+func TestScheduler_RLLatencyBenefit(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyRL
+	s := NewScheduler(0, 2, expectation.NewTracker(16), justitia.SubsidyRL)
+	s.Mechanism = justitia.NewMechanism(cfg)
+	s.FeeTracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	s.FeeTracker.UpdateRemoteShardFee(1, big.NewInt(400))
+	rl := &rlLogger{}
+	s.SetLogger(rl)
+
+	// One CTX fits per block, so a pool of n leaves n-1 waiting
+	for epoch, poolSize := range []int{3, 1, 2, 2} {
+		for block := 0; block < 2; block++ {
+			pool := make([]*core.Transaction, poolSize)
+			for i := range pool {
+				pool[i] = newCTX(fmt.Sprintf("e%db%dctx%d", epoch, block, i), 0, 1, 2000)
+			}
+			s.SelectForBlock(1, pool)
+		}
+		s.UpdateEpoch()
+	}
+	// An epoch without selections has nothing to reward
+	s.UpdateEpoch()
+
+	// First epoch: no baseline; then 2 -> 0 waiting, 0 -> 1, 1 -> 1
+	want := []float64{0, 1, -1, 0}
+	if fmt.Sprint(rl.benefits) != fmt.Sprint(want) {
+		t.Errorf("RL benefits = %v, want %v", rl.benefits, want)
+	}
+}
+
+// rlLogger records the benefit of every closed RL epoch
+type rlLogger struct {
+	benefits []float64
+}
+
+func (l *rlLogger) Debugf(format string, args ...interface{}) {
+	if strings.HasPrefix(format, "[RL]") {
+		l.benefits = append(l.benefits, args[3].(float64))
+	}
+}
+
+func (l *rlLogger) Warnf(string, ...interface{}) {}
+
+// TestScheduler_AccountSubsidy tests that the mechanism's epoch total matches a manual sum of scored subsidies
+func TestScheduler_AccountSubsidy(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyLagrangian
+	cfg.MaxInflation = big.NewInt(1000)
+	s := newLagrangianScheduler(cfg)
+	s.FeeTracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	s.FeeTracker.UpdateRemoteShardFee(1, big.NewInt(300))
+
+	pool := make([]*core.Transaction, 0, 4)
+	for i, fee := range []int64{100, 2500, 40, 900} {
+		pool = append(pool, newCTX(fmt.Sprintf("ctx%d", i), 0, 1, fee))
+	}
+	manual := big.NewInt(0)
+	for _, tx := range s.SelectForBlock(len(pool), pool) {
+		manual.Add(manual, tx.SubsidyR)
+	}
+	if manual.Sign() <= 0 {
+		t.Fatal("Expected scored CTXs to carry a subsidy")
+	}
+
+	total, count, _ := s.GetEpochStats()
+	if total.Cmp(manual) != 0 || count != 4 {
+		t.Errorf("Epoch stats = (%s, %d), want (%s, 4)", total, count, manual)
+	}
+
+	// The internal update moves lambda exactly like the deprecated external-total update
+	reference := justitia.NewMechanism(cfg)
+	reference.UpdateShadowPrice(manual, cfg.MaxInflation)
+	s.UpdateEpoch()
+	if got, want := s.Mechanism.GetShadowPrice(), reference.GetShadowPrice(); got != want {
+		t.Errorf("Lambda after UpdateEpoch = %.6f, want %.6f", got, want)
+	}
+	if total, _, _ := s.GetEpochStats(); total.Sign() != 0 {
+		t.Errorf("Epoch total after UpdateEpoch = %s, want 0", total)
+	}
+}
+
+// newCTX creates a cross-shard transaction from shard `from` to shard `to` with the given fee
+func newCTX(hash string, from, to int, fee int64) *core.Transaction {
+	tx := core.NewTransaction("sender", "recipient", big.NewInt(0), 0, time.Now())
+	tx.TxHash = []byte(hash)
+	tx.FromShard = from
+	tx.ToShard = to
+	tx.IsCrossShard = true
+	tx.FeeToProposer = big.NewInt(fee)
+	return tx
+}
+
+// TestScheduler_ScoreCTX_LazyMechanism tests that a PID scheduler without a mechanism builds one on first use
+func TestScheduler_ScoreCTX_LazyMechanism(t *testing.T) {
+	s := NewScheduler(0, 2, expectation.NewTracker(16), justitia.SubsidyDestAvg)
+	s.SubsidyMode = justitia.SubsidyPID // Mode set after construction, so no mechanism exists
+	if s.Mechanism != nil {
+		t.Fatal("Expected no mechanism before scoring")
+	}
+
+	s.scoreCTX(newCTX("ctx1", 0, 1, 100), big.NewInt(0))
+
+	if s.Mechanism == nil {
+		t.Fatal("Expected mechanism to be lazily constructed")
+	}
+	if got := s.Mechanism.GetConfig().Mode; got != justitia.SubsidyPID {
+		t.Errorf("Lazily constructed mechanism mode = %s, want %s", got, justitia.SubsidyPID)
+	}
+}
+
+// TestScheduler_ScoreCTX_MissingMechanismWarning tests the warn-once fallback when lazy construction is disabled
+func TestScheduler_ScoreCTX_MissingMechanismWarning(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(1, big.NewInt(500))
+
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.SubsidyMode = justitia.SubsidyPID
+	s.LazyMechanism = false
+
+	tx := newCTX("ctx1", 0, 1, 100)
+	s.scoreCTX(tx, big.NewInt(0))
+
+	if s.Mechanism != nil {
+		t.Error("Expected no mechanism when LazyMechanism is disabled")
+	}
+	if !s.mechanismWarned {
+		t.Error("Expected missing-mechanism warning to be recorded")
+	}
+	// Stateless fallback for PID is DestAvg: R = EB
+	if tx.SubsidyR.Cmp(big.NewInt(500)) != 0 {
+		t.Errorf("Fallback subsidy = %s, want 500", tx.SubsidyR)
+	}
+}
+
+// TestScheduler_MinUserFeeForSubsidy tests that CTX below the user fee floor get zero subsidy, with
+// the floor read from the Mechanism's config, or from the global config in static modes
+func TestScheduler_MinUserFeeForSubsidy(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(1, big.NewInt(500))
+
+	orig := params.JustitiaMinUserFeeForSubsidy
+	t.Cleanup(func() { params.JustitiaMinUserFeeForSubsidy = orig })
+
+	// Static mode: no Mechanism, so the global floor applies
+	static := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+
+	// Mechanism-backed mode: the Mechanism's config is the only source, the global floor is ignored
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyEWMADestAvg
+	cfg.EBSmoothingAlpha = 0 // Plain DestAvg, so R = EB
+	cfg.MinUserFeeForSubsidy = big.NewInt(100)
+	dynamic := NewScheduler(0, 2, tracker, justitia.SubsidyEWMADestAvg)
+	dynamic.Mechanism = justitia.NewMechanism(cfg)
+
+	for _, sc := range []struct {
+		name        string
+		s           *Scheduler
+		globalFloor uint64
+	}{
+		{"static", static, 100},
+		{"mechanism", dynamic, 0},
+	} {
+		params.JustitiaMinUserFeeForSubsidy = sc.globalFloor
+		for _, tc := range []struct {
+			fee  int64
+			want int64
+		}{
+			{0, 0},     // Zero-fee CTX
+			{99, 0},    // Below the floor
+			{100, 500}, // At the floor: R = EB
+			{101, 500},
+		} {
+			tx := newCTX("ctx", 0, 1, tc.fee)
+			sc.s.scoreCTX(tx, big.NewInt(0))
+			if tx.SubsidyR.Cmp(big.NewInt(tc.want)) != 0 {
+				t.Errorf("%s: fee %d: subsidy = %s, want %d", sc.name, tc.fee, tx.SubsidyR, tc.want)
+			}
+		}
+	}
+}
+
+// TestScheduler_BrokerCTX tests that broker legs receive a subsidy and a conserved utility split
+func TestScheduler_BrokerCTX(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(400))
+
+	origin := utils.Address("00000000000000000000000000000000000000")     // shard 0
+	final := utils.Address("00000000000000000000000000000000000001")      // shard 1
+	brokerAddr := utils.Address("0000000000000000000000000000000000ff00") // shard 0
+
+	// Broker1 leg: original sender -> broker, executed in the source shard
+	tx := core.NewTransaction(origin, brokerAddr, big.NewInt(0), 0, time.Now())
+	tx.OriginalSender = origin
+	tx.FinalRecipient = final
+	tx.FeeToProposer = big.NewInt(200)
+
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	selected := s.SelectForBlock(10, []*core.Transaction{tx})
+	if len(selected) != 1 {
+		t.Fatalf("Expected broker leg to be selected, got %d txs", len(selected))
+	}
+
+	// The pooled leg keeps its own shards; the subsidy is accounted to the original 0->1 pair
+	if tx.FromShard != 0 || tx.ToShard != 0 {
+		t.Errorf("Broker leg shards changed to %d->%d, want 0->0", tx.FromShard, tx.ToShard)
+	}
+	if r := s.GetSubsidyByPair()[[2]int{0, 1}]; r == nil || r.Cmp(big.NewInt(400)) != 0 {
+		t.Errorf("Subsidy accounted to 0->1 = %v, want 400", r)
+	}
+	// DestAvg: R = EB
+	if tx.SubsidyR.Cmp(big.NewInt(400)) != 0 {
+		t.Errorf("Broker leg subsidy = %s, want 400", tx.SubsidyR)
+	}
+	total := new(big.Int).Add(tx.FeeToProposer, tx.SubsidyR)
+	sum := new(big.Int).Add(tx.UtilityA, tx.UtilityB)
+	if sum.Cmp(total) != 0 {
+		t.Errorf("Utility split not conserved: uA+uB=%s, fAB+R=%s", sum, total)
+	}
+	if tx.JustitiaCase == 0 {
+		t.Error("Broker leg should be classified as a CTX")
+	}
+
+	// Disabling broker scoring treats the leg as a plain ITX
+	plain := core.NewTransaction(origin, brokerAddr, big.NewInt(0), 1, time.Now())
+	plain.OriginalSender = origin
+	plain.FinalRecipient = final
+	plain.FeeToProposer = big.NewInt(200)
+	s.ScoreBrokerTxs = false
+	s.SelectForBlock(10, []*core.Transaction{plain})
+	if plain.SubsidyR.Sign() != 0 || plain.JustitiaCase != 0 {
+		t.Errorf("Expected no subsidy with ScoreBrokerTxs disabled, got R=%s case=%d", plain.SubsidyR, plain.JustitiaCase)
+	}
+}
+
+// TestScheduler_EstimateTotalProposerRevenue tests that the base reward is added once per block
+func TestScheduler_EstimateTotalProposerRevenue(t *testing.T) {
+	s := NewScheduler(0, 2, expectation.NewTracker(16), justitia.SubsidyDestAvg)
+	s.BaseBlockReward = big.NewInt(1000)
+
+	if got := s.EstimateTotalProposerRevenue(nil, true); got.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Empty block revenue = %s, want 1000", got)
+	}
+
+	itx := core.NewTransaction("a", "b", big.NewInt(0), 0, time.Now())
+	itx.FeeToProposer = big.NewInt(50)
+	ctx := newCTX("ctx", 0, 1, 0)
+	ctx.UtilityA = big.NewInt(30)
+	ctx.UtilityB = big.NewInt(70)
+
+	// Base reward counted once regardless of tx count
+	txs := []*core.Transaction{itx, itx, itx, ctx}
+	if got := s.EstimateTotalProposerRevenue(txs, true); got.Cmp(big.NewInt(1000+150+30)) != 0 {
+		t.Errorf("Source revenue = %s, want %d", got, 1000+150+30)
+	}
+	if got := s.EstimateTotalProposerRevenue(txs, false); got.Cmp(big.NewInt(1000+150+70)) != 0 {
+		t.Errorf("Destination revenue = %s, want %d", got, 1000+150+70)
+	}
+
+	s.BaseBlockReward = nil
+	if got := s.EstimateTotalProposerRevenue(txs, true); got.Cmp(big.NewInt(180)) != 0 {
+		t.Errorf("Revenue without base reward = %s, want 180", got)
+	}
+}
+
+// traceTestPool creates a mixed pool of ITX and CTX with distinct fees
+func traceTestPool() []*core.Transaction {
+	pool := make([]*core.Transaction, 0)
+	for i, fee := range []int64{50, 5000, 900, 10} {
+		pool = append(pool, newCTX(fmt.Sprintf("ctx%d", i), 0, 1, fee))
+	}
+	for i, fee := range []int64{300, 1200} {
+		itx := core.NewTransaction("a", "b", big.NewInt(0), uint64(i), time.Now())
+		itx.TxHash = []byte(fmt.Sprintf("itx%d", i))
+		itx.FeeToProposer = big.NewInt(fee)
+		pool = append(pool, itx)
+	}
+	return pool
+}
+
+// TestScheduler_TraceSelection tests that the trace matches SelectForBlock and round-trips through JSON
+func TestScheduler_TraceSelection(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(300))
+
+	const capacity = 4
+	want := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg).SelectForBlock(capacity, traceTestPool())
+
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	selected, trace := s.TraceSelection(capacity, traceTestPool())
+
+	if len(selected) != len(want) || len(trace.Selected) != len(want) {
+		t.Fatalf("Selected %d txs (trace %d), SelectForBlock selected %d", len(selected), len(trace.Selected), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(selected[i].TxHash, want[i].TxHash) {
+			t.Errorf("Position %d: traced %s, SelectForBlock %s", i, selected[i].TxHash, want[i].TxHash)
+		}
+		if trace.Selected[i] != hex.EncodeToString(want[i].TxHash) {
+			t.Errorf("Position %d: trace.Selected %s does not match selected tx", i, trace.Selected[i])
+		}
+	}
+
+	if trace.PoolSize != 6 || len(trace.Entries) != 6 {
+		t.Errorf("Expected 6 pool entries, got PoolSize=%d entries=%d", trace.PoolSize, len(trace.Entries))
+	}
+	if trace.EA != "1000" {
+		t.Errorf("Trace EA = %s, want 1000", trace.EA)
+	}
+	selectedCount := 0
+	for _, entry := range trace.Entries {
+		if entry.Selected {
+			selectedCount++
+		}
+		if entry.IsCrossShard && (entry.Case == 0 || entry.SubsidyR != "300") {
+			t.Errorf("CTX %s: case=%d R=%s, want classified with R=300", entry.TxHash, entry.Case, entry.SubsidyR)
+		}
+	}
+	if selectedCount != len(want) {
+		t.Errorf("Entries marked selected = %d, want %d", selectedCount, len(want))
+	}
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded SelectionTrace
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	again, _ := json.Marshal(decoded)
+	if !bytes.Equal(data, again) {
+		t.Errorf("Trace did not round-trip through JSON:\n%s\n%s", data, again)
+	}
+}
+
+// TestScheduler_TraceSelection_Budget tests that the trace reports the scheduler's own budget bounds
+func TestScheduler_TraceSelection_Budget(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(300))
+
+	cfg := justitia.DefaultConfig()
+	cfg.GammaMin = big.NewInt(100)
+	cfg.GammaMax = big.NewInt(1500)
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.Budget, _ = blockBudget(cfg)
+
+	if _, trace := s.TraceSelection(4, traceTestPool()); trace.GammaMin != 100 || trace.GammaMax != 1500 {
+		t.Errorf("Trace budget = [%d, %d], want the scheduler's [100, 1500]", trace.GammaMin, trace.GammaMax)
+	}
+
+	s.Budget = nil
+	if _, trace := s.TraceSelection(4, traceTestPool()); trace.GammaMin != 0 || trace.GammaMax != 0 {
+		t.Errorf("Trace budget = [%d, %d], want [0, 0] without a budget", trace.GammaMin, trace.GammaMax)
+	}
+}
+
+// runSustainedLoad simulates blocks where high-fee ITX always fill the block and one Case2 CTX
+// arrives per block; returns the number of blocks each CTX waited before inclusion
+func runSustainedLoad(s *Scheduler, blocks, capacity int) (waits map[string]int, maxCTXPerBlock int) {
+	waits = make(map[string]int)
+	arrived := make(map[string]int)
+	pool := make([]*core.Transaction, 0)
+	for block := 0; block < blocks; block++ {
+		for i := 0; i < capacity+5; i++ {
+			itx := core.NewTransaction("a", "b", big.NewInt(0), uint64(i), time.Now())
+			itx.TxHash = []byte(fmt.Sprintf("itx-%d-%d", block, i))
+			itx.FeeToProposer = big.NewInt(5000)
+			pool = append(pool, itx)
+		}
+		hash := fmt.Sprintf("ctx-%d", block)
+		pool = append(pool, newCTX(hash, 0, 1, 10))
+		arrived[hash] = block
+
+		selected := s.SelectForBlock(capacity, pool)
+		inBlock := make(map[string]bool)
+		ctxInBlock := 0
+		for _, tx := range selected {
+			inBlock[string(tx.TxHash)] = true
+			if tx.IsCrossShard {
+				ctxInBlock++
+				waits[string(tx.TxHash)] = block - arrived[string(tx.TxHash)]
+			}
+		}
+		if ctxInBlock > maxCTXPerBlock {
+			maxCTXPerBlock = ctxInBlock
+		}
+		remaining := make([]*core.Transaction, 0, len(pool))
+		for _, tx := range pool {
+			if !inBlock[string(tx.TxHash)] {
+				remaining = append(remaining, tx)
+			}
+		}
+		pool = remaining
+	}
+	return waits, maxCTXPerBlock
+}
+
+// TestScheduler_FairnessCredits tests that every CTX is included within a bounded number of blocks under sustained load
+func TestScheduler_FairnessCredits(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(200))
+
+	const blocks, capacity = 40, 10
+
+	// Without the fairness layer, Case2 CTX starve behind high-fee ITX
+	starving := NewScheduler(0, 2, tracker, justitia.SubsidyNone)
+	starving.FairnessThreshold = 0
+	if waits, _ := runSustainedLoad(starving, blocks, capacity); len(waits) != 0 {
+		t.Fatalf("Expected starvation without fairness credits, %d CTX included", len(waits))
+	}
+
+	// MaxForcedFraction 0 disables forced inclusion even with credits accruing
+	noForced := NewScheduler(0, 2, tracker, justitia.SubsidyNone)
+	noForced.FairnessThreshold = 3
+	noForced.MaxForcedFraction = 0
+	if waits, _ := runSustainedLoad(noForced, blocks, capacity); len(waits) != 0 {
+		t.Errorf("Expected no forced CTX with MaxForcedFraction 0, %d CTX included", len(waits))
+	}
+
+	// A positive fraction below one slot still forces one CTX per block
+	tiny := NewScheduler(0, 2, tracker, justitia.SubsidyNone)
+	tiny.FairnessThreshold = 3
+	tiny.MaxForcedFraction = 0.01
+	if _, maxCTX := runSustainedLoad(tiny, blocks, capacity); maxCTX != 1 {
+		t.Errorf("Forced CTX per block = %d with a tiny positive fraction, want 1", maxCTX)
+	}
+
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyNone)
+	s.FairnessThreshold = 3
+	s.MaxForcedFraction = 0.2
+	waits, maxCTXPerBlock := runSustainedLoad(s, blocks, capacity)
+
+	// Every CTX that arrived early enough to reach the threshold must be included
+	for block := 0; block < blocks-s.FairnessThreshold; block++ {
+		hash := fmt.Sprintf("ctx-%d", block)
+		wait, ok := waits[hash]
+		if !ok {
+			t.Errorf("%s was never included", hash)
+			continue
+		}
+		if wait > s.FairnessThreshold+1 {
+			t.Errorf("%s waited %d blocks, want at most %d", hash, wait, s.FairnessThreshold+1)
+		}
+	}
+	// Forced inclusions never exceed the block-space cap
+	if maxCTXPerBlock > 2 {
+		t.Errorf("Forced CTX per block = %d, want at most 2 (20%% of %d)", maxCTXPerBlock, capacity)
+	}
+	// Credits are only kept for CTX still waiting
+	if len(s.FairnessCredits) > s.FairnessThreshold {
+		t.Errorf("FairnessCredits holds %d entries, expected only waiting CTX", len(s.FairnessCredits))
+	}
+}
+
+// TestScheduler_SecondaryMechanism tests that selection uses the primary, the secondary is logged, and promotion swaps them
+func TestScheduler_SecondaryMechanism(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(300))
+
+	newPool := func() []*core.Transaction {
+		itx := core.NewTransaction("a", "b", big.NewInt(0), 0, time.Now())
+		itx.TxHash = []byte("itx")
+		itx.FeeToProposer = big.NewInt(900) // Below EA: phase 2
+		return []*core.Transaction{itx, newCTX("ctx", 0, 1, 100)}
+	}
+
+	// Primary DestAvg: R=300, uA=550 <= EA-EB=700 -> Case2 (phase 3)
+	// Secondary SumAvg: R=1300, uA=1050 >= EA -> Case1 (phase 1)
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	secondaryCfg := justitia.DefaultConfig()
+	secondaryCfg.Mode = justitia.SubsidySumAvg
+	s.SetSecondaryMechanism(justitia.NewMechanism(secondaryCfg))
+
+	selected := s.SelectForBlock(1, newPool())
+	if len(selected) != 1 || string(selected[0].TxHash) != "itx" {
+		t.Fatalf("Expected primary (DestAvg) selection to pick the ITX, got %s", selected[0].TxHash)
+	}
+	if selected := s.SelectForBlock(2, newPool()); selected[1].SubsidyR.Cmp(big.NewInt(300)) != 0 {
+		t.Errorf("CTX subsidy = %s, want primary R = 300", selected[1].SubsidyR)
+	}
+
+	records := s.SecondaryRecords()
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 secondary record, got %d", len(records))
+	}
+	rec := records[0]
+	if rec.PrimaryR.Cmp(big.NewInt(300)) != 0 || rec.PrimaryCase != justitia.Case2 {
+		t.Errorf("Primary record R=%s case=%s, want 300/Case2", rec.PrimaryR, rec.PrimaryCase)
+	}
+	if rec.SecondaryR.Cmp(big.NewInt(1300)) != 0 || rec.SecondaryCase != justitia.Case1 {
+		t.Errorf("Secondary record R=%s case=%s, want 1300/Case1", rec.SecondaryR, rec.SecondaryCase)
+	}
+
+	if !s.PromoteSecondary() {
+		t.Fatal("PromoteSecondary returned false")
+	}
+	if s.SubsidyMode != justitia.SubsidySumAvg || s.SecondaryMechanism.GetConfig().Mode != justitia.SubsidyDestAvg {
+		t.Errorf("After promotion primary=%s secondary=%s, want SumAvg/DestAvg",
+			s.SubsidyMode, s.SecondaryMechanism.GetConfig().Mode)
+	}
+	selected = s.SelectForBlock(1, newPool())
+	if len(selected) != 1 || string(selected[0].TxHash) != "ctx" {
+		t.Errorf("Expected promoted (SumAvg) selection to pick the CTX, got %s", selected[0].TxHash)
+	}
+	if rec := s.SecondaryRecords(); len(rec) != 1 || rec[0].SecondaryR.Cmp(big.NewInt(300)) != 0 {
+		t.Errorf("Expected demoted DestAvg to be logged as secondary, got %+v", rec)
+	}
+
+	s.SetSecondaryMechanism(nil)
+	if s.PromoteSecondary() {
+		t.Error("PromoteSecondary should fail without a secondary")
+	}
+}
+
+// TestScheduler_SecondaryMechanism_SameInputs tests that the secondary is scored for the CTX's pair,
+// from the same reference fees as the primary, and behind its own user fee floor
+func TestScheduler_SecondaryMechanism_SameInputs(t *testing.T) {
+	tracker := expectation.NewTracker(10)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	for _, fee := range []int64{100, 100, 100, 100, 100, 100, 200, 300, 1000, 5000} {
+		tracker.OnBlockFinalized(1, []*big.Int{big.NewInt(fee)})
+	}
+
+	// Primary DestAvg on the median reference: R = 100
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.FeeReferenceMode = expectation.ReferenceMedian
+
+	// Secondary EWMA DestAvg with pair 0->1 smoothed at 1000: peeking the median 100 gives 550
+	secondaryCfg := justitia.DefaultConfig()
+	secondaryCfg.Mode = justitia.SubsidyEWMADestAvg
+	secondaryCfg.EBSmoothingAlpha = 0.5
+	secondaryCfg.MinUserFeeForSubsidy = big.NewInt(100)
+	secondary := justitia.NewMechanism(secondaryCfg)
+	pair := justitia.PairKey{From: 0, To: 1}
+	secondary.CalculateRABForPair(pair, nil, big.NewInt(1000), nil)
+	s.SetSecondaryMechanism(secondary)
+
+	s.SelectForBlock(10, []*core.Transaction{newCTX("paying", 0, 1, 500), newCTX("cheap", 0, 1, 50)})
+
+	want := map[string][2]int64{
+		"paying": {100, 550},
+		"cheap":  {100, 0}, // Below the secondary's floor only
+	}
+	records := s.SecondaryRecords()
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d secondary records, got %d", len(want), len(records))
+	}
+	for _, rec := range records {
+		w := want[string(rec.TxHash)]
+		if rec.PrimaryR.Int64() != w[0] || rec.SecondaryR.Int64() != w[1] {
+			t.Errorf("%s: primary R=%s secondary R=%s, want %d/%d", rec.TxHash, rec.PrimaryR, rec.SecondaryR, w[0], w[1])
+		}
+	}
+	if got := secondary.GetSmoothedEB(pair); got.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Secondary smoothed EB = %s, want 1000 (peeking must not update it)", got)
+	}
+}
+
+// TestScheduler_GasWeightedExpectation tests that the subsidy follows the selected E(f_s) weighting
+func TestScheduler_GasWeightedExpectation(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.OnBlockFinalizedWithGas(0, []*big.Int{big.NewInt(1000)}, []uint64{21000})
+	// Destination shard: count-weighted E(f_1) = 550, gas-weighted E(f_1) = 918
+	tracker.OnBlockFinalizedWithGas(1, []*big.Int{big.NewInt(100), big.NewInt(1000)}, []uint64{1000, 10000})
+
+	for _, tc := range []struct {
+		gasWeighted bool
+		wantR       int64
+	}{
+		{false, 550},
+		{true, 918},
+	} {
+		s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+		s.UseGasWeightedExpectation = tc.gasWeighted
+		tx := newCTX("ctx", 0, 1, 100)
+		s.SelectForBlock(1, []*core.Transaction{tx})
+		// DestAvg: R = EB
+		if tx.SubsidyR.Cmp(big.NewInt(tc.wantR)) != 0 {
+			t.Errorf("gasWeighted=%v: R = %s, want %d", tc.gasWeighted, tx.SubsidyR, tc.wantR)
+		}
+	}
+}
+
+// TestScheduler_BlockSubsidyCommitment tests that only fresh CTX subsidies are committed, not relay2
+func TestScheduler_BlockSubsidyCommitment(t *testing.T) {
+	s := NewScheduler(0, 2, expectation.NewTracker(16), justitia.SubsidyDestAvg)
+
+	fresh1 := newCTX("fresh1", 0, 1, 100)
+	fresh1.SubsidyR = big.NewInt(300)
+	fresh2 := newCTX("fresh2", 0, 1, 100)
+	fresh2.SubsidyR = big.NewInt(200)
+
+	relay2 := newCTX("relay2", 1, 0, 100) // Arrived from shard 1, subsidy already committed there
+	relay2.IsRelay2 = true
+	relay2.Relayed = true
+	relay2.SubsidyR = big.NewInt(5000)
+
+	itx := core.NewTransaction("a", "b", big.NewInt(0), 0, time.Now())
+	itx.FeeToProposer = big.NewInt(1000)
+
+	selected := []*core.Transaction{fresh1, relay2, itx, fresh2}
+	if got := s.BlockSubsidyCommitment(selected); got.Cmp(big.NewInt(500)) != 0 {
+		t.Errorf("BlockSubsidyCommitment = %s, want 500 (fresh CTX only)", got)
+	}
+	if got := s.BlockSubsidyCommitment(nil); got.Sign() != 0 {
+		t.Errorf("Empty block commitment = %s, want 0", got)
+	}
+}
+
+// TestScheduler_MislabeledCTX tests that a CTX with FromShard == ToShard is scored as an ITX without subsidy
+func TestScheduler_MislabeledCTX(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	tx := newCTX("mislabeled", 0, 0, 700)
+
+	score, txCase := s.scoreCTX(tx, big.NewInt(1000))
+	if txCase != 0 {
+		t.Errorf("Case = %s, want 0 (ITX)", txCase)
+	}
+	if score.Cmp(big.NewInt(700)) != 0 {
+		t.Errorf("Score = %s, want fee 700", score)
+	}
+	if tx.SubsidyR == nil || tx.SubsidyR.Sign() != 0 {
+		t.Errorf("SubsidyR = %v, want 0", tx.SubsidyR)
+	}
+	if !s.mislabelWarned {
+		t.Error("Expected mislabeled-CTX warning to be recorded")
+	}
+
+	// In selection it competes as an ITX: fee 700 < EA lands in phase 2 behind a Case1 CTX
+	case1 := newCTX("case1", 0, 1, 5000)
+	selected := s.SelectForBlock(1, []*core.Transaction{newCTX("mislabeled", 0, 0, 700), case1})
+	if len(selected) != 1 || string(selected[0].TxHash) != "case1" {
+		t.Errorf("Expected the Case1 CTX to be selected first, got %s", selected[0].TxHash)
+	}
+}
+
+// TestScheduler_GetDeferralBacklog tests that deferred Case2 CTX are listed oldest-first with their counts
+func TestScheduler_GetDeferralBacklog(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(200))
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyNone)
+
+	// High-fee ITX fill every block; CTX with fee 10 are Case2
+	filler := func(n int) []*core.Transaction {
+		txs := make([]*core.Transaction, 0, n)
+		for i := 0; i < n; i++ {
+			itx := core.NewTransaction("a", "b", big.NewInt(0), uint64(i), time.Now())
+			itx.TxHash = []byte(fmt.Sprintf("itx%d", i))
+			itx.FeeToProposer = big.NewInt(5000)
+			txs = append(txs, itx)
+		}
+		return txs
+	}
+
+	old := newCTX("old", 0, 1, 10)
+	mid := newCTX("mid", 0, 1, 10)
+	young := newCTX("young", 0, 1, 10)
+
+	s.SelectForBlock(2, append(filler(2), old))
+	time.Sleep(time.Millisecond)
+	s.SelectForBlock(2, append(filler(2), old, mid))
+	time.Sleep(time.Millisecond)
+	s.SelectForBlock(2, append(filler(2), old, mid, young))
+
+	backlog := s.GetDeferralBacklog()
+	want := []struct {
+		hash  string
+		count int
+	}{{"old", 3}, {"mid", 2}, {"young", 1}}
+	if len(backlog) != len(want) {
+		t.Fatalf("Backlog has %d entries, want %d", len(backlog), len(want))
+	}
+	for i, w := range want {
+		if string(backlog[i].TxHash) != w.hash || backlog[i].DeferralCount != w.count {
+			t.Errorf("Backlog[%d] = %s (count %d), want %s (count %d)",
+				i, backlog[i].TxHash, backlog[i].DeferralCount, w.hash, w.count)
+		}
+	}
+	if !backlog[0].FirstDeferred.Before(backlog[2].FirstDeferred) {
+		t.Error("Oldest entry should have the earliest FirstDeferred time")
+	}
+
+	// Once there is room, included CTX leave the backlog
+	s.SelectForBlock(10, []*core.Transaction{old, mid, young})
+	if backlog := s.GetDeferralBacklog(); len(backlog) != 0 {
+		t.Errorf("Backlog after inclusion = %d entries, want 0", len(backlog))
+	}
+}
+
+// TestScheduler_DeadlineForcesCase2 tests that a Case2 CTX near its deadline is included ahead of its phase
+func TestScheduler_DeadlineForcesCase2(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(200))
+
+	pool := func(deadline time.Time) []*core.Transaction {
+		txs := make([]*core.Transaction, 0, 3)
+		for i := 0; i < 2; i++ {
+			itx := core.NewTransaction("a", "b", big.NewInt(0), uint64(i), time.Now())
+			itx.TxHash = []byte(fmt.Sprintf("itx%d", i))
+			itx.FeeToProposer = big.NewInt(5000)
+			txs = append(txs, itx)
+		}
+		ctx := newCTX("urgent", 0, 1, 10)
+		ctx.Deadline = deadline
+		return append(txs, ctx)
+	}
+
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyNone)
+	s.DeadlineImminent = 5 * time.Second
+
+	// Without a deadline the Case2 CTX stays behind the high-fee ITX
+	selected := s.SelectForBlock(2, pool(time.Time{}))
+	for _, tx := range selected {
+		if string(tx.TxHash) == "urgent" {
+			t.Fatal("Case2 CTX without a deadline should be deferred")
+		}
+	}
+	if backlog := s.GetDeferralBacklog(); len(backlog) != 1 {
+		t.Fatalf("Expected the CTX to be deferred as Case2, backlog = %v", backlog)
+	}
+
+	// A distant deadline changes nothing
+	selected = s.SelectForBlock(2, pool(time.Now().Add(time.Hour)))
+	for _, tx := range selected {
+		if string(tx.TxHash) == "urgent" {
+			t.Fatal("Case2 CTX with a distant deadline should be deferred")
+		}
+	}
+
+	// An imminent deadline force-includes it first
+	selected = s.SelectForBlock(2, pool(time.Now().Add(time.Second)))
+	if len(selected) != 2 || string(selected[0].TxHash) != "urgent" {
+		t.Errorf("Expected the near-deadline CTX first, got %d txs starting with %s", len(selected), selected[0].TxHash)
+	}
+
+	// Within the horizon only, it moves from Phase3 up to Phase2
+	s = NewScheduler(0, 2, tracker, justitia.SubsidyNone)
+	s.DeadlineHorizon = 5 * time.Second
+	_, trace := s.TraceSelection(2, pool(time.Now().Add(time.Second)))
+	for _, e := range trace.Entries {
+		if e.TxHash == hex.EncodeToString([]byte("urgent")) && e.Phase != 2 {
+			t.Errorf("Near-deadline Case2 CTX in phase %d, want 2", e.Phase)
+		}
+	}
+}
+
+// TestScheduler_SubsidySmoothing tests that a step in the raw subsidy reaches the committed subsidy gradually
+func TestScheduler_SubsidySmoothing(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(1000))
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.SubsidySmoothingAlpha = 0.5
+
+	committed := func(i int) int64 {
+		ctx := newCTX(fmt.Sprintf("ctx%d", i), 0, 1, 100)
+		s.SelectForBlock(10, []*core.Transaction{ctx})
+		return ctx.SubsidyR.Int64()
+	}
+
+	if r := committed(0); r != 1000 {
+		t.Fatalf("Initial committed R = %d, want 1000", r)
+	}
+
+	// Raw subsidy (DestAvg = EB) steps from 1000 to 2000
+	tracker.UpdateRemoteShardFee(1, big.NewInt(2000))
+	want := []int64{1500, 1750, 1875, 1937}
+	for i, w := range want {
+		if r := committed(i + 1); r != w {
+			t.Errorf("Block %d: committed R = %d, want %d", i+1, r, w)
+		}
+	}
+
+	// Utilities are split from the committed value
+	ctx := newCTX("split", 0, 1, 100)
+	s.SelectForBlock(10, []*core.Transaction{ctx})
+	total := new(big.Int).Add(ctx.UtilityA, ctx.UtilityB)
+	if want := new(big.Int).Add(ctx.FeeToProposer, ctx.SubsidyR); total.Cmp(want) != 0 {
+		t.Errorf("uA + uB = %s, want fee + committed R = %s", total, want)
+	}
+}
+
+// TestScheduler_ResetPair tests that resetting one shard pair leaves another pair's state intact
+func TestScheduler_ResetPair(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(200))
+	tracker.UpdateRemoteShardFee(2, big.NewInt(200))
+	s := NewScheduler(0, 3, tracker, justitia.SubsidyDestAvg)
+	s.SubsidySmoothingAlpha = 0.5
+	s.FairnessThreshold = 100 // accrue credits without forcing inclusion
+
+	pool := func() []*core.Transaction {
+		txs := make([]*core.Transaction, 0, 4)
+		for i := 0; i < 2; i++ {
+			itx := core.NewTransaction("a", "b", big.NewInt(0), uint64(i), time.Now())
+			itx.TxHash = []byte(fmt.Sprintf("itx%d", i))
+			itx.FeeToProposer = big.NewInt(5000)
+			txs = append(txs, itx)
+		}
+		return append(txs, newCTX("to1", 0, 1, 10), newCTX("to2", 0, 2, 10))
+	}
+
+	// Both Case2 CTX are deferred twice and their pairs' subsidies are committed
+	s.SelectForBlock(2, pool())
+	s.SelectForBlock(2, pool())
+	if backlog := s.GetDeferralBacklog(); len(backlog) != 2 {
+		t.Fatalf("Expected both CTX deferred, backlog = %v", backlog)
+	}
+
+	s.ResetPair(0, 1)
+
+	backlog := s.GetDeferralBacklog()
+	if len(backlog) != 1 || string(backlog[0].TxHash) != "to2" || backlog[0].DeferralCount != 2 {
+		t.Errorf("Backlog after reset = %+v, want only to2 with count 2", backlog)
+	}
+	if _, ok := s.FairnessCredits["to1"]; ok {
+		t.Error("Fairness credits for the reset pair should be cleared")
+	}
+	if s.FairnessCredits["to2"] != 2 {
+		t.Errorf("Credits for the other pair = %d, want 2", s.FairnessCredits["to2"])
+	}
+
+	// Raw subsidy steps 200 -> 400: the reset pair commits it directly, the other is still smoothed
+	tracker.UpdateRemoteShardFee(1, big.NewInt(400))
+	tracker.UpdateRemoteShardFee(2, big.NewInt(400))
+	txs := pool()
+	s.SelectForBlock(2, txs)
+	if r := txs[2].SubsidyR.Int64(); r != 400 {
+		t.Errorf("Reset pair committed R = %d, want unsmoothed 400", r)
+	}
+	if r := txs[3].SubsidyR.Int64(); r != 300 {
+		t.Errorf("Other pair committed R = %d, want smoothed 300", r)
+	}
+
+	// The subsidy totals and the mechanism's per-pair smoothed EB are cleared for the reset pair only
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyEWMADestAvg
+	s.SubsidyMode = cfg.Mode
+	s.Mechanism = justitia.NewMechanism(cfg)
+	s.SelectForBlock(4, pool())
+	s.ResetPair(0, 1)
+	byPair := s.GetSubsidyByPair()
+	if _, ok := byPair[[2]int{0, 1}]; ok {
+		t.Error("Subsidy total for the reset pair should be cleared")
+	}
+	if byPair[[2]int{0, 2}] == nil {
+		t.Error("Subsidy total for the other pair should be kept")
+	}
+	if eb := s.Mechanism.GetSmoothedEB(justitia.PairKey{From: 0, To: 1}); eb != nil {
+		t.Errorf("Smoothed EB of the reset pair = %v, want cleared", eb)
+	}
+	if eb := s.Mechanism.GetSmoothedEB(justitia.PairKey{From: 0, To: 2}); eb == nil {
+		t.Error("Smoothed EB of the other pair should be kept")
+	}
+}
+
+// TestScheduler_ForceCrossShard tests that a same-shard tx with the override is scored via the CTX path
+func TestScheduler_ForceCrossShard(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+
+	sameShard := func(hash string) *core.Transaction {
+		tx := core.NewTransaction("a", "b", big.NewInt(0), 0, time.Now())
+		tx.TxHash = []byte(hash)
+		tx.FromShard, tx.ToShard = 0, 0
+		tx.FeeToProposer = big.NewInt(1500)
+		return tx
+	}
+
+	plain := sameShard("plain")
+	forced := sameShard("forced")
+	yes := true
+	forced.ForceCrossShard = &yes
+
+	s.SelectForBlock(10, []*core.Transaction{plain, forced})
+
+	if plain.JustitiaCase != 0 || plain.SubsidyR.Sign() != 0 {
+		t.Errorf("Plain same-shard tx should be scored as ITX, got case %d R=%v", plain.JustitiaCase, plain.SubsidyR)
+	}
+	if forced.JustitiaCase == 0 {
+		t.Error("Forced tx should be classified via the CTX path")
+	}
+	if forced.SubsidyR == nil || forced.SubsidyR.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Forced tx SubsidyR = %v, want DestAvg subsidy 1000", forced.SubsidyR)
+	}
+	if forced.UtilityA == nil || forced.UtilityB == nil {
+		t.Error("Forced tx should have Shapley utilities")
+	}
+
+	// An explicit false keeps a labelled CTX on the ITX path
+	no := false
+	ctx := newCTX("unforced", 0, 1, 100)
+	ctx.ForceCrossShard = &no
+	s.SelectForBlock(10, []*core.Transaction{ctx})
+	if ctx.JustitiaCase != 0 || ctx.SubsidyR.Sign() != 0 {
+		t.Errorf("ForceCrossShard=false should skip CTX scoring, got case %d", ctx.JustitiaCase)
+	}
+}
+
+// TestScheduler_Phase1Policy tests that normalizing CTX utility reorders a subsidized CTX and a high-fee ITX
+func TestScheduler_Phase1Policy(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(1000))
+
+	// DestAvg: R = EB = 1000, so the CTX has uA = (1500+1000+1000-1000)/2 = 1250 (Case1),
+	// of which R/2 = 500 is subsidy; the ITX pays 1200
+	firstPick := func(policy Phase1Policy, weight float64) string {
+		s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+		s.Phase1Policy = policy
+		s.CTXUtilityWeight = weight
+		itx := newCTX("itx", 0, 0, 1200)
+		itx.IsCrossShard = false
+		selected := s.SelectForBlock(1, []*core.Transaction{newCTX("ctx", 0, 1, 1500), itx})
+		if len(selected) != 1 {
+			t.Fatalf("selected %d txs, want 1", len(selected))
+		}
+		return string(selected[0].TxHash)
+	}
+
+	if got := firstPick(Phase1ByScore, 0); got != "ctx" {
+		t.Errorf("Phase1ByScore picked %s, want ctx (1250 > 1200)", got)
+	}
+	if got := firstPick(Phase1ByUserFee, 0); got != "itx" {
+		t.Errorf("Phase1ByUserFee picked %s, want itx (750 < 1200)", got)
+	}
+	if got := firstPick(Phase1ByWeighted, 0.9); got != "itx" {
+		t.Errorf("Phase1ByWeighted(0.9) picked %s, want itx (1125 < 1200)", got)
+	}
+	if got := firstPick(Phase1ByWeighted, 1.5); got != "ctx" {
+		t.Errorf("Phase1ByWeighted(1.5) picked %s, want ctx", got)
+	}
+}
+
+// benchmarkPool builds n txs for shard 0 of a 4-shard system: one third ITX, the rest CTX
+// in both directions, with fees spread around the per-shard expectations
+func benchmarkPool(n int) []*core.Transaction {
+	pool := make([]*core.Transaction, 0, n)
+	for i := 0; i < n; i++ {
+		fee := int64(200 + (i*7919)%2000)
+		other := 1 + i%3
+		switch i % 3 {
+		case 0:
+			itx := newCTX(fmt.Sprintf("itx-%d", i), 0, 0, fee)
+			itx.IsCrossShard = false
+			pool = append(pool, itx)
+		case 1:
+			pool = append(pool, newCTX(fmt.Sprintf("out-%d", i), 0, other, fee))
+		default:
+			pool = append(pool, newCTX(fmt.Sprintf("in-%d", i), other, 0, fee))
+		}
+	}
+	return pool
+}
+
+func benchmarkSelectForBlock(b *testing.B, mode justitia.SubsidyMode) {
+	tracker := expectation.NewTracker(16)
+	for shard, avg := range []int64{1000, 600, 1400, 900} {
+		tracker.UpdateRemoteShardFee(shard, big.NewInt(avg))
+	}
+	s := NewScheduler(0, 4, tracker, mode)
+	pool := benchmarkPool(3000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.SelectForBlock(500, pool)
+		// Close a Lagrangian epoch every 10 blocks so the budget update is on the path
+		if i%10 == 9 {
+			s.UpdateEpoch()
+		}
+	}
+}
+
+// BenchmarkSelectForBlock measures full selection (scoring, three phases, budget) over a mixed pool
+func BenchmarkSelectForBlock(b *testing.B) {
+	b.Run("DestAvg", func(b *testing.B) { benchmarkSelectForBlock(b, justitia.SubsidyDestAvg) })
+	b.Run("Lagrangian", func(b *testing.B) { benchmarkSelectForBlock(b, justitia.SubsidyLagrangian) })
+}
+
+// TestScheduler_SelectForBlockAllocs guards against allocation regressions on the full selection path
+func TestScheduler_SelectForBlockAllocs(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	for shard, avg := range []int64{1000, 600, 1400, 900} {
+		tracker.UpdateRemoteShardFee(shard, big.NewInt(avg))
+	}
+	s := NewScheduler(0, 4, tracker, justitia.SubsidyDestAvg)
+	pool := benchmarkPool(300)
+
+	// About 16 allocations per tx today; fail well before a quadratic or per-tx blowup goes unnoticed
+	const maxAllocsPerTx = 32
+	allocs := testing.AllocsPerRun(5, func() { s.SelectForBlock(50, pool) })
+	if perTx := allocs / float64(len(pool)); perTx > maxAllocsPerTx {
+		t.Errorf("SelectForBlock allocates %.1f times per tx, want <= %d", perTx, maxAllocsPerTx)
+	}
+}
+
+// TestScheduler_FeeReferenceMode tests that the subsidy follows the configured fee reference
+func TestScheduler_FeeReferenceMode(t *testing.T) {
+	tracker := expectation.NewTracker(10)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	for _, fee := range []int64{100, 100, 100, 100, 100, 100, 200, 300, 1000, 5000} {
+		tracker.OnBlockFinalized(1, []*big.Int{big.NewInt(fee)})
+	}
+
+	// DestAvg pays R = EB, so R is shard 1's reference fee
+	tests := []struct {
+		mode  expectation.ReferenceMode
+		wantR int64
+	}{
+		{expectation.ReferenceMean, 710},
+		{expectation.ReferenceMedian, 100},
+		{expectation.ReferenceP75, 300},
+		{expectation.ReferenceP90, 1000},
+	}
+	for _, tt := range tests {
+		s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+		s.FeeReferenceMode = tt.mode
+		ctx := newCTX("ctx", 0, 1, 500)
+		s.SelectForBlock(10, []*core.Transaction{ctx})
+		if ctx.SubsidyR == nil || ctx.SubsidyR.Int64() != tt.wantR {
+			t.Errorf("mode %d: SubsidyR = %v, want %d", tt.mode, ctx.SubsidyR, tt.wantR)
+		}
+	}
+}
+
+// TestScheduler_BlockBudget tests that GammaMax caps the block's total subsidy and utilities are recomputed
+func TestScheduler_BlockBudget(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(1000))
+
+	cfg := justitia.DefaultConfig()
+	cfg.GammaMax = big.NewInt(1500)
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.Budget, _ = blockBudget(cfg)
+
+	// DestAvg gives each CTX R = 1000; the block total 2000 is scaled to 1500
+	a, b := newCTX("a", 0, 1, 2000), newCTX("b", 0, 1, 3000)
+	selected := s.SelectForBlock(10, []*core.Transaction{a, b})
+	if got := s.BlockSubsidyCommitment(selected); got.Cmp(big.NewInt(1500)) != 0 {
+		t.Errorf("block subsidy = %v, want 1500", got)
+	}
+	for _, tx := range []*core.Transaction{a, b} {
+		if tx.SubsidyR.Int64() != 750 {
+			t.Errorf("%s: SubsidyR = %v, want 750", tx.TxHash, tx.SubsidyR)
+		}
+		sum := new(big.Int).Add(tx.UtilityA, tx.UtilityB)
+		if want := new(big.Int).Add(tx.FeeToProposer, tx.SubsidyR); sum.Cmp(want) != 0 {
+			t.Errorf("%s: uA+uB = %v, want fee+R = %v", tx.TxHash, sum, want)
+		}
+	}
+
+	// Within budget, and with no CTX selected, the pass is a no-op
+	c := newCTX("c", 0, 1, 2000)
+	s.SelectForBlock(10, []*core.Transaction{c})
+	if c.SubsidyR.Int64() != 1000 {
+		t.Errorf("single CTX within budget: SubsidyR = %v, want 1000", c.SubsidyR)
+	}
+	itx := newCTX("itx", 0, 0, 500)
+	itx.IsCrossShard = false
+	if got := s.SelectForBlock(10, []*core.Transaction{itx}); len(got) != 1 {
+		t.Errorf("ITX-only block selected %d txs, want 1", len(got))
+	}
+
+	if budget, _ := blockBudget(justitia.DefaultConfig()); budget != nil {
+		t.Error("GammaMax = 0 should mean no budget")
+	}
+}
+
+// TestScheduler_BlockBudgetAccounting tests that when Bmax binds, the epoch spend, the per-pair
+// totals and the smoothing baseline record the scaled subsidy actually committed
+func TestScheduler_BlockBudgetAccounting(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyLagrangian
+	cfg.GammaMax = big.NewInt(1000)
+	s := newLagrangianScheduler(cfg)
+	s.Budget, _ = blockBudget(cfg)
+	s.SubsidySmoothingAlpha = 0.5
+	s.QueueLenProvider = func(int) int64 { return 2000 } // Congested: Lagrangian R = 4 * EB
+	s.FeeTracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	s.FeeTracker.UpdateRemoteShardFee(1, big.NewInt(1000))
+
+	// Left out of the block by capacity: never accounted
+	pool := []*core.Transaction{newCTX("a", 0, 1, 3000), newCTX("b", 0, 1, 2000), newCTX("c", 0, 1, 1)}
+	selected := s.SelectForBlock(2, pool)
+	if len(selected) != 2 {
+		t.Fatalf("Selected %d txs, want 2", len(selected))
+	}
+
+	final := big.NewInt(0)
+	for _, tx := range selected {
+		final.Add(final, tx.SubsidyR)
+	}
+	if final.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("Block subsidy = %s, want Bmax 1000", final)
+	}
+	if total, count, _ := s.GetEpochStats(); total.Cmp(final) != 0 || count != 2 {
+		t.Errorf("Epoch stats = (%s, %d), want (%s, 2)", total, count, final)
+	}
+	if got := s.GetSubsidyByPair()[[2]int{0, 1}]; got == nil || got.Cmp(final) != 0 {
+		t.Errorf("Pair total = %v, want %s", got, final)
+	}
+	if got := s.smoothedCur[[2]int{0, 1}]; got == nil || got.Cmp(selected[0].SubsidyR) != 0 {
+		t.Errorf("Smoothing baseline = %v, want scaled R %s", got, selected[0].SubsidyR)
+	}
+}
+
+// TestScheduler_SelectForBlockBytes tests that byte-size selection skips txs that do not fit,
+// keeps trying smaller ones in the same phase and never admits a tx larger than the block
+func TestScheduler_SelectForBlockBytes(t *testing.T) {
+	s := NewScheduler(0, 2, expectation.NewTracker(16), justitia.SubsidyDestAvg)
+
+	newITX := func(hash string, fee int64, pad int) *core.Transaction {
+		tx := newCTX(hash, 0, 0, fee)
+		tx.IsCrossShard = false
+		tx.Sender = tx.Sender + strings.Repeat("x", pad)
+		return tx
+	}
+	huge := newITX("huge", 100, 8192)
+	a := newITX("a", 90, 0)
+	b := newITX("b", 80, 400)
+	c := newITX("c", 70, 0)
+	sizeA, sizeB, sizeC := len(a.Encode()), len(b.Encode()), len(c.Encode())
+
+	// Room for a and c but not a and b
+	maxBytes := sizeA + sizeC + (sizeB-sizeC)/2
+	if len(huge.Encode()) <= maxBytes {
+		t.Fatal("test setup: huge tx must exceed maxBytes on its own")
+	}
+	selected := s.SelectForBlockBytes(maxBytes, []*core.Transaction{huge, a, b, c})
+	if len(selected) != 2 || selected[0] != a || selected[1] != c {
+		t.Fatalf("selected %d txs, want [a c]", len(selected))
+	}
+	used := 0
+	for _, tx := range selected {
+		used += len(tx.Encode())
+	}
+	if used > maxBytes {
+		t.Errorf("selected %d bytes, want <= %d", used, maxBytes)
+	}
+
+	// A pool holding only an oversized tx yields an empty block
+	if got := s.SelectForBlockBytes(maxBytes, []*core.Transaction{huge}); len(got) != 0 {
+		t.Errorf("oversized-only pool selected %d txs, want 0", len(got))
+	}
+	if got := s.SelectForBlockBytes(0, []*core.Transaction{a}); got != nil {
+		t.Errorf("maxBytes = 0 selected %d txs, want none", len(got))
+	}
+}
+
+// TestScheduler_MaxDeferAge tests that a Case2 CTX older than maxDeferAge is promoted ahead of a full Phase1
+func TestScheduler_MaxDeferAge(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(200))
+
+	ctx := newCTX("waiting", 0, 1, 10)
+	pool := func() []*core.Transaction {
+		txs := make([]*core.Transaction, 0, 3)
+		for i := 0; i < 2; i++ {
+			itx := core.NewTransaction("a", "b", big.NewInt(0), uint64(i), time.Now())
+			itx.TxHash = []byte(fmt.Sprintf("itx%d", i))
+			itx.FeeToProposer = big.NewInt(5000)
+			txs = append(txs, itx)
+		}
+		return append(txs, ctx)
+	}
+	contains := func(txs []*core.Transaction, hash string) bool {
+		for _, tx := range txs {
+			if string(tx.TxHash) == hash {
+				return true
+			}
+		}
+		return false
+	}
+
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyNone)
+	s.SetMaxDeferAge(time.Minute)
+
+	// Young Case2 CTX stays behind the high-fee ITX filling Phase1
+	ctx.ArrivalTime = time.Now().Add(-time.Second)
+	if contains(s.SelectForBlock(2, pool()), "waiting") {
+		t.Fatal("Case2 CTX below the age threshold should be deferred")
+	}
+	if backlog := s.GetDeferralBacklog(); len(backlog) != 1 {
+		t.Fatalf("Expected the CTX to be deferred as Case2, backlog = %v", backlog)
+	}
+
+	// Past the threshold it is promoted ahead of Phase1
+	ctx.ArrivalTime = time.Now().Add(-2 * time.Minute)
+	selected := s.SelectForBlock(2, pool())
+	if len(selected) != 2 || string(selected[0].TxHash) != "waiting" {
+		t.Errorf("Expected the aged CTX first, got %d txs starting with %s", len(selected), selected[0].TxHash)
+	}
+
+	// Aging disabled: the old CTX is deferred again
+	s.SetMaxDeferAge(0)
+	if contains(s.SelectForBlock(2, pool()), "waiting") {
+		t.Error("Case2 CTX should be deferred with aging disabled")
+	}
+}
+
+// TestScheduler_QueueLenProvider tests that the subsidy follows the destination queue length reported by the provider
+func TestScheduler_QueueLenProvider(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyLagrangian
+	s := newLagrangianScheduler(cfg)
+	s.FeeTracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	s.FeeTracker.UpdateRemoteShardFee(1, big.NewInt(1000))
+
+	queues := map[int]int64{0: 10}
+	s.QueueLenProvider = func(shardID int) int64 { return queues[shardID] }
+
+	subsidyAt := func(queueB int64) *big.Int {
+		queues[1] = queueB
+		ctx := newCTX(fmt.Sprintf("ctx-%d", queueB), 0, 1, 500)
+		s.SelectForBlock(10, []*core.Transaction{ctx})
+		return ctx.SubsidyR
+	}
+	low, high := subsidyAt(100), subsidyAt(900)
+	if high.Cmp(low) <= 0 {
+		t.Errorf("R with congested destination = %v, want > R with idle destination = %v", high, low)
+	}
+
+	// Both shards are queried; an unknown destination queue falls back to DefaultQueueLengthB
+	if m := s.dynamicMetrics(1); m.QueueLengthA != 10 || m.QueueLengthB != 900 {
+		t.Errorf("metrics = (%d, %d), want (10, 900)", m.QueueLengthA, m.QueueLengthB)
+	}
+	queues[1] = -1
+	if m := s.dynamicMetrics(1); m.QueueLengthB != DefaultQueueLengthB {
+		t.Errorf("unknown QueueLengthB = %d, want %d", m.QueueLengthB, DefaultQueueLengthB)
+	}
+	s.QueueLenProvider = nil
+	if m := s.dynamicMetrics(1); m.QueueLengthB != DefaultQueueLengthB || !s.queueWarned {
+		t.Errorf("without provider QueueLengthB = %d (warned=%v), want %d", m.QueueLengthB, s.queueWarned, DefaultQueueLengthB)
+	}
+}
+
+// TestScheduler_TrackerQueueLenProvider tests that a remote queue length received via fee sync changes R
+func TestScheduler_TrackerQueueLenProvider(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyLagrangian
+	s := newLagrangianScheduler(cfg)
+	s.FeeTracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	s.FeeTracker.UpdateRemoteShardFee(1, big.NewInt(1000))
+	s.QueueLenProvider = TrackerQueueLenProvider(0, func() int64 { return 10 }, s.FeeTracker)
+
+	// No report from shard 1 yet: the default queue length is assumed
+	if m := s.dynamicMetrics(1); m.QueueLengthA != 10 || m.QueueLengthB != DefaultQueueLengthB {
+		t.Errorf("metrics before any report = (%d, %d), want (10, %d)", m.QueueLengthA, m.QueueLengthB, DefaultQueueLengthB)
+	}
+
+	subsidyAt := func(queueB int64) *big.Int {
+		s.FeeTracker.UpdateRemoteQueueLength(1, queueB)
+		ctx := newCTX(fmt.Sprintf("ctx-%d", queueB), 0, 1, 500)
+		s.SelectForBlock(10, []*core.Transaction{ctx})
+		return ctx.SubsidyR
+	}
+	low, high := subsidyAt(100), subsidyAt(900)
+	if high.Cmp(low) <= 0 {
+		t.Errorf("R after remote queue grew = %v, want > R with idle remote queue = %v", high, low)
+	}
+}
+
+// TestScheduler_SubsidyByPair tests that the subsidy assigned to CTX is accumulated per shard pair
+func TestScheduler_SubsidyByPair(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	for shard, avg := range []int64{1000, 600, 1400} {
+		tracker.UpdateRemoteShardFee(shard, big.NewInt(avg))
+	}
+	s := NewScheduler(0, 3, tracker, justitia.SubsidyDestAvg)
+
+	// DestAvg: R = E(f_ToShard)
+	s.SelectForBlock(10, []*core.Transaction{
+		newCTX("a", 0, 1, 100), newCTX("b", 0, 1, 100), newCTX("c", 0, 2, 100), newCTX("d", 1, 0, 100),
+	})
+	want := map[[2]int]int64{{0, 1}: 1200, {0, 2}: 1400, {1, 0}: 1000}
+	got := s.GetSubsidyByPair()
+	if len(got) != len(want) {
+		t.Fatalf("GetSubsidyByPair has %d pairs, want %d: %v", len(got), len(want), got)
+	}
+	for pair, total := range want {
+		if got[pair] == nil || got[pair].Int64() != total {
+			t.Errorf("pair %v: total = %v, want %d", pair, got[pair], total)
+		}
+	}
+
+	// The snapshot is a deep copy
+	got[[2]int{0, 1}].SetInt64(0)
+	if s.GetSubsidyByPair()[[2]int{0, 1}].Int64() != 1200 {
+		t.Error("modifying the snapshot changed the scheduler's totals")
+	}
+
+	// An epoch update clears the totals in every mode
+	s.UpdateEpoch()
+	if len(s.GetSubsidyByPair()) != 0 {
+		t.Errorf("DestAvg totals after UpdateEpoch = %v, want empty", s.GetSubsidyByPair())
+	}
+	cfg := justitia.DefaultConfig()
+	cfg.Mode = justitia.SubsidyLagrangian
+	lag := newLagrangianScheduler(cfg)
+	lag.FeeTracker = tracker
+	lag.SelectForBlock(10, []*core.Transaction{newCTX("e", 0, 1, 100)})
+	if len(lag.GetSubsidyByPair()) != 1 {
+		t.Fatalf("Lagrangian totals = %v, want one pair", lag.GetSubsidyByPair())
+	}
+	lag.UpdateEpoch()
+	if len(lag.GetSubsidyByPair()) != 0 {
+		t.Errorf("totals after UpdateEpoch = %v, want empty", lag.GetSubsidyByPair())
+	}
+}
+
+// TestScheduler_MinCTXFraction tests that reserved CTX slots survive a flood of high-fee ITX
+func TestScheduler_MinCTXFraction(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(300))
+
+	pool := make([]*core.Transaction, 0, 110)
+	for i := 0; i < 100; i++ {
+		itx := newCTX(fmt.Sprintf("itx%03d", i), 0, 0, 100000)
+		itx.IsCrossShard = false
+		pool = append(pool, itx)
+	}
+	for i := 0; i < 10; i++ {
+		pool = append(pool, newCTX(fmt.Sprintf("ctx%d", i), 0, 1, int64(2000+100*i)))
+	}
+	countCTX := func(txs []*core.Transaction) int {
+		n := 0
+		for _, tx := range txs {
+			if tx.IsCrossShard {
+				n++
+			}
+		}
+		return n
+	}
+
+	const capacity = 20
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	if got := countCTX(s.SelectForBlock(capacity, pool)); got != 0 {
+		t.Fatalf("Without a quota the ITX flood should crowd out every CTX, got %d", got)
+	}
+
+	s = NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.SetMinCTXFraction(0.25)
+	selected := s.SelectForBlock(capacity, pool)
+	if len(selected) != capacity {
+		t.Fatalf("Selected %d txs, want %d", len(selected), capacity)
+	}
+	if got := countCTX(selected); got != 5 {
+		t.Errorf("Selected %d CTX, want the 5 reserved slots", got)
+	}
+	// The best-scoring CTX take the reserved slots
+	for _, tx := range selected {
+		if tx.IsCrossShard && tx.FeeToProposer.Int64() < 2500 {
+			t.Errorf("Reserved slot went to %s (fee %s) instead of a higher-fee CTX", tx.TxHash, tx.FeeToProposer)
+		}
+	}
+
+	// With fewer CTX than the quota, the remainder goes to ITX
+	s = NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.SetMinCTXFraction(1)
+	selected = s.SelectForBlock(capacity, pool)
+	if got := countCTX(selected); got != 10 || len(selected) != capacity {
+		t.Errorf("Selected %d CTX of %d txs, want all 10 CTX in a full block", got, len(selected))
+	}
+}
+
+// recordingLogger collects formatted debug lines and warnings
+type recordingLogger struct {
+	lines    []string
+	warnings []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+// captureStdout returns everything f writes to os.Stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+// TestScheduler_Logger tests that selection prints nothing by default and that SetLogger re-enables the debug output
+func TestScheduler_Logger(t *testing.T) {
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(400))
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.QueueLenProvider = func(int) int64 { return 10 }
+
+	pool := func() []*core.Transaction {
+		itx := newCTX("itx", 0, 0, 500)
+		itx.IsCrossShard = false
+		return []*core.Transaction{itx, newCTX("ctx1", 0, 1, 2000), newCTX("ctx2", 0, 1, 50)}
+	}
+
+	if out := captureStdout(t, func() { s.SelectForBlock(2, pool()) }); out != "" {
+		t.Errorf("Expected no stdout output by default, got:\n%s", out)
+	}
+
+	logger := &recordingLogger{}
+	s.SetLogger(logger)
+	if out := captureStdout(t, func() { s.SelectForBlock(2, pool()) }); out != "" {
+		t.Errorf("Expected debug output to go to the logger, got stdout:\n%s", out)
+	}
+	all := strings.Join(logger.lines, "")
+	for _, want := range []string{"[SELECT] Shard 0: Starting selection with EA=1000", "[SELECT] Shard 0: CTX distribution",
+		"[DEBUG] CTX Score (Source S0->S1): Fee=2000, EA=1000, EB=400, R=400"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Debug output missing %q, got:\n%s", want, all)
+		}
+	}
+
+	// A nil logger discards the output again
+	s.SetLogger(nil)
+	logger.lines = nil
+	s.SelectForBlock(2, pool())
+	if len(logger.lines) != 0 {
+		t.Errorf("Expected no debug lines after SetLogger(nil), got %d", len(logger.lines))
+	}
+}
+
+// TestScheduler_LoggerWarnings tests that one-time warnings go to the logger, once, and never to stdout
+func TestScheduler_LoggerWarnings(t *testing.T) {
+	cfg := justitia.DefaultConfig()
+	cfg.GammaMin = big.NewInt(2000)
+	cfg.GammaMax = big.NewInt(1000)
+	tracker := expectation.NewTracker(16)
+	tracker.UpdateRemoteShardFee(0, big.NewInt(1000))
+	tracker.UpdateRemoteShardFee(1, big.NewInt(400))
+	s := NewScheduler(0, 2, tracker, justitia.SubsidyDestAvg)
+	s.Budget, s.budgetErr = blockBudget(cfg)
+
+	pool := func() []*core.Transaction {
+		return []*core.Transaction{newCTX("mislabeled", 0, 0, 500), newCTX("ctx", 0, 1, 2000)}
+	}
+	if out := captureStdout(t, func() { s.SelectForBlock(2, pool()) }); out != "" {
+		t.Errorf("Expected no stdout output by default, got:\n%s", out)
+	}
+
+	s.budgetWarned, s.mislabelWarned, s.queueWarned = false, false, false
+	logger := &recordingLogger{}
+	s.SetLogger(StdoutWarnLogger{})
+	if !strings.Contains(captureStdout(t, func() { s.SelectForBlock(2, pool()) }), "ignoring subsidy budget") {
+		t.Error("Expected StdoutWarnLogger to print the budget warning")
+	}
+
+	s.budgetWarned, s.mislabelWarned, s.queueWarned = false, false, false
+	s.SetLogger(logger)
+	if out := captureStdout(t, func() {
+		s.SelectForBlock(2, pool())
+		s.SelectForBlock(2, pool())
+	}); out != "" {
+		t.Errorf("Expected warnings to go to the logger, got stdout:\n%s", out)
+	}
+	all := strings.Join(logger.warnings, "")
+	for _, want := range []string{"ignoring subsidy budget", "FromShard == ToShard == 0", "no QueueLenProvider set"} {
+		if strings.Count(all, want) != 1 {
+			t.Errorf("Expected warning %q exactly once, got:\n%s", want, all)
+		}
+	}
+	if len(logger.warnings) != 3 {
+		t.Errorf("Expected 3 warnings, got %d", len(logger.warnings))
+	}
+}
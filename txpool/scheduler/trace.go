@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"blockEmulator/core"
+	"encoding/hex"
+	"math/big"
+)
+
+// TraceEntry records the scoring outcome of one transaction in a selection trace
+// Amounts are decimal strings so the trace round-trips through JSON without precision loss
+type TraceEntry struct {
+	TxHash       string `json:"txHash"`
+	IsCrossShard bool   `json:"isCrossShard"`
+	FromShard    int    `json:"fromShard"`
+	ToShard      int    `json:"toShard"`
+	Fee          string `json:"fee"`
+	SubsidyR     string `json:"subsidyR"`
+	UtilityA     string `json:"utilityA"`
+	UtilityB     string `json:"utilityB"`
+	Score        string `json:"score"`
+	Case         int    `json:"case"`  // 0 for ITX
+	Phase        int    `json:"phase"` // 1, 2 or 3
+	Selected     bool   `json:"selected"`
+}
+
+// SelectionTrace is a machine-readable record of one block's transaction selection
+type SelectionTrace struct {
+	ShardID      int          `json:"shardID"`
+	Capacity     int          `json:"capacity"`
+	PoolSize     int          `json:"poolSize"`
+	SubsidyMode  string       `json:"subsidyMode"`
+	EA           string       `json:"ea"`
+	GammaMin     uint64       `json:"gammaMin"` // Per-block subsidy budget bounds of the scheduler's Budget (0 = no limit)
+	GammaMax     uint64       `json:"gammaMax"`
+	TotalSubsidy string       `json:"totalSubsidy"` // Sum of R over selected CTX
+	Entries      []TraceEntry `json:"entries"`
+	Selected     []string     `json:"selected"` // Selected tx hashes in priority order
+}
+
+// TraceSelection runs the same selection as SelectForBlock and also returns a JSON-serializable
+// trace of the pool, computed scores/cases, the budget in effect and the final selected set
+func (s *Scheduler) TraceSelection(capacity int, txPool []*core.Transaction) (selected []*core.Transaction, trace SelectionTrace) {
+	trace = SelectionTrace{
+		ShardID:      s.ShardID,
+		Capacity:     capacity,
+		PoolSize:     len(txPool),
+		SubsidyMode:  s.SubsidyMode.String(),
+		EA:           "0",
+		TotalSubsidy: "0",
+		Entries:      make([]TraceEntry, 0, len(txPool)),
+		Selected:     make([]string, 0),
+	}
+	if s.Budget != nil {
+		trace.GammaMin, trace.GammaMax = s.Budget.Bmin, s.Budget.Bmax
+	}
+	selected = s.selectForBlock(capacity, txPool, &trace)
+	return selected, trace
+}
+
+// traceAmount renders an optional amount as a decimal string
+func traceAmount(v *big.Int) string {
+	if v == nil {
+		return "0"
+	}
+	return v.String()
+}
+
+// recordPhase appends entries for all scored transactions assigned to a phase, with the shard
+// pair each was scored for as reported by shardPair
+func (trace *SelectionTrace) recordPhase(phase int, txs []TxWithScore, shardPair func(*core.Transaction) (int, int)) {
+	for _, scored := range txs {
+		tx := scored.Tx
+		from, to := shardPair(tx)
+		trace.Entries = append(trace.Entries, TraceEntry{
+			TxHash:       hex.EncodeToString(tx.TxHash),
+			IsCrossShard: isCrossShard(tx),
+			FromShard:    from,
+			ToShard:      to,
+			Fee:          traceAmount(tx.FeeToProposer),
+			SubsidyR:     traceAmount(tx.SubsidyR),
+			UtilityA:     traceAmount(tx.UtilityA),
+			UtilityB:     traceAmount(tx.UtilityB),
+			Score:        traceAmount(scored.Score),
+			Case:         int(scored.Case),
+			Phase:        phase,
+		})
+	}
+}
+
+// recordSelected marks selected entries and totals the subsidy of selected CTX
+func (trace *SelectionTrace) recordSelected(selected []*core.Transaction) {
+	index := make(map[string]int, len(trace.Entries))
+	for i, entry := range trace.Entries {
+		index[entry.TxHash] = i
+	}
+
+	total := big.NewInt(0)
+	for _, tx := range selected {
+		hash := hex.EncodeToString(tx.TxHash)
+		trace.Selected = append(trace.Selected, hash)
+		if i, ok := index[hash]; ok {
+			trace.Entries[i].Selected = true
+			if trace.Entries[i].Case != 0 && tx.SubsidyR != nil {
+				total.Add(total, tx.SubsidyR)
+			}
+		}
+	}
+	trace.TotalSubsidy = total.String()
+}
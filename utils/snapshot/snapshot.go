@@ -0,0 +1,95 @@
+// Package snapshot defines the versioned envelope shared by the state snapshot formats
+// (justitia.Mechanism, pending.Ledger, expectation.Tracker)
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrVersionMismatch = errors.New("snapshot: unsupported version")
+	ErrKindMismatch    = errors.New("snapshot: wrong kind")
+)
+
+// Envelope wraps a serialized state with the format it was written in
+type Envelope struct {
+	Kind    string          `json:"kind"`
+	Version int             `json:"version"`
+	State   json.RawMessage `json:"state"`
+}
+
+// Migration upgrades a state payload by exactly one version (from -> from+1)
+type Migration func(state json.RawMessage) (json.RawMessage, error)
+
+type migrationKey struct {
+	kind string
+	from int
+}
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   = make(map[migrationKey]Migration)
+)
+
+// RegisterMigration installs the hook that upgrades kind's payload from version from to from+1.
+// Decode chains registered hooks to bring an older snapshot up to the current version.
+func RegisterMigration(kind string, from int, fn Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	if fn == nil {
+		delete(migrations, migrationKey{kind, from})
+		return
+	}
+	migrations[migrationKey{kind, from}] = fn
+}
+
+func lookupMigration(kind string, from int) Migration {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	return migrations[migrationKey{kind, from}]
+}
+
+// Encode serializes state inside an envelope tagged with kind and version
+func Encode(kind string, version int, state interface{}) ([]byte, error) {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: encode %s: %w", kind, err)
+	}
+	return json.Marshal(Envelope{Kind: kind, Version: version, State: raw})
+}
+
+// Decode unwraps an envelope written by Encode into state. The envelope must carry kind;
+// a version newer than current, or an older one without a complete migration chain,
+// is rejected with ErrVersionMismatch rather than decoded on a best-effort basis.
+func Decode(data []byte, kind string, current int, state interface{}) error {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("snapshot: decode %s: %w", kind, err)
+	}
+	if env.Kind != kind {
+		return fmt.Errorf("%w: got %q, want %q", ErrKindMismatch, env.Kind, kind)
+	}
+	if env.Version <= 0 || env.Version > current {
+		return fmt.Errorf("%w: %s version %d (supported up to %d)", ErrVersionMismatch, kind, env.Version, current)
+	}
+
+	raw := env.State
+	for v := env.Version; v < current; v++ {
+		migrate := lookupMigration(kind, v)
+		if migrate == nil {
+			return fmt.Errorf("%w: %s version %d has no migration to %d", ErrVersionMismatch, kind, v, v+1)
+		}
+		var err error
+		if raw, err = migrate(raw); err != nil {
+			return fmt.Errorf("snapshot: migrate %s from version %d: %w", kind, v, err)
+		}
+	}
+
+	if err := json.Unmarshal(raw, state); err != nil {
+		return fmt.Errorf("snapshot: decode %s state: %w", kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type testState struct {
+	Value int `json:"value"`
+}
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	data, err := Encode("test.roundtrip", 1, testState{Value: 7})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	var got testState
+	if err := Decode(data, "test.roundtrip", 1, &got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got.Value != 7 {
+		t.Errorf("Value = %d, want 7", got.Value)
+	}
+}
+
+func TestDecode_RejectsUnknownVersionAndKind(t *testing.T) {
+	data := []byte(`{"kind":"test.reject","version":9,"state":{"value":1}}`)
+	var got testState
+	if err := Decode(data, "test.reject", 1, &got); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("future version: err = %v, want ErrVersionMismatch", err)
+	}
+	if err := Decode(data, "test.other", 9, &got); !errors.Is(err, ErrKindMismatch) {
+		t.Errorf("wrong kind: err = %v, want ErrKindMismatch", err)
+	}
+	// An older version without a registered migration is rejected too
+	if err := Decode([]byte(`{"kind":"test.reject","version":1,"state":{}}`), "test.reject", 2, &got); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("missing migration: err = %v, want ErrVersionMismatch", err)
+	}
+}
+
+func TestDecode_AppliesMigrations(t *testing.T) {
+	// Version 1 stored the value under "v"; version 2 renamed it to "value"
+	RegisterMigration("test.migrate", 1, func(state json.RawMessage) (json.RawMessage, error) {
+		var old struct {
+			V int `json:"v"`
+		}
+		if err := json.Unmarshal(state, &old); err != nil {
+			return nil, err
+		}
+		return json.Marshal(testState{Value: old.V})
+	})
+	defer RegisterMigration("test.migrate", 1, nil)
+
+	var got testState
+	if err := Decode([]byte(`{"kind":"test.migrate","version":1,"state":{"v":42}}`), "test.migrate", 2, &got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got.Value != 42 {
+		t.Errorf("Value = %d, want 42", got.Value)
+	}
+}